@@ -0,0 +1,274 @@
+// Adaptive arithmetic coding of grey levels as a streaming encoder and decoder
+package pkg
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	arithmeticTop          uint64 = 1<<32 - 1
+	arithmeticHalf         uint64 = 1 << 31
+	arithmeticFirstQuarter uint64 = 1 << 30
+	arithmeticThirdQuarter uint64 = 3 << 30
+	// arithmeticMaximumTotal keeps the smallest interval above one count, the model
+	// halves its counts when the total reaches it
+	arithmeticMaximumTotal int = 1 << 16
+	arithmeticIncrement    int = 32
+)
+
+// arithmeticModel is the adaptive order-0 model shared by the encoder and decoder:
+// every symbol starts with a count of 1 and gains arithmeticIncrement each time it
+// is coded. The counts are kept in a Fenwick tree for fast cumulative sums.
+type arithmeticModel struct {
+	counts []int
+	tree   []int
+	total  int
+}
+
+func newArithmeticModel() *arithmeticModel {
+	var model *arithmeticModel = &arithmeticModel{counts: make([]int, endOfStreamSymbol+1)}
+	for symbol := range model.counts {
+		model.counts[symbol] = 1
+	}
+	model.rebuild()
+	return model
+}
+
+func (model *arithmeticModel) rebuild() {
+	model.tree = make([]int, len(model.counts)+1)
+	model.total = 0
+	for symbol, count := range model.counts {
+		model.add(symbol, count)
+	}
+}
+
+func (model *arithmeticModel) add(symbol int, count int) {
+	model.total += count
+	for index := symbol + 1; index < len(model.tree); index += index & -index {
+		model.tree[index] += count
+	}
+}
+
+func (model *arithmeticModel) cumulative(symbol int) int {
+	// The total count of the symbols before symbol
+	var sum int = 0
+	for index := symbol; index > 0; index -= index & -index {
+		sum += model.tree[index]
+	}
+	return sum
+}
+
+func (model *arithmeticModel) find(target int) int {
+	// The symbol whose cumulative range holds target
+	var symbol int = 0
+	var step int = 1
+	for step*2 < len(model.tree) {
+		step *= 2
+	}
+	for ; step > 0; step /= 2 {
+		if symbol+step < len(model.tree) && model.tree[symbol+step] <= target {
+			symbol += step
+			target -= model.tree[symbol]
+		}
+	}
+	return symbol
+}
+
+func (model *arithmeticModel) update(symbol int) {
+	model.counts[symbol] += arithmeticIncrement
+	model.add(symbol, arithmeticIncrement)
+	if model.total >= arithmeticMaximumTotal {
+		for index := range model.counts {
+			model.counts[index] = (model.counts[index] + 1) / 2
+		}
+		model.rebuild()
+	}
+}
+
+// ArithmeticWriter encodes the bytes written to it with an adaptive model, so the
+// stream needs no header. Close writes the end of stream symbol.
+type ArithmeticWriter struct {
+	bits    *bitWriter
+	model   *arithmeticModel
+	low     uint64
+	high    uint64
+	pending int
+	closed  bool
+}
+
+func NewArithmeticWriter(w io.Writer) *ArithmeticWriter {
+	return &ArithmeticWriter{bits: newBitWriter(w), model: newArithmeticModel(), high: arithmeticTop}
+}
+
+func (writer *ArithmeticWriter) emit(bit uint) error {
+	// A decided bit followed by the opposite bits held back while the interval
+	// straddled the middle
+	if err := writer.bits.writeBit(bit); err != nil {
+		return err
+	}
+	for ; writer.pending > 0; writer.pending-- {
+		if err := writer.bits.writeBit(1 - bit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (writer *ArithmeticWriter) encode(symbol int) error {
+	// This is from Section 8.2.3 of DIP book
+	// Narrows [low, high] to the part of the symbol and shifts out the leading bits
+	// that low and high agree on, in 32-bit integer arithmetic
+	var span uint64 = writer.high - writer.low + 1
+	var total uint64 = uint64(writer.model.total)
+	writer.high = writer.low + span*uint64(writer.model.cumulative(symbol+1))/total - 1
+	writer.low = writer.low + span*uint64(writer.model.cumulative(symbol))/total
+	writer.model.update(symbol)
+
+	for {
+		switch {
+		case writer.high < arithmeticHalf:
+			if err := writer.emit(0); err != nil {
+				return err
+			}
+		case writer.low >= arithmeticHalf:
+			if err := writer.emit(1); err != nil {
+				return err
+			}
+			writer.low -= arithmeticHalf
+			writer.high -= arithmeticHalf
+		case writer.low >= arithmeticFirstQuarter && writer.high < arithmeticThirdQuarter:
+			writer.pending++
+			writer.low -= arithmeticFirstQuarter
+			writer.high -= arithmeticFirstQuarter
+		default:
+			return nil
+		}
+		writer.low = 2 * writer.low
+		writer.high = 2*writer.high + 1
+	}
+}
+
+func (writer *ArithmeticWriter) Write(p []byte) (int, error) {
+	if writer.closed {
+		return 0, fmt.Errorf("write to a closed arithmetic writer")
+	}
+	for index, symbol := range p {
+		if err := writer.encode(int(symbol)); err != nil {
+			return index, err
+		}
+	}
+	return len(p), nil
+}
+
+func (writer *ArithmeticWriter) Close() error {
+	if writer.closed {
+		return nil
+	}
+	writer.closed = true
+	if err := writer.encode(endOfStreamSymbol); err != nil {
+		return err
+	}
+	// Two more bits pick a value inside the final interval
+	writer.pending++
+	var bit uint = 1
+	if writer.low < arithmeticFirstQuarter {
+		bit = 0
+	}
+	if err := writer.emit(bit); err != nil {
+		return err
+	}
+	return writer.bits.flush()
+}
+
+// ArithmeticReader decodes a stream written by ArithmeticWriter
+type ArithmeticReader struct {
+	bits    *bitReader
+	model   *arithmeticModel
+	low     uint64
+	high    uint64
+	value   uint64
+	padding int
+	primed  bool
+	done    bool
+}
+
+func NewArithmeticReader(r io.Reader) *ArithmeticReader {
+	return &ArithmeticReader{bits: newBitReader(r), model: newArithmeticModel(), high: arithmeticTop}
+}
+
+func (reader *ArithmeticReader) nextBit() (uint64, error) {
+	// Past the end of the stream the encoder's padding is zeros, for at most the 32
+	// bits the decoder looks ahead. Needing more means the stream was cut short.
+	bit, err := reader.bits.readBit()
+	if err == io.ErrUnexpectedEOF && reader.padding < 32 {
+		reader.padding++
+		return 0, nil
+	}
+	return uint64(bit), err
+}
+
+func (reader *ArithmeticReader) decode() (int, error) {
+	if !reader.primed {
+		for bit := 0; bit < 32; bit++ {
+			next, err := reader.nextBit()
+			if err != nil {
+				return 0, err
+			}
+			reader.value = reader.value<<1 | next
+		}
+		reader.primed = true
+	}
+
+	var span uint64 = reader.high - reader.low + 1
+	var total uint64 = uint64(reader.model.total)
+	var target uint64 = ((reader.value-reader.low+1)*total - 1) / span
+	if target >= total {
+		return 0, fmt.Errorf("invalid arithmetic code")
+	}
+	symbol := reader.model.find(int(target))
+	reader.high = reader.low + span*uint64(reader.model.cumulative(symbol+1))/total - 1
+	reader.low = reader.low + span*uint64(reader.model.cumulative(symbol))/total
+	reader.model.update(symbol)
+
+	for {
+		switch {
+		case reader.high < arithmeticHalf:
+		case reader.low >= arithmeticHalf:
+			reader.low -= arithmeticHalf
+			reader.high -= arithmeticHalf
+			reader.value -= arithmeticHalf
+		case reader.low >= arithmeticFirstQuarter && reader.high < arithmeticThirdQuarter:
+			reader.low -= arithmeticFirstQuarter
+			reader.high -= arithmeticFirstQuarter
+			reader.value -= arithmeticFirstQuarter
+		default:
+			return symbol, nil
+		}
+		next, err := reader.nextBit()
+		if err != nil {
+			return 0, err
+		}
+		reader.low = 2 * reader.low
+		reader.high = 2*reader.high + 1
+		reader.value = 2*reader.value + next
+	}
+}
+
+func (reader *ArithmeticReader) Read(p []byte) (int, error) {
+	for index := range p {
+		if reader.done {
+			return index, io.EOF
+		}
+		symbol, err := reader.decode()
+		if err != nil {
+			return index, err
+		}
+		if symbol == endOfStreamSymbol {
+			reader.done = true
+			return index, io.EOF
+		}
+		p[index] = byte(symbol)
+	}
+	return len(p), nil
+}
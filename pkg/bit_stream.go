@@ -0,0 +1,133 @@
+// Bit level reading and writing for the variable length codes of the lossless coders
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// bitWriter packs bits most significant first into bytes. The last byte is padded
+// with zeros by flush.
+type bitWriter struct {
+	writer  *bufio.Writer
+	current byte
+	count   uint
+	written int
+}
+
+func newBitWriter(w io.Writer) *bitWriter {
+	return &bitWriter{writer: bufio.NewWriter(w)}
+}
+
+func (writer *bitWriter) writeBit(bit uint) error {
+	writer.current = writer.current<<1 | byte(bit&1)
+	writer.count++
+	writer.written++
+	if writer.count == 8 {
+		if err := writer.writer.WriteByte(writer.current); err != nil {
+			return err
+		}
+		writer.current, writer.count = 0, 0
+	}
+	return nil
+}
+
+func (writer *bitWriter) writeBits(value uint64, count uint) error {
+	// The lowest count bits of value, the most significant first
+	for bit := count; bit > 0; bit-- {
+		if err := writer.writeBit(uint(value >> (bit - 1))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (writer *bitWriter) writeGamma(value uint64) error {
+	// The Elias gamma code of value >= 1: as many zeros as value has bits after the
+	// leading one, then value itself
+	if value == 0 {
+		return fmt.Errorf("the gamma code starts at 1")
+	}
+	var length uint = 0
+	for shifted := value; shifted > 1; shifted >>= 1 {
+		length++
+	}
+	if err := writer.writeBits(0, length); err != nil {
+		return err
+	}
+	return writer.writeBits(value, length+1)
+}
+
+func (writer *bitWriter) flush() error {
+	if writer.count > 0 {
+		if err := writer.writer.WriteByte(writer.current << (8 - writer.count)); err != nil {
+			return err
+		}
+		writer.current, writer.count = 0, 0
+	}
+	return writer.writer.Flush()
+}
+
+// bitReader reads the bits written by bitWriter
+type bitReader struct {
+	reader  io.ByteReader
+	current byte
+	count   uint
+}
+
+func newBitReader(r io.Reader) *bitReader {
+	if byteReader, ok := r.(io.ByteReader); ok {
+		return &bitReader{reader: byteReader}
+	}
+	return &bitReader{reader: bufio.NewReader(r)}
+}
+
+func (reader *bitReader) readBit() (uint, error) {
+	if reader.count == 0 {
+		next, err := reader.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		reader.current, reader.count = next, 8
+	}
+	reader.count--
+	return uint(reader.current>>reader.count) & 1, nil
+}
+
+func (reader *bitReader) readBits(count uint) (uint64, error) {
+	var value uint64 = 0
+	for ; count > 0; count-- {
+		bit, err := reader.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<1 | uint64(bit)
+	}
+	return value, nil
+}
+
+func (reader *bitReader) readGamma() (uint64, error) {
+	var length uint = 0
+	for {
+		bit, err := reader.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			break
+		}
+		length++
+		if length > 63 {
+			return 0, fmt.Errorf("gamma code longer than 64 bits")
+		}
+	}
+	rest, err := reader.readBits(length)
+	if err != nil {
+		return 0, err
+	}
+	return 1<<length | rest, nil
+}
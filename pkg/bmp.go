@@ -0,0 +1,235 @@
+// Uncompressed Windows BMP reading and writing, registered with the image package
+package pkg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+func init() {
+	image.RegisterFormat(string(BMPFormat), "BM", decodeBMP, decodeBMPConfig)
+}
+
+// The file and BITMAPINFOHEADER sizes
+const (
+	bmpFileHeaderSize int = 14
+	bmpInfoHeaderSize int = 40
+)
+
+// bmpHeader is what is needed of the file and info headers to read the pixels
+type bmpHeader struct {
+	offset       int
+	width        int
+	height       int
+	topDown      bool
+	bitsPerPixel int
+	palette      color.Palette
+	// The bytes read by readBMPHeader
+	size int
+}
+
+func bmpRowSize(width int, bitsPerPixel int) int {
+	// Rows are padded to a multiple of 4 bytes
+	return (width*bitsPerPixel + 31) / 32 * 4
+}
+
+func encodeBMP(w io.Writer, img image.Image) error {
+	// Grey images as 8 bits with a grey palette, others as 24 bit BGR, bottom row first
+	var bounds image.Rectangle = img.Bounds()
+	var width, height int = bounds.Dx(), bounds.Dy()
+	var bitsPerPixel, paletteSize int = 24, 0
+	if isGrayModel(img) {
+		bitsPerPixel, paletteSize = 8, MaxGrayscaleLevels
+	}
+	var rowSize int = bmpRowSize(width, bitsPerPixel)
+	var offset int = bmpFileHeaderSize + bmpInfoHeaderSize + 4*paletteSize
+
+	var header []byte = make([]byte, offset)
+	copy(header, "BM")
+	binary.LittleEndian.PutUint32(header[2:], uint32(offset+rowSize*height))
+	binary.LittleEndian.PutUint32(header[10:], uint32(offset))
+	var info []byte = header[bmpFileHeaderSize:]
+	binary.LittleEndian.PutUint32(info[0:], uint32(bmpInfoHeaderSize))
+	binary.LittleEndian.PutUint32(info[4:], uint32(width))
+	binary.LittleEndian.PutUint32(info[8:], uint32(height))
+	binary.LittleEndian.PutUint16(info[12:], 1)
+	binary.LittleEndian.PutUint16(info[14:], uint16(bitsPerPixel))
+	binary.LittleEndian.PutUint32(info[20:], uint32(rowSize*height))
+	// 72 dots per inch in dots per metre
+	binary.LittleEndian.PutUint32(info[24:], 2835)
+	binary.LittleEndian.PutUint32(info[28:], 2835)
+	binary.LittleEndian.PutUint32(info[32:], uint32(paletteSize))
+	for level := 0; level < paletteSize; level++ {
+		entry := info[bmpInfoHeaderSize+4*level:]
+		entry[0], entry[1], entry[2] = uint8(level), uint8(level), uint8(level)
+	}
+
+	var writer *bufio.Writer = bufio.NewWriter(w)
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+	var row []byte = make([]byte, rowSize)
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if bitsPerPixel == 8 {
+				row[x-bounds.Min.X] = color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+				continue
+			}
+			pixel := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			index := 3 * (x - bounds.Min.X)
+			row[index], row[index+1], row[index+2] = pixel.B, pixel.G, pixel.R
+		}
+		if _, err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func readBMPHeader(r io.Reader) (bmpHeader, error) {
+	// BITMAPINFOHEADER and its later versions, without compression, at 1, 4, 8, 24
+	// or 32 bits per pixel
+	var header bmpHeader
+	var fileHeader []byte = make([]byte, bmpFileHeaderSize+4)
+	if _, err := io.ReadFull(r, fileHeader); err != nil {
+		return header, err
+	}
+	if string(fileHeader[:2]) != "BM" {
+		return header, fmt.Errorf("not a BMP file")
+	}
+	header.offset = int(binary.LittleEndian.Uint32(fileHeader[10:]))
+	var infoSize int = int(binary.LittleEndian.Uint32(fileHeader[14:]))
+	if infoSize < bmpInfoHeaderSize || infoSize > 1024 {
+		return header, fmt.Errorf("unsupported BMP info header of %d bytes", infoSize)
+	}
+	var info []byte = make([]byte, infoSize-4)
+	if _, err := io.ReadFull(r, info); err != nil {
+		return header, err
+	}
+	header.width = int(int32(binary.LittleEndian.Uint32(info[0:])))
+	header.height = int(int32(binary.LittleEndian.Uint32(info[4:])))
+	if header.height < 0 {
+		header.height, header.topDown = -header.height, true
+	}
+	header.bitsPerPixel = int(binary.LittleEndian.Uint16(info[10:]))
+	var compression uint32 = binary.LittleEndian.Uint32(info[12:])
+	var colours int = int(binary.LittleEndian.Uint32(info[28:]))
+	if header.bitsPerPixel > 8 {
+		colours = 0
+	}
+	if header.width <= 0 || header.height == 0 || header.width > 1<<20 || header.height > 1<<20 || header.width*header.height > maxImagePixels {
+		return header, fmt.Errorf("invalid BMP size %dx%d", header.width, header.height)
+	}
+	if compression != 0 {
+		return header, fmt.Errorf("compressed BMP files are not supported")
+	}
+
+	switch header.bitsPerPixel {
+	case 1, 4, 8:
+		if colours == 0 || colours > 1<<header.bitsPerPixel {
+			colours = 1 << header.bitsPerPixel
+		}
+		var entries []byte = make([]byte, 4*colours)
+		if _, err := io.ReadFull(r, entries); err != nil {
+			return header, err
+		}
+		// Indices past the colours in the file are black, so that every index is valid
+		header.palette = make(color.Palette, 1<<header.bitsPerPixel)
+		for index := range header.palette {
+			header.palette[index] = color.RGBA{0, 0, 0, 255}
+			if index < colours {
+				header.palette[index] = color.RGBA{entries[4*index+2], entries[4*index+1], entries[4*index], 255}
+			}
+		}
+	case 24, 32:
+	default:
+		return header, fmt.Errorf("unsupported BMP depth of %d bits", header.bitsPerPixel)
+	}
+	header.size = bmpFileHeaderSize + infoSize + 4*colours
+	if header.offset < header.size {
+		return header, fmt.Errorf("BMP pixels overlap the header")
+	}
+	return header, nil
+}
+
+func decodeBMPConfig(r io.Reader) (image.Config, error) {
+	header, err := readBMPHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	var model color.Model = color.RGBAModel
+	if header.palette != nil {
+		model = header.palette
+	}
+	return image.Config{ColorModel: model, Width: header.width, Height: header.height}, nil
+}
+
+func decodeBMP(r io.Reader) (image.Image, error) {
+	// Paletted images of grey levels only are returned as *image.Gray
+	var reader *bufio.Reader = bufio.NewReader(r)
+	header, err := readBMPHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := reader.Discard(header.offset - header.size); err != nil {
+		return nil, err
+	}
+
+	var gray bool = header.palette != nil
+	for _, entry := range header.palette {
+		red, green, blue, _ := entry.RGBA()
+		gray = gray && red == green && green == blue
+	}
+	var rectangle image.Rectangle = image.Rect(0, 0, header.width, header.height)
+	var img image.Image
+	var set func(x int, y int, row []byte)
+	switch {
+	case gray:
+		grayImage := image.NewGray(rectangle)
+		img = grayImage
+		set = func(x int, y int, row []byte) {
+			grayImage.Pix[y*grayImage.Stride+x] = header.palette[paletteIndex(row, x, header.bitsPerPixel)].(color.RGBA).R
+		}
+	case header.palette != nil:
+		paletted := image.NewPaletted(rectangle, header.palette)
+		img = paletted
+		set = func(x int, y int, row []byte) {
+			paletted.Pix[y*paletted.Stride+x] = paletteIndex(row, x, header.bitsPerPixel)
+		}
+	default:
+		// The fourth byte of 32 bit pixels is not used without a bit field mask
+		rgba := image.NewRGBA(rectangle)
+		img = rgba
+		var bytesPerPixel int = header.bitsPerPixel / 8
+		set = func(x int, y int, row []byte) {
+			pixel, target := row[bytesPerPixel*x:], rgba.Pix[y*rgba.Stride+4*x:]
+			target[0], target[1], target[2], target[3] = pixel[2], pixel[1], pixel[0], 255
+		}
+	}
+
+	var row []byte = make([]byte, bmpRowSize(header.width, header.bitsPerPixel))
+	for line := 0; line < header.height; line++ {
+		if _, err := io.ReadFull(reader, row); err != nil {
+			return nil, err
+		}
+		y := header.height - 1 - line
+		if header.topDown {
+			y = line
+		}
+		for x := 0; x < header.width; x++ {
+			set(x, y, row)
+		}
+	}
+	return img, nil
+}
+
+func paletteIndex(row []byte, x int, bitsPerPixel int) uint8 {
+	// Pixels of fewer than 8 bits are packed from the most significant bit
+	var perByte int = 8 / bitsPerPixel
+	var shift uint = uint(8 - bitsPerPixel*(x%perByte+1))
+	return row[x/perByte] >> shift & (1<<uint(bitsPerPixel) - 1)
+}
@@ -0,0 +1,606 @@
+// Boundary representation: Moore boundary following, Freeman chain codes, minimum-perimeter polygons and polygon approximation
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Boundary is the outer boundary of a labelled region, traced clockwise as seen on
+// screen (x to the right, y down) from its uppermost, leftmost pixel
+type Boundary struct {
+	Label  int           `json:"label"`
+	Points []image.Point `json:"points"`
+}
+
+// ChainCode is a Freeman chain code. With 8 directions 0 is east and the codes go
+// counterclockwise in steps of 45 degrees (1 is north east, 2 north, ...), with 4
+// directions in steps of 90 degrees (1 is north). Codes[i] is the step from the i-th
+// boundary point to the next, the last step closes the boundary back at Start.
+type ChainCode struct {
+	Start      image.Point `json:"start"`
+	Directions int         `json:"directions"`
+	Codes      []int       `json:"codes"`
+}
+
+// Polygon is a closed polygon, the last vertex connects back to the first
+type Polygon struct {
+	Vertices []image.Point `json:"vertices"`
+}
+
+// BoundaryDescription gathers the representations of one region
+type BoundaryDescription struct {
+	Label           int       `json:"label"`
+	Boundary        Boundary  `json:"boundary"`
+	ChainCode       ChainCode `json:"chain_code"`
+	FirstDifference []int     `json:"first_difference"`
+	ShapeNumber     []int     `json:"shape_number"`
+	MPP             Polygon   `json:"mpp"`
+}
+
+// Moore neighbours clockwise on screen, starting from the west
+var mooreNeighbours []image.Point = []image.Point{
+	{-1, 0}, {-1, -1}, {0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1},
+}
+
+// Steps for each chain code, y grows downwards so north is -y
+var chainSteps8 []image.Point = []image.Point{
+	{1, 0}, {1, -1}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}, {0, 1}, {1, 1},
+}
+var chainSteps4 []image.Point = []image.Point{
+	{1, 0}, {0, -1}, {-1, 0}, {0, 1},
+}
+
+func FollowBoundary(labels [][]int, label int) (Boundary, error) {
+	// This is from Section 11.1.1 of DIP book (Moore boundary tracing)
+	// 1. b0 is the uppermost, leftmost point of the region and c0 its west neighbour
+	// 2. Examine the 8 neighbours of b clockwise starting at c, the first one in the
+	//    region is the next b and the neighbour examined just before it the next c
+	// 3. Stop when b is b0 again and the next boundary point found is b1
+	// Only the 8-connected component containing b0 is traced.
+	if len(labels) == 0 || len(labels[0]) == 0 {
+		return Boundary{}, fmt.Errorf("empty label image")
+	}
+	var width int = len(labels)
+	var height int = len(labels[0])
+	inRegion := func(point image.Point) bool {
+		return point.X >= 0 && point.Y >= 0 && point.X < width && point.Y < height && labels[point.X][point.Y] == label
+	}
+
+	var start image.Point
+	var found bool = false
+	for y := 0; y < height && !found; y++ {
+		for x := 0; x < width; x++ {
+			if labels[x][y] == label {
+				start = image.Point{x, y}
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return Boundary{}, fmt.Errorf("label %d is not in the image", label)
+	}
+
+	var boundary Boundary = Boundary{Label: label, Points: []image.Point{start}}
+	var current image.Point = start
+	var searchFrom int = 0
+	for {
+		var next int = -1
+		for step := 0; step < len(mooreNeighbours); step++ {
+			direction := (searchFrom + step) % len(mooreNeighbours)
+			if inRegion(current.Add(mooreNeighbours[direction])) {
+				next = direction
+				break
+			}
+		}
+		if next < 0 {
+			// An isolated pixel is its own boundary
+			return boundary, nil
+		}
+
+		backtrack := current.Add(mooreNeighbours[(next+len(mooreNeighbours)-1)%len(mooreNeighbours)])
+		previous := current
+		current = current.Add(mooreNeighbours[next])
+		for direction, offset := range mooreNeighbours {
+			if current.Add(offset) == backtrack {
+				searchFrom = direction
+				break
+			}
+		}
+
+		if previous == start && len(boundary.Points) > 1 && current == boundary.Points[1] {
+			// Drop the repeated b0
+			boundary.Points = boundary.Points[:len(boundary.Points)-1]
+			return boundary, nil
+		}
+		boundary.Points = append(boundary.Points, current)
+	}
+}
+
+func RegionBoundaries(labels [][]int) ([]Boundary, error) {
+	// Follows the boundary of every positive label, in increasing label order
+	var labelSet map[int]bool = make(map[int]bool)
+	var maximum int = 0
+	for x := range labels {
+		for _, label := range labels[x] {
+			if label > 0 {
+				labelSet[label] = true
+				if label > maximum {
+					maximum = label
+				}
+			}
+		}
+	}
+	var boundaries []Boundary
+	for label := 1; label <= maximum; label++ {
+		if !labelSet[label] {
+			continue
+		}
+		boundary, err := FollowBoundary(labels, label)
+		if err != nil {
+			return nil, err
+		}
+		boundaries = append(boundaries, boundary)
+	}
+	return boundaries, nil
+}
+
+func crossProduct(first image.Point, second image.Point) int {
+	return first.X*second.Y - first.Y*second.X
+}
+
+func fourConnectedPath(points []image.Point) []image.Point {
+	// Replaces each diagonal step of a closed 8-connected boundary by two steps through
+	// the pixel on the region side, which is to the right of a clockwise boundary
+	var path []image.Point
+	for index, point := range points {
+		path = append(path, point)
+		next := points[(index+1)%len(points)]
+		step := next.Sub(point)
+		if step.X == 0 || step.Y == 0 {
+			continue
+		}
+		horizontal := image.Point{step.X, 0}
+		if crossProduct(step, horizontal) > 0 {
+			path = append(path, point.Add(horizontal))
+		} else {
+			path = append(path, point.Add(image.Point{0, step.Y}))
+		}
+	}
+	return path
+}
+
+func NewChainCode(boundary Boundary, directions int) (ChainCode, error) {
+	// This is from Section 11.1.2 of DIP book
+	// For the 4-direction code diagonal steps are split in two through the pixel inside
+	// the region, so the code still follows the region's pixels
+	if directions != 4 && directions != 8 {
+		return ChainCode{}, fmt.Errorf("chain codes have 4 or 8 directions, got %d", directions)
+	}
+	if len(boundary.Points) == 0 {
+		return ChainCode{}, fmt.Errorf("empty boundary")
+	}
+	var points []image.Point = boundary.Points
+	var steps []image.Point = chainSteps8
+	if directions == 4 {
+		points = fourConnectedPath(points)
+		steps = chainSteps4
+	}
+
+	var code ChainCode = ChainCode{Start: boundary.Points[0], Directions: directions}
+	if len(points) == 1 {
+		return code, nil
+	}
+	for index, point := range points {
+		step := points[(index+1)%len(points)].Sub(point)
+		var found bool = false
+		for value, candidate := range steps {
+			if step == candidate {
+				code.Codes = append(code.Codes, value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ChainCode{}, fmt.Errorf("boundary points %v and %v are not neighbours", point, points[(index+1)%len(points)])
+		}
+	}
+	return code, nil
+}
+
+func (code ChainCode) Points() []image.Point {
+	// Walks the code from the start point, the inverse of NewChainCode
+	var steps []image.Point = chainSteps8
+	if code.Directions == 4 {
+		steps = chainSteps4
+	}
+	var points []image.Point = []image.Point{code.Start}
+	for index, value := range code.Codes {
+		if index == len(code.Codes)-1 {
+			break
+		}
+		points = append(points, points[len(points)-1].Add(steps[value]))
+	}
+	return points
+}
+
+func (code ChainCode) FirstDifference() []int {
+	// Number of direction changes, counted counterclockwise, between consecutive codes.
+	// The code is treated as circular so the first element compares the first code
+	// with the last one, which makes the difference invariant to rotation.
+	var difference []int = make([]int, len(code.Codes))
+	for index, value := range code.Codes {
+		previous := code.Codes[(index+len(code.Codes)-1)%len(code.Codes)]
+		difference[index] = (value - previous + code.Directions) % code.Directions
+	}
+	return difference
+}
+
+func NormaliseStartPoint(codes []int) []int {
+	// Rotates the circular sequence so it forms the integer of minimum magnitude,
+	// which makes the code independent of the boundary point it started from
+	var best int = 0
+	for candidate := 1; candidate < len(codes); candidate++ {
+		for offset := 0; offset < len(codes); offset++ {
+			first := codes[(candidate+offset)%len(codes)]
+			second := codes[(best+offset)%len(codes)]
+			if first != second {
+				if first < second {
+					best = candidate
+				}
+				break
+			}
+		}
+	}
+	var normalised []int = make([]int, len(codes))
+	for index := range codes {
+		normalised[index] = codes[(best+index)%len(codes)]
+	}
+	return normalised
+}
+
+func (code ChainCode) ShapeNumber() []int {
+	// This is from Section 11.2.2 of DIP book
+	// The first difference of smallest magnitude, invariant to rotation by multiples of
+	// the code's angle and to the starting point
+	return NormaliseStartPoint(code.FirstDifference())
+}
+
+type mppVertex struct {
+	point  image.Point
+	convex bool
+}
+
+func orientation(a image.Point, b image.Point, c image.Point) int {
+	// sgn(a, b, c) of Section 11.1.3, positive when the points turn the same way as the
+	// polygon vertices are ordered, zero when they are collinear
+	value := (b.X-a.X)*(c.Y-a.Y) - (c.X-a.X)*(b.Y-a.Y)
+	switch {
+	case value > 0:
+		return 1
+	case value < 0:
+		return -1
+	}
+	return 0
+}
+
+func fillBinaryHoles(pixels [][]bool) [][]bool {
+	// Background pixels that cannot be reached from the border become foreground
+	var width int = len(pixels)
+	var height int = len(pixels[0])
+	var outside [][]bool = newBinary(width, height)
+	var stack []image.Point
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if (x == 0 || y == 0 || x == width-1 || y == height-1) && !pixels[x][y] {
+				outside[x][y] = true
+				stack = append(stack, image.Point{x, y})
+			}
+		}
+	}
+	for len(stack) > 0 {
+		point := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, offset := range fourNeighbours {
+			neighbour := point.Add(offset)
+			if neighbour.X < 0 || neighbour.Y < 0 || neighbour.X >= width || neighbour.Y >= height {
+				continue
+			}
+			if !pixels[neighbour.X][neighbour.Y] && !outside[neighbour.X][neighbour.Y] {
+				outside[neighbour.X][neighbour.Y] = true
+				stack = append(stack, neighbour)
+			}
+		}
+	}
+	var filled [][]bool = newBinary(width, height)
+	for x := range filled {
+		for y := range filled[x] {
+			filled[x][y] = !outside[x][y]
+		}
+	}
+	return filled
+}
+
+func MinimumPerimeterPolygon(labels [][]int, label int, cellSize int) (Polygon, error) {
+	// This is from Section 11.1.3 of DIP book
+	// The region is covered by square cells of cellSize pixels, a cell belongs to the
+	// region when at least half of its pixels do, holes are filled and only the largest
+	// 8-connected piece is kept. Walking the 4-connected boundary through the cell
+	// centres, convex corners are the W vertices and the concave corners, mirrored
+	// diagonally onto the outer wall, the B vertices.
+	// The MPP algorithm then crawls along them keeping the white (WC) and black (BC)
+	// crawlers and emitting a vertex whenever the polygon has to turn. Vertices are
+	// returned in pixel coordinates, at cell centres.
+	if cellSize < 1 {
+		return Polygon{}, fmt.Errorf("cell size must be at least 1, got %d", cellSize)
+	}
+	if len(labels) == 0 || len(labels[0]) == 0 {
+		return Polygon{}, fmt.Errorf("empty label image")
+	}
+	var columns int = (len(labels) + cellSize - 1) / cellSize
+	var rows int = (len(labels[0]) + cellSize - 1) / cellSize
+	var cells [][]bool = newBinary(columns, rows)
+	for column := 0; column < columns; column++ {
+		for row := 0; row < rows; row++ {
+			var inside, total int
+			for x := column * cellSize; x < (column+1)*cellSize && x < len(labels); x++ {
+				for y := row * cellSize; y < (row+1)*cellSize && y < len(labels[0]); y++ {
+					total++
+					if labels[x][y] == label {
+						inside++
+					}
+				}
+			}
+			cells[column][row] = 2*inside >= total && inside > 0
+		}
+	}
+	cells = fillBinaryHoles(cells)
+
+	// Coarse cells can break a thin region apart, the largest piece is kept
+	cellLabels, count, err := labelBinary(cells, EightConnectivity)
+	if err != nil {
+		return Polygon{}, err
+	}
+	if count == 0 {
+		return Polygon{}, fmt.Errorf("label %d covers no cell of size %d", label, cellSize)
+	}
+	var areas []int = make([]int, count+1)
+	for x := range cellLabels {
+		for _, cellLabel := range cellLabels[x] {
+			areas[cellLabel]++
+		}
+	}
+	var largest int = 1
+	for cellLabel := 2; cellLabel <= count; cellLabel++ {
+		if areas[cellLabel] > areas[largest] {
+			largest = cellLabel
+		}
+	}
+	boundary, err := FollowBoundary(cellLabels, largest)
+	if err != nil {
+		return Polygon{}, err
+	}
+
+	toPixels := func(point image.Point) image.Point {
+		return image.Point{point.X*cellSize + cellSize/2, point.Y*cellSize + cellSize/2}
+	}
+	var path []image.Point = fourConnectedPath(boundary.Points)
+	if len(path) < 3 {
+		var polygon Polygon
+		for _, point := range path {
+			polygon.Vertices = append(polygon.Vertices, toPixels(point))
+		}
+		return polygon, nil
+	}
+
+	// Corners of the path. The boundary is clockwise on screen, so a convex corner
+	// turns right, which is a positive cross product with y pointing down.
+	var vertices []mppVertex
+	var first int = -1
+	for index, point := range path {
+		incoming := point.Sub(path[(index+len(path)-1)%len(path)])
+		outgoing := path[(index+1)%len(path)].Sub(point)
+		turn := crossProduct(incoming, outgoing)
+		switch {
+		case turn > 0 || outgoing == incoming.Mul(-1):
+			vertices = append(vertices, mppVertex{point: point, convex: true})
+			last := vertices[len(vertices)-1].point
+			if first < 0 || last.Y < vertices[first].point.Y || (last.Y == vertices[first].point.Y && last.X < vertices[first].point.X) {
+				first = len(vertices) - 1
+			}
+		case turn < 0:
+			vertices = append(vertices, mppVertex{point: point.Add(outgoing).Sub(incoming), convex: false})
+		}
+	}
+	// Start at the uppermost, leftmost W vertex, which is always an MPP vertex, and
+	// close the sequence with it
+	var ordered []mppVertex
+	for index := 0; index <= len(vertices); index++ {
+		ordered = append(ordered, vertices[(first+index)%len(vertices)])
+	}
+
+	var polygon Polygon = Polygon{Vertices: []image.Point{toPixels(ordered[0].point)}}
+	var last, white, black int = 0, 0, 0
+	for index := 1; index < len(ordered); index++ {
+		vertex := ordered[index]
+		switch {
+		case orientation(ordered[last].point, ordered[white].point, vertex.point) > 0:
+			// Beyond the white crawler, so it is the next MPP vertex
+			last = white
+		case orientation(ordered[last].point, ordered[black].point, vertex.point) < 0:
+			// Beyond the black crawler, so it is the next MPP vertex
+			last = black
+		default:
+			if vertex.convex {
+				white = index
+			} else {
+				black = index
+			}
+			continue
+		}
+		if last == len(ordered)-1 {
+			break
+		}
+		polygon.Vertices = append(polygon.Vertices, toPixels(ordered[last].point))
+		white, black = last, last
+		index = last
+	}
+	return polygon, nil
+}
+
+func lineFitError(points []image.Point) float64 {
+	// Sum of squared perpendicular distances to the least squares (total) line fit,
+	// the smallest eigenvalue of the scatter matrix
+	if len(points) < 3 {
+		return 0
+	}
+	var meanX, meanY float64
+	for _, point := range points {
+		meanX += float64(point.X)
+		meanY += float64(point.Y)
+	}
+	meanX /= float64(len(points))
+	meanY /= float64(len(points))
+	var sxx, syy, sxy float64
+	for _, point := range points {
+		dx, dy := float64(point.X)-meanX, float64(point.Y)-meanY
+		sxx += dx * dx
+		syy += dy * dy
+		sxy += dx * dy
+	}
+	return (sxx + syy - math.Sqrt((sxx-syy)*(sxx-syy)+4*sxy*sxy)) / 2
+}
+
+func MergingPolygon(boundary Boundary, threshold float64) (Polygon, error) {
+	// This is from Section 11.1.4 of DIP book
+	// Points along the boundary are merged until the least squares error of the line
+	// fitted through the points merged so far exceeds the threshold, the last point that
+	// fitted becomes a vertex and merging starts again from it
+	if threshold < 0 {
+		return Polygon{}, fmt.Errorf("threshold must not be negative, got %v", threshold)
+	}
+	if len(boundary.Points) == 0 {
+		return Polygon{}, fmt.Errorf("empty boundary")
+	}
+	var points []image.Point = append(append([]image.Point{}, boundary.Points...), boundary.Points[0])
+	var polygon Polygon = Polygon{Vertices: []image.Point{points[0]}}
+	var start int = 0
+	for index := 2; index < len(points); index++ {
+		if lineFitError(points[start:index+1]) > threshold {
+			start = index - 1
+			polygon.Vertices = append(polygon.Vertices, points[start])
+		}
+	}
+	return polygon, nil
+}
+
+func perpendicularDistance(point image.Point, from image.Point, to image.Point) float64 {
+	length := distance(from, to)
+	if length == 0 {
+		return distance(point, from)
+	}
+	return math.Abs(float64(crossProduct(to.Sub(from), point.Sub(from)))) / length
+}
+
+func splitSegment(points []image.Point, threshold float64) []image.Point {
+	// Vertices strictly between the first and last point, splitting at the point
+	// farthest from the line joining them while it is beyond the threshold
+	var farthest int = -1
+	var largest float64 = threshold
+	for index := 1; index < len(points)-1; index++ {
+		d := perpendicularDistance(points[index], points[0], points[len(points)-1])
+		if d > largest {
+			largest = d
+			farthest = index
+		}
+	}
+	if farthest < 0 {
+		return nil
+	}
+	var vertices []image.Point = splitSegment(points[:farthest+1], threshold)
+	vertices = append(vertices, points[farthest])
+	return append(vertices, splitSegment(points[farthest:], threshold)...)
+}
+
+func SplittingPolygon(boundary Boundary, threshold float64) (Polygon, error) {
+	// This is from Section 11.1.4 of DIP book
+	// The boundary is first split at its two farthest points, then each part is split
+	// again at its point farthest from the line joining its ends, as long as that
+	// distance exceeds the threshold
+	if threshold < 0 {
+		return Polygon{}, fmt.Errorf("threshold must not be negative, got %v", threshold)
+	}
+	if len(boundary.Points) == 0 {
+		return Polygon{}, fmt.Errorf("empty boundary")
+	}
+	var points []image.Point = boundary.Points
+	var first, second int = 0, 0
+	var largest float64 = -1
+	for i := range points {
+		for j := i + 1; j < len(points); j++ {
+			if d := distance(points[i], points[j]); d > largest {
+				largest = d
+				first, second = i, j
+			}
+		}
+	}
+	if first == second {
+		return Polygon{Vertices: []image.Point{points[0]}}, nil
+	}
+
+	var polygon Polygon = Polygon{Vertices: []image.Point{points[first]}}
+	polygon.Vertices = append(polygon.Vertices, splitSegment(points[first:second+1], threshold)...)
+	polygon.Vertices = append(polygon.Vertices, points[second])
+	var back []image.Point = append(append([]image.Point{}, points[second:]...), points[:first+1]...)
+	polygon.Vertices = append(polygon.Vertices, splitSegment(back, threshold)...)
+	return polygon, nil
+}
+
+func (polygon Polygon) Perimeter() float64 {
+	var perimeter float64 = 0
+	for index, vertex := range polygon.Vertices {
+		perimeter += distance(vertex, polygon.Vertices[(index+1)%len(polygon.Vertices)])
+	}
+	return perimeter
+}
+
+func DescribeBoundaries(labels [][]int, directions int, cellSize int) ([]BoundaryDescription, error) {
+	// Boundary, chain code, first difference, shape number and MPP of every region
+	boundaries, err := RegionBoundaries(labels)
+	if err != nil {
+		return nil, err
+	}
+	var descriptions []BoundaryDescription
+	for _, boundary := range boundaries {
+		code, err := NewChainCode(boundary, directions)
+		if err != nil {
+			return nil, err
+		}
+		polygon, err := MinimumPerimeterPolygon(labels, boundary.Label, cellSize)
+		if err != nil {
+			return nil, err
+		}
+		descriptions = append(descriptions, BoundaryDescription{
+			Label:           boundary.Label,
+			Boundary:        boundary,
+			ChainCode:       code,
+			FirstDifference: code.FirstDifference(),
+			ShapeNumber:     code.ShapeNumber(),
+			MPP:             polygon,
+		})
+	}
+	return descriptions, nil
+}
+
+func DrawPolygons(img image.Image, polygons []Polygon, colour color.Color) (image.Image, error) {
+	canvas := imageToRGBA(img)
+	for _, polygon := range polygons {
+		for index, vertex := range polygon.Vertices {
+			drawLine(canvas, vertex, polygon.Vertices[(index+1)%len(polygon.Vertices)], colour)
+		}
+	}
+	return canvas, nil
+}
@@ -0,0 +1,194 @@
+package pkg
+
+import (
+	"encoding/json"
+	"image"
+	"reflect"
+	"testing"
+)
+
+func labelsFromRows(rows []string) [][]int {
+	var labels [][]int = newLabels(len(rows[0]), len(rows))
+	for y, row := range rows {
+		for x, cell := range row {
+			if cell != '.' {
+				labels[x][y] = int(cell - '0')
+			}
+		}
+	}
+	return labels
+}
+
+func TestFollowBoundaryAndChainCodes(t *testing.T) {
+	labels := labelsFromRows([]string{
+		".....",
+		".111.",
+		".111.",
+		".111.",
+		".....",
+	})
+
+	boundary, err := FollowBoundary(labels, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []image.Point{{1, 1}, {2, 1}, {3, 1}, {3, 2}, {3, 3}, {2, 3}, {1, 3}, {1, 2}}
+	if !reflect.DeepEqual(boundary.Points, want) {
+		t.Errorf("boundary = %v, want %v", boundary.Points, want)
+	}
+
+	code, err := NewChainCode(boundary, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(code.Codes, []int{0, 0, 6, 6, 4, 4, 2, 2}) {
+		t.Errorf("8-direction code = %v", code.Codes)
+	}
+	if !reflect.DeepEqual(code.Points(), boundary.Points) {
+		t.Errorf("walking the code gives %v, want the boundary", code.Points())
+	}
+	if !reflect.DeepEqual(code.FirstDifference(), []int{6, 0, 6, 0, 6, 0, 6, 0}) {
+		t.Errorf("first difference = %v", code.FirstDifference())
+	}
+	if !reflect.DeepEqual(code.ShapeNumber(), []int{0, 6, 0, 6, 0, 6, 0, 6}) {
+		t.Errorf("shape number = %v", code.ShapeNumber())
+	}
+
+	four, err := NewChainCode(boundary, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(four.Codes, []int{0, 0, 3, 3, 2, 2, 1, 1}) {
+		t.Errorf("4-direction code = %v", four.Codes)
+	}
+
+	// A diagonal boundary is split through the region's pixels in the 4-direction code
+	diagonal := labelsFromRows([]string{
+		"1..",
+		"11.",
+		"111",
+	})
+	boundary, err = FollowBoundary(diagonal, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	four, err = NewChainCode(boundary, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, point := range four.Points() {
+		if diagonal[point.X][point.Y] != 1 {
+			t.Errorf("4-direction path leaves the region at %v", point)
+		}
+	}
+
+	if !reflect.DeepEqual(NormaliseStartPoint([]int{3, 1, 0, 2, 0, 1}), []int{0, 1, 3, 1, 0, 2}) {
+		t.Errorf("normalised start point = %v", NormaliseStartPoint([]int{3, 1, 0, 2, 0, 1}))
+	}
+	if _, err := FollowBoundary(labels, 2); err == nil {
+		t.Error("expected an error for a missing label")
+	}
+}
+
+func TestMinimumPerimeterPolygon(t *testing.T) {
+	square := labelsFromRows([]string{
+		".....",
+		".111.",
+		".111.",
+		".111.",
+		".....",
+	})
+	polygon, err := MinimumPerimeterPolygon(square, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []image.Point{{1, 1}, {3, 1}, {3, 3}, {1, 3}}
+	if !reflect.DeepEqual(polygon.Vertices, want) {
+		t.Errorf("square MPP = %v, want %v", polygon.Vertices, want)
+	}
+	if polygon.Perimeter() != 8 {
+		t.Errorf("perimeter = %v, want 8", polygon.Perimeter())
+	}
+
+	// The concave corner of the L is cut off along the outer wall
+	shape := labelsFromRows([]string{
+		"111..",
+		"111..",
+		"11111",
+		"11111",
+	})
+	polygon, err = MinimumPerimeterPolygon(shape, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []image.Point{{0, 0}, {2, 0}, {4, 2}, {4, 3}, {0, 3}}
+	if !reflect.DeepEqual(polygon.Vertices, want) {
+		t.Errorf("L shape MPP = %v, want %v", polygon.Vertices, want)
+	}
+
+	if _, err := MinimumPerimeterPolygon(shape, 1, 0); err == nil {
+		t.Error("expected an error for a zero cell size")
+	}
+}
+
+func TestPolygonApproximation(t *testing.T) {
+	rectangle := labelsFromRows([]string{
+		"........",
+		".111111.",
+		".111111.",
+		".111111.",
+		".111111.",
+		"........",
+	})
+	boundary, err := FollowBoundary(rectangle, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	splitting, err := SplittingPolygon(boundary, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merging, err := MergingPolygon(boundary, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corners := map[image.Point]bool{{1, 1}: true, {6, 1}: true, {6, 4}: true, {1, 4}: true}
+	for name, polygon := range map[string]Polygon{"splitting": splitting, "merging": merging} {
+		if len(polygon.Vertices) != 4 {
+			t.Errorf("%s polygon = %v, want the 4 corners", name, polygon.Vertices)
+			continue
+		}
+		for _, vertex := range polygon.Vertices {
+			if !corners[vertex] {
+				t.Errorf("%s polygon vertex %v is not a corner", name, vertex)
+			}
+		}
+	}
+}
+
+func TestDescribeBoundariesJSON(t *testing.T) {
+	labels := labelsFromRows([]string{
+		"11..2",
+		"11..2",
+	})
+	descriptions, err := DescribeBoundaries(labels, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descriptions) != 2 {
+		t.Fatalf("got %d descriptions, want 2", len(descriptions))
+	}
+
+	encoded, err := json.Marshal(descriptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []BoundaryDescription
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, descriptions) {
+		t.Errorf("JSON round trip gives %+v, want %+v", decoded, descriptions)
+	}
+}
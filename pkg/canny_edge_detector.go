@@ -0,0 +1,145 @@
+// Canny edge detector
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+func nonMaximumSuppression(gradient Gradient) [][]float64 {
+	// Keeps a pixel only if its magnitude is not below both neighbours along the
+	// gradient direction, quantised to the nearest multiple of 45 degrees
+	var width int = len(gradient.Magnitude)
+	var height int = len(gradient.Magnitude[0])
+	var suppressed [][]float64 = newFloats(width, height)
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			magnitude := gradient.Magnitude[x][y]
+			if magnitude == 0 {
+				continue
+			}
+			direction := math.Round(gradient.Direction[x][y]/(math.Pi/4)) * math.Pi / 4
+			dx := int(math.Round(math.Cos(direction)))
+			dy := int(math.Round(math.Sin(direction)))
+
+			var forward, backward float64
+			if x+dx >= 0 && x+dx < width && y+dy >= 0 && y+dy < height {
+				forward = gradient.Magnitude[x+dx][y+dy]
+			}
+			if x-dx >= 0 && x-dx < width && y-dy >= 0 && y-dy < height {
+				backward = gradient.Magnitude[x-dx][y-dy]
+			}
+			if magnitude >= forward && magnitude >= backward {
+				suppressed[x][y] = magnitude
+			}
+		}
+	}
+	return suppressed
+}
+
+func automaticCannyThresholds(magnitudes [][]float64, maximum float64) (float64, float64) {
+	// Same heuristic as MATLAB's edge function: the high threshold is placed so that
+	// 70% of the pixels fall below it, the low threshold is 0.4 of the high one
+	var values []float64
+	for x := range magnitudes {
+		values = append(values, magnitudes[x]...)
+	}
+	sort.Float64s(values)
+	var high float64 = values[int(0.7*float64(len(values)-1))] / maximum
+	if high <= 0 {
+		high = 0.1
+	}
+	return 0.4 * high, high
+}
+
+func CannyEdgeDetector(img image.Image, sigma float64, low float64, high float64) (image.Image, float64, float64, error) {
+	// This is from Section 10.2.6 of DIP book
+	// 1. Smooth the image with a Gaussian of the given sigma
+	// 2. Compute the gradient magnitude and direction with the Sobel operators
+	// 3. Apply non-maximum suppression to the magnitude
+	// 4. Double threshold and link the weak edges connected to strong ones
+	// Thresholds are fractions of the largest gradient magnitude, a high threshold of
+	// zero or less selects both automatically and a low one of zero or less uses 0.4 high.
+	// Returns the binary edge map and the thresholds that were used.
+	if high > 1 || low > 1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), 0, 0, fmt.Errorf("thresholds must be fractions of the maximum magnitude, got %v and %v", low, high)
+	}
+	if high > 0 && low > high {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), 0, 0, fmt.Errorf("low threshold %v is above high threshold %v", low, high)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), 0, 0, fmt.Errorf("empty image")
+	}
+
+	var values [][]float64 = levelsToFloats(levels)
+	if sigma > 0 {
+		smoothed, err := gaussianSmoothFloats(values, sigma)
+		if err != nil {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), 0, 0, err
+		}
+		values = smoothed
+	}
+
+	var gradient Gradient = gradientOfFloats(values, SobelOperator1, SobelOperator2)
+	var suppressed [][]float64 = nonMaximumSuppression(gradient)
+
+	var maximum float64 = 0
+	for x := range gradient.Magnitude {
+		for y := range gradient.Magnitude[x] {
+			maximum = math.Max(maximum, gradient.Magnitude[x][y])
+		}
+	}
+	var width int = len(values)
+	var height int = len(values[0])
+	var edges [][]bool = newBinary(width, height)
+	if maximum == 0 {
+		newImage, err := binaryToImage(edges)
+		if err != nil {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), 0, 0, err
+		}
+		return newImage, low, high, nil
+	}
+
+	if high <= 0 {
+		low, high = automaticCannyThresholds(gradient.Magnitude, maximum)
+	} else if low <= 0 {
+		low = 0.4 * high
+	}
+
+	// Strong pixels seed the edges, weak pixels are kept only when 8-connected to one
+	var stack []image.Point
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if suppressed[x][y] >= high*maximum {
+				edges[x][y] = true
+				stack = append(stack, image.Point{x, y})
+			}
+		}
+	}
+	for len(stack) > 0 {
+		point := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				nx, ny := point.X+dx, point.Y+dy
+				if nx < 0 || ny < 0 || nx >= width || ny >= height || edges[nx][ny] {
+					continue
+				}
+				if suppressed[nx][ny] >= low*maximum && suppressed[nx][ny] > 0 {
+					edges[nx][ny] = true
+					stack = append(stack, image.Point{nx, ny})
+				}
+			}
+		}
+	}
+
+	newImage, err := binaryToImage(edges)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), 0, 0, err
+	}
+	return newImage, low, high, nil
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestGaussianKernel(t *testing.T) {
+	kernel, err := GaussianKernel(1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kernel) != 9 || len(kernel[0]) != 9 {
+		t.Errorf("kernel size = %dx%d, want 9x9", len(kernel), len(kernel[0]))
+	}
+	var sum float64 = 0
+	for _, row := range kernel {
+		for _, cell := range row {
+			sum += cell
+		}
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("kernel sum = %v, want 1", sum)
+	}
+	if kernel[4][4] <= kernel[4][3] || kernel[4][3] != kernel[3][4] {
+		t.Error("kernel is not peaked and symmetric around its centre")
+	}
+
+	if _, err := GaussianKernel(0); err == nil {
+		t.Error("expected an error for a zero sigma")
+	}
+}
+
+func TestCannyEdgeDetector(t *testing.T) {
+	// A bright square on a dark background
+	var values []uint8
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			var level uint8 = 20
+			if x >= 6 && x < 14 && y >= 6 && y < 14 {
+				level = 220
+			}
+			values = append(values, level)
+		}
+	}
+	img := createTestImage(20, 20, values)
+
+	edges, low, high, err := CannyEdgeDetector(img, 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if low <= 0 || high <= low {
+		t.Errorf("automatic thresholds = %v and %v, want 0 < low < high", low, high)
+	}
+
+	// Edges follow the sides of the square and are one pixel thick
+	gray := edges.(*image.Gray)
+	var rowEdges int = 0
+	for x := 0; x < 20; x++ {
+		if gray.GrayAt(x, 10).Y == 255 {
+			rowEdges++
+		}
+	}
+	if rowEdges != 2 {
+		t.Errorf("edges crossing the middle row = %d, want 2", rowEdges)
+	}
+	checkPixelValue(t, edges, 10, 10, 0)
+	checkPixelValue(t, edges, 1, 1, 0)
+
+	flat, _, _, err := CannyEdgeDetector(createTestImage(8, 8, nil), 1, 0.1, 0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countForeground(flat); got != 0 {
+		t.Errorf("flat image has %d edge pixels, want 0", got)
+	}
+
+	if _, _, _, err := CannyEdgeDetector(img, 1, 0.5, 0.2); err == nil {
+		t.Error("expected an error when the low threshold is above the high one")
+	}
+}
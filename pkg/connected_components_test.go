@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestLabelConnectedComponents(t *testing.T) {
+	img := createBinaryTestImage([]string{
+		"11....1",
+		"11...1.",
+		"....1..",
+		".1.....",
+		"111..11",
+		".1...11",
+	})
+
+	tests := []struct {
+		name         string
+		connectivity Connectivity
+		want         int
+	}{
+		{name: "4-connected", connectivity: FourConnectivity, want: 6},
+		{name: "8-connected", connectivity: EightConnectivity, want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, count, err := LabelConnectedComponents(img, tt.connectivity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.want {
+				t.Errorf("got %d components, want %d", count, tt.want)
+			}
+			if labels[0][0] != 1 || labels[1][1] != 1 || labels[3][0] != 0 {
+				t.Error("top left square should be component 1 on a background of 0")
+			}
+		})
+	}
+
+	if _, _, err := LabelConnectedComponents(img, 6); err == nil {
+		t.Error("expected an error for 6-connectivity")
+	}
+}
+
+func TestComponentStatistics(t *testing.T) {
+	// A 3x2 block of level 100 and 200 columns, and a single pixel
+	img := createBinaryTestImage([]string{
+		"......",
+		".111..",
+		".111..",
+		".....1",
+	})
+	labels, count, err := LabelConnectedComponents(img, EightConnectivity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("got %d components, want 2", count)
+	}
+
+	var values []uint8
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 6; x++ {
+			values = append(values, uint8(100*(x%2+1)))
+		}
+	}
+	statistics, err := ComponentStatistics(labels, createTestImage(6, 4, values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := statistics[0]
+	if block.Label != 1 || block.Area != 6 || block.BoundingBox != image.Rect(1, 1, 4, 3) {
+		t.Errorf("block = %+v, want label 1, area 6 and box (1,1)-(4,3)", block)
+	}
+	if block.CentroidX != 2 || block.CentroidY != 1.5 {
+		t.Errorf("centroid = (%v, %v), want (2, 1.5)", block.CentroidX, block.CentroidY)
+	}
+	if block.Perimeter != 6 {
+		t.Errorf("perimeter = %d, want 6", block.Perimeter)
+	}
+	// Columns 1 and 3 are at 200, column 2 at 100
+	if math.Abs(block.Mean-500.0/3) > 1e-9 || math.Abs(block.Variance-20000.0/9) > 1e-6 {
+		t.Errorf("mean and variance = %v and %v, want %v and %v", block.Mean, block.Variance, 500.0/3, 20000.0/9)
+	}
+	if statistics[1].Area != 1 || statistics[1].Variance != 0 {
+		t.Errorf("single pixel = %+v, want area 1 and no variance", statistics[1])
+	}
+
+	filtered, remaining, err := FilterComponentsByArea(labels, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 1 || filtered[5][3] != 0 || filtered[1][1] != 1 {
+		t.Errorf("area filter kept %d components, want only the block", remaining)
+	}
+	binary, err := LabelsToBinaryImage(filtered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countForeground(binary); got != 6 {
+		t.Errorf("binary image has %d foreground pixels, want 6", got)
+	}
+}
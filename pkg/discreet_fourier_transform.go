@@ -46,3 +46,140 @@ func DiscreetFourierTransform(img image.Image) (image.Image, error) {
 	}
 	return newImage, nil
 }
+
+func fastFourierTransform(values []complex128, inverse bool) []complex128 {
+	// 1-D DFT of any length, F(u) = sum f(x) exp(-j 2 pi u x / N). The inverse divides
+	// by N so the two are exact inverses. Powers of two use the radix-2 algorithm,
+	// other lengths Bluestein's algorithm on top of it.
+	var length int = len(values)
+	if length == 0 {
+		return nil
+	}
+	var result []complex128
+	if length&(length-1) == 0 {
+		result = radix2FFT(values, inverse)
+	} else {
+		result = bluesteinFFT(values, inverse)
+	}
+	if inverse {
+		for index := range result {
+			result[index] /= complex(float64(length), 0)
+		}
+	}
+	return result
+}
+
+func radix2FFT(values []complex128, inverse bool) []complex128 {
+	// Iterative Cooley-Tukey, the length must be a power of two. Not normalised.
+	var length int = len(values)
+	var result []complex128 = make([]complex128, length)
+	var bits int = 0
+	for 1<<bits < length {
+		bits++
+	}
+	for index, value := range values {
+		var reversed int = 0
+		for bit := 0; bit < bits; bit++ {
+			if index&(1<<bit) != 0 {
+				reversed |= 1 << (bits - 1 - bit)
+			}
+		}
+		result[reversed] = value
+	}
+
+	var sign float64 = -1
+	if inverse {
+		sign = 1
+	}
+	for size := 2; size <= length; size *= 2 {
+		angle := sign * 2 * math.Pi / float64(size)
+		step := complex(math.Cos(angle), math.Sin(angle))
+		for start := 0; start < length; start += size {
+			var twiddle complex128 = 1
+			for offset := 0; offset < size/2; offset++ {
+				even := result[start+offset]
+				odd := result[start+offset+size/2] * twiddle
+				result[start+offset] = even + odd
+				result[start+offset+size/2] = even - odd
+				twiddle *= step
+			}
+		}
+	}
+	return result
+}
+
+func bluesteinFFT(values []complex128, inverse bool) []complex128 {
+	// Rewrites the DFT as a convolution with the chirp exp(j pi x^2 / N), which is done
+	// with power of two FFTs. Not normalised.
+	var length int = len(values)
+	var sign float64 = -1
+	if inverse {
+		sign = 1
+	}
+	var chirp []complex128 = make([]complex128, length)
+	for index := range chirp {
+		// index^2 mod 2N keeps the angle accurate for long inputs
+		angle := sign * math.Pi * float64((index*index)%(2*length)) / float64(length)
+		chirp[index] = complex(math.Cos(angle), math.Sin(angle))
+	}
+
+	var size int = nextPowerOfTwo(2*length - 1)
+	var first []complex128 = make([]complex128, size)
+	var second []complex128 = make([]complex128, size)
+	for index, value := range values {
+		first[index] = value * chirp[index]
+	}
+	second[0] = complexConjugate(chirp[0])
+	for index := 1; index < length; index++ {
+		second[index] = complexConjugate(chirp[index])
+		second[size-index] = complexConjugate(chirp[index])
+	}
+
+	first = radix2FFT(first, false)
+	second = radix2FFT(second, false)
+	for index := range first {
+		first[index] *= second[index]
+	}
+	var convolved []complex128 = radix2FFT(first, true)
+
+	var result []complex128 = make([]complex128, length)
+	for index := range result {
+		result[index] = convolved[index] / complex(float64(size), 0) * chirp[index]
+	}
+	return result
+}
+
+func complexConjugate(value complex128) complex128 {
+	return complex(real(value), -imag(value))
+}
+
+func fourierTransform2D(values [][]complex128, inverse bool) [][]complex128 {
+	// The 2-D DFT is separable, 1-D transforms along x and then along y, Section 4.11.1
+	// of DIP book. values is indexed [x][y] and is transformed in place.
+	if len(values) == 0 || len(values[0]) == 0 {
+		return values
+	}
+	var width int = len(values)
+	var height int = len(values[0])
+	var column []complex128 = make([]complex128, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			column[x] = values[x][y]
+		}
+		for x, value := range fastFourierTransform(column, inverse) {
+			values[x][y] = value
+		}
+	}
+	for x := 0; x < width; x++ {
+		values[x] = fastFourierTransform(values[x], inverse)
+	}
+	return values
+}
+
+func nextPowerOfTwo(length int) int {
+	var size int = 1
+	for size < length {
+		size *= 2
+	}
+	return size
+}
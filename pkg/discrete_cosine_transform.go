@@ -0,0 +1,141 @@
+// Discrete cosine transform of any size, with a fast path for the 8x8 blocks of transform coding
+package pkg
+
+import (
+	"fmt"
+	"math"
+)
+
+// dct8Basis holds the orthonormal DCT basis for 8 samples, dct8Basis[u][x] = a(u) cos((2x + 1) u pi / 16)
+var dct8Basis [8][8]float64 = func() [8][8]float64 {
+	var basis [8][8]float64
+	for u, row := range dctMatrix(8) {
+		copy(basis[u][:], row)
+	}
+	return basis
+}()
+
+func dctMatrix(size int) [][]float64 {
+	// The orthonormal DCT-II basis, a(u) cos((2x + 1) u pi / 2n) with a(0) = sqrt(1/n)
+	// and a(u) = sqrt(2/n) otherwise, so that the inverse is the transpose
+	var matrix [][]float64 = newFloats(size, size)
+	for u := 0; u < size; u++ {
+		scale := math.Sqrt(2 / float64(size))
+		if u == 0 {
+			scale = math.Sqrt(1 / float64(size))
+		}
+		for x := 0; x < size; x++ {
+			matrix[u][x] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/float64(2*size))
+		}
+	}
+	return matrix
+}
+
+func dctBlock8(block *[8][8]float64, inverse bool) {
+	// Transforms block, indexed [x][y], in place along x and then y
+	var line [8]float64
+	for pass := 0; pass < 2; pass++ {
+		for index := 0; index < 8; index++ {
+			for output := 0; output < 8; output++ {
+				var sum float64 = 0
+				for input := 0; input < 8; input++ {
+					var value float64
+					if pass == 0 {
+						value = block[input][index]
+					} else {
+						value = block[index][input]
+					}
+					if inverse {
+						sum += dct8Basis[input][output] * value
+					} else {
+						sum += dct8Basis[output][input] * value
+					}
+				}
+				line[output] = sum
+			}
+			for output := 0; output < 8; output++ {
+				if pass == 0 {
+					block[output][index] = line[output]
+				} else {
+					block[index][output] = line[output]
+				}
+			}
+		}
+	}
+}
+
+func dctFloats(values [][]float64, inverse bool) [][]float64 {
+	// The separable 2-D transform of any size as two matrix products
+	var width, height int = len(values), len(values[0])
+	var alongX, alongY [][]float64 = dctMatrix(width), dctMatrix(height)
+	if inverse {
+		alongX, alongY = transposeFloats(alongX), transposeFloats(alongY)
+	}
+
+	var partial [][]float64 = newFloats(width, height)
+	for u := 0; u < width; u++ {
+		for x := 0; x < width; x++ {
+			weight := alongX[u][x]
+			for y := 0; y < height; y++ {
+				partial[u][y] += weight * values[x][y]
+			}
+		}
+	}
+	var result [][]float64 = newFloats(width, height)
+	for u := 0; u < width; u++ {
+		for v := 0; v < height; v++ {
+			var sum float64 = 0
+			for y := 0; y < height; y++ {
+				sum += alongY[v][y] * partial[u][y]
+			}
+			result[u][v] = sum
+		}
+	}
+	return result
+}
+
+func transposeFloats(values [][]float64) [][]float64 {
+	var transposed [][]float64 = newFloats(len(values[0]), len(values))
+	for x := range values {
+		for y := range values[x] {
+			transposed[y][x] = values[x][y]
+		}
+	}
+	return transposed
+}
+
+func transformCosine(values [][]float64, inverse bool) ([][]float64, error) {
+	if len(values) == 0 || len(values[0]) == 0 {
+		return nil, fmt.Errorf("empty values")
+	}
+	for x := range values {
+		if len(values[x]) != len(values[0]) {
+			return nil, fmt.Errorf("column %d has %d values, expected %d", x, len(values[x]), len(values[0]))
+		}
+	}
+	if len(values) != 8 || len(values[0]) != 8 {
+		return dctFloats(values, inverse), nil
+	}
+	var block [8][8]float64
+	for x := range block {
+		copy(block[x][:], values[x])
+	}
+	dctBlock8(&block, inverse)
+	var result [][]float64 = newFloats(8, 8)
+	for x := range block {
+		copy(result[x], block[x][:])
+	}
+	return result, nil
+}
+
+func DiscreteCosineTransform(values [][]float64) ([][]float64, error) {
+	// This is from Section 8.2.8 of DIP book
+	// The orthonormal 2-D DCT of values indexed [x][y], result indexed [u][v]. The
+	// transform is separable and computed directly, which is fine for blocks but
+	// quadratic in the size of each side.
+	return transformCosine(values, false)
+}
+
+func InverseDiscreteCosineTransform(coefficients [][]float64) ([][]float64, error) {
+	return transformCosine(coefficients, true)
+}
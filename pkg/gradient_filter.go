@@ -2,12 +2,25 @@
 package pkg
 
 import (
+	"fmt"
 	"image"
 	"image/color"
+	"math"
 )
 
 type GradientMask func() [][]int
 
+// Gradient holds the responses indexed [x][y]. Gx and Gy are the signed component
+// responses, Magnitude is sqrt(gx^2 + gy^2), L1Magnitude is |gx| + |gy| and Direction
+// is atan2(gy, gx) in radians, measured from the x axis towards the y axis.
+type Gradient struct {
+	Gx          [][]float64
+	Gy          [][]float64
+	Magnitude   [][]float64
+	L1Magnitude [][]float64
+	Direction   [][]float64
+}
+
 func GradientFilter(img image.Image, maskFn GradientMask) (image.Image, error) {
 	// TODO: Some of this is similar to smoothing spatial filter
 	// This is from Section 3.5.1 of DIP book
@@ -30,7 +43,11 @@ func GradientFilter(img image.Image, maskFn GradientMask) (image.Image, error) {
 				}
 			}
 
-			xPixels = append(xPixels, color.Gray{uint8(level)})
+			// The response is signed, casting it straight to uint8 would wrap negative values around
+			if level < 0 {
+				level = -level
+			}
+			xPixels = append(xPixels, color.Gray{clampLevel(level)})
 		}
 		pixels = append(pixels, xPixels)
 	}
@@ -71,3 +88,214 @@ func RobertsCrossOperator2() [][]int {
 		{1, 0},
 	}
 }
+
+func PrewittOperator1() [][]int {
+	return [][]int{
+		{-1, -1, -1},
+		{0, 0, 0},
+		{1, 1, 1},
+	}
+}
+
+func PrewittOperator2() [][]int {
+	return [][]int{
+		{-1, 0, 1},
+		{-1, 0, 1},
+		{-1, 0, 1},
+	}
+}
+
+func ScharrOperator1() [][]int {
+	return [][]int{
+		{-3, -10, -3},
+		{0, 0, 0},
+		{3, 10, 3},
+	}
+}
+
+func ScharrOperator2() [][]int {
+	return [][]int{
+		{-3, 0, 3},
+		{-10, 0, 10},
+		{-3, 0, 3},
+	}
+}
+
+func KirschCompassMasks() []GradientMask {
+	// This is from Figure 10.15 of DIP book
+	// Mask k responds most strongly to edges whose gradient points at k * 45 degrees,
+	// the 5s sit on the three neighbours around that direction and the rest are -3
+	var masks []GradientMask
+	for k := 0; k < 8; k++ {
+		direction := k
+		masks = append(masks, func() [][]int {
+			var mask [][]int = [][]int{{-3, -3, -3}, {-3, 0, -3}, {-3, -3, -3}}
+			for _, offset := range []int{-1, 0, 1} {
+				angle := float64(direction+offset) * math.Pi / 4
+				dx := int(math.Round(math.Cos(angle)))
+				dy := int(math.Round(math.Sin(angle)))
+				mask[dx+1][dy+1] = 5
+			}
+			return mask
+		})
+	}
+	return masks
+}
+
+func gradientFromComponents(gx [][]float64, gy [][]float64) Gradient {
+	var gradient Gradient = Gradient{
+		Gx:          gx,
+		Gy:          gy,
+		Magnitude:   newFloats(len(gx), len(gx[0])),
+		L1Magnitude: newFloats(len(gx), len(gx[0])),
+		Direction:   newFloats(len(gx), len(gx[0])),
+	}
+	for x := range gx {
+		for y := range gx[x] {
+			gradient.Magnitude[x][y] = math.Hypot(gx[x][y], gy[x][y])
+			gradient.L1Magnitude[x][y] = math.Abs(gx[x][y]) + math.Abs(gy[x][y])
+			gradient.Direction[x][y] = math.Atan2(gy[x][y], gx[x][y])
+		}
+	}
+	return gradient
+}
+
+func gradientOfFloats(values [][]float64, maskX GradientMask, maskY GradientMask) Gradient {
+	return gradientFromComponents(correlateFloats(values, intMaskToFloats(maskX())), correlateFloats(values, intMaskToFloats(maskY())))
+}
+
+func ComputeGradient(img image.Image, maskX GradientMask, maskY GradientMask) (Gradient, error) {
+	// This is from Section 10.2.5 of DIP book
+	// Runs both component masks, maskX for the derivative along x and maskY along y
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return Gradient{}, fmt.Errorf("empty image")
+	}
+	return gradientOfFloats(levelsToFloats(levels), maskX, maskY), nil
+}
+
+func SobelGradient(img image.Image) (Gradient, error) {
+	return ComputeGradient(img, SobelOperator1, SobelOperator2)
+}
+
+func PrewittGradient(img image.Image) (Gradient, error) {
+	return ComputeGradient(img, PrewittOperator1, PrewittOperator2)
+}
+
+func RobertsCrossGradient(img image.Image) (Gradient, error) {
+	// The Roberts masks take diagonal differences, so the direction is rotated by
+	// 45 degrees relative to the other operators
+	return ComputeGradient(img, RobertsCrossOperator1, RobertsCrossOperator2)
+}
+
+func ScharrGradient(img image.Image) (Gradient, error) {
+	return ComputeGradient(img, ScharrOperator1, ScharrOperator2)
+}
+
+func CompassGradient(img image.Image, masks []GradientMask) (Gradient, error) {
+	// This is from Section 10.2.5 of DIP book
+	// The magnitude is the strongest response over all the masks and the direction is the
+	// one of the winning mask, mask k pointing at k * 2pi / len(masks). Gx and Gy are the
+	// magnitude projected onto the axes so the struct stays consistent with the other operators.
+	if len(masks) == 0 {
+		return Gradient{}, fmt.Errorf("no compass masks given")
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return Gradient{}, fmt.Errorf("empty image")
+	}
+	var values [][]float64 = levelsToFloats(levels)
+
+	var responses [][][]float64
+	for _, maskFn := range masks {
+		responses = append(responses, correlateFloats(values, intMaskToFloats(maskFn())))
+	}
+
+	var gx [][]float64 = newFloats(len(values), len(values[0]))
+	var gy [][]float64 = newFloats(len(values), len(values[0]))
+	var gradient Gradient = Gradient{
+		Gx:          gx,
+		Gy:          gy,
+		Magnitude:   newFloats(len(values), len(values[0])),
+		L1Magnitude: newFloats(len(values), len(values[0])),
+		Direction:   newFloats(len(values), len(values[0])),
+	}
+	for x := range values {
+		for y := range values[x] {
+			var best int = 0
+			for k := range responses {
+				if responses[k][x][y] > responses[best][x][y] {
+					best = k
+				}
+			}
+			magnitude := math.Max(responses[best][x][y], 0)
+			direction := math.Atan2(math.Sin(2*math.Pi*float64(best)/float64(len(masks))), math.Cos(2*math.Pi*float64(best)/float64(len(masks))))
+			gx[x][y] = magnitude * math.Cos(direction)
+			gy[x][y] = magnitude * math.Sin(direction)
+			gradient.Magnitude[x][y] = magnitude
+			gradient.L1Magnitude[x][y] = math.Abs(gx[x][y]) + math.Abs(gy[x][y])
+			gradient.Direction[x][y] = direction
+		}
+	}
+	return gradient, nil
+}
+
+func GradientDirectionImage(gradient Gradient) (image.Image, error) {
+	// Colour codes the direction as hue and the magnitude as brightness, so flat
+	// areas are black and edges take the colour of their orientation
+	if len(gradient.Magnitude) == 0 || len(gradient.Magnitude[0]) == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty gradient")
+	}
+	var width int = len(gradient.Magnitude)
+	var height int = len(gradient.Magnitude[0])
+
+	var maximum float64 = 0
+	for x := range gradient.Magnitude {
+		for y := range gradient.Magnitude[x] {
+			maximum = math.Max(maximum, gradient.Magnitude[x][y])
+		}
+	}
+
+	newImage := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			var value float64 = 0
+			if maximum > 0 {
+				value = gradient.Magnitude[x][y] / maximum
+			}
+			hue := (gradient.Direction[x][y] + math.Pi) / (2 * math.Pi) * 360
+			newImage.Set(x, y, hsvToRGBA(hue, 1, value))
+		}
+	}
+	return newImage, nil
+}
+
+func hsvToRGBA(hue float64, saturation float64, value float64) color.RGBA {
+	// https://en.wikipedia.org/wiki/HSL_and_HSV#HSV_to_RGB
+	chroma := value * saturation
+	sector := math.Mod(hue/60, 6)
+	second := chroma * (1 - math.Abs(math.Mod(sector, 2)-1))
+
+	var red, green, blue float64
+	switch {
+	case sector < 1:
+		red, green = chroma, second
+	case sector < 2:
+		red, green = second, chroma
+	case sector < 3:
+		green, blue = chroma, second
+	case sector < 4:
+		green, blue = second, chroma
+	case sector < 5:
+		red, blue = second, chroma
+	default:
+		red, blue = chroma, second
+	}
+	offset := value - chroma
+	return color.RGBA{
+		uint8(math.Round((red + offset) * 255)),
+		uint8(math.Round((green + offset) * 255)),
+		uint8(math.Round((blue + offset) * 255)),
+		255,
+	}
+}
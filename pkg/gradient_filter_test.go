@@ -3,6 +3,7 @@ package pkg
 import (
 	"image"
 	"image/color"
+	"math"
 	"testing"
 )
 
@@ -137,3 +138,106 @@ func compareMatrices(a, b [][]int) bool {
 	}
 	return true
 }
+
+func TestGradientFilterDoesNotWrapNegativeResponses(t *testing.T) {
+	// Intensity falls along x, so the x derivative is negative everywhere inside
+	img := createTestImage(3, 3, []uint8{
+		200, 100, 0,
+		200, 100, 0,
+		200, 100, 0,
+	})
+
+	got, err := GradientFilter(img, SobelOperator1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (1*0 + 2*0 + 1*0) - (1*200 + 2*200 + 1*200) = -800, clamped to 255 instead of wrapping
+	checkPixelValue(t, got, 1, 1, 255)
+}
+
+func TestComputeGradient(t *testing.T) {
+	img := createTestImage(5, 5, []uint8{
+		0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0,
+		90, 90, 90, 90, 90,
+		90, 90, 90, 90, 90,
+	})
+
+	tests := []struct {
+		name     string
+		gradient func(image.Image) (Gradient, error)
+	}{
+		{"Sobel", SobelGradient},
+		{"Prewitt", PrewittGradient},
+		{"Scharr", ScharrGradient},
+		{"Kirsch", func(img image.Image) (Gradient, error) { return CompassGradient(img, KirschCompassMasks()) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gradient, err := tt.gradient(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The step runs along y, so the gradient points along +y
+			if gradient.Magnitude[2][2] <= 0 {
+				t.Errorf("magnitude at the edge = %v, want positive", gradient.Magnitude[2][2])
+			}
+			if math.Abs(gradient.Direction[2][2]-math.Pi/2) > 1e-9 {
+				t.Errorf("direction at the edge = %v, want pi/2", gradient.Direction[2][2])
+			}
+			if math.Abs(gradient.Gx[2][2]) > 1e-9 {
+				t.Errorf("gx at the edge = %v, want 0", gradient.Gx[2][2])
+			}
+			if gradient.Magnitude[2][0] != 0 {
+				t.Errorf("magnitude in the flat area = %v, want 0", gradient.Magnitude[2][0])
+			}
+			if gradient.L1Magnitude[2][2] < gradient.Magnitude[2][2] {
+				t.Errorf("L1 magnitude %v is below the L2 magnitude %v", gradient.L1Magnitude[2][2], gradient.Magnitude[2][2])
+			}
+		})
+	}
+
+	if _, err := CompassGradient(img, nil); err == nil {
+		t.Error("expected an error without compass masks")
+	}
+}
+
+func TestKirschCompassMasks(t *testing.T) {
+	masks := KirschCompassMasks()
+	if len(masks) != 8 {
+		t.Fatalf("got %d masks, want 8", len(masks))
+	}
+	if !compareMatrices(masks[0](), [][]int{{-3, -3, -3}, {-3, 0, -3}, {5, 5, 5}}) {
+		t.Errorf("first mask = %v", masks[0]())
+	}
+	for index, maskFn := range masks {
+		var sum int = 0
+		for _, row := range maskFn() {
+			for _, cell := range row {
+				sum += cell
+			}
+		}
+		if sum != 0 {
+			t.Errorf("mask %d sums to %d, want 0", index, sum)
+		}
+	}
+}
+
+func TestGradientDirectionImage(t *testing.T) {
+	gradient, err := SobelGradient(createTestImage(4, 4, []uint8{0, 0, 255, 255, 0, 0, 255, 255, 0, 0, 255, 255, 0, 0, 255, 255}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	visualisation, err := GradientDirectionImage(gradient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visualisation.Bounds().Dx() != 4 || visualisation.Bounds().Dy() != 4 {
+		t.Errorf("visualisation size = %v, want 4x4", visualisation.Bounds())
+	}
+	if r, g, b, _ := visualisation.At(1, 1).RGBA(); r == 0 && g == 0 && b == 0 {
+		t.Error("edge pixel is black in the direction visualisation")
+	}
+}
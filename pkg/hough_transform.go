@@ -0,0 +1,600 @@
+// Hough transform for lines, circles and arbitrary shapes on binary edge images
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+// HoughLineAccumulator is the rho-theta parameter space of the line Hough transform.
+// Votes is indexed [theta index][rho index], so that as an image theta runs along x
+// and rho along y like the figures in the book. Thetas are in radians.
+type HoughLineAccumulator struct {
+	Votes  [][]int
+	Thetas []float64
+	Rhos   []float64
+}
+
+// HoughLine is a detected line x cos(theta) + y sin(theta) = rho
+type HoughLine struct {
+	Rho   float64
+	Theta float64
+	Votes int
+}
+
+// LineSegment is a run of edge pixels along a detected line
+type LineSegment struct {
+	Start image.Point
+	End   image.Point
+	Line  HoughLine
+}
+
+// HoughCircleAccumulator holds the local maxima of the x-y accumulator of every
+// radius, which are the only cells that can be peaks, rather than one accumulator
+// per radius. Votes is the most votes any radius gave each centre, indexed [x][y].
+type HoughCircleAccumulator struct {
+	Candidates []HoughCircle
+	Votes      [][]int
+	Radii      []int
+}
+
+// HoughCircle is a detected circle. Coverage is the fraction of the circle's
+// pixels that voted for it, which makes circles of different radii comparable.
+type HoughCircle struct {
+	Centre   image.Point
+	Radius   int
+	Votes    int
+	Coverage float64
+}
+
+// GeneralisedHoughTemplate is the R-table of a shape. Edge points are grouped by
+// the orientation of the edge through them and each entry is the displacement
+// from the edge point to the reference point.
+type GeneralisedHoughTemplate struct {
+	RTable    [][]image.Point
+	Points    []image.Point
+	Reference image.Point
+}
+
+// GeneralisedHoughMatch is a position of the template's reference point in the image
+type GeneralisedHoughMatch struct {
+	Reference image.Point
+	Votes     int
+}
+
+func edgePoints(edges [][]bool) []image.Point {
+	var points []image.Point
+	for x := range edges {
+		for y := range edges[x] {
+			if edges[x][y] {
+				points = append(points, image.Point{x, y})
+			}
+		}
+	}
+	return points
+}
+
+func HoughLineTransform(img image.Image, thetaStep float64, rhoStep float64) (HoughLineAccumulator, error) {
+	// This is from Section 10.2.7 of DIP book
+	// Every edge pixel votes for all the lines rho = x cos(theta) + y sin(theta) through it,
+	// with theta in [-90, 90) degrees and rho in [-D, D] where D is the image diagonal.
+	// thetaStep is in degrees and rhoStep in pixels.
+	if thetaStep <= 0 || rhoStep <= 0 {
+		return HoughLineAccumulator{}, fmt.Errorf("theta and rho steps must be greater than 0, got %v and %v", thetaStep, rhoStep)
+	}
+	var edges [][]bool = imageToBinary(img)
+	if len(edges) == 0 || len(edges[0]) == 0 {
+		return HoughLineAccumulator{}, fmt.Errorf("empty image")
+	}
+	var width int = len(edges)
+	var height int = len(edges[0])
+
+	var diagonal float64 = math.Hypot(float64(width-1), float64(height-1))
+	var rhoOffset int = int(math.Ceil(diagonal / rhoStep))
+	var accumulator HoughLineAccumulator
+	for theta := -90.0; theta < 90; theta += thetaStep {
+		accumulator.Thetas = append(accumulator.Thetas, theta*math.Pi/180)
+	}
+	for index := 0; index <= 2*rhoOffset; index++ {
+		accumulator.Rhos = append(accumulator.Rhos, float64(index-rhoOffset)*rhoStep)
+	}
+	accumulator.Votes = make([][]int, len(accumulator.Thetas))
+	for index := range accumulator.Votes {
+		accumulator.Votes[index] = make([]int, len(accumulator.Rhos))
+	}
+
+	var cosines []float64 = make([]float64, len(accumulator.Thetas))
+	var sines []float64 = make([]float64, len(accumulator.Thetas))
+	for index, theta := range accumulator.Thetas {
+		cosines[index] = math.Cos(theta)
+		sines[index] = math.Sin(theta)
+	}
+
+	for _, point := range edgePoints(edges) {
+		for index := range accumulator.Thetas {
+			rho := float64(point.X)*cosines[index] + float64(point.Y)*sines[index]
+			accumulator.Votes[index][int(math.Round(rho/rhoStep))+rhoOffset]++
+		}
+	}
+	return accumulator, nil
+}
+
+func accumulatorPeaks(votes [][]int, count int, minimumVotes int, neighbourhood int) []image.Point {
+	// Repeatedly picks the largest cell and clears the (2 neighbourhood + 1)^2 cells
+	// around it, so one strong peak does not return its own shoulders. A minimum of
+	// zero or less uses half of the largest vote, like MATLAB's houghpeaks.
+	var maximum int = 0
+	for x := range votes {
+		for y := range votes[x] {
+			if votes[x][y] > maximum {
+				maximum = votes[x][y]
+			}
+		}
+	}
+	if minimumVotes <= 0 {
+		minimumVotes = (maximum + 1) / 2
+	}
+	if maximum == 0 || maximum < minimumVotes {
+		return nil
+	}
+
+	var suppressed [][]bool = newBinary(len(votes), len(votes[0]))
+	var peaks []image.Point
+	for len(peaks) < count {
+		var best image.Point
+		var bestVotes int = 0
+		for x := range votes {
+			for y := range votes[x] {
+				if !suppressed[x][y] && votes[x][y] > bestVotes {
+					best = image.Point{x, y}
+					bestVotes = votes[x][y]
+				}
+			}
+		}
+		if bestVotes < minimumVotes || bestVotes == 0 {
+			break
+		}
+		peaks = append(peaks, best)
+
+		for x := best.X - neighbourhood; x <= best.X+neighbourhood; x++ {
+			for y := best.Y - neighbourhood; y <= best.Y+neighbourhood; y++ {
+				if x >= 0 && y >= 0 && x < len(votes) && y < len(votes[0]) {
+					suppressed[x][y] = true
+				}
+			}
+		}
+	}
+	return peaks
+}
+
+func HoughLinePeaks(accumulator HoughLineAccumulator, count int, minimumVotes int, neighbourhood int) ([]HoughLine, error) {
+	// Returns up to count lines in decreasing order of votes. neighbourhood is the
+	// half size, in accumulator cells, of the area cleared around each peak.
+	if len(accumulator.Votes) == 0 {
+		return nil, fmt.Errorf("empty accumulator")
+	}
+	if count < 1 || neighbourhood < 0 {
+		return nil, fmt.Errorf("invalid peak count %d or neighbourhood %d", count, neighbourhood)
+	}
+	var lines []HoughLine
+	for _, peak := range accumulatorPeaks(accumulator.Votes, count, minimumVotes, neighbourhood) {
+		lines = append(lines, HoughLine{
+			Rho:   accumulator.Rhos[peak.Y],
+			Theta: accumulator.Thetas[peak.X],
+			Votes: accumulator.Votes[peak.X][peak.Y],
+		})
+	}
+	return lines, nil
+}
+
+func HoughLineSegments(img image.Image, accumulator HoughLineAccumulator, lines []HoughLine, fillGap float64, minimumLength float64) ([]LineSegment, error) {
+	// This is from Section 10.2.7 of DIP book
+	// The edge pixels that fall in each line's accumulator cell are ordered along the line,
+	// gaps of at most fillGap pixels are bridged and segments shorter than minimumLength
+	// are dropped
+	if fillGap < 0 || minimumLength < 0 {
+		return nil, fmt.Errorf("fill gap and minimum length must not be negative, got %v and %v", fillGap, minimumLength)
+	}
+	if len(accumulator.Rhos) < 2 {
+		return nil, fmt.Errorf("accumulator has no rho resolution")
+	}
+	var edges [][]bool = imageToBinary(img)
+	if len(edges) == 0 || len(edges[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	var rhoStep float64 = accumulator.Rhos[1] - accumulator.Rhos[0]
+	var points []image.Point = edgePoints(edges)
+
+	var segments []LineSegment
+	for _, line := range lines {
+		cosine, sine := math.Cos(line.Theta), math.Sin(line.Theta)
+		var bin float64 = math.Round(line.Rho / rhoStep)
+		var onLine []image.Point
+		for _, point := range points {
+			rho := float64(point.X)*cosine + float64(point.Y)*sine
+			if math.Round(rho/rhoStep) == bin {
+				onLine = append(onLine, point)
+			}
+		}
+		if len(onLine) == 0 {
+			continue
+		}
+
+		// Position along the line direction (-sin(theta), cos(theta))
+		position := func(point image.Point) float64 {
+			return -float64(point.X)*sine + float64(point.Y)*cosine
+		}
+		sort.Slice(onLine, func(i, j int) bool {
+			return position(onLine[i]) < position(onLine[j])
+		})
+
+		var start int = 0
+		for index := 1; index <= len(onLine); index++ {
+			if index < len(onLine) && distance(onLine[index], onLine[index-1]) <= fillGap+1 {
+				continue
+			}
+			if distance(onLine[start], onLine[index-1]) >= minimumLength {
+				segments = append(segments, LineSegment{Start: onLine[start], End: onLine[index-1], Line: line})
+			}
+			start = index
+		}
+	}
+	return segments, nil
+}
+
+func distance(a image.Point, b image.Point) float64 {
+	return math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y))
+}
+
+func circleOffsets(radius int) []image.Point {
+	// Distinct pixel offsets on a digital circle of the given radius
+	var seen map[image.Point]bool = make(map[image.Point]bool)
+	var offsets []image.Point
+	var steps int = 8 * (radius + 1)
+	for step := 0; step < steps; step++ {
+		angle := 2 * math.Pi * float64(step) / float64(steps)
+		offset := image.Point{int(math.Round(float64(radius) * math.Cos(angle))), int(math.Round(float64(radius) * math.Sin(angle)))}
+		if !seen[offset] {
+			seen[offset] = true
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets
+}
+
+func HoughCircleTransform(img image.Image, minimumRadius int, maximumRadius int) (HoughCircleAccumulator, error) {
+	// Every edge pixel votes for all the centres (a, b) at distance r from it,
+	// (x - a)^2 + (y - b)^2 = r^2, for each radius in the range. The radii are voted
+	// one at a time in the same x-y accumulator and only its local maxima are kept.
+	if minimumRadius < 1 || maximumRadius < minimumRadius {
+		return HoughCircleAccumulator{}, fmt.Errorf("invalid radius range %d to %d", minimumRadius, maximumRadius)
+	}
+	var edges [][]bool = imageToBinary(img)
+	if len(edges) == 0 || len(edges[0]) == 0 {
+		return HoughCircleAccumulator{}, fmt.Errorf("empty image")
+	}
+	var width int = len(edges)
+	var height int = len(edges[0])
+	var points []image.Point = edgePoints(edges)
+
+	var accumulator HoughCircleAccumulator = HoughCircleAccumulator{Votes: newLabels(width, height)}
+	var votes [][]int = newLabels(width, height)
+	for radius := minimumRadius; radius <= maximumRadius; radius++ {
+		var offsets []image.Point = circleOffsets(radius)
+		for _, offset := range offsets {
+			for _, point := range points {
+				centreX, centreY := point.X-offset.X, point.Y-offset.Y
+				if centreX >= 0 && centreY >= 0 && centreX < width && centreY < height {
+					votes[centreX][centreY]++
+				}
+			}
+		}
+		for x := range votes {
+			for y := range votes[x] {
+				if votes[x][y] > accumulator.Votes[x][y] {
+					accumulator.Votes[x][y] = votes[x][y]
+				}
+				if isLocalMaximum(votes, x, y) {
+					accumulator.Candidates = append(accumulator.Candidates, HoughCircle{
+						Centre:   image.Point{x, y},
+						Radius:   radius,
+						Votes:    votes[x][y],
+						Coverage: float64(votes[x][y]) / float64(len(offsets)),
+					})
+				}
+			}
+		}
+		for x := range votes {
+			for y := range votes[x] {
+				votes[x][y] = 0
+			}
+		}
+		accumulator.Radii = append(accumulator.Radii, radius)
+	}
+	return accumulator, nil
+}
+
+func isLocalMaximum(votes [][]int, x int, y int) bool {
+	// At least as many votes as the 8 neighbours, and more than those before it in the
+	// scan, so that no two neighbouring cells of a plateau are both kept
+	if votes[x][y] == 0 {
+		return false
+	}
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			nx, ny := x+dx, y+dy
+			if (dx == 0 && dy == 0) || nx < 0 || ny < 0 || nx >= len(votes) || ny >= len(votes[0]) {
+				continue
+			}
+			if votes[nx][ny] > votes[x][y] || (votes[nx][ny] == votes[x][y] && (dx < 0 || (dx == 0 && dy < 0))) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func HoughCirclePeaks(accumulator HoughCircleAccumulator, count int, minimumCoverage float64, neighbourhood int) ([]HoughCircle, error) {
+	// Returns up to count circles in decreasing order of coverage. Circles whose centre
+	// and radius are both within neighbourhood of a stronger one are suppressed.
+	if len(accumulator.Radii) == 0 {
+		return nil, fmt.Errorf("empty accumulator")
+	}
+	if count < 1 || neighbourhood < 0 || minimumCoverage < 0 || minimumCoverage > 1 {
+		return nil, fmt.Errorf("invalid peak count %d, neighbourhood %d or coverage %v", count, neighbourhood, minimumCoverage)
+	}
+
+	var candidates []HoughCircle
+	for _, candidate := range accumulator.Candidates {
+		if candidate.Coverage >= minimumCoverage {
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Coverage > candidates[j].Coverage
+	})
+
+	var circles []HoughCircle
+	for _, candidate := range candidates {
+		if len(circles) == count {
+			break
+		}
+		var suppressed bool = false
+		for _, circle := range circles {
+			if absInt(candidate.Centre.X-circle.Centre.X) <= neighbourhood && absInt(candidate.Centre.Y-circle.Centre.Y) <= neighbourhood && absInt(candidate.Radius-circle.Radius) <= neighbourhood {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			circles = append(circles, candidate)
+		}
+	}
+	return circles, nil
+}
+
+func absInt(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func edgeOrientation(edges [][]bool, x int, y int, radius int) float64 {
+	// Orientation of the edge through (x, y) in [0, pi), the principal direction of the
+	// edge pixels around it. Only the binary edge map is needed, no grey level gradient.
+	var sumX, sumY, sumXX, sumYY, sumXY, count float64
+	for dx := -radius; dx <= radius; dx++ {
+		for dy := -radius; dy <= radius; dy++ {
+			nx, ny := x+dx, y+dy
+			if nx < 0 || ny < 0 || nx >= len(edges) || ny >= len(edges[0]) || !edges[nx][ny] {
+				continue
+			}
+			sumX += float64(dx)
+			sumY += float64(dy)
+			sumXX += float64(dx * dx)
+			sumYY += float64(dy * dy)
+			sumXY += float64(dx * dy)
+			count++
+		}
+	}
+	covarianceXX := sumXX/count - (sumX/count)*(sumX/count)
+	covarianceYY := sumYY/count - (sumY/count)*(sumY/count)
+	covarianceXY := sumXY/count - (sumX/count)*(sumY/count)
+	orientation := 0.5 * math.Atan2(2*covarianceXY, covarianceXX-covarianceYY)
+	if orientation < 0 {
+		orientation += math.Pi
+	}
+	return orientation
+}
+
+func orientationBin(orientation float64, bins int) int {
+	bin := int(orientation / math.Pi * float64(bins))
+	if bin >= bins {
+		bin = bins - 1
+	}
+	return bin
+}
+
+func NewGeneralisedHoughTemplate(template image.Image, bins int) (GeneralisedHoughTemplate, error) {
+	// Builds the R-table of a binary edge image of the shape. The reference point is the
+	// centroid of the edge pixels and orientations are quantised into bins over [0, 180).
+	if bins < 1 {
+		return GeneralisedHoughTemplate{}, fmt.Errorf("bins must be at least 1, got %d", bins)
+	}
+	var edges [][]bool = imageToBinary(template)
+	var points []image.Point = edgePoints(edges)
+	if len(points) == 0 {
+		return GeneralisedHoughTemplate{}, fmt.Errorf("template has no edge pixels")
+	}
+
+	var sumX, sumY int
+	for _, point := range points {
+		sumX += point.X
+		sumY += point.Y
+	}
+	var shape GeneralisedHoughTemplate = GeneralisedHoughTemplate{
+		RTable:    make([][]image.Point, bins),
+		Reference: image.Point{int(math.Round(float64(sumX) / float64(len(points)))), int(math.Round(float64(sumY) / float64(len(points))))},
+	}
+	for _, point := range points {
+		bin := orientationBin(edgeOrientation(edges, point.X, point.Y, 2), bins)
+		shape.RTable[bin] = append(shape.RTable[bin], shape.Reference.Sub(point))
+		shape.Points = append(shape.Points, point.Sub(shape.Reference))
+	}
+	return shape, nil
+}
+
+func GeneralisedHoughTransform(img image.Image, template GeneralisedHoughTemplate) ([][]int, error) {
+	// Every edge pixel looks up the displacements stored for its orientation and votes
+	// for the reference points they lead to. Returns the accumulator indexed [x][y].
+	if len(template.RTable) == 0 {
+		return nil, fmt.Errorf("empty template")
+	}
+	var edges [][]bool = imageToBinary(img)
+	if len(edges) == 0 || len(edges[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	var width int = len(edges)
+	var height int = len(edges[0])
+	var votes [][]int = make([][]int, width)
+	for x := range votes {
+		votes[x] = make([]int, height)
+	}
+
+	for _, point := range edgePoints(edges) {
+		bin := orientationBin(edgeOrientation(edges, point.X, point.Y, 2), len(template.RTable))
+		for _, displacement := range template.RTable[bin] {
+			reference := point.Add(displacement)
+			if reference.X >= 0 && reference.Y >= 0 && reference.X < width && reference.Y < height {
+				votes[reference.X][reference.Y]++
+			}
+		}
+	}
+	return votes, nil
+}
+
+func GeneralisedHoughPeaks(votes [][]int, count int, minimumVotes int, neighbourhood int) ([]GeneralisedHoughMatch, error) {
+	// Returns up to count template positions in decreasing order of votes
+	if len(votes) == 0 || len(votes[0]) == 0 {
+		return nil, fmt.Errorf("empty accumulator")
+	}
+	if count < 1 || neighbourhood < 0 {
+		return nil, fmt.Errorf("invalid peak count %d or neighbourhood %d", count, neighbourhood)
+	}
+	var matches []GeneralisedHoughMatch
+	for _, peak := range accumulatorPeaks(votes, count, minimumVotes, neighbourhood) {
+		matches = append(matches, GeneralisedHoughMatch{Reference: peak, Votes: votes[peak.X][peak.Y]})
+	}
+	return matches, nil
+}
+
+func HoughAccumulatorImage(votes [][]int) (image.Image, error) {
+	// Scales the votes to 0..255 for display
+	var values [][]float64 = make([][]float64, len(votes))
+	for x := range votes {
+		values[x] = make([]float64, len(votes[x]))
+		for y := range votes[x] {
+			values[x][y] = float64(votes[x][y])
+		}
+	}
+	return FloatsToImage(values)
+}
+
+func imageToRGBA(img image.Image) *image.RGBA {
+	// Copies the image so that its top left corner is at the origin
+	bounds := img.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), img, bounds.Min, draw.Src)
+	return canvas
+}
+
+func drawLine(canvas *image.RGBA, from image.Point, to image.Point, colour color.Color) {
+	// Bresenham's line algorithm, pixels outside the canvas are skipped
+	dx, dy := absInt(to.X-from.X), -absInt(to.Y-from.Y)
+	stepX, stepY := 1, 1
+	if from.X > to.X {
+		stepX = -1
+	}
+	if from.Y > to.Y {
+		stepY = -1
+	}
+	var errorTerm int = dx + dy
+	x, y := from.X, from.Y
+	for {
+		if (image.Point{x, y}).In(canvas.Bounds()) {
+			canvas.Set(x, y, colour)
+		}
+		if x == to.X && y == to.Y {
+			return
+		}
+		doubled := 2 * errorTerm
+		if doubled >= dy {
+			errorTerm += dy
+			x += stepX
+		}
+		if doubled <= dx {
+			errorTerm += dx
+			y += stepY
+		}
+	}
+}
+
+func DrawHoughLines(img image.Image, lines []HoughLine, colour color.Color) (image.Image, error) {
+	// Draws each line across the whole image
+	canvas := imageToRGBA(img)
+	bounds := canvas.Bounds()
+	var length float64 = math.Hypot(float64(bounds.Dx()), float64(bounds.Dy()))
+	var limit int = bounds.Dx() + bounds.Dy()
+	for _, line := range lines {
+		cosine, sine := math.Cos(line.Theta), math.Sin(line.Theta)
+		// Closest point of the line to the origin, then out along the line both ways
+		x0, y0 := line.Rho*cosine, line.Rho*sine
+		from := image.Point{int(math.Round(x0 + length*sine)), int(math.Round(y0 - length*cosine))}
+		to := image.Point{int(math.Round(x0 - length*sine)), int(math.Round(y0 + length*cosine))}
+		if absInt(from.X) > 2*limit || absInt(from.Y) > 2*limit || absInt(to.X) > 2*limit || absInt(to.Y) > 2*limit {
+			continue
+		}
+		drawLine(canvas, from, to, colour)
+	}
+	return canvas, nil
+}
+
+func DrawLineSegments(img image.Image, segments []LineSegment, colour color.Color) (image.Image, error) {
+	canvas := imageToRGBA(img)
+	for _, segment := range segments {
+		drawLine(canvas, segment.Start, segment.End, colour)
+	}
+	return canvas, nil
+}
+
+func DrawHoughCircles(img image.Image, circles []HoughCircle, colour color.Color) (image.Image, error) {
+	canvas := imageToRGBA(img)
+	for _, circle := range circles {
+		for _, offset := range circleOffsets(circle.Radius) {
+			point := circle.Centre.Add(offset)
+			if point.In(canvas.Bounds()) {
+				canvas.Set(point.X, point.Y, colour)
+			}
+		}
+	}
+	return canvas, nil
+}
+
+func DrawGeneralisedHoughMatches(img image.Image, template GeneralisedHoughTemplate, matches []GeneralisedHoughMatch, colour color.Color) (image.Image, error) {
+	// Overlays the template's edge pixels at every match
+	canvas := imageToRGBA(img)
+	for _, match := range matches {
+		for _, offset := range template.Points {
+			point := match.Reference.Add(offset)
+			if point.In(canvas.Bounds()) {
+				canvas.Set(point.X, point.Y, colour)
+			}
+		}
+	}
+	return canvas, nil
+}
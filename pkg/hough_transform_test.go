@@ -0,0 +1,187 @@
+package pkg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func createEdgeTestImage(width int, height int, points []image.Point) image.Image {
+	var values []uint8 = make([]uint8, width*height)
+	for _, point := range points {
+		values[point.Y*width+point.X] = 255
+	}
+	return createTestImage(width, height, values)
+}
+
+func TestHoughLines(t *testing.T) {
+	// A horizontal line at y = 5 with a gap, and a vertical line at x = 15
+	var points []image.Point
+	for x := 1; x < 12; x++ {
+		if x != 6 && x != 7 {
+			points = append(points, image.Point{x, 5})
+		}
+	}
+	for y := 0; y < 16; y++ {
+		points = append(points, image.Point{15, y})
+	}
+	img := createEdgeTestImage(20, 16, points)
+
+	accumulator, err := HoughLineTransform(img, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accumulator.Thetas) != 180 || len(accumulator.Votes) != 180 {
+		t.Errorf("got %d thetas, want 180", len(accumulator.Thetas))
+	}
+
+	lines, err := HoughLinePeaks(accumulator, 2, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	// The vertical line has more pixels so it comes first. A short line gets the same
+	// votes over a few neighbouring angles, so allow a couple of degrees.
+	if math.Abs(lines[0].Theta) > 2*math.Pi/180 || lines[0].Rho != 15 || lines[0].Votes != 16 {
+		t.Errorf("first line = %+v, want theta 0, rho 15 with 16 votes", lines[0])
+	}
+	if math.Abs(lines[1].Theta+math.Pi/2) > 2*math.Pi/180 || lines[1].Rho != -5 {
+		t.Errorf("second line = %+v, want theta -pi/2, rho -5", lines[1])
+	}
+
+	// A gap of two pixels splits the horizontal line unless it is filled
+	segments, err := HoughLineSegments(img, accumulator, lines[1:], 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 {
+		t.Errorf("got %d segments with a fill gap of 1, want 2", len(segments))
+	}
+	segments, err = HoughLineSegments(img, accumulator, lines[1:], 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("got %d segments with a fill gap of 2, want 1", len(segments))
+	}
+	ends := map[image.Point]bool{segments[0].Start: true, segments[0].End: true}
+	if !ends[image.Point{1, 5}] || !ends[image.Point{11, 5}] {
+		t.Errorf("segment = %v to %v, want (1,5) to (11,5)", segments[0].Start, segments[0].End)
+	}
+
+	drawn, err := DrawHoughLines(createTestImage(20, 16, nil), lines[:1], color.White)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, drawn, 15, 0, 255)
+	checkPixelValue(t, drawn, 15, 15, 255)
+	checkPixelValue(t, drawn, 14, 8, 0)
+
+	if _, err := HoughLineTransform(img, 0, 1); err == nil {
+		t.Error("expected an error for a zero theta step")
+	}
+}
+
+func TestHoughCircles(t *testing.T) {
+	var points []image.Point
+	for _, offset := range circleOffsets(6) {
+		points = append(points, image.Point{12, 10}.Add(offset))
+	}
+	img := createEdgeTestImage(25, 22, points)
+
+	accumulator, err := HoughCircleTransform(img, 4, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accumulator.Radii) != 5 {
+		t.Errorf("got %d radii, want 5", len(accumulator.Radii))
+	}
+	if accumulator.Votes[12][10] != len(circleOffsets(6)) {
+		t.Errorf("centre has %d votes, want %d", accumulator.Votes[12][10], len(circleOffsets(6)))
+	}
+	// Only local maxima are kept, so no two candidates of a radius are neighbours
+	for i, first := range accumulator.Candidates {
+		for _, second := range accumulator.Candidates[i+1:] {
+			if first.Radius == second.Radius && absInt(first.Centre.X-second.Centre.X) <= 1 && absInt(first.Centre.Y-second.Centre.Y) <= 1 {
+				t.Fatalf("candidates %+v and %+v are neighbours", first, second)
+			}
+		}
+	}
+	circles, err := HoughCirclePeaks(accumulator, 1, 0.5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(circles) != 1 {
+		t.Fatalf("got %d circles, want 1", len(circles))
+	}
+	if circles[0].Centre != (image.Point{12, 10}) || circles[0].Radius != 6 || circles[0].Coverage != 1 {
+		t.Errorf("circle = %+v, want centre (12,10), radius 6 and full coverage", circles[0])
+	}
+
+	drawn, err := DrawHoughCircles(createTestImage(25, 22, nil), circles, color.White)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, drawn, 18, 10, 255)
+	checkPixelValue(t, drawn, 12, 10, 0)
+
+	if _, err := HoughCircleTransform(img, 5, 4); err == nil {
+		t.Error("expected an error for an empty radius range")
+	}
+}
+
+func TestGeneralisedHough(t *testing.T) {
+	// An L shaped outline, found twice in a larger image
+	shape := []image.Point{}
+	for i := 0; i < 6; i++ {
+		shape = append(shape, image.Point{0, i}, image.Point{i, 5})
+	}
+	shape = append(shape, image.Point{6, 5}, image.Point{0, 6})
+
+	template, err := NewGeneralisedHoughTemplate(createEdgeTestImage(8, 8, shape), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var points []image.Point
+	for _, origin := range []image.Point{{2, 3}, {18, 10}} {
+		for _, point := range shape {
+			points = append(points, origin.Add(point))
+		}
+	}
+	img := createEdgeTestImage(30, 20, points)
+
+	votes, err := GeneralisedHoughTransform(img, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := GeneralisedHoughPeaks(votes, 2, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(matches))
+	}
+	found := map[image.Point]bool{}
+	for _, match := range matches {
+		found[match.Reference.Sub(template.Reference)] = true
+	}
+	if !found[image.Point{2, 3}] || !found[image.Point{18, 10}] {
+		t.Errorf("matches = %+v, want the shape at (2,3) and (18,10)", matches)
+	}
+
+	accumulatorImage, err := HoughAccumulatorImage(votes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accumulatorImage.Bounds().Dx() != 30 || accumulatorImage.Bounds().Dy() != 20 {
+		t.Errorf("accumulator image bounds = %v, want 30x20", accumulatorImage.Bounds())
+	}
+
+	if _, err := NewGeneralisedHoughTemplate(createTestImage(4, 4, nil), 8); err == nil {
+		t.Error("expected an error for a template without edges")
+	}
+}
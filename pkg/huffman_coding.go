@@ -0,0 +1,271 @@
+// Huffman coding of grey levels as a streaming encoder and decoder
+package pkg
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// endOfStreamSymbol is the extra symbol that ends a Huffman or arithmetic stream
+const endOfStreamSymbol int = 256
+
+// huffmanLengthBits is the size of each code length in the stream header
+const huffmanLengthBits uint = 6
+
+// HuffmanCode is a prefix code for the 256 grey levels and an end of stream symbol.
+// Lengths holds the code length of every symbol, 0 for those that do not occur, and
+// the codes themselves are the canonical ones for those lengths, so the lengths are
+// all a decoder needs.
+type HuffmanCode struct {
+	Lengths []int
+	codes   []uint64
+}
+
+// huffmanNode is a subtree while the code is built, symbols lists its leaves
+type huffmanNode struct {
+	count   int
+	symbols []int
+}
+
+type huffmanQueue []huffmanNode
+
+func (queue huffmanQueue) Len() int { return len(queue) }
+func (queue huffmanQueue) Less(i, j int) bool {
+	// Ties go to the subtree with the smaller first symbol so the code is repeatable
+	if queue[i].count != queue[j].count {
+		return queue[i].count < queue[j].count
+	}
+	return queue[i].symbols[0] < queue[j].symbols[0]
+}
+func (queue huffmanQueue) Swap(i, j int)  { queue[i], queue[j] = queue[j], queue[i] }
+func (queue *huffmanQueue) Push(node any) { *queue = append(*queue, node.(huffmanNode)) }
+func (queue *huffmanQueue) Pop() any {
+	old := *queue
+	node := old[len(old)-1]
+	*queue = old[:len(old)-1]
+	return node
+}
+
+func NewHuffmanCode(histogram []int) (HuffmanCode, error) {
+	// This is from Section 8.2.1 of DIP book
+	// Builds the code from the counts of the grey levels, as from HistogramGrayscale(img, 0),
+	// by repeatedly merging the two least probable subtrees. The end of stream symbol
+	// is counted once.
+	var code HuffmanCode = HuffmanCode{Lengths: make([]int, endOfStreamSymbol+1)}
+	if len(histogram) > MaxGrayscaleLevels {
+		return code, fmt.Errorf("histogram has %d levels, at most %d are supported", len(histogram), MaxGrayscaleLevels)
+	}
+	var queue huffmanQueue
+	for symbol, count := range histogram {
+		if count < 0 {
+			return code, fmt.Errorf("negative count %d for level %d", count, symbol)
+		}
+		if count > 0 {
+			queue = append(queue, huffmanNode{count: count, symbols: []int{symbol}})
+		}
+	}
+	queue = append(queue, huffmanNode{count: 1, symbols: []int{endOfStreamSymbol}})
+	heap.Init(&queue)
+
+	// Every merge makes the codes of all the leaves below one bit longer
+	if queue.Len() == 1 {
+		code.Lengths[endOfStreamSymbol] = 1
+	}
+	for queue.Len() > 1 {
+		first := heap.Pop(&queue).(huffmanNode)
+		second := heap.Pop(&queue).(huffmanNode)
+		merged := huffmanNode{count: first.count + second.count, symbols: append(append([]int{}, first.symbols...), second.symbols...)}
+		sort.Ints(merged.symbols)
+		for _, symbol := range merged.symbols {
+			code.Lengths[symbol]++
+		}
+		heap.Push(&queue, merged)
+	}
+	if err := code.assignCodes(); err != nil {
+		return code, err
+	}
+	return code, nil
+}
+
+func (code *HuffmanCode) canonicalOrder() []int {
+	// The symbols that have a code, by length and then by symbol
+	var order []int
+	for symbol, length := range code.Lengths {
+		if length > 0 {
+			order = append(order, symbol)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return code.Lengths[order[i]] < code.Lengths[order[j]] })
+	return order
+}
+
+func (code *HuffmanCode) assignCodes() error {
+	// The canonical code: consecutive values within a length, shifted left when the
+	// length grows. Fails if the lengths do not form a prefix code.
+	if len(code.Lengths) != endOfStreamSymbol+1 {
+		return fmt.Errorf("a Huffman code needs %d lengths, got %d", endOfStreamSymbol+1, len(code.Lengths))
+	}
+	code.codes = make([]uint64, len(code.Lengths))
+	var next uint64 = 0
+	var previousLength int = 0
+	for _, symbol := range code.canonicalOrder() {
+		length := code.Lengths[symbol]
+		if length >= 1<<huffmanLengthBits {
+			return fmt.Errorf("code of symbol %d is %d bits long", symbol, length)
+		}
+		next <<= uint(length - previousLength)
+		if next >= 1<<uint(length) {
+			return fmt.Errorf("code lengths do not form a prefix code")
+		}
+		code.codes[symbol] = next
+		next++
+		previousLength = length
+	}
+	return nil
+}
+
+func (code HuffmanCode) AverageLength(histogram []int) float64 {
+	// The average number of bits per grey level for the counts in histogram
+	var bits, total int = 0, 0
+	for symbol, count := range histogram {
+		if symbol < endOfStreamSymbol {
+			bits += count * code.Lengths[symbol]
+			total += count
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(bits) / float64(total)
+}
+
+// HuffmanWriter encodes the bytes written to it. The stream starts with the code
+// lengths and ends with the end of stream symbol written by Close.
+type HuffmanWriter struct {
+	bits   *bitWriter
+	code   HuffmanCode
+	closed bool
+}
+
+func NewHuffmanWriter(w io.Writer, code HuffmanCode) (*HuffmanWriter, error) {
+	if err := code.assignCodes(); err != nil {
+		return nil, err
+	}
+	if code.Lengths[endOfStreamSymbol] == 0 {
+		return nil, fmt.Errorf("the code has no end of stream symbol")
+	}
+	var writer *HuffmanWriter = &HuffmanWriter{bits: newBitWriter(w), code: code}
+	for _, length := range code.Lengths {
+		if err := writer.bits.writeBits(uint64(length), huffmanLengthBits); err != nil {
+			return nil, err
+		}
+	}
+	return writer, nil
+}
+
+func (writer *HuffmanWriter) Write(p []byte) (int, error) {
+	if writer.closed {
+		return 0, fmt.Errorf("write to a closed Huffman writer")
+	}
+	for index, symbol := range p {
+		length := writer.code.Lengths[symbol]
+		if length == 0 {
+			return index, fmt.Errorf("level %d has no Huffman code", symbol)
+		}
+		if err := writer.bits.writeBits(writer.code.codes[symbol], uint(length)); err != nil {
+			return index, err
+		}
+	}
+	return len(p), nil
+}
+
+func (writer *HuffmanWriter) Close() error {
+	if writer.closed {
+		return nil
+	}
+	writer.closed = true
+	if err := writer.bits.writeBits(writer.code.codes[endOfStreamSymbol], uint(writer.code.Lengths[endOfStreamSymbol])); err != nil {
+		return err
+	}
+	return writer.bits.flush()
+}
+
+// HuffmanReader decodes a stream written by HuffmanWriter
+type HuffmanReader struct {
+	bits *bitReader
+	code HuffmanCode
+	// For every length, the first canonical code, the number of codes and where
+	// their symbols start in order
+	first  []uint64
+	counts []int
+	starts []int
+	order  []int
+	done   bool
+}
+
+func NewHuffmanReader(r io.Reader) (*HuffmanReader, error) {
+	var reader *HuffmanReader = &HuffmanReader{bits: newBitReader(r)}
+	reader.code.Lengths = make([]int, endOfStreamSymbol+1)
+	for symbol := range reader.code.Lengths {
+		length, err := reader.bits.readBits(huffmanLengthBits)
+		if err != nil {
+			return nil, err
+		}
+		reader.code.Lengths[symbol] = int(length)
+	}
+	if err := reader.code.assignCodes(); err != nil {
+		return nil, err
+	}
+	if reader.code.Lengths[endOfStreamSymbol] == 0 {
+		return nil, fmt.Errorf("the code has no end of stream symbol")
+	}
+
+	reader.order = reader.code.canonicalOrder()
+	var longest int = reader.code.Lengths[reader.order[len(reader.order)-1]]
+	reader.first = make([]uint64, longest+1)
+	reader.counts = make([]int, longest+1)
+	reader.starts = make([]int, longest+1)
+	for index := len(reader.order) - 1; index >= 0; index-- {
+		symbol := reader.order[index]
+		length := reader.code.Lengths[symbol]
+		reader.first[length] = reader.code.codes[symbol]
+		reader.counts[length]++
+		reader.starts[length] = index
+	}
+	return reader, nil
+}
+
+func (reader *HuffmanReader) readSymbol() (int, error) {
+	var value uint64 = 0
+	for length := 1; length < len(reader.first); length++ {
+		bit, err := reader.bits.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<1 | uint64(bit)
+		if reader.counts[length] > 0 && value >= reader.first[length] && value-reader.first[length] < uint64(reader.counts[length]) {
+			return reader.order[reader.starts[length]+int(value-reader.first[length])], nil
+		}
+	}
+	return 0, fmt.Errorf("invalid Huffman code")
+}
+
+func (reader *HuffmanReader) Read(p []byte) (int, error) {
+	for index := range p {
+		if reader.done {
+			return index, io.EOF
+		}
+		symbol, err := reader.readSymbol()
+		if err != nil {
+			return index, err
+		}
+		if symbol == endOfStreamSymbol {
+			reader.done = true
+			return index, io.EOF
+		}
+		p[index] = byte(symbol)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,94 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestNewHuffmanCode(t *testing.T) {
+	// The source of the Huffman example in the book, with probabilities 0.4, 0.3, 0.1,
+	// 0.1, 0.06 and 0.04 and entropy 2.14 bits
+	histogram := make([]int, 6)
+	for level, count := range []int{4000, 3000, 1000, 1000, 600, 400} {
+		histogram[level] = count
+	}
+	code, err := NewHuffmanCode(histogram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	average := code.AverageLength(histogram)
+	if average < Entropy(histogram) || average > 2.25 {
+		t.Errorf("average length = %v, want about 2.2", average)
+	}
+	if code.Lengths[0] != 1 || code.Lengths[1] != 2 || code.Lengths[6] != 0 {
+		t.Errorf("lengths = %v", code.Lengths[:7])
+	}
+
+	// The codes form a prefix code
+	for first, firstLength := range code.Lengths {
+		for second, secondLength := range code.Lengths {
+			if first == second || firstLength == 0 || secondLength == 0 || firstLength > secondLength {
+				continue
+			}
+			if code.codes[second]>>uint(secondLength-firstLength) == code.codes[first] {
+				t.Fatalf("code of %d is a prefix of the code of %d", first, second)
+			}
+		}
+	}
+
+	if _, err := NewHuffmanCode([]int{1, -1}); err == nil {
+		t.Error("expected an error for a negative count")
+	}
+}
+
+func TestHuffmanStream(t *testing.T) {
+	message := []byte("abracadabra, abracadabra")
+	histogram := make([]int, MaxGrayscaleLevels)
+	for _, symbol := range message {
+		histogram[symbol]++
+	}
+	code, err := NewHuffmanCode(histogram)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var coded bytes.Buffer
+	writer, err := NewHuffmanWriter(&coded, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Written in two parts to check the streaming
+	if _, err := writer.Write(message[:7]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(message[7:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte{'a'}); err == nil {
+		t.Error("expected an error writing after Close")
+	}
+
+	reader, err := NewHuffmanReader(&coded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, message) {
+		t.Errorf("decoded %q, want %q", decoded, message)
+	}
+
+	writer, err = NewHuffmanWriter(&bytes.Buffer{}, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte{'z'}); err == nil {
+		t.Error("expected an error for a level without a code")
+	}
+}
@@ -0,0 +1,169 @@
+// Loading and saving images in the format chosen by the file extension or given explicitly
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImageFormat names a file format the way image.Decode reports it
+type ImageFormat string
+
+const (
+	PNGFormat  ImageFormat = "png"
+	JPEGFormat ImageFormat = "jpeg"
+	GIFFormat  ImageFormat = "gif"
+	BMPFormat  ImageFormat = "bmp"
+	TIFFFormat ImageFormat = "tiff"
+	PGMFormat  ImageFormat = "pgm"
+	PPMFormat  ImageFormat = "ppm"
+	PBMFormat  ImageFormat = "pbm"
+	PAMFormat  ImageFormat = "pam"
+)
+
+// The file extensions of each format
+var imageFormatExtensions map[string]ImageFormat = map[string]ImageFormat{
+	".png":  PNGFormat,
+	".jpg":  JPEGFormat,
+	".jpeg": JPEGFormat,
+	".gif":  GIFFormat,
+	".bmp":  BMPFormat,
+	".tif":  TIFFFormat,
+	".tiff": TIFFFormat,
+	".pgm":  PGMFormat,
+	".ppm":  PPMFormat,
+	".pbm":  PBMFormat,
+	".pam":  PAMFormat,
+}
+
+// The most pixels a decoder accepts, so that a small file claiming a huge size cannot
+// make it allocate more memory than the machine has
+const maxImagePixels int = 1 << 28
+
+// SaveOptions configures SaveImage and EncodeImage. Format is taken from the file
+// extension when left empty. Quality, from 1 to 100, is used by JPEG and is 75 when
+// left at 0. Plain selects the ASCII variants of PBM, PGM and PPM. PNG, TIFF, PGM,
+// PPM and PAM keep 16 bits per sample for 16 bit images, the other formats have 8
+// bits at most.
+type SaveOptions struct {
+	Format  ImageFormat
+	Quality int
+	Plain   bool
+}
+
+func FormatFromFileName(fileName string) (ImageFormat, error) {
+	format, found := imageFormatExtensions[strings.ToLower(filepath.Ext(fileName))]
+	if !found {
+		return "", fmt.Errorf("unknown image format for %q", fileName)
+	}
+	return format, nil
+}
+
+func isGrayModel(img image.Image) bool {
+	return img.ColorModel() == color.GrayModel || img.ColorModel() == color.Gray16Model
+}
+
+func is16BitModel(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.Gray16Model, color.RGBA64Model, color.NRGBA64Model:
+		return true
+	}
+	return false
+}
+
+func grayPalettedImage(img image.Image) *image.Paletted {
+	// The image with a palette of the 256 grey levels, so that GIF keeps them exactly
+	var palette color.Palette = make(color.Palette, MaxGrayscaleLevels)
+	for level := range palette {
+		palette[level] = color.Gray{uint8(level)}
+	}
+	var bounds image.Rectangle = img.Bounds()
+	var paletted *image.Paletted = image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			paletted.SetColorIndex(x-bounds.Min.X, y-bounds.Min.Y, color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+		}
+	}
+	return paletted
+}
+
+func EncodeImage(w io.Writer, img image.Image, options SaveOptions) error {
+	if img.Bounds().Empty() {
+		return fmt.Errorf("empty image")
+	}
+	switch options.Format {
+	case PNGFormat:
+		return png.Encode(w, img)
+	case JPEGFormat:
+		var quality int = options.Quality
+		if quality == 0 {
+			quality = jpeg.DefaultQuality
+		}
+		if quality < 1 || quality > 100 {
+			return fmt.Errorf("JPEG quality must be between 1 and 100, got %d", quality)
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case GIFFormat:
+		if isGrayModel(img) {
+			return gif.Encode(w, grayPalettedImage(img), nil)
+		}
+		return gif.Encode(w, img, &gif.Options{NumColors: 256})
+	case BMPFormat:
+		return encodeBMP(w, img)
+	case TIFFFormat:
+		return encodeTIFF(w, img)
+	case PGMFormat, PPMFormat, PBMFormat, PAMFormat:
+		return EncodeNetpbm(w, img, NetpbmOptions{Format: options.Format, Plain: options.Plain})
+	case "":
+		return fmt.Errorf("no image format given")
+	}
+	return fmt.Errorf("unknown image format %q", options.Format)
+}
+
+func SaveImage(fileName string, img image.Image, options SaveOptions) error {
+	if options.Format == "" {
+		format, err := FormatFromFileName(fileName)
+		if err != nil {
+			return err
+		}
+		options.Format = format
+	}
+	// Encoded in memory first, so that a failure leaves any existing file untouched
+	var encoded bytes.Buffer
+	if err := EncodeImage(&encoded, img, options); err != nil {
+		return fmt.Errorf("failed to encode %s: %v", fileName, err)
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if _, err := encoded.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func LoadImage(fileName string) (image.Image, ImageFormat, error) {
+	// Any registered format, recognised by its contents rather than the extension
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	img, format, err := image.Decode(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s: %v", fileName, err)
+	}
+	return img, ImageFormat(format), nil
+}
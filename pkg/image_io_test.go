@@ -0,0 +1,262 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func createColourTestImage(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(40 * x), uint8(50 * y), uint8(7*x + 11*y), 255})
+		}
+	}
+	return img
+}
+
+func checkSameColours(t *testing.T, decoded image.Image, expected image.Image) {
+	t.Helper()
+	if decoded.Bounds().Size() != expected.Bounds().Size() {
+		t.Fatalf("decoded image is %v, want %v", decoded.Bounds(), expected.Bounds())
+	}
+	for y := 0; y < expected.Bounds().Dy(); y++ {
+		for x := 0; x < expected.Bounds().Dx(); x++ {
+			got := color.RGBA64Model.Convert(decoded.At(decoded.Bounds().Min.X+x, decoded.Bounds().Min.Y+y))
+			want := color.RGBA64Model.Convert(expected.At(expected.Bounds().Min.X+x, expected.Bounds().Min.Y+y))
+			if got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestImageFormatRoundTrips(t *testing.T) {
+	gray := createWaveletTestImage(13, 7)
+	gray16 := image.NewGray16(image.Rect(0, 0, 5, 3))
+	colour16 := image.NewRGBA64(image.Rect(0, 0, 5, 3))
+	for x := 0; x < 5; x++ {
+		for y := 0; y < 3; y++ {
+			// Levels that 8 bits cannot hold
+			gray16.SetGray16(x, y, color.Gray16{uint16(1000*x + 300*y + 1)})
+			colour16.SetRGBA64(x, y, color.RGBA64{uint16(257*x + 3), uint16(4001 * y), 65535, 65535})
+		}
+	}
+
+	cases := []struct {
+		format ImageFormat
+		img    image.Image
+	}{
+		{PNGFormat, gray}, {PNGFormat, createColourTestImage(6, 5)}, {PNGFormat, gray16},
+		{GIFFormat, gray},
+		{BMPFormat, gray}, {BMPFormat, createColourTestImage(6, 5)},
+		{TIFFFormat, gray}, {TIFFFormat, createColourTestImage(6, 5)}, {TIFFFormat, gray16}, {TIFFFormat, colour16},
+	}
+	for _, test := range cases {
+		var encoded bytes.Buffer
+		if err := EncodeImage(&encoded, test.img, SaveOptions{Format: test.format}); err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+		decoded, format, err := image.Decode(&encoded)
+		if err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+		if ImageFormat(format) != test.format {
+			t.Errorf("decoded as %s, want %s", format, test.format)
+		}
+		checkSameColours(t, decoded, test.img)
+	}
+}
+
+func TestEncodeJPEGQuality(t *testing.T) {
+	img := createWaveletTestImage(64, 48)
+	var low, high bytes.Buffer
+	if err := EncodeImage(&low, img, SaveOptions{Format: JPEGFormat, Quality: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeImage(&high, img, SaveOptions{Format: JPEGFormat, Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	if low.Len() >= high.Len() {
+		t.Errorf("quality 10 takes %d bytes, quality 95 %d", low.Len(), high.Len())
+	}
+	if err := EncodeImage(&low, img, SaveOptions{Format: JPEGFormat, Quality: 101}); err == nil {
+		t.Error("expected an error for quality 101")
+	}
+}
+
+func TestEncodeNetpbm(t *testing.T) {
+	img := createTestImage(3, 2, []uint8{0, 100, 200, 255, 127, 128})
+	var encoded bytes.Buffer
+	if err := EncodeImage(&encoded, img, SaveOptions{Format: PGMFormat}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "P5\n3 2\n255\n\x00\x64\xc8\xff\x7f\x80"; encoded.String() != want {
+		t.Errorf("PGM = %q, want %q", encoded.String(), want)
+	}
+
+	// Black, the levels below 128, is 1 in a bitmap
+	encoded.Reset()
+	if err := EncodeImage(&encoded, img, SaveOptions{Format: PBMFormat}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "P4\n3 2\n\xc0\x40"; encoded.String() != want {
+		t.Errorf("PBM = %q, want %q", encoded.String(), want)
+	}
+
+	colour16 := image.NewRGBA64(image.Rect(0, 0, 1, 1))
+	colour16.SetRGBA64(0, 0, color.RGBA64{0x1234, 0x5678, 0x9abc, 0xffff})
+	encoded.Reset()
+	if err := EncodeImage(&encoded, colour16, SaveOptions{Format: PPMFormat}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "P6\n1 1\n65535\n\x12\x34\x56\x78\x9a\xbc"; encoded.String() != want {
+		t.Errorf("PPM = %q, want %q", encoded.String(), want)
+	}
+}
+
+func createTIFFTestFile(entries [][3]uint32, pixels []byte) []byte {
+	// A big-endian TIFF with the pixels at offset 8 and a directory of single valued
+	// SHORT (3) or LONG (4) fields after them
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(tiff[4:], uint32(8+len(pixels)))
+	tiff = append(tiff, pixels...)
+	tiff = append(tiff, 0, byte(len(entries)))
+	for _, entry := range entries {
+		field := make([]byte, 12)
+		binary.BigEndian.PutUint16(field, uint16(entry[0]))
+		binary.BigEndian.PutUint16(field[2:], uint16(entry[1]))
+		binary.BigEndian.PutUint32(field[4:], 1)
+		if entry[1] == 3 {
+			binary.BigEndian.PutUint16(field[8:], uint16(entry[2]))
+		} else {
+			binary.BigEndian.PutUint32(field[8:], entry[2])
+		}
+		tiff = append(tiff, field...)
+	}
+	return append(tiff, 0, 0, 0, 0)
+}
+
+func TestDecodeBMPAndTIFFVariants(t *testing.T) {
+	// A 1 bit BMP stored top row first, with a black and white palette
+	bmp := make([]byte, 62+8)
+	copy(bmp, "BM")
+	binary.LittleEndian.PutUint32(bmp[10:], 62)
+	binary.LittleEndian.PutUint32(bmp[14:], 40)
+	binary.LittleEndian.PutUint32(bmp[18:], 3)
+	binary.LittleEndian.PutUint32(bmp[22:], uint32(0xffffffff-1)) // height -2
+	binary.LittleEndian.PutUint16(bmp[26:], 1)
+	binary.LittleEndian.PutUint16(bmp[28:], 1)
+	copy(bmp[58:], []byte{255, 255, 255, 0})
+	bmp[62], bmp[66] = 0xa0, 0x40
+	img, _, err := image.Decode(bytes.NewReader(bmp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameColours(t, img, createTestImage(3, 2, []uint8{255, 0, 255, 0, 255, 0}))
+
+	// Too many pixels in all, though each side is allowed
+	huge := append([]byte(nil), bmp...)
+	binary.LittleEndian.PutUint32(huge[18:], 1<<20)
+	binary.LittleEndian.PutUint32(huge[22:], 1<<20)
+	if _, _, err := image.Decode(bytes.NewReader(huge)); err == nil {
+		t.Error("expected an error for a BMP of 1048576x1048576")
+	}
+
+	// A big-endian 8 bit TIFF with white as 0
+	tiff := createTIFFTestFile([][3]uint32{{256, 4, 2}, {257, 4, 1}, {258, 3, 8}, {262, 3, 0}, {273, 4, 8}, {279, 4, 2}}, []byte{0, 55})
+	img, _, err = image.Decode(bytes.NewReader(tiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameColours(t, img, createTestImage(2, 1, []uint8{255, 200}))
+}
+
+func TestDecodeMalformedTIFF(t *testing.T) {
+	pixels := make([]byte, 16)
+	cases := map[string][][3]uint32{
+		"no samples":          {{256, 4, 4}, {257, 4, 4}, {258, 3, 8}, {262, 3, 1}, {277, 3, 0}, {273, 4, 8}, {279, 4, 16}},
+		"grey with 2 samples": {{256, 4, 4}, {257, 4, 2}, {258, 3, 8}, {262, 3, 1}, {277, 3, 2}, {273, 4, 8}, {279, 4, 16}},
+		"RGB with 1 sample":   {{256, 4, 4}, {257, 4, 4}, {258, 3, 8}, {262, 3, 2}, {277, 3, 1}, {273, 4, 8}, {279, 4, 16}},
+		"RGB with 5 samples":  {{256, 4, 1}, {257, 4, 1}, {258, 3, 8}, {262, 3, 2}, {277, 3, 5}, {273, 4, 8}, {279, 4, 5}},
+		// Far more pixels than the strips hold, which must fail before allocating them
+		"huge size":      {{256, 4, 1 << 20}, {257, 4, 1 << 20}, {258, 3, 8}, {262, 3, 1}, {273, 4, 8}, {279, 4, 16}},
+		"short strip":    {{256, 4, 4}, {257, 4, 5}, {258, 3, 8}, {262, 3, 1}, {273, 4, 8}, {279, 4, 16}},
+		"strip past end": {{256, 4, 4}, {257, 4, 4}, {258, 3, 8}, {262, 3, 1}, {273, 4, 8}, {279, 4, 1000}},
+	}
+	for name, entries := range cases {
+		if _, _, err := image.Decode(bytes.NewReader(createTIFFTestFile(entries, pixels))); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Too many pixels in all, though each side is allowed, which the size alone rejects
+	huge := createTIFFTestFile([][3]uint32{{256, 4, 1 << 15}, {257, 4, 1 << 14}, {258, 3, 8}, {262, 3, 1}, {273, 4, 8}, {279, 4, 16}}, pixels)
+	if _, _, err := image.DecodeConfig(bytes.NewReader(huge)); err == nil {
+		t.Error("expected an error for the config of a TIFF of 32768x16384")
+	}
+	if _, _, err := image.Decode(bytes.NewReader(huge)); err == nil {
+		t.Error("expected an error for a TIFF of 32768x16384")
+	}
+
+	// Four strips that all hold the same 4 bytes are not the 16 bytes of a 4x4 image
+	overlapping := createTIFFTestFile([][3]uint32{{256, 4, 4}, {257, 4, 4}, {258, 3, 8}, {262, 3, 1}, {273, 4, 0}, {279, 4, 0}}, pixels)
+	var directory int = 8 + len(pixels) + 2
+	for index, value := range []uint32{8, 4} {
+		field := overlapping[directory+12*(4+index):]
+		binary.BigEndian.PutUint32(field[4:], 4)
+		binary.BigEndian.PutUint32(field[8:], uint32(len(overlapping)))
+		for strip := 0; strip < 4; strip++ {
+			overlapping = append(overlapping, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	if _, _, err := image.Decode(bytes.NewReader(overlapping)); err == nil {
+		t.Error("expected an error for overlapping strips")
+	}
+}
+
+func TestSaveAndLoadImage(t *testing.T) {
+	img := createWaveletTestImage(9, 6)
+	for _, name := range []string{"image.PNG", "image.tif", "image.bmp", "image.jpg"} {
+		fileName := filepath.Join(t.TempDir(), name)
+		if err := SaveImage(fileName, img, SaveOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		loaded, format, err := LoadImage(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := FormatFromFileName(name)
+		if format != want || loaded.Bounds().Size() != img.Bounds().Size() {
+			t.Errorf("%s loaded as %s of %v", name, format, loaded.Bounds())
+		}
+	}
+
+	// An explicit format wins over the extension
+	fileName := filepath.Join(t.TempDir(), "image.jpg")
+	if err := SaveImage(fileName, img, SaveOptions{Format: PNGFormat}); err != nil {
+		t.Fatal(err)
+	}
+	if _, format, err := LoadImage(fileName); err != nil || format != PNGFormat {
+		t.Errorf("loaded as %s, %v", format, err)
+	}
+
+	// A failed encode keeps the file that was there
+	if err := SaveImage(fileName, img, SaveOptions{Format: JPEGFormat, Quality: 101}); err == nil {
+		t.Error("expected an error for a JPEG quality of 101")
+	}
+	if _, format, err := LoadImage(fileName); err != nil || format != PNGFormat {
+		t.Errorf("after a failed save loaded as %s, %v", format, err)
+	}
+
+	if err := SaveImage(filepath.Join(t.TempDir(), "image.xyz"), img, SaveOptions{}); err == nil {
+		t.Error("expected an error for an unknown extension")
+	}
+	if _, _, err := LoadImage(filepath.Join(t.TempDir(), "missing.png")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,216 @@
+// Gaussian and Laplacian image pyramids with the reduce and expand operators
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// pyramidKernel is the 5-tap generating kernel of Burt and Adelson, [1 4 6 4 1] / 16,
+// applied along x and then y
+var pyramidKernel []float64 = []float64{1.0 / 16, 4.0 / 16, 6.0 / 16, 4.0 / 16, 1.0 / 16}
+
+func reduceFloats(values [][]float64) [][]float64 {
+	// Smooths with the generating kernel and keeps every other sample, giving a
+	// (width + 1) / 2 x (height + 1) / 2 result. Borders repeat the nearest sample.
+	var width, height int = len(values), len(values[0])
+	var reducedWidth, reducedHeight int = (width + 1) / 2, (height + 1) / 2
+
+	var alongX [][]float64 = newFloats(reducedWidth, height)
+	for x := 0; x < reducedWidth; x++ {
+		for y := 0; y < height; y++ {
+			for index, weight := range pyramidKernel {
+				alongX[x][y] += weight * values[clampIndex(2*x+index-2, width)][y]
+			}
+		}
+	}
+	var reduced [][]float64 = newFloats(reducedWidth, reducedHeight)
+	for x := 0; x < reducedWidth; x++ {
+		for y := 0; y < reducedHeight; y++ {
+			for index, weight := range pyramidKernel {
+				reduced[x][y] += weight * alongX[x][clampIndex(2*y+index-2, height)]
+			}
+		}
+	}
+	return reduced
+}
+
+func expandSample(values []float64, position int) float64 {
+	// Interpolates between the samples of values at position on a grid twice as fine,
+	// 2 sum_m w(m) g((position - m) / 2) over the m that give whole indices
+	var sum float64 = 0
+	for index, weight := range pyramidKernel {
+		offset := position - (index - 2)
+		if offset%2 != 0 {
+			continue
+		}
+		sum += 2 * weight * values[clampIndex(offset/2, len(values))]
+	}
+	return sum
+}
+
+func expandFloats(values [][]float64, width int, height int) [][]float64 {
+	// The expand operator, from a reduced level back up to width x height
+	var alongY [][]float64 = newFloats(len(values), height)
+	for x := range values {
+		for y := 0; y < height; y++ {
+			alongY[x][y] = expandSample(values[x], y)
+		}
+	}
+	var expanded [][]float64 = newFloats(width, height)
+	var row []float64 = make([]float64, len(values))
+	for y := 0; y < height; y++ {
+		for x := range values {
+			row[x] = alongY[x][y]
+		}
+		for x := 0; x < width; x++ {
+			expanded[x][y] = expandSample(row, x)
+		}
+	}
+	return expanded
+}
+
+func floatsToLevelImage(values [][]float64) (image.Image, error) {
+	// Rounds and clamps to 0..255 without rescaling
+	var levels [][]uint8 = newLevels(len(values), len(values[0]))
+	for x := range values {
+		for y, value := range values[x] {
+			levels[x][y] = clampLevel(int(math.Round(value)))
+		}
+	}
+	newImage, err := levelsToImage(levels)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func ReduceImage(img image.Image) (image.Image, error) {
+	// The next level of the Gaussian pyramid, half the size
+	var values [][]float64 = levelsToFloats(imageToLevels(img))
+	if len(values) == 0 || len(values[0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	return floatsToLevelImage(reduceFloats(values))
+}
+
+func ExpandImage(img image.Image, width int, height int) (image.Image, error) {
+	// Interpolates img up to width x height, which should be at most twice its size
+	var values [][]float64 = levelsToFloats(imageToLevels(img))
+	if len(values) == 0 || len(values[0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	if width < len(values) || height < len(values[0]) || width > 2*len(values) || height > 2*len(values[0]) {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("cannot expand %dx%d to %dx%d", len(values), len(values[0]), width, height)
+	}
+	return floatsToLevelImage(expandFloats(values, width, height))
+}
+
+func GaussianPyramid(img image.Image, levels int) ([][][]float64, error) {
+	// This is from Section 7.1.1 of DIP book
+	// The approximation pyramid, level 0 is the image and each further level is the
+	// reduced previous one. Stops early when a level would be smaller than 1 pixel.
+	if levels < 1 {
+		return nil, fmt.Errorf("levels must be at least 1, got %d", levels)
+	}
+	var values [][]float64 = levelsToFloats(imageToLevels(img))
+	if len(values) == 0 || len(values[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	var pyramid [][][]float64 = [][][]float64{values}
+	for len(pyramid) < levels {
+		previous := pyramid[len(pyramid)-1]
+		if len(previous) == 1 && len(previous[0]) == 1 {
+			break
+		}
+		pyramid = append(pyramid, reduceFloats(previous))
+	}
+	return pyramid, nil
+}
+
+func LaplacianPyramid(img image.Image, levels int) ([][][]float64, error) {
+	// The prediction residual pyramid, each level is a Gaussian level minus the expanded
+	// next one. The last level is the last Gaussian level itself, so the image can be
+	// rebuilt exactly with ReconstructLaplacianPyramid.
+	gaussian, err := GaussianPyramid(img, levels)
+	if err != nil {
+		return nil, err
+	}
+	var pyramid [][][]float64
+	for level := 0; level < len(gaussian)-1; level++ {
+		current := gaussian[level]
+		predicted := expandFloats(gaussian[level+1], len(current), len(current[0]))
+		var residual [][]float64 = newFloats(len(current), len(current[0]))
+		for x := range current {
+			for y := range current[x] {
+				residual[x][y] = current[x][y] - predicted[x][y]
+			}
+		}
+		pyramid = append(pyramid, residual)
+	}
+	return append(pyramid, gaussian[len(gaussian)-1]), nil
+}
+
+func ReconstructLaplacianPyramid(pyramid [][][]float64) (image.Image, error) {
+	// Expands from the top and adds back each residual
+	if len(pyramid) == 0 || len(pyramid[0]) == 0 || len(pyramid[0][0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty pyramid")
+	}
+	var current [][]float64 = pyramid[len(pyramid)-1]
+	for level := len(pyramid) - 2; level >= 0; level-- {
+		residual := pyramid[level]
+		if len(residual) > 2*len(current) || len(residual[0]) > 2*len(current[0]) {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("level %d is more than twice the size of level %d", level, level+1)
+		}
+		expanded := expandFloats(current, len(residual), len(residual[0]))
+		for x := range expanded {
+			for y := range expanded[x] {
+				expanded[x][y] += residual[x][y]
+			}
+		}
+		current = expanded
+	}
+	return floatsToLevelImage(current)
+}
+
+func PyramidImage(pyramid [][][]float64) (image.Image, error) {
+	// Lays the pyramid out as one image, level 0 on the left and the smaller levels
+	// stacked top to bottom on its right. Each level is scaled to the full grey range
+	// on its own, which shows the residuals of a Laplacian pyramid.
+	if len(pyramid) == 0 || len(pyramid[0]) == 0 || len(pyramid[0][0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty pyramid")
+	}
+	var width int = len(pyramid[0])
+	var height int = len(pyramid[0][0])
+	if len(pyramid) > 1 {
+		width += len(pyramid[1])
+	}
+	// Odd sizes round up, so the stacked levels can be taller than level 0
+	var stacked int = 0
+	for _, values := range pyramid[1:] {
+		if len(values) > 0 {
+			stacked += len(values[0])
+		}
+	}
+	if stacked > height {
+		height = stacked
+	}
+	canvas := image.NewGray(image.Rect(0, 0, width, height))
+	var corner image.Point
+	for level, values := range pyramid {
+		levelImage, err := FloatsToImage(values)
+		if err != nil {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), err
+		}
+		bounds := levelImage.Bounds()
+		draw.Draw(canvas, bounds.Add(corner), levelImage, bounds.Min, draw.Src)
+		if level == 0 {
+			corner = image.Point{bounds.Dx(), 0}
+		} else {
+			corner.Y += bounds.Dy()
+		}
+	}
+	return canvas, nil
+}
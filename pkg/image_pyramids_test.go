@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestGaussianPyramid(t *testing.T) {
+	pyramid, err := GaussianPyramid(createWaveletTestImage(21, 10), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := [][2]int{{21, 10}, {11, 5}, {6, 3}, {3, 2}}
+	if len(pyramid) != len(sizes) {
+		t.Fatalf("got %d levels, want %d", len(pyramid), len(sizes))
+	}
+	for level, size := range sizes {
+		if len(pyramid[level]) != size[0] || len(pyramid[level][0]) != size[1] {
+			t.Errorf("level %d is %dx%d, want %dx%d", level, len(pyramid[level]), len(pyramid[level][0]), size[0], size[1])
+		}
+	}
+
+	// Stops once a single pixel is left
+	pyramid, err = GaussianPyramid(createWaveletTestImage(4, 4), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pyramid) != 3 {
+		t.Errorf("got %d levels for a 4x4 image, want 3", len(pyramid))
+	}
+
+	if _, err := GaussianPyramid(createWaveletTestImage(4, 4), 0); err == nil {
+		t.Error("expected an error for zero levels")
+	}
+}
+
+func TestReduceAndExpandConstantImage(t *testing.T) {
+	values := make([]uint8, 7*5)
+	for i := range values {
+		values[i] = 90
+	}
+	constant := createTestImage(7, 5, values)
+
+	reduced, err := ReduceImage(constant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reduced.Bounds() != image.Rect(0, 0, 4, 3) {
+		t.Fatalf("reduced image is %v, want 4x3", reduced.Bounds())
+	}
+	expanded, err := ExpandImage(reduced, 7, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 7; x++ {
+		for y := 0; y < 5; y++ {
+			checkPixelValue(t, expanded, x, y, 90)
+		}
+	}
+
+	if _, err := ExpandImage(reduced, 9, 5); err == nil {
+		t.Error("expected an error for expanding more than twice")
+	}
+}
+
+func TestLaplacianPyramidReconstruction(t *testing.T) {
+	img := createWaveletTestImage(29, 18)
+	pyramid, err := LaplacianPyramid(img, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pyramid) != 4 || len(pyramid[3]) != 4 || len(pyramid[3][0]) != 3 {
+		t.Fatalf("got %d levels with a %dx%d top", len(pyramid), len(pyramid[3]), len(pyramid[3][0]))
+	}
+	// The residuals of a smooth area are small
+	if math.Abs(pyramid[0][3][3]) > 10 {
+		t.Errorf("residual in a smooth area = %v", pyramid[0][3][3])
+	}
+
+	reconstructed, err := ReconstructLaplacianPyramid(pyramid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := imageToLevels(img)
+	rebuilt := imageToLevels(reconstructed)
+	for x := range original {
+		for y := range original[x] {
+			if original[x][y] != rebuilt[x][y] {
+				t.Fatalf("pixel (%d, %d) = %d, want %d", x, y, rebuilt[x][y], original[x][y])
+			}
+		}
+	}
+
+	layout, err := PyramidImage(pyramid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Bounds() != image.Rect(0, 0, 29+15, 18) {
+		t.Errorf("pyramid image is %v, want 44x18", layout.Bounds())
+	}
+
+	// Levels of 3, 2 and 1 rows stack to more than the 5 rows of level 0
+	short, err := GaussianPyramid(createWaveletTestImage(8, 5), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err = PyramidImage(short)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Bounds().Dy() != 6 {
+		t.Errorf("pyramid image is %v, want 6 rows", layout.Bounds())
+	}
+}
@@ -175,6 +175,41 @@ func BitPlaneSlicingBitNumber(img image.Image, bitNumber uint8) (image.Image, er
 	return newImage, nil
 }
 
+func BitPlane(img image.Image, bitNumber uint8, grayCode bool) (image.Image, error) {
+	// This is from Section 8.2.7 of DIP book
+	// The given bit of every level as a binary image, unlike BitPlaneSlicingBitNumber
+	// which clears it. With grayCode the bit is taken from the Gray code of the level.
+	if bitNumber >= 8 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("bit number must be between 0 and 7, got %d", bitNumber)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	var plane [][]bool = make([][]bool, len(levels))
+	for x := range levels {
+		plane[x] = make([]bool, len(levels[x]))
+		for y, level := range levels[x] {
+			if grayCode {
+				level = GrayCode(level)
+			}
+			plane[x][y] = level>>bitNumber&1 == 1
+		}
+	}
+	return binaryToImage(plane)
+}
+
+func GrayCode(level uint8) uint8 {
+	// Neighbouring levels differ in a single bit of their Gray codes, so a small change
+	// of level does not flip all the bit planes as 127 to 128 does
+	return level ^ level>>1
+}
+
+func InverseGrayCode(code uint8) uint8 {
+	var level uint8 = code
+	for shift := uint(1); shift < 8; shift <<= 1 {
+		level ^= level >> shift
+	}
+	return level
+}
+
 func ConvertToGrayscale(img image.Image) (image.Image, error) {
 	bounds := img.Bounds()
 	var pixels [][]color.Gray
@@ -0,0 +1,238 @@
+// Local and adaptive thresholding: local mean and standard deviation, Niblack, Sauvola, moving averages and image partitioning
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// integralImage holds running sums of levels and squared levels with a leading row and
+// column of zeros, so the mean and variance of any window cost four lookups each
+type integralImage struct {
+	sums    [][]float64
+	squares [][]float64
+}
+
+func newIntegralImage(levels [][]float64) integralImage {
+	var width int = len(levels)
+	var height int = len(levels[0])
+	var integral integralImage = integralImage{
+		sums:    make([][]float64, width+1),
+		squares: make([][]float64, width+1),
+	}
+	for x := range integral.sums {
+		integral.sums[x] = make([]float64, height+1)
+		integral.squares[x] = make([]float64, height+1)
+	}
+
+	for x := 1; x <= width; x++ {
+		for y := 1; y <= height; y++ {
+			value := levels[x-1][y-1]
+			integral.sums[x][y] = value + integral.sums[x-1][y] + integral.sums[x][y-1] - integral.sums[x-1][y-1]
+			integral.squares[x][y] = value*value + integral.squares[x-1][y] + integral.squares[x][y-1] - integral.squares[x-1][y-1]
+		}
+	}
+	return integral
+}
+
+func (integral integralImage) windowSum(table [][]float64, x0 int, y0 int, x1 int, y1 int) float64 {
+	// Sum over x0 <= x < x1 and y0 <= y < y1
+	return table[x1][y1] - table[x0][y1] - table[x1][y0] + table[x0][y0]
+}
+
+func (integral integralImage) statistics(x int, y int, windowSize int) (float64, float64) {
+	// Mean and standard deviation of the window centred on (x, y), clipped to the image
+	var width int = len(integral.sums) - 1
+	var height int = len(integral.sums[0]) - 1
+	var half int = windowSize / 2
+
+	x0, y0, x1, y1 := x-half, y-half, x+half+1, y+half+1
+	if x0 < 0 {
+		x0 = 0
+	}
+	if y0 < 0 {
+		y0 = 0
+	}
+	if x1 > width {
+		x1 = width
+	}
+	if y1 > height {
+		y1 = height
+	}
+	var count float64 = float64((x1 - x0) * (y1 - y0))
+
+	mean := integral.windowSum(integral.sums, x0, y0, x1, y1) / count
+	variance := integral.windowSum(integral.squares, x0, y0, x1, y1)/count - mean*mean
+	if variance < 0 {
+		// Rounding can push a flat window slightly below zero
+		variance = 0
+	}
+	return mean, math.Sqrt(variance)
+}
+
+func levelsToFloats(levels [][]uint8) [][]float64 {
+	var values [][]float64 = make([][]float64, len(levels))
+	for x := range levels {
+		values[x] = make([]float64, len(levels[x]))
+		for y := range levels[x] {
+			values[x][y] = float64(levels[x][y])
+		}
+	}
+	return values
+}
+
+func localThreshold(img image.Image, windowSize int, predicate func(level float64, mean float64, standardDeviation float64) bool) (image.Image, error) {
+	if windowSize < 1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("window size must be at least 1, got %d", windowSize)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	var integral integralImage = newIntegralImage(levelsToFloats(levels))
+	var result [][]uint8 = newLevels(len(levels), len(levels[0]))
+	for x := range levels {
+		for y := range levels[x] {
+			mean, standardDeviation := integral.statistics(x, y, windowSize)
+			if predicate(float64(levels[x][y]), mean, standardDeviation) {
+				result[x][y] = uint8(MaxGrayscaleLevels - 1)
+			}
+		}
+	}
+
+	newImage, err := levelsToImage(result)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func VariableThreshold(img image.Image, windowSize int, a float64, b float64, useGlobalMean bool) (image.Image, error) {
+	// This is from Section 10.3.7 of DIP book
+	// g(x, y) = 1 if f(x, y) > a sigma_xy AND f(x, y) > b m, where m is either the
+	// local mean m_xy or the global mean m_G
+	var globalMean float64 = MeanIntensity(img, 0)
+
+	return localThreshold(img, windowSize, func(level float64, mean float64, standardDeviation float64) bool {
+		if useGlobalMean {
+			mean = globalMean
+		}
+		return level > a*standardDeviation && level > b*mean
+	})
+}
+
+func NiblackThreshold(img image.Image, windowSize int, k float64) (image.Image, error) {
+	// T(x, y) = m(x, y) + k sigma(x, y), k is usually around -0.2 for dark text on a light background
+	return localThreshold(img, windowSize, func(level float64, mean float64, standardDeviation float64) bool {
+		return level > mean+k*standardDeviation
+	})
+}
+
+func SauvolaThreshold(img image.Image, windowSize int, k float64, r float64) (image.Image, error) {
+	// T(x, y) = m(x, y) [1 + k (sigma(x, y) / R - 1)], R is the dynamic range of the
+	// standard deviation (128 for 8-bit images) and k is usually around 0.5
+	if r <= 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("R must be greater than 0, got %v", r)
+	}
+	return localThreshold(img, windowSize, func(level float64, mean float64, standardDeviation float64) bool {
+		return level > mean*(1+k*(standardDeviation/r-1))
+	})
+}
+
+func MovingAverageThreshold(img image.Image, n int, c float64) (image.Image, error) {
+	// This is from Section 10.3.7 of DIP book
+	// Lines are scanned in a zigzag so the average carries over from one line to the next,
+	// m(k+1) = m(k) + (z_k+1 - z_k-n) / n and g = 1 if f > c m
+	if n < 1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("n must be at least 1, got %d", n)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	var width int = len(levels)
+	var height int = len(levels[0])
+	var result [][]uint8 = newLevels(width, height)
+
+	// Samples before the first pixel are taken as zero, like the book's initial condition
+	var history []float64 = make([]float64, n)
+	var mean float64 = 0
+	var index int = 0
+
+	for y := 0; y < height; y++ {
+		for step := 0; step < width; step++ {
+			x := step
+			if y%2 == 1 {
+				x = width - 1 - step
+			}
+			level := float64(levels[x][y])
+			mean += (level - history[index%n]) / float64(n)
+			history[index%n] = level
+			index++
+
+			if level > c*mean {
+				result[x][y] = uint8(MaxGrayscaleLevels - 1)
+			}
+		}
+	}
+
+	newImage, err := levelsToImage(result)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func PartitionThreshold(img image.Image, columns int, rows int) (image.Image, [][]uint8, error) {
+	// This is from Section 10.3.7 of DIP book
+	// The image is split into columns x rows rectangles and each one is thresholded with
+	// Otsu's method. Returns the binary image and the threshold used for every partition,
+	// indexed [column][row].
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), nil, fmt.Errorf("empty image")
+	}
+	var width int = len(levels)
+	var height int = len(levels[0])
+	if columns < 1 || rows < 1 || columns > width || rows > height {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), nil, fmt.Errorf("cannot split a %dx%d image into %dx%d partitions", width, height, columns, rows)
+	}
+
+	var result [][]uint8 = newLevels(width, height)
+	var thresholds [][]uint8 = newLevels(columns, rows)
+
+	for column := 0; column < columns; column++ {
+		x0, x1 := column*width/columns, (column+1)*width/columns
+		for row := 0; row < rows; row++ {
+			y0, y1 := row*height/rows, (row+1)*height/rows
+
+			var histogram []int = make([]int, MaxGrayscaleLevels)
+			for x := x0; x < x1; x++ {
+				for y := y0; y < y1; y++ {
+					histogram[levels[x][y]]++
+				}
+			}
+			threshold, _, err := otsuFromHistogram(histogram)
+			if err != nil {
+				return image.NewGray(image.Rect(0, 0, 1, 1)), nil, err
+			}
+			thresholds[column][row] = threshold
+
+			for x := x0; x < x1; x++ {
+				for y := y0; y < y1; y++ {
+					if levels[x][y] > threshold {
+						result[x][y] = uint8(MaxGrayscaleLevels - 1)
+					}
+				}
+			}
+		}
+	}
+
+	newImage, err := levelsToImage(result)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), nil, err
+	}
+	return newImage, thresholds, nil
+}
@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIntegralImageStatistics(t *testing.T) {
+	levels := [][]float64{
+		{1, 2, 3},
+		{4, 5, 6},
+		{7, 8, 9},
+	}
+	integral := newIntegralImage(levels)
+
+	mean, standardDeviation := integral.statistics(1, 1, 3)
+	if math.Abs(mean-5) > 1e-9 {
+		t.Errorf("mean = %v, want 5", mean)
+	}
+	if math.Abs(standardDeviation-math.Sqrt(60.0/9.0)) > 1e-9 {
+		t.Errorf("standard deviation = %v, want %v", standardDeviation, math.Sqrt(60.0/9.0))
+	}
+
+	// Windows are clipped at the border
+	mean, _ = integral.statistics(0, 0, 3)
+	if math.Abs(mean-3) > 1e-9 {
+		t.Errorf("corner mean = %v, want 3", mean)
+	}
+}
+
+func TestLocalThresholdsOnUnevenIllumination(t *testing.T) {
+	// Dark marks on a background that brightens from left to right, no global threshold
+	// separates the dark mark on the right from the background on the left
+	var values []uint8
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 24; x++ {
+			level := 60 + 8*x
+			if (x == 3 || x == 20) && y >= 4 && y < 8 {
+				level -= 50
+			}
+			values = append(values, uint8(level))
+		}
+	}
+	img := createTestImage(24, 12, values)
+
+	niblack, err := NiblackThreshold(img, 7, -0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, niblack, 3, 5, 0)
+	checkPixelValue(t, niblack, 20, 5, 0)
+	checkPixelValue(t, niblack, 12, 5, 255)
+
+	sauvola, err := SauvolaThreshold(img, 7, 0.1, 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, sauvola, 3, 5, 0)
+	checkPixelValue(t, sauvola, 20, 5, 0)
+	checkPixelValue(t, sauvola, 12, 5, 255)
+
+	movingAverage, err := MovingAverageThreshold(img, 4, 0.9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, movingAverage, 20, 5, 0)
+	checkPixelValue(t, movingAverage, 12, 5, 255)
+}
+
+func TestPartitionThreshold(t *testing.T) {
+	// Two halves with different background levels, each with its own object
+	var values []uint8
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			var level uint8 = 20
+			if x >= 4 {
+				level = 120
+			}
+			if x == 1 || x == 6 {
+				level += 80
+			}
+			values = append(values, level)
+		}
+	}
+	img := createTestImage(8, 4, values)
+
+	binary, thresholds, err := PartitionThreshold(img, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thresholds) != 2 || len(thresholds[0]) != 1 {
+		t.Fatalf("thresholds = %v, want 2x1", thresholds)
+	}
+	checkPixelValue(t, binary, 1, 0, 255)
+	checkPixelValue(t, binary, 2, 0, 0)
+	checkPixelValue(t, binary, 5, 0, 0)
+	checkPixelValue(t, binary, 6, 0, 255)
+
+	if _, _, err := PartitionThreshold(img, 9, 1); err == nil {
+		t.Error("expected an error for more partitions than columns")
+	}
+}
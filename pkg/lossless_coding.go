@@ -0,0 +1,211 @@
+// Lossless coding of whole images with a report of entropy, code length and redundancy
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"math"
+)
+
+// LosslessMethod selects one of the coders of LosslessCode. The run-length coders
+// work on the image thresholded to binary, the others on the grey levels.
+type LosslessMethod int
+
+const (
+	HuffmanCoding LosslessMethod = iota
+	ArithmeticCoding
+	LZWCoding
+	RunLengthCoding
+	RunLengthCoding2D
+	BitPlaneCoding
+	GrayCodeBitPlaneCoding
+)
+
+// LosslessMethods lists every LosslessMethod
+var LosslessMethods []LosslessMethod = []LosslessMethod{
+	HuffmanCoding, ArithmeticCoding, LZWCoding, RunLengthCoding, RunLengthCoding2D, BitPlaneCoding, GrayCodeBitPlaneCoding,
+}
+
+func (method LosslessMethod) String() string {
+	switch method {
+	case HuffmanCoding:
+		return "huffman"
+	case ArithmeticCoding:
+		return "arithmetic"
+	case LZWCoding:
+		return "lzw"
+	case RunLengthCoding:
+		return "run_length"
+	case RunLengthCoding2D:
+		return "run_length_2d"
+	case BitPlaneCoding:
+		return "bit_plane"
+	case GrayCodeBitPlaneCoding:
+		return "gray_bit_plane"
+	}
+	return fmt.Sprintf("LosslessMethod(%d)", int(method))
+}
+
+func (method LosslessMethod) binary() bool {
+	return method == RunLengthCoding || method == RunLengthCoding2D
+}
+
+// CodingReport compares the coded size of an image with the first-order entropy of
+// its pixels, all in bits per pixel. CodingRedundancy is the average code length
+// minus the entropy, CompressionRatio is the uncoded size, 8 bits per pixel or 1 for
+// the binary coders, over the coded size, and RelativeRedundancy is 1 - 1 / ratio.
+// The entropy ignores the correlation between pixels, so coders that use it can
+// have a negative coding redundancy.
+type CodingReport struct {
+	Method             LosslessMethod
+	Pixels             int
+	Bits               int
+	Entropy            float64
+	AverageCodeLength  float64
+	CodingRedundancy   float64
+	CompressionRatio   float64
+	RelativeRedundancy float64
+}
+
+func Entropy(histogram []int) float64 {
+	// This is from Section 8.1.4 of DIP book
+	// The first-order estimate -sum p log2 p in bits per symbol from symbol counts
+	var total int = 0
+	for _, count := range histogram {
+		total += count
+	}
+	var entropy float64 = 0
+	for _, count := range histogram {
+		if count > 0 {
+			probability := float64(count) / float64(total)
+			entropy -= probability * math.Log2(probability)
+		}
+	}
+	return entropy
+}
+
+func pixelStream(levels [][]uint8) []byte {
+	// The levels in raster order, row by row
+	var stream []byte = make([]byte, 0, len(levels)*len(levels[0]))
+	for y := range levels[0] {
+		for x := range levels {
+			stream = append(stream, levels[x][y])
+		}
+	}
+	return stream
+}
+
+func encodeStream(w io.Writer, method LosslessMethod, img image.Image, stream []byte) error {
+	var writer io.WriteCloser
+	switch method {
+	case HuffmanCoding:
+		code, err := NewHuffmanCode(HistogramGrayscale(img, 0))
+		if err != nil {
+			return err
+		}
+		if writer, err = NewHuffmanWriter(w, code); err != nil {
+			return err
+		}
+	case ArithmeticCoding:
+		writer = NewArithmeticWriter(w)
+	case LZWCoding:
+		writer = NewLZWWriter(w)
+	case RunLengthCoding:
+		return RunLengthEncode(w, img)
+	case RunLengthCoding2D:
+		return RunLengthEncode2D(w, img)
+	case BitPlaneCoding, GrayCodeBitPlaneCoding:
+		return BitPlaneEncode(w, img, method == GrayCodeBitPlaneCoding)
+	default:
+		return fmt.Errorf("unknown lossless method %d", method)
+	}
+	if _, err := writer.Write(stream); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func decodeStream(r io.Reader, method LosslessMethod) ([]byte, error) {
+	var reader io.Reader
+	switch method {
+	case HuffmanCoding:
+		huffman, err := NewHuffmanReader(r)
+		if err != nil {
+			return nil, err
+		}
+		reader = huffman
+	case ArithmeticCoding:
+		reader = NewArithmeticReader(r)
+	case LZWCoding:
+		reader = NewLZWReader(r)
+	default:
+		var decoded image.Image
+		var err error
+		switch method {
+		case RunLengthCoding:
+			decoded, err = RunLengthDecode(r)
+		case RunLengthCoding2D:
+			decoded, err = RunLengthDecode2D(r)
+		default:
+			decoded, err = BitPlaneDecode(r)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return pixelStream(imageToLevels(decoded)), nil
+	}
+	return io.ReadAll(reader)
+}
+
+func LosslessCode(img image.Image, method LosslessMethod) (CodingReport, error) {
+	// Codes the image, decodes it again to check that nothing was lost and reports
+	// the size against the entropy
+	var report CodingReport = CodingReport{Method: method}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return report, fmt.Errorf("empty image")
+	}
+	var sourceBits float64 = 8
+	var histogram []int = HistogramGrayscale(img, 0)
+	if method.binary() {
+		// The run-length coders see the thresholded image
+		var pixels [][]bool = imageToBinary(img)
+		histogram = make([]int, 2)
+		for x := range pixels {
+			for y, foreground := range pixels[x] {
+				if foreground {
+					levels[x][y] = uint8(MaxGrayscaleLevels - 1)
+					histogram[1]++
+				} else {
+					levels[x][y] = 0
+					histogram[0]++
+				}
+			}
+		}
+		sourceBits = 1
+	}
+	var stream []byte = pixelStream(levels)
+
+	var coded bytes.Buffer
+	if err := encodeStream(&coded, method, img, stream); err != nil {
+		return report, err
+	}
+	report.Bits = 8 * coded.Len()
+	decoded, err := decodeStream(&coded, method)
+	if err != nil {
+		return report, err
+	}
+	if !bytes.Equal(decoded, stream) {
+		return report, fmt.Errorf("%s coding did not restore the image", method)
+	}
+
+	report.Pixels = len(stream)
+	report.Entropy = Entropy(histogram)
+	report.AverageCodeLength = float64(report.Bits) / float64(report.Pixels)
+	report.CodingRedundancy = report.AverageCodeLength - report.Entropy
+	report.CompressionRatio = sourceBits / report.AverageCodeLength
+	report.RelativeRedundancy = 1 - 1/report.CompressionRatio
+	return report, nil
+}
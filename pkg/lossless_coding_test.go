@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEntropy(t *testing.T) {
+	if entropy := Entropy([]int{5, 5, 5, 5}); entropy != 2 {
+		t.Errorf("entropy of 4 equally likely symbols = %v, want 2", entropy)
+	}
+	if entropy := Entropy([]int{10, 0}); entropy != 0 {
+		t.Errorf("entropy of a certain symbol = %v, want 0", entropy)
+	}
+}
+
+func TestArithmeticAndLZWStreams(t *testing.T) {
+	random := rand.New(rand.NewSource(5))
+	var skewed, noisy []byte
+	for index := 0; index < 20000; index++ {
+		// Mostly a few levels, which an adaptive coder learns
+		skewed = append(skewed, byte(random.Intn(3)*random.Intn(2)))
+		noisy = append(noisy, byte(random.Intn(256)))
+	}
+	histogram := make([]int, MaxGrayscaleLevels)
+	for _, symbol := range skewed {
+		histogram[symbol]++
+	}
+
+	for index, message := range [][]byte{skewed, noisy, []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), {}} {
+		for _, name := range []string{"arithmetic", "lzw"} {
+			var coded bytes.Buffer
+			var writer io.WriteCloser = NewArithmeticWriter(&coded)
+			if name == "lzw" {
+				writer = NewLZWWriter(&coded)
+			}
+			if _, err := writer.Write(message); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			size := coded.Len()
+			stream := append([]byte(nil), coded.Bytes()...)
+
+			var reader io.Reader = NewArithmeticReader(&coded)
+			if name == "lzw" {
+				reader = NewLZWReader(&coded)
+			}
+			decoded, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, message) {
+				t.Fatalf("%s: decoded %d bytes that differ from the %d written", name, len(decoded), len(message))
+			}
+			if len(message) > 1000 {
+				// Half of the stream must not decode as if it were all there
+				reader = NewArithmeticReader(bytes.NewReader(stream[:size/2]))
+				if name == "lzw" {
+					reader = NewLZWReader(bytes.NewReader(stream[:size/2]))
+				}
+				if _, err := io.ReadAll(reader); err != io.ErrUnexpectedEOF {
+					t.Errorf("%s: truncated stream gave %v, want %v", name, err, io.ErrUnexpectedEOF)
+				}
+			}
+			// The arithmetic coder gets close to the entropy of the skewed source
+			if name == "arithmetic" && index == 0 {
+				if bits := float64(8*size) / float64(len(message)); bits > Entropy(histogram)+0.05 {
+					t.Errorf("arithmetic coding takes %.3f bits per symbol, entropy is %.3f", bits, Entropy(histogram))
+				}
+			}
+		}
+	}
+}
+
+func TestLosslessCode(t *testing.T) {
+	img := createSmoothTestImage(64, 48)
+	for _, method := range LosslessMethods {
+		report, err := LosslessCode(img, method)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if report.Pixels != 64*48 || report.Bits <= 0 {
+			t.Errorf("%s: %d pixels in %d bits", method, report.Pixels, report.Bits)
+		}
+		if math.Abs(report.CodingRedundancy-(report.AverageCodeLength-report.Entropy)) > 1e-12 ||
+			math.Abs(report.RelativeRedundancy-(1-1/report.CompressionRatio)) > 1e-12 {
+			t.Errorf("%s: inconsistent report %+v", method, report)
+		}
+	}
+
+	// Huffman coding of single pixels cannot beat the first-order entropy
+	report, err := LosslessCode(img, HuffmanCoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.CodingRedundancy < 0 || report.CodingRedundancy > 1 {
+		t.Errorf("Huffman coding redundancy = %v", report.CodingRedundancy)
+	}
+	// The binary coders see two levels, at most 1 bit of entropy
+	report, err = LosslessCode(createRunLengthTestImage(), RunLengthCoding2D)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entropy > 1 || report.CompressionRatio <= 1 {
+		t.Errorf("2-D run-length report %+v", report)
+	}
+
+	if _, err := LosslessCode(img, LosslessMethod(99)); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+	if LosslessMethod(99).String() != "LosslessMethod(99)" || GrayCodeBitPlaneCoding.String() != "gray_bit_plane" {
+		t.Errorf("method names %q and %q", LosslessMethod(99), GrayCodeBitPlaneCoding)
+	}
+}
@@ -0,0 +1,201 @@
+// Lempel-Ziv-Welch coding of grey levels as a streaming encoder and decoder
+package pkg
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// lzwClear restarts the dictionary, the first code after the 256 grey levels
+	lzwClear int = 256
+	// lzwEnd ends the stream
+	lzwEnd int = 257
+	// lzwFirst is the first code of a sequence of grey levels
+	lzwFirst        int  = 258
+	lzwMaximumCodes int  = 1 << 12
+	lzwMinimumWidth uint = 9
+	lzwMaximumWidth uint = 12
+)
+
+func lzwWidth(count int) uint {
+	// The bits needed for the count-th code after a clear. The largest code it can be
+	// is the dictionary entry the decoder is about to add, 256 + count.
+	var width uint = 0
+	for value := lzwClear + count; value > 0; value >>= 1 {
+		width++
+	}
+	if width < lzwMinimumWidth {
+		return lzwMinimumWidth
+	}
+	if width > lzwMaximumWidth {
+		return lzwMaximumWidth
+	}
+	return width
+}
+
+// LZWWriter encodes the bytes written to it with a dictionary of up to 4096 codes
+// of 9 to 12 bits, restarting when it is full
+type LZWWriter struct {
+	bits       *bitWriter
+	dictionary map[int]int
+	next       int
+	current    int
+	count      int
+	closed     bool
+}
+
+func NewLZWWriter(w io.Writer) *LZWWriter {
+	var writer *LZWWriter = &LZWWriter{bits: newBitWriter(w), current: -1}
+	writer.reset()
+	return writer
+}
+
+func (writer *LZWWriter) reset() {
+	writer.dictionary = map[int]int{}
+	writer.next = lzwFirst
+	writer.count = 0
+}
+
+func (writer *LZWWriter) emit(code int) error {
+	writer.count++
+	return writer.bits.writeBits(uint64(code), lzwWidth(writer.count))
+}
+
+func (writer *LZWWriter) Write(p []byte) (int, error) {
+	// This is from Section 8.2.4 of DIP book
+	// Extends the recognised sequence while it is in the dictionary, otherwise emits
+	// its code and adds the sequence extended by the new grey level
+	if writer.closed {
+		return 0, fmt.Errorf("write to a closed LZW writer")
+	}
+	for index, level := range p {
+		if writer.current < 0 {
+			writer.current = int(level)
+			continue
+		}
+		key := writer.current<<8 | int(level)
+		if code, ok := writer.dictionary[key]; ok {
+			writer.current = code
+			continue
+		}
+		if err := writer.emit(writer.current); err != nil {
+			return index, err
+		}
+		if writer.next < lzwMaximumCodes {
+			writer.dictionary[key] = writer.next
+			writer.next++
+		} else {
+			if err := writer.emit(lzwClear); err != nil {
+				return index, err
+			}
+			writer.reset()
+		}
+		writer.current = int(level)
+	}
+	return len(p), nil
+}
+
+func (writer *LZWWriter) Close() error {
+	if writer.closed {
+		return nil
+	}
+	writer.closed = true
+	if writer.current >= 0 {
+		if err := writer.emit(writer.current); err != nil {
+			return err
+		}
+	}
+	if err := writer.emit(lzwEnd); err != nil {
+		return err
+	}
+	return writer.bits.flush()
+}
+
+// LZWReader decodes a stream written by LZWWriter
+type LZWReader struct {
+	bits     *bitReader
+	entries  [][]byte
+	previous int
+	count    int
+	pending  []byte
+	done     bool
+}
+
+func NewLZWReader(r io.Reader) *LZWReader {
+	var reader *LZWReader = &LZWReader{bits: newBitReader(r)}
+	reader.reset()
+	return reader
+}
+
+func (reader *LZWReader) reset() {
+	reader.entries = make([][]byte, lzwFirst, lzwMaximumCodes)
+	for level := 0; level < lzwClear; level++ {
+		reader.entries[level] = []byte{byte(level)}
+	}
+	reader.previous = -1
+	reader.count = 0
+}
+
+func (reader *LZWReader) decode() error {
+	// Reads one code into pending. A code one past the dictionary is the previous
+	// sequence followed by its own first grey level.
+	reader.count++
+	value, err := reader.bits.readBits(lzwWidth(reader.count))
+	if err != nil {
+		return err
+	}
+	var code int = int(value)
+	switch {
+	case code == lzwClear:
+		reader.reset()
+		return nil
+	case code == lzwEnd:
+		reader.done = true
+		return nil
+	case reader.previous < 0:
+		if code >= lzwClear {
+			return fmt.Errorf("invalid LZW code %d after a clear", code)
+		}
+		reader.pending = append(reader.pending, reader.entries[code]...)
+		reader.previous = code
+		return nil
+	}
+
+	var entry []byte
+	switch {
+	case code < len(reader.entries) && code >= lzwFirst || code < lzwClear:
+		entry = reader.entries[code]
+	case code == len(reader.entries):
+		previous := reader.entries[reader.previous]
+		entry = append(append([]byte{}, previous...), previous[0])
+	default:
+		return fmt.Errorf("invalid LZW code %d with %d entries", code, len(reader.entries))
+	}
+	if len(reader.entries) < lzwMaximumCodes {
+		previous := reader.entries[reader.previous]
+		reader.entries = append(reader.entries, append(append(make([]byte, 0, len(previous)+1), previous...), entry[0]))
+	}
+	reader.pending = append(reader.pending, entry...)
+	reader.previous = code
+	return nil
+}
+
+func (reader *LZWReader) Read(p []byte) (int, error) {
+	var index int = 0
+	for index < len(p) {
+		if len(reader.pending) > 0 {
+			copied := copy(p[index:], reader.pending)
+			reader.pending = reader.pending[copied:]
+			index += copied
+			continue
+		}
+		if reader.done {
+			return index, io.EOF
+		}
+		if err := reader.decode(); err != nil {
+			return index, err
+		}
+	}
+	return index, nil
+}
@@ -0,0 +1,183 @@
+// Marr-Hildreth edge detector: Laplacian of Gaussian, difference of Gaussians and zero crossings
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+func LaplacianOfGaussianKernel(sigma float64) ([][]float64, error) {
+	// This is from Section 10.2.6 of DIP book
+	// LoG(x, y) = [(x^2 + y^2 - 2 sigma^2) / sigma^4] exp(-(x^2 + y^2) / 2 sigma^2), sampled
+	// on the smallest odd size not below 6 sigma. The mean is subtracted so the
+	// coefficients sum to zero and flat regions give a response of exactly zero.
+	if sigma <= 0 {
+		return nil, fmt.Errorf("sigma must be greater than 0, got %v", sigma)
+	}
+	var size int = int(math.Ceil(6 * sigma))
+	if size%2 == 0 {
+		size++
+	}
+	var half int = size / 2
+
+	var kernel [][]float64 = newFloats(size, size)
+	var sum float64 = 0
+	for rowIndex := range kernel {
+		for colIndex := range kernel[rowIndex] {
+			dx := float64(rowIndex - half)
+			dy := float64(colIndex - half)
+			r2 := dx*dx + dy*dy
+			kernel[rowIndex][colIndex] = (r2 - 2*sigma*sigma) / (sigma * sigma * sigma * sigma) * math.Exp(-r2/(2*sigma*sigma))
+			sum += kernel[rowIndex][colIndex]
+		}
+	}
+	var mean float64 = sum / float64(size*size)
+	for rowIndex := range kernel {
+		for colIndex := range kernel[rowIndex] {
+			kernel[rowIndex][colIndex] -= mean
+		}
+	}
+	return kernel, nil
+}
+
+func DifferenceOfGaussiansKernel(sigma1 float64, sigma2 float64) ([][]float64, error) {
+	// This is from Section 10.2.6 of DIP book
+	// DoG(x, y) = G_sigma1(x, y) - G_sigma2(x, y) with sigma1 > sigma2, a ratio of 1.6
+	// approximates the LoG closely. Both Gaussians are sampled on the size needed by
+	// sigma1 and normalised to unit sum, so the kernel sums to zero.
+	if sigma2 <= 0 || sigma1 <= sigma2 {
+		return nil, fmt.Errorf("sigmas must satisfy sigma1 > sigma2 > 0, got %v and %v", sigma1, sigma2)
+	}
+	wide, err := GaussianKernel(sigma1)
+	if err != nil {
+		return nil, err
+	}
+	var size int = len(wide)
+	var half int = size / 2
+
+	var narrow [][]float64 = newFloats(size, size)
+	var sum float64 = 0
+	for rowIndex := range narrow {
+		for colIndex := range narrow[rowIndex] {
+			dx := float64(rowIndex - half)
+			dy := float64(colIndex - half)
+			narrow[rowIndex][colIndex] = math.Exp(-(dx*dx + dy*dy) / (2 * sigma2 * sigma2))
+			sum += narrow[rowIndex][colIndex]
+		}
+	}
+
+	var kernel [][]float64 = newFloats(size, size)
+	for rowIndex := range kernel {
+		for colIndex := range kernel[rowIndex] {
+			kernel[rowIndex][colIndex] = wide[rowIndex][colIndex] - narrow[rowIndex][colIndex]/sum
+		}
+	}
+	return kernel, nil
+}
+
+func LaplacianOfGaussian(img image.Image, sigma float64) ([][]float64, error) {
+	// Signed response of the image to the LoG, indexed [x][y]. As in the book the image
+	// is smoothed with the (separable) Gaussian first and the Laplacian is then taken with
+	// the 3x3 mask of Fig. 10.4(d), which is much cheaper than a large LoG kernel.
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	smoothed, err := gaussianSmoothFloats(levelsToFloats(levels), sigma)
+	if err != nil {
+		return nil, err
+	}
+	return correlateFloats(smoothed, intMaskToFloats(LaplacianMask2())), nil
+}
+
+func DifferenceOfGaussians(img image.Image, sigma1 float64, sigma2 float64) ([][]float64, error) {
+	// Signed response of the image to G_sigma1 - G_sigma2, indexed [x][y]
+	if sigma2 <= 0 || sigma1 <= sigma2 {
+		return nil, fmt.Errorf("sigmas must satisfy sigma1 > sigma2 > 0, got %v and %v", sigma1, sigma2)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	var values [][]float64 = levelsToFloats(levels)
+	wide, err := gaussianSmoothFloats(values, sigma1)
+	if err != nil {
+		return nil, err
+	}
+	narrow, err := gaussianSmoothFloats(values, sigma2)
+	if err != nil {
+		return nil, err
+	}
+	for x := range wide {
+		for y := range wide[x] {
+			wide[x][y] -= narrow[x][y]
+		}
+	}
+	return wide, nil
+}
+
+func ZeroCrossings(response [][]float64, threshold float64) (image.Image, error) {
+	// This is from Section 10.2.6 of DIP book
+	// A pixel is a zero crossing when the signs of at least one pair of opposing
+	// neighbours (left/right, up/down and the two diagonals) differ and the absolute
+	// difference of their values is above the threshold
+	if len(response) == 0 || len(response[0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty response")
+	}
+	if threshold < 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("threshold must not be negative, got %v", threshold)
+	}
+	var width int = len(response)
+	var height int = len(response[0])
+	var pairs [][2]image.Point = [][2]image.Point{
+		{{-1, 0}, {1, 0}},
+		{{0, -1}, {0, 1}},
+		{{-1, -1}, {1, 1}},
+		{{-1, 1}, {1, -1}},
+	}
+
+	var edges [][]bool = newBinary(width, height)
+	for x := 1; x < width-1; x++ {
+		for y := 1; y < height-1; y++ {
+			for _, pair := range pairs {
+				a := response[x+pair[0].X][y+pair[0].Y]
+				b := response[x+pair[1].X][y+pair[1].Y]
+				if a*b < 0 && math.Abs(a-b) > threshold {
+					edges[x][y] = true
+					break
+				}
+			}
+		}
+	}
+
+	newImage, err := binaryToImage(edges)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func MarrHildreth(img image.Image, sigma float64, thresholdFraction float64) (image.Image, error) {
+	// This is from Section 10.2.6 of DIP book
+	// 1. Filter the image with an n x n Gaussian lowpass filter, n >= 6 sigma
+	// 2. Compute the Laplacian of the smoothed image
+	// 3. Find the zero crossings
+	// The threshold is a fraction of the largest absolute LoG response, the book uses 4%.
+	// A fraction of zero keeps every zero crossing, which gives the "spaghetti" effect.
+	if thresholdFraction < 0 || thresholdFraction > 1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("threshold must be a fraction between 0 and 1, got %v", thresholdFraction)
+	}
+	response, err := LaplacianOfGaussian(img, sigma)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	var maximum float64 = 0
+	for x := range response {
+		for y := range response[x] {
+			maximum = math.Max(maximum, math.Abs(response[x][y]))
+		}
+	}
+	return ZeroCrossings(response, thresholdFraction*maximum)
+}
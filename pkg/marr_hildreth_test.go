@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestLaplacianOfGaussianKernels(t *testing.T) {
+	kernel, err := LaplacianOfGaussianKernel(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kernel) != 7 {
+		t.Errorf("kernel size = %d, want 7", len(kernel))
+	}
+	var sum float64 = 0
+	for _, row := range kernel {
+		for _, cell := range row {
+			sum += cell
+		}
+	}
+	if math.Abs(sum) > 1e-9 {
+		t.Errorf("kernel sum = %v, want 0", sum)
+	}
+	if kernel[3][3] >= 0 || kernel[0][3] <= kernel[3][3] {
+		t.Error("LoG kernel should have a negative centre")
+	}
+
+	dog, err := DifferenceOfGaussiansKernel(1.6, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum = 0
+	for _, row := range dog {
+		for _, cell := range row {
+			sum += cell
+		}
+	}
+	if math.Abs(sum) > 1e-9 {
+		t.Errorf("DoG kernel sum = %v, want 0", sum)
+	}
+	if dog[len(dog)/2][len(dog)/2] >= 0 {
+		t.Error("DoG kernel should have a negative centre")
+	}
+
+	if _, err := DifferenceOfGaussiansKernel(1, 1.6); err == nil {
+		t.Error("expected an error when sigma1 is not the larger sigma")
+	}
+}
+
+func TestMarrHildreth(t *testing.T) {
+	// A vertical step edge between columns 9 and 10
+	var values []uint8
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 20; x++ {
+			var level uint8 = 30
+			if x >= 10 {
+				level = 210
+			}
+			values = append(values, level)
+		}
+	}
+	img := createTestImage(20, 12, values)
+
+	response, err := LaplacianOfGaussian(img, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The response keeps its sign on each side of the edge instead of being clamped
+	if response[8][6] <= 0 || response[11][6] >= 0 {
+		t.Errorf("responses = %v and %v, want positive on the dark side and negative on the bright side", response[8][6], response[11][6])
+	}
+
+	edges, err := MarrHildreth(img, 1, 0.04)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := edges.(*image.Gray)
+	for x := 0; x < 20; x++ {
+		if gray.GrayAt(x, 6).Y == 255 && (x < 8 || x > 11) {
+			t.Errorf("unexpected zero crossing at column %d", x)
+		}
+	}
+	if gray.GrayAt(9, 6).Y != 255 && gray.GrayAt(10, 6).Y != 255 {
+		t.Error("no zero crossing found at the step")
+	}
+
+	// A high threshold rejects the weak crossings of a faint edge
+	faint := createModalTestImage(20, 12, []uint8{100, 104})
+	faintResponse, err := LaplacianOfGaussian(faint, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak, err := ZeroCrossings(faintResponse, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countForeground(weak); got != 0 {
+		t.Errorf("faint edge gives %d crossings above the threshold, want 0", got)
+	}
+
+	if _, err := MarrHildreth(img, 1, 2); err == nil {
+		t.Error("expected an error for a threshold fraction above 1")
+	}
+}
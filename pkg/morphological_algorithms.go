@@ -0,0 +1,489 @@
+// Morphological algorithms: hit-or-miss, boundary extraction, hole filling, thinning, thickening, skeletons, pruning and convex hull
+package pkg
+
+import (
+	"fmt"
+	"image"
+)
+
+// MorphologicalSkeleton keeps the skeleton subsets S_k(A) so the original set can be reconstructed
+type MorphologicalSkeleton struct {
+	Subsets [][][]bool
+	Element StructuringElement
+}
+
+// Hit-or-miss masks are 3x3 with the origin at the centre:
+// 1 is foreground, 0 is background and -1 is don't care.
+type hitOrMissMask [][]int
+
+func (mask hitOrMissMask) offsets() ([]elementOffset, []elementOffset) {
+	var foreground, background []elementOffset
+	for rowIndex, row := range mask {
+		for colIndex, cell := range row {
+			offset := elementOffset{rowIndex - len(mask)/2, colIndex - len(row)/2, 0}
+			switch cell {
+			case 1:
+				foreground = append(foreground, offset)
+			case 0:
+				background = append(background, offset)
+			}
+		}
+	}
+	return foreground, background
+}
+
+func (mask hitOrMissMask) rotate() hitOrMissMask {
+	// Rotates the mask by 90 degrees
+	var size int = len(mask)
+	var rotated hitOrMissMask = make(hitOrMissMask, size)
+	for rowIndex := range rotated {
+		rotated[rowIndex] = make([]int, size)
+		for colIndex := range rotated[rowIndex] {
+			rotated[rowIndex][colIndex] = mask[size-1-colIndex][rowIndex]
+		}
+	}
+	return rotated
+}
+
+func (mask hitOrMissMask) swap() hitOrMissMask {
+	// Swaps foreground and background, leaving don't care cells alone
+	var swapped hitOrMissMask = make(hitOrMissMask, len(mask))
+	for rowIndex, row := range mask {
+		swapped[rowIndex] = make([]int, len(row))
+		for colIndex, cell := range row {
+			switch cell {
+			case 1:
+				swapped[rowIndex][colIndex] = 0
+			case 0:
+				swapped[rowIndex][colIndex] = 1
+			default:
+				swapped[rowIndex][colIndex] = cell
+			}
+		}
+	}
+	return swapped
+}
+
+func rotatedMasks(first hitOrMissMask, second hitOrMissMask) []hitOrMissMask {
+	// Alternates the two masks through four 90 degree rotations, giving eight masks 45 degrees apart
+	var masks []hitOrMissMask
+	for i := 0; i < 4; i++ {
+		masks = append(masks, first, second)
+		first = first.rotate()
+		second = second.rotate()
+	}
+	return masks
+}
+
+func thinningMasks() []hitOrMissMask {
+	// Figure 9.21 of DIP book
+	return rotatedMasks(
+		hitOrMissMask{
+			{0, 0, 0},
+			{-1, 1, -1},
+			{1, 1, 1},
+		},
+		hitOrMissMask{
+			{-1, 0, 0},
+			{1, 1, 0},
+			{1, 1, -1},
+		},
+	)
+}
+
+func endPointMasks() []hitOrMissMask {
+	// Figure 9.25 of DIP book
+	return rotatedMasks(
+		hitOrMissMask{
+			{-1, 0, 0},
+			{1, 1, 0},
+			{-1, 0, 0},
+		},
+		hitOrMissMask{
+			{1, 0, 0},
+			{0, 1, 0},
+			{0, 0, 0},
+		},
+	)
+}
+
+func convexHullMasks() []hitOrMissMask {
+	// Figure 9.19 of DIP book
+	var first hitOrMissMask = hitOrMissMask{
+		{1, 1, 1},
+		{-1, -1, -1},
+		{-1, -1, -1},
+	}
+	var masks []hitOrMissMask
+	for i := 0; i < 4; i++ {
+		masks = append(masks, first)
+		first = first.rotate()
+	}
+	return masks
+}
+
+func hitOrMissBinary(pixels [][]bool, foreground []elementOffset, background []elementOffset) [][]bool {
+	var result [][]bool = newBinary(len(pixels), len(pixels[0]))
+
+	for x := range pixels {
+		for y := range pixels[x] {
+			var match bool = true
+			for _, offset := range foreground {
+				if !binaryAt(pixels, x+offset.dx, y+offset.dy) {
+					match = false
+					break
+				}
+			}
+			if !match {
+				continue
+			}
+			for _, offset := range background {
+				if binaryAt(pixels, x+offset.dx, y+offset.dy) {
+					match = false
+					break
+				}
+			}
+			result[x][y] = match
+		}
+	}
+	return result
+}
+
+func subtractBinary(first [][]bool, second [][]bool) [][]bool {
+	var result [][]bool = newBinary(len(first), len(first[0]))
+	for x := range first {
+		for y := range first[x] {
+			result[x][y] = first[x][y] && !second[x][y]
+		}
+	}
+	return result
+}
+
+func unionBinary(first [][]bool, second [][]bool) [][]bool {
+	var result [][]bool = newBinary(len(first), len(first[0]))
+	for x := range first {
+		for y := range first[x] {
+			result[x][y] = first[x][y] || second[x][y]
+		}
+	}
+	return result
+}
+
+func intersectBinary(first [][]bool, second [][]bool) [][]bool {
+	var result [][]bool = newBinary(len(first), len(first[0]))
+	for x := range first {
+		for y := range first[x] {
+			result[x][y] = first[x][y] && second[x][y]
+		}
+	}
+	return result
+}
+
+func complementBinary(pixels [][]bool) [][]bool {
+	var result [][]bool = newBinary(len(pixels), len(pixels[0]))
+	for x := range pixels {
+		for y := range pixels[x] {
+			result[x][y] = !pixels[x][y]
+		}
+	}
+	return result
+}
+
+func equalBinary(first [][]bool, second [][]bool) bool {
+	for x := range first {
+		for y := range first[x] {
+			if first[x][y] != second[x][y] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func emptyBinary(pixels [][]bool) bool {
+	for x := range pixels {
+		for y := range pixels[x] {
+			if pixels[x][y] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func thinBinary(pixels [][]bool, masks []hitOrMissMask, iterations int) [][]bool {
+	// A thin {B} = ((...((A thin B1) thin B2)...) thin Bn), repeated until nothing changes
+	// or for the given number of iterations when it is positive
+	for iteration := 0; iterations <= 0 || iteration < iterations; iteration++ {
+		var previous [][]bool = pixels
+		for _, mask := range masks {
+			foreground, background := mask.offsets()
+			pixels = subtractBinary(pixels, hitOrMissBinary(pixels, foreground, background))
+		}
+		if equalBinary(previous, pixels) {
+			break
+		}
+	}
+	return pixels
+}
+
+func HitOrMiss(img image.Image, foreground StructuringElement, background StructuringElement) (image.Image, error) {
+	// This is from Section 9.4 of DIP book
+	// A hit-or-miss B = (A erode B1) intersection (A complement erode B2)
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	newImage, err := binaryToImage(hitOrMissBinary(pixels, foreground.offsets(), background.offsets()))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func BoundaryExtraction(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.5.1 of DIP book
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	newImage, err := binaryToImage(subtractBinary(pixels, erodeBinary(pixels, element.offsets())))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func HoleFilling(img image.Image, seeds []image.Point) (image.Image, error) {
+	// This is from Section 9.5.2 of DIP book
+	// X_k = (X_k-1 dilate B) intersection A complement, with B the 3x3 cross. Growing X
+	// one dilation at a time visits exactly the 4-connected background pixels reachable
+	// from the seeds, so a flood fill gives the same result in a single pass.
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	var filled [][]bool = newBinary(len(pixels), len(pixels[0]))
+	var stack []image.Point
+	for _, seed := range seeds {
+		if seed.X < 0 || seed.Y < 0 || seed.X >= len(pixels) || seed.Y >= len(pixels[0]) {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("seed %v is outside the image", seed)
+		}
+		stack = append(stack, seed)
+	}
+
+	for len(stack) > 0 {
+		point := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if point.X < 0 || point.Y < 0 || point.X >= len(pixels) || point.Y >= len(pixels[0]) {
+			continue
+		}
+		if pixels[point.X][point.Y] || filled[point.X][point.Y] {
+			continue
+		}
+		filled[point.X][point.Y] = true
+		stack = append(stack,
+			image.Point{point.X + 1, point.Y}, image.Point{point.X - 1, point.Y},
+			image.Point{point.X, point.Y + 1}, image.Point{point.X, point.Y - 1})
+	}
+
+	newImage, err := binaryToImage(unionBinary(pixels, filled))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func Thinning(img image.Image, iterations int) (image.Image, error) {
+	// This is from Section 9.5.5 of DIP book
+	// Iterations of zero or less run until the result stops changing
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	newImage, err := binaryToImage(thinBinary(pixels, thinningMasks(), iterations))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func Thickening(img image.Image, iterations int) (image.Image, error) {
+	// This is from Section 9.5.6 of DIP book
+	// A thicken B = A union (A hit-or-miss B), using the thinning masks with 1s and 0s swapped.
+	// Applied directly the set keeps growing, so with iterations of zero or less we follow
+	// the book and thin the background instead, then take the complement of the result.
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	if iterations <= 0 {
+		pixels = complementBinary(thinBinary(complementBinary(pixels), thinningMasks(), 0))
+	} else {
+		var masks []hitOrMissMask
+		for _, mask := range thinningMasks() {
+			masks = append(masks, mask.swap())
+		}
+		for iteration := 0; iteration < iterations; iteration++ {
+			for _, mask := range masks {
+				foreground, background := mask.offsets()
+				pixels = unionBinary(pixels, hitOrMissBinary(pixels, foreground, background))
+			}
+		}
+	}
+
+	newImage, err := binaryToImage(pixels)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func Skeletonise(img image.Image, element StructuringElement) (image.Image, MorphologicalSkeleton, error) {
+	// This is from Section 9.5.7 of DIP book
+	// S_k(A) = (A erode kB) - (A erode kB) open B, for k = 0..K where K is the last
+	// step before A erodes to an empty set. The skeleton is the union of the S_k(A).
+	var skeleton MorphologicalSkeleton = MorphologicalSkeleton{Element: element}
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), skeleton, fmt.Errorf("empty image")
+	}
+
+	var offsets []elementOffset = element.offsets()
+	var union [][]bool = newBinary(len(pixels), len(pixels[0]))
+	var eroded [][]bool = pixels
+
+	for !emptyBinary(eroded) {
+		next := erodeBinary(eroded, offsets)
+		// An element such as a single pixel erodes nothing, so A would never become empty
+		if equalBinary(next, eroded) {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), skeleton, fmt.Errorf("erosion by the structuring element leaves the image unchanged")
+		}
+		subset := subtractBinary(eroded, dilateBinary(next, offsets))
+		skeleton.Subsets = append(skeleton.Subsets, subset)
+		union = unionBinary(union, subset)
+		eroded = next
+	}
+
+	newImage, err := binaryToImage(union)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), skeleton, err
+	}
+	return newImage, skeleton, nil
+}
+
+func SkeletonReconstruction(skeleton MorphologicalSkeleton) (image.Image, error) {
+	// This is from Section 9.5.7 of DIP book
+	// A = union of (S_k(A) dilate kB) for k = 0..K
+	if len(skeleton.Subsets) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("skeleton has no subsets")
+	}
+
+	var offsets []elementOffset = skeleton.Element.offsets()
+	var reconstructed [][]bool = newBinary(len(skeleton.Subsets[0]), len(skeleton.Subsets[0][0]))
+
+	for k, subset := range skeleton.Subsets {
+		dilated := subset
+		for i := 0; i < k; i++ {
+			dilated = dilateBinary(dilated, offsets)
+		}
+		reconstructed = unionBinary(reconstructed, dilated)
+	}
+
+	newImage, err := binaryToImage(reconstructed)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func Pruning(img image.Image, iterations int) (image.Image, error) {
+	// This is from Section 9.5.8 of DIP book
+	// Iterations is the length of the parasitic branches to remove
+	if iterations < 1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("iterations must be at least 1, got %d", iterations)
+	}
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	// X1 = A thin {B}, removing end points n times
+	var masks []hitOrMissMask = endPointMasks()
+	var thinned [][]bool = thinBinary(pixels, masks, iterations)
+
+	// X2 = union of (X1 hit-or-miss B_k), the end points of X1
+	var endPoints [][]bool = newBinary(len(pixels), len(pixels[0]))
+	for _, mask := range masks {
+		foreground, background := mask.offsets()
+		endPoints = unionBinary(endPoints, hitOrMissBinary(thinned, foreground, background))
+	}
+
+	// X3 = (X2 dilate H) intersection A, applied n times
+	square, err := SquareStructuringElement(3)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	var offsets []elementOffset = square.offsets()
+	for i := 0; i < iterations; i++ {
+		endPoints = intersectBinary(dilateBinary(endPoints, offsets), pixels)
+	}
+
+	// X4 = X1 union X3
+	newImage, err := binaryToImage(unionBinary(thinned, endPoints))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func ConvexHull(img image.Image) (image.Image, error) {
+	// This is from Section 9.5.4 of DIP book
+	// X_k = (X_k-1 hit-or-miss B_i) union A for each of the four masks until convergence,
+	// growth is limited to the bounding box of A as suggested in the book.
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	var boundingBox image.Rectangle
+	for x := range pixels {
+		for y := range pixels[x] {
+			if pixels[x][y] {
+				boundingBox = boundingBox.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	var hull [][]bool = newBinary(len(pixels), len(pixels[0]))
+	for _, mask := range convexHullMasks() {
+		foreground, background := mask.offsets()
+		var current [][]bool = pixels
+		for {
+			next := unionBinary(hitOrMissBinary(current, foreground, background), pixels)
+			for x := range next {
+				for y := range next[x] {
+					if !image.Pt(x, y).In(boundingBox) {
+						next[x][y] = false
+					}
+				}
+			}
+			if equalBinary(current, next) {
+				break
+			}
+			current = next
+		}
+		hull = unionBinary(hull, current)
+	}
+
+	newImage, err := binaryToImage(hull)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
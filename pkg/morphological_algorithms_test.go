@@ -0,0 +1,189 @@
+package pkg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Helper function to create a binary test image from rows of 0s and 1s
+func createBinaryTestImage(rows []string) image.Image {
+	img := image.NewGray(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, cell := range row {
+			if cell == '1' {
+				img.Set(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+func countForeground(img image.Image) int {
+	var count int = 0
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y >= BinaryForegroundLevel {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func TestBoundaryExtractionAndHoleFilling(t *testing.T) {
+	img := createBinaryTestImage([]string{
+		"0000000",
+		"0111110",
+		"0111110",
+		"0111110",
+		"0111110",
+		"0000000",
+	})
+	square, _ := SquareStructuringElement(3)
+
+	boundary, err := BoundaryExtraction(img, square)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countForeground(boundary); got != 14 {
+		t.Errorf("boundary pixels = %d, want 14", got)
+	}
+
+	filled, err := HoleFilling(boundary, []image.Point{{3, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countForeground(filled); got != countForeground(img) {
+		t.Errorf("filled pixels = %d, want %d", got, countForeground(img))
+	}
+
+	if _, err := HoleFilling(boundary, []image.Point{{30, 2}}); err == nil {
+		t.Error("expected an error for a seed outside the image")
+	}
+}
+
+func TestHitOrMiss(t *testing.T) {
+	img := createBinaryTestImage([]string{
+		"00000",
+		"01000",
+		"00000",
+		"00110",
+		"00000",
+	})
+	// An isolated point detector: a single foreground pixel surrounded by background
+	foreground, _ := NewStructuringElement([][]uint8{{1}}, 0, 0)
+	background, _ := NewStructuringElement([][]uint8{
+		{1, 1, 1},
+		{1, 0, 1},
+		{1, 1, 1},
+	}, 1, 1)
+
+	result, err := HitOrMiss(img, foreground, background)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countForeground(result); got != 1 {
+		t.Errorf("matches = %d, want 1", got)
+	}
+	checkPixelValue(t, result, 1, 1, 255)
+}
+
+func TestThinning(t *testing.T) {
+	img := createBinaryTestImage([]string{
+		"0000000000",
+		"0111111110",
+		"0111111110",
+		"0111111110",
+		"0000000000",
+	})
+
+	thinned, err := Thinning(img, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := countForeground(thinned)
+	if got == 0 || got >= countForeground(img) {
+		t.Errorf("thinned pixels = %d, want a thinner non-empty set", got)
+	}
+	// The middle of the bar survives as a one pixel wide line
+	checkPixelValue(t, thinned, 4, 1, 0)
+	checkPixelValue(t, thinned, 4, 2, 255)
+	checkPixelValue(t, thinned, 4, 3, 0)
+	// Every remaining pixel must come from the original
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 10; x++ {
+			if thinned.(*image.Gray).GrayAt(x, y).Y != 0 && img.(*image.Gray).GrayAt(x, y).Y == 0 {
+				t.Errorf("thinning added pixel (%d,%d)", x, y)
+			}
+		}
+	}
+}
+
+func TestSkeletonReconstruction(t *testing.T) {
+	img := createBinaryTestImage([]string{
+		"000000000",
+		"011111110",
+		"011111110",
+		"011111110",
+		"011100000",
+		"011100000",
+		"000000000",
+	})
+	square, _ := SquareStructuringElement(3)
+
+	skeleton, subsets, err := Skeletonise(img, square)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countForeground(skeleton) >= countForeground(img) {
+		t.Error("skeleton is not smaller than the original")
+	}
+
+	reconstructed, err := SkeletonReconstruction(subsets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 9; x++ {
+			checkPixelValue(t, reconstructed, x, y, img.(*image.Gray).GrayAt(x, y).Y)
+		}
+	}
+}
+
+func TestSkeletoniseSinglePixelElement(t *testing.T) {
+	img := createBinaryTestImage([]string{
+		"0000",
+		"0110",
+		"0110",
+		"0000",
+	})
+	square, _ := SquareStructuringElement(1)
+	disk, _ := DiskStructuringElement(0)
+	line, _ := LineStructuringElement(1, 45)
+	for _, element := range []StructuringElement{square, disk, line} {
+		if _, _, err := Skeletonise(img, element); err == nil {
+			t.Error("expected an error for an element that erodes nothing")
+		}
+	}
+}
+
+func TestConvexHull(t *testing.T) {
+	img := createBinaryTestImage([]string{
+		"0000000",
+		"0111110",
+		"0100010",
+		"0100010",
+		"0111110",
+		"0000000",
+	})
+
+	hull, err := ConvexHull(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countForeground(hull); got != 20 {
+		t.Errorf("hull pixels = %d, want 20", got)
+	}
+}
@@ -0,0 +1,457 @@
+// Morphological reconstruction and grayscale morphology: geodesic operations, top-hat, gradient, granulometry
+package pkg
+
+import (
+	"fmt"
+	"image"
+)
+
+type GranulometryResult struct {
+	Radii        []int
+	SurfaceAreas []float64
+	// Differences[i] is SurfaceAreas[i] - SurfaceAreas[i+1], peaks show the dominant particle sizes
+	Differences []float64
+}
+
+func subtractLevels(first [][]uint8, second [][]uint8) [][]uint8 {
+	var result [][]uint8 = newLevels(len(first), len(first[0]))
+	for x := range first {
+		for y := range first[x] {
+			result[x][y] = clampLevel(int(first[x][y]) - int(second[x][y]))
+		}
+	}
+	return result
+}
+
+func complementLevels(levels [][]uint8) [][]uint8 {
+	var result [][]uint8 = newLevels(len(levels), len(levels[0]))
+	for x := range levels {
+		for y := range levels[x] {
+			result[x][y] = uint8(MaxGrayscaleLevels-1) - levels[x][y]
+		}
+	}
+	return result
+}
+
+func pointwiseMinimum(first [][]uint8, second [][]uint8) [][]uint8 {
+	var result [][]uint8 = newLevels(len(first), len(first[0]))
+	for x := range first {
+		for y := range first[x] {
+			result[x][y] = first[x][y]
+			if second[x][y] < first[x][y] {
+				result[x][y] = second[x][y]
+			}
+		}
+	}
+	return result
+}
+
+func pointwiseMaximum(first [][]uint8, second [][]uint8) [][]uint8 {
+	var result [][]uint8 = newLevels(len(first), len(first[0]))
+	for x := range first {
+		for y := range first[x] {
+			result[x][y] = first[x][y]
+			if second[x][y] > first[x][y] {
+				result[x][y] = second[x][y]
+			}
+		}
+	}
+	return result
+}
+
+func checkSameSize(first [][]uint8, second [][]uint8) error {
+	if len(first) == 0 || len(second) == 0 {
+		return fmt.Errorf("empty image")
+	}
+	if len(first) != len(second) || len(first[0]) != len(second[0]) {
+		return fmt.Errorf("image dimensions differ, %dx%d and %dx%d", len(first), len(first[0]), len(second), len(second[0]))
+	}
+	return nil
+}
+
+func reconstructLevels(marker [][]uint8, mask [][]uint8, element StructuringElement, byDilation bool) [][]uint8 {
+	// Iterating geodesic dilations (or erosions) until stability as in Section 9.6.4 is slow
+	// for large images, so the updates are done in place with alternating raster and
+	// anti-raster scans. Both reach the same fixed point, this one in far fewer passes.
+	var result [][]uint8
+	var offsets []elementOffset
+	if byDilation {
+		result = pointwiseMinimum(marker, mask)
+		offsets = element.reflectedOffsets()
+	} else {
+		result = pointwiseMaximum(marker, mask)
+		offsets = element.offsets()
+	}
+	var width int = len(result)
+	var height int = len(result[0])
+
+	update := func(x int, y int) bool {
+		var level uint8 = result[x][y]
+		for _, offset := range offsets {
+			neighbourX := x + offset.dx
+			neighbourY := y + offset.dy
+			if neighbourX < 0 || neighbourY < 0 || neighbourX >= width || neighbourY >= height {
+				continue
+			}
+			neighbour := result[neighbourX][neighbourY]
+			if byDilation && neighbour > level {
+				level = neighbour
+			}
+			if !byDilation && neighbour < level {
+				level = neighbour
+			}
+		}
+		if byDilation && level > mask[x][y] {
+			level = mask[x][y]
+		}
+		if !byDilation && level < mask[x][y] {
+			level = mask[x][y]
+		}
+		if level == result[x][y] {
+			return false
+		}
+		result[x][y] = level
+		return true
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				if update(x, y) {
+					changed = true
+				}
+			}
+		}
+		for y := height - 1; y >= 0; y-- {
+			for x := width - 1; x >= 0; x-- {
+				if update(x, y) {
+					changed = true
+				}
+			}
+		}
+	}
+	return result
+}
+
+func borderMarker(levels [][]uint8, inside uint8) [][]uint8 {
+	// Marker that keeps the image on its border and sets every other pixel to inside
+	var marker [][]uint8 = newLevels(len(levels), len(levels[0]))
+	for x := range levels {
+		for y := range levels[x] {
+			if x == 0 || y == 0 || x == len(levels)-1 || y == len(levels[x])-1 {
+				marker[x][y] = levels[x][y]
+			} else {
+				marker[x][y] = inside
+			}
+		}
+	}
+	return marker
+}
+
+func GeodesicDilation(marker image.Image, mask image.Image, element StructuringElement, size int) (image.Image, error) {
+	// This is from Section 9.6.4 of DIP book
+	// D_G^(n)(F) = D_G^(1)(D_G^(n-1)(F)), with D_G^(1)(F) = (F dilate B) min G
+	var markerLevels [][]uint8 = imageToLevels(marker)
+	var maskLevels [][]uint8 = imageToLevels(mask)
+	if err := checkSameSize(markerLevels, maskLevels); err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	if size < 1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("size must be at least 1, got %d", size)
+	}
+
+	var result [][]uint8 = pointwiseMinimum(markerLevels, maskLevels)
+	for i := 0; i < size; i++ {
+		result = pointwiseMinimum(dilateLevels(result, element), maskLevels)
+	}
+
+	newImage, err := levelsToImage(result)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func GeodesicErosion(marker image.Image, mask image.Image, element StructuringElement, size int) (image.Image, error) {
+	// This is from Section 9.6.4 of DIP book
+	// E_G^(n)(F) = E_G^(1)(E_G^(n-1)(F)), with E_G^(1)(F) = (F erode B) max G
+	var markerLevels [][]uint8 = imageToLevels(marker)
+	var maskLevels [][]uint8 = imageToLevels(mask)
+	if err := checkSameSize(markerLevels, maskLevels); err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	if size < 1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("size must be at least 1, got %d", size)
+	}
+
+	var result [][]uint8 = pointwiseMaximum(markerLevels, maskLevels)
+	for i := 0; i < size; i++ {
+		result = pointwiseMaximum(erodeLevels(result, element), maskLevels)
+	}
+
+	newImage, err := levelsToImage(result)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func ReconstructionByDilation(marker image.Image, mask image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.6.4 of DIP book
+	var markerLevels [][]uint8 = imageToLevels(marker)
+	var maskLevels [][]uint8 = imageToLevels(mask)
+	if err := checkSameSize(markerLevels, maskLevels); err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	newImage, err := levelsToImage(reconstructLevels(markerLevels, maskLevels, element, true))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func ReconstructionByErosion(marker image.Image, mask image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.6.4 of DIP book
+	var markerLevels [][]uint8 = imageToLevels(marker)
+	var maskLevels [][]uint8 = imageToLevels(mask)
+	if err := checkSameSize(markerLevels, maskLevels); err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	newImage, err := levelsToImage(reconstructLevels(markerLevels, maskLevels, element, false))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func OpeningByReconstruction(img image.Image, element StructuringElement, size int) (image.Image, error) {
+	// This is from Section 9.6.4 of DIP book
+	// O_R^(n)(F) = R_F^D[(F erode nB)], reconstruction uses the 3x3 square
+	if size < 1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("size must be at least 1, got %d", size)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	square, err := SquareStructuringElement(3)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	var marker [][]uint8 = levels
+	for i := 0; i < size; i++ {
+		marker = erodeLevels(marker, element)
+	}
+
+	newImage, err := levelsToImage(reconstructLevels(marker, levels, square, true))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func ClosingByReconstruction(img image.Image, element StructuringElement, size int) (image.Image, error) {
+	// This is from Section 9.6.4 of DIP book
+	// C_R^(n)(F) = R_F^E[(F dilate nB)], reconstruction uses the 3x3 square
+	if size < 1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("size must be at least 1, got %d", size)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	square, err := SquareStructuringElement(3)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	var marker [][]uint8 = levels
+	for i := 0; i < size; i++ {
+		marker = dilateLevels(marker, element)
+	}
+
+	newImage, err := levelsToImage(reconstructLevels(marker, levels, square, false))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func FillHoles(img image.Image) (image.Image, error) {
+	// This is from Section 9.5.9 of DIP book
+	// H = [R_I^c^D(F)]^c with F = 1 - I on the border and 0 elsewhere. Working on
+	// levels instead of a binary image also fills dark holes in grayscale images.
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	square, err := SquareStructuringElement(3)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	var complement [][]uint8 = complementLevels(levels)
+	var marker [][]uint8 = borderMarker(complement, 0)
+
+	newImage, err := levelsToImage(complementLevels(reconstructLevels(marker, complement, square, true)))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func ClearBorder(img image.Image) (image.Image, error) {
+	// This is from Section 9.5.9 of DIP book
+	// X = I - R_I^D(F) with F = I on the border and 0 elsewhere
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	square, err := SquareStructuringElement(3)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	var marker [][]uint8 = borderMarker(levels, 0)
+
+	newImage, err := levelsToImage(subtractLevels(levels, reconstructLevels(marker, levels, square, true)))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func TopHat(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.6.3 of DIP book
+	// T_hat(f) = f - (f open b), useful for correcting uneven illumination
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	var opened [][]uint8 = dilateLevels(erodeLevels(levels, element), element)
+
+	newImage, err := levelsToImage(subtractLevels(levels, opened))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func BottomHat(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.6.3 of DIP book
+	// B_hat(f) = (f close b) - f
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	var closed [][]uint8 = erodeLevels(dilateLevels(levels, element), element)
+
+	newImage, err := levelsToImage(subtractLevels(closed, levels))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func MorphologicalGradient(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.6.3 of DIP book
+	// g = (f dilate b) - (f erode b)
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	newImage, err := levelsToImage(subtractLevels(dilateLevels(levels, element), erodeLevels(levels, element)))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func Granulometry(img image.Image, maxRadius int) (GranulometryResult, error) {
+	// This is from Section 9.6.3 of DIP book
+	// The image is smoothed with an opening and closing, then opened with disks of
+	// increasing radius. The drop in surface area between consecutive openings is
+	// largest at the radius matching the dominant particle size.
+	var result GranulometryResult
+	if maxRadius < 1 {
+		return result, fmt.Errorf("maximum radius must be at least 1, got %d", maxRadius)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return result, fmt.Errorf("empty image")
+	}
+
+	smoothing, err := DiskStructuringElement(1)
+	if err != nil {
+		return result, err
+	}
+	levels = dilateLevels(erodeLevels(levels, smoothing), smoothing)
+	levels = erodeLevels(dilateLevels(levels, smoothing), smoothing)
+
+	for radius := 1; radius <= maxRadius; radius++ {
+		disk, err := DiskStructuringElement(radius)
+		if err != nil {
+			return result, err
+		}
+		opened := dilateLevels(erodeLevels(levels, disk), disk)
+
+		var surfaceArea float64 = 0
+		for x := range opened {
+			for y := range opened[x] {
+				surfaceArea += float64(opened[x][y])
+			}
+		}
+		result.Radii = append(result.Radii, radius)
+		result.SurfaceAreas = append(result.SurfaceAreas, surfaceArea)
+	}
+
+	for index := 0; index+1 < len(result.SurfaceAreas); index++ {
+		result.Differences = append(result.Differences, result.SurfaceAreas[index]-result.SurfaceAreas[index+1])
+	}
+	return result, nil
+}
+
+func TexturalSegmentation(img image.Image, smallBlobRadius int, gapRadius int) (image.Image, image.Image, error) {
+	// This is from Section 9.6.3 of DIP book
+	// 1. Closing with a disk larger than the small dark blobs removes them
+	// 2. Opening with a disk larger than the gaps between the large blobs joins them into a region
+	// 3. The morphological gradient of the result is the boundary between the two textures
+	// Returns the region image and the boundary image
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	small, err := DiskStructuringElement(smallBlobRadius)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	gap, err := DiskStructuringElement(gapRadius)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	square, err := SquareStructuringElement(3)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	var regions [][]uint8 = erodeLevels(dilateLevels(levels, small), small)
+	regions = dilateLevels(erodeLevels(regions, gap), gap)
+	var boundary [][]uint8 = subtractLevels(dilateLevels(regions, square), erodeLevels(regions, square))
+
+	regionImage, err := levelsToImage(regions)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	boundaryImage, err := levelsToImage(boundary)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return regionImage, boundaryImage, nil
+}
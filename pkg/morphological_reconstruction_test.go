@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"image"
+	"testing"
+)
+
+func TestReconstructionByDilation(t *testing.T) {
+	mask := createBinaryTestImage([]string{
+		"000000000",
+		"011100110",
+		"011100110",
+		"000000000",
+		"011111100",
+		"000000000",
+	})
+	// The marker touches the first and last objects only
+	marker := createBinaryTestImage([]string{
+		"000000000",
+		"001000000",
+		"000000000",
+		"000000000",
+		"000001000",
+		"000000000",
+	})
+	square, _ := SquareStructuringElement(3)
+
+	reconstructed, err := ReconstructionByDilation(marker, mask, square)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, reconstructed, 1, 1, 255)
+	checkPixelValue(t, reconstructed, 1, 4, 255)
+	checkPixelValue(t, reconstructed, 6, 1, 0)
+
+	// Iterating geodesic dilations long enough reaches the same result
+	iterated, err := GeodesicDilation(marker, mask, square, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 9; x++ {
+			checkPixelValue(t, iterated, x, y, reconstructed.(*image.Gray).GrayAt(x, y).Y)
+		}
+	}
+
+	if _, err := ReconstructionByDilation(marker, createTestImage(2, 2, nil), square); err == nil {
+		t.Error("expected an error for images of different sizes")
+	}
+}
+
+func TestFillHolesAndClearBorder(t *testing.T) {
+	img := createBinaryTestImage([]string{
+		"110000000",
+		"100011111",
+		"000010001",
+		"000010101",
+		"000010001",
+		"000011111",
+		"000000000",
+	})
+
+	filled, err := FillHoles(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, filled, 5, 2, 255)
+	checkPixelValue(t, filled, 6, 3, 255)
+	checkPixelValue(t, filled, 2, 2, 0)
+
+	inner := createBinaryTestImage([]string{
+		"110000000",
+		"100000000",
+		"000011100",
+		"000011100",
+		"000000000",
+	})
+	cleared, err := ClearBorder(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, cleared, 0, 0, 0)
+	checkPixelValue(t, cleared, 0, 1, 0)
+	checkPixelValue(t, cleared, 4, 2, 255)
+}
+
+func TestTopHatRemovesBackground(t *testing.T) {
+	// A gently sloping background with a single bright spot
+	var values []uint8
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			values = append(values, uint8(50+5*x))
+		}
+	}
+	values[4*9+4] = 200
+	img := createTestImage(9, 9, values)
+	disk, _ := DiskStructuringElement(2)
+
+	topHat, err := TopHat(img, disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, topHat, 2, 0, 0)
+	checkPixelValue(t, topHat, 6, 8, 0)
+	if got := topHat.(*image.Gray).GrayAt(4, 4).Y; got < 100 {
+		t.Errorf("top-hat of the bright spot = %d, want at least 100", got)
+	}
+
+	gradient, err := MorphologicalGradient(img, disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gradient.(*image.Gray).GrayAt(4, 4).Y; got < 100 {
+		t.Errorf("gradient at the bright spot = %d, want at least 100", got)
+	}
+}
+
+func TestGranulometry(t *testing.T) {
+	result, err := Granulometry(createTestImage(20, 20, nil), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.SurfaceAreas) != 3 || len(result.Differences) != 2 {
+		t.Errorf("got %d areas and %d differences, want 3 and 2", len(result.SurfaceAreas), len(result.Differences))
+	}
+
+	if _, err := Granulometry(createTestImage(20, 20, nil), 0); err == nil {
+		t.Error("expected an error for a zero radius")
+	}
+}
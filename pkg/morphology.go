@@ -0,0 +1,406 @@
+// Morphological image processing: structuring elements, erosion, dilation, opening and closing
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Pixels at or above this level are treated as foreground by the binary operations
+const BinaryForegroundLevel uint8 = 128
+
+// StructuringElement follows the same layout as the filter masks, Mask[row][col]
+// covers the offset (row-OriginX, col-OriginY) from the pixel being processed.
+// Heights is only used by the grayscale operations, a nil Heights is a flat element.
+type StructuringElement struct {
+	Mask    [][]bool
+	Heights [][]int
+	OriginX int
+	OriginY int
+}
+
+type elementOffset struct {
+	dx     int
+	dy     int
+	height int
+}
+
+func NewStructuringElement(mask [][]uint8, originX int, originY int) (StructuringElement, error) {
+	return NewNonFlatStructuringElement(mask, nil, originX, originY)
+}
+
+func NewNonFlatStructuringElement(mask [][]uint8, heights [][]int, originX int, originY int) (StructuringElement, error) {
+	if len(mask) == 0 || len(mask[0]) == 0 {
+		return StructuringElement{}, fmt.Errorf("empty structuring element")
+	}
+	if originX < 0 || originX >= len(mask) || originY < 0 || originY >= len(mask[0]) {
+		return StructuringElement{}, fmt.Errorf("origin (%d,%d) is outside the structuring element", originX, originY)
+	}
+	if heights != nil && len(heights) != len(mask) {
+		return StructuringElement{}, fmt.Errorf("heights and mask dimensions differ")
+	}
+
+	var element StructuringElement = StructuringElement{OriginX: originX, OriginY: originY}
+	var members int = 0
+
+	for rowIndex, row := range mask {
+		if len(row) != len(mask[0]) {
+			return StructuringElement{}, fmt.Errorf("inconsistent structuring element dimensions at row %d", rowIndex)
+		}
+		if heights != nil && len(heights[rowIndex]) != len(row) {
+			return StructuringElement{}, fmt.Errorf("heights and mask dimensions differ at row %d", rowIndex)
+		}
+		var maskRow []bool = make([]bool, len(row))
+		for colIndex, cell := range row {
+			maskRow[colIndex] = cell != 0
+			if cell != 0 {
+				members++
+			}
+		}
+		element.Mask = append(element.Mask, maskRow)
+	}
+	if members == 0 {
+		return StructuringElement{}, fmt.Errorf("structuring element has no members")
+	}
+
+	if heights != nil {
+		for _, row := range heights {
+			element.Heights = append(element.Heights, append([]int(nil), row...))
+		}
+	}
+	return element, nil
+}
+
+func SquareStructuringElement(size int) (StructuringElement, error) {
+	if size < 1 {
+		return StructuringElement{}, fmt.Errorf("size must be at least 1, got %d", size)
+	}
+	var mask [][]uint8 = make([][]uint8, size)
+	for rowIndex := range mask {
+		mask[rowIndex] = make([]uint8, size)
+		for colIndex := range mask[rowIndex] {
+			mask[rowIndex][colIndex] = 1
+		}
+	}
+	return NewStructuringElement(mask, size/2, size/2)
+}
+
+func DiskStructuringElement(radius int) (StructuringElement, error) {
+	if radius < 0 {
+		return StructuringElement{}, fmt.Errorf("radius must not be negative, got %d", radius)
+	}
+	var size int = 2*radius + 1
+	var mask [][]uint8 = make([][]uint8, size)
+	for rowIndex := range mask {
+		mask[rowIndex] = make([]uint8, size)
+		for colIndex := range mask[rowIndex] {
+			dx := rowIndex - radius
+			dy := colIndex - radius
+			if dx*dx+dy*dy <= radius*radius {
+				mask[rowIndex][colIndex] = 1
+			}
+		}
+	}
+	return NewStructuringElement(mask, radius, radius)
+}
+
+func CrossStructuringElement(size int) (StructuringElement, error) {
+	if size < 1 || size%2 == 0 {
+		return StructuringElement{}, fmt.Errorf("size must be a positive odd number, got %d", size)
+	}
+	var mask [][]uint8 = make([][]uint8, size)
+	for rowIndex := range mask {
+		mask[rowIndex] = make([]uint8, size)
+		for colIndex := range mask[rowIndex] {
+			if rowIndex == size/2 || colIndex == size/2 {
+				mask[rowIndex][colIndex] = 1
+			}
+		}
+	}
+	return NewStructuringElement(mask, size/2, size/2)
+}
+
+func LineStructuringElement(length int, angle float64) (StructuringElement, error) {
+	// Length is the number of pixels along the dominant axis, angle is in degrees
+	// measured from the x axis towards the y axis
+	if length < 1 {
+		return StructuringElement{}, fmt.Errorf("length must be at least 1, got %d", length)
+	}
+	var radians float64 = angle * math.Pi / 180.0
+	var cosine float64 = math.Cos(radians)
+	var sine float64 = math.Sin(radians)
+	var reach int = length / 2
+	var size int = 2*reach + 1
+
+	var mask [][]uint8 = make([][]uint8, size)
+	for rowIndex := range mask {
+		mask[rowIndex] = make([]uint8, size)
+	}
+	for step := 0; step < length; step++ {
+		t := float64(step - (length-1)/2)
+		var dx, dy int
+		if math.Abs(cosine) >= math.Abs(sine) {
+			dx = int(t * math.Copysign(1, cosine))
+			dy = int(math.Round(t * sine / math.Abs(cosine)))
+		} else {
+			dx = int(math.Round(t * cosine / math.Abs(sine)))
+			dy = int(t * math.Copysign(1, sine))
+		}
+		mask[dx+reach][dy+reach] = 1
+	}
+	return NewStructuringElement(mask, reach, reach)
+}
+
+func (element StructuringElement) offsets() []elementOffset {
+	var offsets []elementOffset
+	for rowIndex, row := range element.Mask {
+		for colIndex, member := range row {
+			if !member {
+				continue
+			}
+			var height int = 0
+			if element.Heights != nil {
+				height = element.Heights[rowIndex][colIndex]
+			}
+			offsets = append(offsets, elementOffset{rowIndex - element.OriginX, colIndex - element.OriginY, height})
+		}
+	}
+	return offsets
+}
+
+func (element StructuringElement) reflectedOffsets() []elementOffset {
+	var offsets []elementOffset = element.offsets()
+	for index := range offsets {
+		offsets[index].dx = -offsets[index].dx
+		offsets[index].dy = -offsets[index].dy
+	}
+	return offsets
+}
+
+func imageToBinary(img image.Image) [][]bool {
+	var levels [][]uint8 = imageToLevels(img)
+	var pixels [][]bool = make([][]bool, len(levels))
+	for x, column := range levels {
+		pixels[x] = make([]bool, len(column))
+		for y, level := range column {
+			pixels[x][y] = level >= BinaryForegroundLevel
+		}
+	}
+	return pixels
+}
+
+func binaryToImage(pixels [][]bool) (image.Image, error) {
+	var levels [][]uint8 = make([][]uint8, len(pixels))
+	for x, column := range pixels {
+		levels[x] = make([]uint8, len(column))
+		for y, foreground := range column {
+			if foreground {
+				levels[x][y] = uint8(MaxGrayscaleLevels - 1)
+			}
+		}
+	}
+	return levelsToImage(levels)
+}
+
+func newBinary(width int, height int) [][]bool {
+	pixels := make([][]bool, width)
+	for x := range pixels {
+		pixels[x] = make([]bool, height)
+	}
+	return pixels
+}
+
+func binaryAt(pixels [][]bool, x int, y int) bool {
+	// Everything outside the image is background
+	if x < 0 || y < 0 || x >= len(pixels) || y >= len(pixels[x]) {
+		return false
+	}
+	return pixels[x][y]
+}
+
+func erodeBinary(pixels [][]bool, offsets []elementOffset) [][]bool {
+	var result [][]bool = newBinary(len(pixels), len(pixels[0]))
+
+	for x := range pixels {
+		for y := range pixels[x] {
+			var contained bool = true
+			for _, offset := range offsets {
+				if !binaryAt(pixels, x+offset.dx, y+offset.dy) {
+					contained = false
+					break
+				}
+			}
+			result[x][y] = contained
+		}
+	}
+	return result
+}
+
+func dilateBinary(pixels [][]bool, offsets []elementOffset) [][]bool {
+	var result [][]bool = newBinary(len(pixels), len(pixels[0]))
+
+	for x := range pixels {
+		for y := range pixels[x] {
+			for _, offset := range offsets {
+				if binaryAt(pixels, x-offset.dx, y-offset.dy) {
+					result[x][y] = true
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+func BinaryErosion(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.2.1 of DIP book
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	newImage, err := binaryToImage(erodeBinary(pixels, element.offsets()))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func BinaryDilation(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.2.2 of DIP book
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	newImage, err := binaryToImage(dilateBinary(pixels, element.offsets()))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func BinaryOpening(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.3 of DIP book
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	var offsets []elementOffset = element.offsets()
+
+	newImage, err := binaryToImage(dilateBinary(erodeBinary(pixels, offsets), offsets))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func BinaryClosing(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.3 of DIP book
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	var offsets []elementOffset = element.offsets()
+
+	newImage, err := binaryToImage(erodeBinary(dilateBinary(pixels, offsets), offsets))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func morphologyWindow(levels [][]uint8, offsets []elementOffset, heightSign int, statisticFn orderStatistic) [][]uint8 {
+	// Same idea as NonlinearSmoothingSpatialFilter, except the window is the support
+	// of the structuring element and every level is shifted by the element height.
+	// Clamping before MinOrder / MaxOrder is safe because clamping is monotonic.
+	var result [][]uint8 = newLevels(len(levels), len(levels[0]))
+	var window [][]uint8 = [][]uint8{make([]uint8, 0, len(offsets))}
+
+	for x := range levels {
+		for y := range levels[x] {
+			window[0] = window[0][:0]
+			for _, offset := range offsets {
+				neighbourX := x + offset.dx
+				neighbourY := y + offset.dy
+				if neighbourX < 0 || neighbourY < 0 || neighbourX >= len(levels) || neighbourY >= len(levels[x]) {
+					continue
+				}
+				window[0] = append(window[0], clampLevel(int(levels[neighbourX][neighbourY])+heightSign*offset.height))
+			}
+			if len(window[0]) == 0 {
+				result[x][y] = levels[x][y]
+				continue
+			}
+			result[x][y] = statisticFn(window)
+		}
+	}
+	return result
+}
+
+func erodeLevels(levels [][]uint8, element StructuringElement) [][]uint8 {
+	// [f erode b](x, y) = min { f(x+s, y+t) - b(s, t) }
+	return morphologyWindow(levels, element.offsets(), -1, MinOrder)
+}
+
+func dilateLevels(levels [][]uint8, element StructuringElement) [][]uint8 {
+	// [f dilate b](x, y) = max { f(x-s, y-t) + b(s, t) }
+	return morphologyWindow(levels, element.reflectedOffsets(), 1, MaxOrder)
+}
+
+func GrayscaleErosion(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.6.1 of DIP book
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	newImage, err := levelsToImage(erodeLevels(levels, element))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func GrayscaleDilation(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.6.1 of DIP book
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	newImage, err := levelsToImage(dilateLevels(levels, element))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func GrayscaleOpening(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.6.2 of DIP book
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	newImage, err := levelsToImage(dilateLevels(erodeLevels(levels, element), element))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func GrayscaleClosing(img image.Image, element StructuringElement) (image.Image, error) {
+	// This is from Section 9.6.2 of DIP book
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	newImage, err := levelsToImage(erodeLevels(dilateLevels(levels, element), element))
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
@@ -0,0 +1,195 @@
+package pkg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestStructuringElements(t *testing.T) {
+	tests := []struct {
+		name        string
+		element     func() (StructuringElement, error)
+		wantErr     bool
+		wantMembers int
+		wantOrigin  image.Point
+	}{
+		{
+			name:        "3x3 square",
+			element:     func() (StructuringElement, error) { return SquareStructuringElement(3) },
+			wantMembers: 9,
+			wantOrigin:  image.Point{1, 1},
+		},
+		{
+			name:        "disk of radius 2",
+			element:     func() (StructuringElement, error) { return DiskStructuringElement(2) },
+			wantMembers: 13,
+			wantOrigin:  image.Point{2, 2},
+		},
+		{
+			name:        "5x5 cross",
+			element:     func() (StructuringElement, error) { return CrossStructuringElement(5) },
+			wantMembers: 9,
+			wantOrigin:  image.Point{2, 2},
+		},
+		{
+			name:        "horizontal line",
+			element:     func() (StructuringElement, error) { return LineStructuringElement(5, 0) },
+			wantMembers: 5,
+			wantOrigin:  image.Point{2, 2},
+		},
+		{
+			name:        "diagonal line",
+			element:     func() (StructuringElement, error) { return LineStructuringElement(5, 45) },
+			wantMembers: 5,
+			wantOrigin:  image.Point{2, 2},
+		},
+		{
+			name: "arbitrary mask with corner origin",
+			element: func() (StructuringElement, error) {
+				return NewStructuringElement([][]uint8{{1, 1}, {0, 1}}, 0, 0)
+			},
+			wantMembers: 3,
+			wantOrigin:  image.Point{0, 0},
+		},
+		{
+			name: "origin outside mask",
+			element: func() (StructuringElement, error) {
+				return NewStructuringElement([][]uint8{{1, 1}, {0, 1}}, 2, 0)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "even cross",
+			element: func() (StructuringElement, error) { return CrossStructuringElement(4) },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			element, err := tt.element()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := len(element.offsets()); got != tt.wantMembers {
+				t.Errorf("members = %d, want %d", got, tt.wantMembers)
+			}
+			if element.OriginX != tt.wantOrigin.X || element.OriginY != tt.wantOrigin.Y {
+				t.Errorf("origin = (%d,%d), want %v", element.OriginX, element.OriginY, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestBinaryErosionAndDilation(t *testing.T) {
+	// 5x5 image with a 3x3 foreground square in the middle
+	img := createTestImage(5, 5, []uint8{
+		0, 0, 0, 0, 0,
+		0, 255, 255, 255, 0,
+		0, 255, 255, 255, 0,
+		0, 255, 255, 255, 0,
+		0, 0, 0, 0, 0,
+	})
+	square, _ := SquareStructuringElement(3)
+	cross, _ := CrossStructuringElement(3)
+
+	eroded, err := BinaryErosion(img, square)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			var want uint8 = 0
+			if x == 2 && y == 2 {
+				want = 255
+			}
+			checkPixelValue(t, eroded, x, y, want)
+		}
+	}
+
+	dilated, err := BinaryDilation(eroded, cross)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, dilated, 2, 2, 255)
+	checkPixelValue(t, dilated, 1, 2, 255)
+	checkPixelValue(t, dilated, 2, 3, 255)
+	checkPixelValue(t, dilated, 1, 1, 0)
+}
+
+func TestBinaryOpeningAndClosing(t *testing.T) {
+	// A 3x3 square with an isolated noise pixel, and a square with a one pixel hole
+	img := createTestImage(7, 5, []uint8{
+		255, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 255, 255, 255,
+		0, 0, 0, 0, 255, 0, 255,
+		0, 0, 0, 0, 255, 255, 255,
+		0, 0, 0, 0, 0, 0, 0,
+	})
+	square, _ := SquareStructuringElement(3)
+
+	opened, err := BinaryOpening(img, square)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, opened, 0, 0, 0)
+
+	closed, err := BinaryClosing(img, square)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, closed, 5, 2, 255)
+}
+
+func TestGrayscaleMorphology(t *testing.T) {
+	img := createTestImage(3, 3, []uint8{
+		10, 20, 30,
+		40, 50, 60,
+		70, 80, 90,
+	})
+	square, _ := SquareStructuringElement(3)
+
+	eroded, err := GrayscaleErosion(img, square)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, eroded, 1, 1, 10)
+	checkPixelValue(t, eroded, 2, 2, 50)
+
+	dilated, err := GrayscaleDilation(img, square)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, dilated, 1, 1, 90)
+	checkPixelValue(t, dilated, 0, 0, 50)
+
+	// A non-flat element lifts the dilation by its height
+	nonFlat, err := NewNonFlatStructuringElement([][]uint8{{1}}, [][]int{{5}}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lifted, err := GrayscaleDilation(img, nonFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, lifted, 1, 1, 55)
+
+	// Opening never increases and closing never decreases intensities
+	opened, _ := GrayscaleOpening(img, square)
+	closed, _ := GrayscaleClosing(img, square)
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			original := color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+			if got := opened.(*image.Gray).GrayAt(x, y).Y; got > original {
+				t.Errorf("opening at (%d,%d) = %d, above original %d", x, y, got, original)
+			}
+			if got := closed.(*image.Gray).GrayAt(x, y).Y; got < original {
+				t.Errorf("closing at (%d,%d) = %d, below original %d", x, y, got, original)
+			}
+		}
+	}
+}
@@ -0,0 +1,545 @@
+// Netpbm bitmaps, grey maps, pixmaps and arbitrary maps, plain and binary, registered with the image package
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	for _, magic := range []string{"P1", "P4"} {
+		image.RegisterFormat(string(PBMFormat), magic, decodeNetpbm, decodeNetpbmConfig)
+	}
+	for _, magic := range []string{"P2", "P5"} {
+		image.RegisterFormat(string(PGMFormat), magic, decodeNetpbm, decodeNetpbmConfig)
+	}
+	for _, magic := range []string{"P3", "P6"} {
+		image.RegisterFormat(string(PPMFormat), magic, decodeNetpbm, decodeNetpbmConfig)
+	}
+	image.RegisterFormat(string(PAMFormat), "P7", decodeNetpbm, decodeNetpbmConfig)
+}
+
+// NetpbmOptions configures EncodeNetpbm. Format is one of PBMFormat, PGMFormat,
+// PPMFormat and PAMFormat. Plain writes the ASCII variants P1, P2 and P3 instead of
+// P4, P5 and P6, PAM has only the binary one. Maxval, from 1 to 65535, is the largest
+// sample, 65535 for 16 bit images and 255 otherwise when left at 0. Bitmaps have 1.
+type NetpbmOptions struct {
+	Format ImageFormat
+	Plain  bool
+	Maxval int
+}
+
+// netpbmHeader describes the image that follows the header. PAM images may be
+// BLACKANDWHITE, GRAYSCALE or RGB, each optionally with _ALPHA, and the other
+// formats are given the matching depth.
+type netpbmHeader struct {
+	magic     byte
+	width     int
+	height    int
+	depth     int
+	maxval    int
+	tupleType string
+}
+
+func (header netpbmHeader) plain() bool {
+	return header.magic <= '3'
+}
+
+func (header netpbmHeader) bitmap() bool {
+	return header.magic == '1' || header.magic == '4'
+}
+
+func skipNetpbmSpace(reader *bufio.Reader) error {
+	// Whitespace and comments, which run from # to the end of the line
+	for {
+		next, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case next == '#':
+			if _, err := reader.ReadString('\n'); err != nil {
+				return err
+			}
+		case next == ' ' || next == '\t' || next == '\n' || next == '\r' || next == '\v' || next == '\f':
+		default:
+			return reader.UnreadByte()
+		}
+	}
+}
+
+func readNetpbmNumber(reader *bufio.Reader) (int, error) {
+	// A decimal number after any whitespace and comments. The single whitespace
+	// character that ends it is read too, as the last one of a binary header must be.
+	// A comment may also end it and is read through its newline, so that it stands for
+	// that whitespace character. Anything else is an error.
+	if err := skipNetpbmSpace(reader); err != nil {
+		return 0, err
+	}
+	var value int = 0
+	var digits int = 0
+	for {
+		next, err := reader.ReadByte()
+		if err == io.EOF && digits > 0 {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if next < '0' || next > '9' {
+			if digits == 0 {
+				return 0, fmt.Errorf("invalid character %q in Netpbm number", next)
+			}
+			switch next {
+			case ' ', '\t', '\n', '\r', '\v', '\f':
+			case '#':
+				if _, err := reader.ReadString('\n'); err != nil && err != io.EOF {
+					return 0, err
+				}
+			default:
+				return 0, fmt.Errorf("invalid character %q after Netpbm number", next)
+			}
+			break
+		}
+		value = 10*value + int(next-'0')
+		digits++
+		if value > 1<<24 {
+			return 0, fmt.Errorf("Netpbm number is too large")
+		}
+	}
+	return value, nil
+}
+
+func readPAMHeader(reader *bufio.Reader, header *netpbmHeader) error {
+	// Lines of a keyword and value up to ENDHDR
+	var tupleTypes []string
+	var found map[string]bool = map[string]bool{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "ENDHDR" {
+			break
+		}
+		if len(fields) < 2 {
+			return fmt.Errorf("PAM header line %q has no value", strings.TrimSpace(line))
+		}
+		if fields[0] == "TUPLTYPE" {
+			tupleTypes = append(tupleTypes, strings.Join(fields[1:], " "))
+			continue
+		}
+		value, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return fmt.Errorf("PAM header line %q: %v", strings.TrimSpace(line), err)
+		}
+		switch fields[0] {
+		case "WIDTH":
+			header.width = value
+		case "HEIGHT":
+			header.height = value
+		case "DEPTH":
+			header.depth = value
+		case "MAXVAL":
+			header.maxval = value
+		default:
+			return fmt.Errorf("unknown PAM header keyword %q", fields[0])
+		}
+		found[fields[0]] = true
+	}
+	for _, keyword := range []string{"WIDTH", "HEIGHT", "DEPTH", "MAXVAL"} {
+		if !found[keyword] {
+			return fmt.Errorf("PAM header has no %s", keyword)
+		}
+	}
+	header.tupleType = strings.Join(tupleTypes, " ")
+	if header.depth < 1 || header.depth > 4 {
+		return fmt.Errorf("PAM depth %d is not supported", header.depth)
+	}
+	return nil
+}
+
+func readNetpbmHeader(reader *bufio.Reader) (netpbmHeader, error) {
+	var header netpbmHeader
+	var magic []byte = make([]byte, 2)
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return header, err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '7' {
+		return header, fmt.Errorf("not a Netpbm file")
+	}
+	header.magic = magic[1]
+
+	if header.magic == '7' {
+		if err := readPAMHeader(reader, &header); err != nil {
+			return header, err
+		}
+	} else {
+		var err error
+		if header.width, err = readNetpbmNumber(reader); err != nil {
+			return header, err
+		}
+		if header.height, err = readNetpbmNumber(reader); err != nil {
+			return header, err
+		}
+		header.maxval, header.depth = 1, 1
+		if !header.bitmap() {
+			if header.maxval, err = readNetpbmNumber(reader); err != nil {
+				return header, err
+			}
+		}
+		if header.magic == '3' || header.magic == '6' {
+			header.depth = 3
+		}
+	}
+	if header.width <= 0 || header.height <= 0 || header.width > 1<<20 || header.height > 1<<20 || header.width*header.height > maxImagePixels {
+		return header, fmt.Errorf("invalid Netpbm size %dx%d", header.width, header.height)
+	}
+	if header.maxval < 1 || header.maxval > 65535 {
+		return header, fmt.Errorf("Netpbm maxval %d is not between 1 and 65535", header.maxval)
+	}
+	return header, nil
+}
+
+func netpbmColorModel(header netpbmHeader) color.Model {
+	// Grey and opaque colour images at 8 bits when maxval allows, 16 otherwise, and
+	// non-premultiplied colour for the PAM images with alpha
+	var wide bool = header.maxval > 255
+	switch {
+	case header.depth == 1 && wide:
+		return color.Gray16Model
+	case header.depth == 1:
+		return color.GrayModel
+	case header.depth == 3 && wide:
+		return color.RGBA64Model
+	case header.depth == 3:
+		return color.RGBAModel
+	case wide:
+		return color.NRGBA64Model
+	}
+	return color.NRGBAModel
+}
+
+func decodeNetpbmConfig(r io.Reader) (image.Config, error) {
+	header, err := readNetpbmHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: netpbmColorModel(header), Width: header.width, Height: header.height}, nil
+}
+
+func decodeNetpbm(r io.Reader) (image.Image, error) {
+	// Bitmaps come back as *image.Gray with black 0 and white 255. Samples are scaled
+	// from maxval to 255, or to 65535 when maxval is above 255.
+	var reader *bufio.Reader = bufio.NewReader(r)
+	header, err := readNetpbmHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var readSample func() (int, error)
+	switch {
+	case header.magic == '1':
+		readSample = func() (int, error) {
+			// Plain bitmap pixels need no space between them
+			if err := skipNetpbmSpace(reader); err != nil {
+				return 0, err
+			}
+			next, err := reader.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			if next != '0' && next != '1' {
+				return 0, fmt.Errorf("invalid character %q in plain bitmap", next)
+			}
+			return int(next - '0'), nil
+		}
+	case header.plain():
+		readSample = func() (int, error) {
+			return readNetpbmNumber(reader)
+		}
+	case header.maxval > 255:
+		readSample = func() (int, error) {
+			high, err := reader.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			low, err := reader.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			return int(high)<<8 | int(low), nil
+		}
+	default:
+		readSample = func() (int, error) {
+			next, err := reader.ReadByte()
+			return int(next), err
+		}
+	}
+
+	var rectangle image.Rectangle = image.Rect(0, 0, header.width, header.height)
+	var model color.Model = netpbmColorModel(header)
+	var img image.Image
+	var set func(x int, y int, samples []uint16)
+	switch model {
+	case color.GrayModel:
+		gray := image.NewGray(rectangle)
+		img = gray
+		set = func(x int, y int, samples []uint16) { gray.Pix[y*gray.Stride+x] = uint8(samples[0]) }
+	case color.Gray16Model:
+		gray := image.NewGray16(rectangle)
+		img = gray
+		set = func(x int, y int, samples []uint16) { gray.SetGray16(x, y, color.Gray16{samples[0]}) }
+	case color.RGBAModel, color.RGBA64Model:
+		rgba := image.NewRGBA64(rectangle)
+		img = rgba
+		set = func(x int, y int, samples []uint16) {
+			rgba.SetRGBA64(x, y, color.RGBA64{samples[0], samples[1], samples[2], 0xffff})
+		}
+		if model == color.RGBAModel {
+			rgba8 := image.NewRGBA(rectangle)
+			img = rgba8
+			set = func(x int, y int, samples []uint16) {
+				target := rgba8.Pix[y*rgba8.Stride+4*x:]
+				target[0], target[1], target[2], target[3] = uint8(samples[0]), uint8(samples[1]), uint8(samples[2]), 255
+			}
+		}
+	default:
+		// Grey with alpha is spread over the three colours
+		nrgba := image.NewNRGBA64(rectangle)
+		img = nrgba
+		set = func(x int, y int, samples []uint16) {
+			if header.depth == 2 {
+				nrgba.SetNRGBA64(x, y, color.NRGBA64{samples[0], samples[0], samples[0], samples[1]})
+				return
+			}
+			nrgba.SetNRGBA64(x, y, color.NRGBA64{samples[0], samples[1], samples[2], samples[3]})
+		}
+		if model == color.NRGBAModel {
+			nrgba8 := image.NewNRGBA(rectangle)
+			img = nrgba8
+			set = func(x int, y int, samples []uint16) {
+				target := nrgba8.Pix[y*nrgba8.Stride+4*x:]
+				if header.depth == 2 {
+					target[0], target[1], target[2], target[3] = uint8(samples[0]), uint8(samples[0]), uint8(samples[0]), uint8(samples[1])
+					return
+				}
+				target[0], target[1], target[2], target[3] = uint8(samples[0]), uint8(samples[1]), uint8(samples[2]), uint8(samples[3])
+			}
+		}
+	}
+
+	// Samples are scaled straight to the depth of the image, so 8 bit levels are
+	// rounded once rather than through 16 bits
+	var top int = 0xffff
+	if header.maxval <= 255 {
+		top = 0xff
+	}
+	var samples []uint16 = make([]uint16, header.depth)
+	var packed []byte = make([]byte, (header.width+7)/8)
+	for y := 0; y < header.height; y++ {
+		if header.magic == '4' {
+			// Binary bitmap rows are packed 8 pixels to a byte
+			if _, err := io.ReadFull(reader, packed); err != nil {
+				return nil, netpbmEOF(err)
+			}
+		}
+		for x := 0; x < header.width; x++ {
+			if header.bitmap() {
+				var bit int
+				if header.magic == '4' {
+					bit = int(packed[x/8]>>uint(7-x%8)) & 1
+				} else if bit, err = readSample(); err != nil {
+					return nil, netpbmEOF(err)
+				}
+				// 1 is black in a bitmap
+				samples[0] = uint16(top * (1 - bit))
+				set(x, y, samples)
+				continue
+			}
+			for index := range samples {
+				value, err := readSample()
+				if err != nil {
+					return nil, netpbmEOF(err)
+				}
+				if value > header.maxval {
+					return nil, fmt.Errorf("Netpbm sample %d is above maxval %d", value, header.maxval)
+				}
+				samples[index] = uint16((value*top + header.maxval/2) / header.maxval)
+			}
+			set(x, y, samples)
+		}
+	}
+	return img, nil
+}
+
+func netpbmEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func hasAlpha(img image.Image) bool {
+	var bounds image.Rectangle = img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, alpha := img.At(x, y).RGBA(); alpha != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func EncodeNetpbm(w io.Writer, img image.Image, options NetpbmOptions) error {
+	var bounds image.Rectangle = img.Bounds()
+	if bounds.Empty() {
+		return fmt.Errorf("empty image")
+	}
+	var maxval int = options.Maxval
+	if maxval == 0 {
+		maxval = 255
+		if is16BitModel(img) {
+			maxval = 65535
+		}
+	}
+	if maxval < 1 || maxval > 65535 {
+		return fmt.Errorf("Netpbm maxval %d is not between 1 and 65535", maxval)
+	}
+
+	var writer *bufio.Writer = bufio.NewWriter(w)
+	var magic int
+	var depth int = 1
+	switch options.Format {
+	case PBMFormat:
+		magic, maxval = 4, 1
+	case PGMFormat:
+		magic = 5
+	case PPMFormat:
+		magic, depth = 6, 3
+	case PAMFormat:
+		if options.Plain {
+			return fmt.Errorf("PAM has no plain variant")
+		}
+		var tupleType string = "GRAYSCALE"
+		switch {
+		case hasAlpha(img):
+			tupleType, depth = "RGB_ALPHA", 4
+		case !isGrayModel(img):
+			tupleType, depth = "RGB", 3
+		}
+		if _, err := fmt.Fprintf(writer, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH %d\nMAXVAL %d\nTUPLTYPE %s\nENDHDR\n",
+			bounds.Dx(), bounds.Dy(), depth, maxval, tupleType); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%q is not a Netpbm format", options.Format)
+	}
+	if options.Plain {
+		magic -= 3
+	}
+	if options.Format != PAMFormat {
+		var header string = fmt.Sprintf("P%d\n%d %d\n", magic, bounds.Dx(), bounds.Dy())
+		if options.Format != PBMFormat {
+			header += fmt.Sprintf("%d\n", maxval)
+		}
+		if _, err := writer.WriteString(header); err != nil {
+			return err
+		}
+	}
+
+	// Plain lines are kept to 70 characters
+	var lineLength int = 0
+	var writeSample = func(value int) error {
+		switch {
+		case options.Plain:
+			text := strconv.Itoa(value)
+			if lineLength > 0 && lineLength+1+len(text) > 70 {
+				if err := writer.WriteByte('\n'); err != nil {
+					return err
+				}
+				lineLength = 0
+			}
+			if lineLength > 0 {
+				if err := writer.WriteByte(' '); err != nil {
+					return err
+				}
+				lineLength++
+			}
+			lineLength += len(text)
+			_, err := writer.WriteString(text)
+			return err
+		case maxval > 255:
+			if err := writer.WriteByte(byte(value >> 8)); err != nil {
+				return err
+			}
+			return writer.WriteByte(byte(value))
+		}
+		return writer.WriteByte(byte(value))
+	}
+	var scale = func(value uint16) int {
+		return (int(value)*maxval + 0x7fff) / 0xffff
+	}
+
+	var packed []byte = make([]byte, (bounds.Dx()+7)/8)
+	var samples []uint16 = make([]uint16, 0, 4)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for index := range packed {
+			packed[index] = 0
+		}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if options.Format == PBMFormat {
+				// 1 is black, the levels below BinaryForegroundLevel
+				var black int = 0
+				if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < BinaryForegroundLevel {
+					black = 1
+				}
+				if options.Plain {
+					if err := writeSample(black); err != nil {
+						return err
+					}
+				} else {
+					packed[(x-bounds.Min.X)/8] |= byte(black << uint(7-(x-bounds.Min.X)%8))
+				}
+				continue
+			}
+			switch depth {
+			case 1:
+				samples = append(samples[:0], color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y)
+			case 3:
+				pixel := color.RGBA64Model.Convert(img.At(x, y)).(color.RGBA64)
+				samples = append(samples[:0], pixel.R, pixel.G, pixel.B)
+			default:
+				pixel := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+				samples = append(samples[:0], pixel.R, pixel.G, pixel.B, pixel.A)
+			}
+			for _, value := range samples {
+				if err := writeSample(scale(value)); err != nil {
+					return err
+				}
+			}
+		}
+		if options.Format == PBMFormat && !options.Plain {
+			if _, err := writer.Write(packed); err != nil {
+				return err
+			}
+		}
+		if options.Plain {
+			if err := writer.WriteByte('\n'); err != nil {
+				return err
+			}
+			lineLength = 0
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,189 @@
+package pkg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNetpbmTestdataRoundTrips(t *testing.T) {
+	gray16 := image.NewGray16(image.Rect(0, 0, 3, 1))
+	for x, level := range []uint16{0, 32800, 65535} {
+		gray16.SetGray16(x, 0, color.Gray16{level})
+	}
+	colour := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	colour.SetRGBA(0, 0, color.RGBA{255, 0, 0, 255})
+	colour.SetRGBA(1, 0, color.RGBA{0, 255, 0, 255})
+	colour.SetRGBA(0, 1, color.RGBA{0, 0, 255, 255})
+	colour.SetRGBA(1, 1, color.RGBA{128, 128, 128, 255})
+	binaryColour := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	binaryColour.SetRGBA(0, 0, color.RGBA{10, 20, 30, 255})
+	binaryColour.SetRGBA(1, 0, color.RGBA{200, 150, 100, 255})
+	colour16 := image.NewRGBA64(image.Rect(0, 0, 2, 1))
+	colour16.SetRGBA64(0, 0, color.RGBA64{0x1234, 0x5678, 0x9abc, 0xffff})
+	colour16.SetRGBA64(1, 0, color.RGBA64{1, 2, 0xffff, 0xffff})
+	rgba := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	rgba.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	rgba.SetNRGBA(1, 0, color.NRGBA{0, 0, 255, 128})
+	grayAlpha := image.NewNRGBA64(image.Rect(0, 0, 2, 1))
+	grayAlpha.SetNRGBA64(0, 0, color.NRGBA64{1000, 1000, 1000, 0xffff})
+	grayAlpha.SetNRGBA64(1, 0, color.NRGBA64{40000, 40000, 40000, 30000})
+
+	cases := []struct {
+		file     string
+		format   ImageFormat
+		plain    bool
+		maxval   int
+		expected image.Image
+		// Whether EncodeNetpbm writes the file byte for byte
+		exact bool
+	}{
+		{"plain.pbm", PBMFormat, true, 0, createTestImage(5, 3, []uint8{0, 255, 0, 255, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255}), false},
+		{"binary.pbm", PBMFormat, false, 0, createTestImage(10, 2, []uint8{
+			0, 255, 255, 255, 255, 255, 255, 255, 0, 0,
+			255, 0, 0, 0, 0, 0, 0, 0, 0, 255}), true},
+		{"plain.pgm", PGMFormat, true, 15, createTestImage(4, 2, []uint8{0, 85, 170, 255, 17, 34, 51, 238}), false},
+		{"binary.pgm", PGMFormat, false, 0, createTestImage(3, 2, []uint8{0, 64, 128, 192, 255, 7}), true},
+		{"binary16.pgm", PGMFormat, false, 1023, gray16, true},
+		{"plain.ppm", PPMFormat, true, 0, colour, false},
+		{"binary.ppm", PPMFormat, false, 0, binaryColour, true},
+		{"binary16.ppm", PPMFormat, false, 0, colour16, true},
+		{"rgba.pam", PAMFormat, false, 0, rgba, true},
+		{"gray_alpha.pam", PAMFormat, false, 0, grayAlpha, false},
+	}
+	for _, test := range cases {
+		fileName := filepath.Join("testdata", test.file)
+		img, format, err := LoadImage(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != test.format {
+			t.Errorf("%s decoded as %s, want %s", test.file, format, test.format)
+		}
+		if img.ColorModel() != test.expected.ColorModel() {
+			t.Errorf("%s decoded as %T", test.file, img)
+		}
+		checkSameColours(t, img, test.expected)
+
+		var encoded bytes.Buffer
+		if err := EncodeNetpbm(&encoded, img, NetpbmOptions{Format: test.format, Plain: test.plain, Maxval: test.maxval}); err != nil {
+			t.Fatalf("%s: %v", test.file, err)
+		}
+		if test.exact {
+			original, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encoded.Bytes(), original) {
+				t.Errorf("%s encoded as %q, want %q", test.file, encoded.Bytes(), original)
+			}
+		}
+		decoded, _, err := image.Decode(&encoded)
+		if err != nil {
+			t.Fatalf("%s: %v", test.file, err)
+		}
+		checkSameColours(t, decoded, test.expected)
+	}
+}
+
+func TestEncodePlainNetpbm(t *testing.T) {
+	img := createTestImage(3, 2, []uint8{0, 100, 200, 255, 127, 128})
+	var encoded bytes.Buffer
+	if err := EncodeImage(&encoded, img, SaveOptions{Format: PGMFormat, Plain: true}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "P2\n3 2\n255\n0 100 200\n255 127 128\n"; encoded.String() != want {
+		t.Errorf("PGM = %q, want %q", encoded.String(), want)
+	}
+	encoded.Reset()
+	if err := EncodeImage(&encoded, img, SaveOptions{Format: PBMFormat, Plain: true}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "P1\n3 2\n1 1 0\n0 1 0\n"; encoded.String() != want {
+		t.Errorf("PBM = %q, want %q", encoded.String(), want)
+	}
+
+	// Long rows are broken into lines of 70 characters at most
+	encoded.Reset()
+	if err := EncodeNetpbm(&encoded, createColourTestImage(40, 3), NetpbmOptions{Format: PPMFormat, Plain: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(encoded.String(), "\n") {
+		if len(line) > 70 {
+			t.Fatalf("line of %d characters: %q", len(line), line)
+		}
+	}
+	decoded, _, err := image.Decode(&encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameColours(t, decoded, createColourTestImage(40, 3))
+}
+
+func TestDecodeNetpbmHeaderComments(t *testing.T) {
+	// A comment right after the last header number stands for the whitespace before
+	// the raster, so its text is not read as pixels
+	img, _, err := image.Decode(strings.NewReader("P5\n2 1\n255#c\n\x01\x02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameLevels(t, img, createTestImage(2, 1, []uint8{1, 2}))
+
+	img, _, err = image.Decode(strings.NewReader("P4 # size\n8 1#c\n\x0f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameLevels(t, img, createTestImage(8, 1, []uint8{255, 255, 255, 255, 0, 0, 0, 0}))
+}
+
+func TestDecodeNetpbmScaling(t *testing.T) {
+	// Levels below maxval 255 are rounded to the nearest of 255, 1 of 100 is 2.55
+	img, _, err := image.Decode(strings.NewReader("P2\n3 1\n100\n1 50 100\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameLevels(t, img, createTestImage(3, 1, []uint8{3, 128, 255}))
+
+	img, _, err = image.Decode(strings.NewReader("P3\n1 1\n7\n1 2 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != (color.RGBA{36, 73, 109, 255}) {
+		t.Errorf("pixel = %v, want {36 73 109 255}", got)
+	}
+}
+
+func TestNetpbmErrors(t *testing.T) {
+	for _, data := range []string{
+		"P5\n2 2\n255\n\x00\x01\x02",
+		"P2\n2 1\n15\n3 16\n",
+		"P1\n2 1\n1 2\n",
+		"P5\n2 1\n0\n\x00\x00",
+		"P5\n0 1\n255\n",
+		"P5 12x34 255\n",
+		"P2\n2 1\n15\n3,4\n",
+		// Each side is allowed but the image would take a terabyte
+		"P5 1048576 1048576 255\n",
+		"P7\nWIDTH 1048576\nHEIGHT 1048576\nDEPTH 1\nMAXVAL 255\nENDHDR\n",
+		"P7\nWIDTH 1\nHEIGHT 1\nMAXVAL 255\nENDHDR\n\x00",
+		"P7\nWIDTH 1\nHEIGHT 1\nDEPTH 5\nMAXVAL 255\nENDHDR\n\x00\x00\x00\x00\x00",
+	} {
+		if _, _, err := image.Decode(strings.NewReader(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+	img := createWaveletTestImage(4, 4)
+	if err := EncodeNetpbm(&bytes.Buffer{}, img, NetpbmOptions{Format: PAMFormat, Plain: true}); err == nil {
+		t.Error("expected an error for plain PAM")
+	}
+	if err := EncodeNetpbm(&bytes.Buffer{}, img, NetpbmOptions{Format: PGMFormat, Maxval: 65536}); err == nil {
+		t.Error("expected an error for maxval 65536")
+	}
+	if err := EncodeNetpbm(&bytes.Buffer{}, img, NetpbmOptions{Format: PNGFormat}); err == nil {
+		t.Error("expected an error for PNG")
+	}
+}
@@ -0,0 +1,467 @@
+// Decision-theoretic pattern classifiers: minimum distance, correlation matching and Bayes for Gaussian classes
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Pattern is a feature vector with the class it belongs to, Class is empty for
+// patterns that are still to be classified
+type Pattern struct {
+	Features []float64 `json:"features"`
+	Class    string    `json:"class,omitempty"`
+}
+
+// Classifier learns classes from labelled patterns and assigns one of them to a
+// feature vector
+type Classifier interface {
+	Train(patterns []Pattern) error
+	Predict(features []float64) (string, error)
+}
+
+// MinimumDistanceClassifier assigns a pattern to the class with the nearest mean
+// vector. Means[j] is the mean of the training patterns of Classes[j].
+type MinimumDistanceClassifier struct {
+	Classes []string    `json:"classes"`
+	Means   [][]float64 `json:"means"`
+}
+
+// CorrelationClassifier assigns a pattern the class of the training pattern it is
+// most correlated with. The correlation coefficient ignores the offset and scale of
+// the feature vectors, so it compares their shape.
+type CorrelationClassifier struct {
+	Prototypes []Pattern `json:"prototypes"`
+}
+
+// BayesClassifier is the Bayes classifier for Gaussian pattern classes, which is
+// optimal when each class is normally distributed with the estimated mean and
+// covariance. Regularisation is added to the diagonal of every covariance matrix
+// before it is inverted, so that features that are constant within a class do not
+// make it singular. A value of zero uses 1e-6 of the mean variance.
+type BayesClassifier struct {
+	Classes        []string      `json:"classes"`
+	Priors         []float64     `json:"priors"`
+	Means          [][]float64   `json:"means"`
+	Covariances    [][][]float64 `json:"covariances"`
+	Regularisation float64       `json:"regularisation"`
+}
+
+// ConfusionMatrix counts test patterns by their true class, the row, and the
+// predicted class, the column. Classes holds the names of both in order.
+type ConfusionMatrix struct {
+	Classes []string `json:"classes"`
+	Counts  [][]int  `json:"counts"`
+}
+
+func DescriptorFeatures(descriptors RegionDescriptors) []float64 {
+	// A feature vector of the descriptors that do not depend on the position, size or
+	// rotation of the region: circularity, eccentricity, Euler number and the Hu moments.
+	// The moments span many orders of magnitude, so each is replaced by
+	// -sign(phi) log10 |phi| as is usual.
+	var features []float64 = []float64{descriptors.Circularity, descriptors.Eccentricity, float64(descriptors.EulerNumber)}
+	for _, moment := range descriptors.HuMoments {
+		if moment == 0 {
+			features = append(features, 0)
+			continue
+		}
+		features = append(features, -math.Copysign(1, moment)*math.Log10(math.Abs(moment)))
+	}
+	return features
+}
+
+func groupPatterns(patterns []Pattern) ([]string, map[string][][]float64, error) {
+	// Sorted class names and the feature vectors of each class, checking that all the
+	// vectors have the same length
+	if len(patterns) == 0 {
+		return nil, nil, fmt.Errorf("no training patterns")
+	}
+	var groups map[string][][]float64 = make(map[string][][]float64)
+	var classes []string
+	for _, pattern := range patterns {
+		if pattern.Class == "" {
+			return nil, nil, fmt.Errorf("training pattern without a class")
+		}
+		if len(pattern.Features) == 0 || len(pattern.Features) != len(patterns[0].Features) {
+			return nil, nil, fmt.Errorf("patterns have %d and %d features", len(patterns[0].Features), len(pattern.Features))
+		}
+		if _, ok := groups[pattern.Class]; !ok {
+			classes = append(classes, pattern.Class)
+		}
+		groups[pattern.Class] = append(groups[pattern.Class], pattern.Features)
+	}
+	sort.Strings(classes)
+	return classes, groups, nil
+}
+
+func (classifier *MinimumDistanceClassifier) Train(patterns []Pattern) error {
+	// This is from Section 12.2.1 of DIP book
+	// m_j = 1/N_j sum of the patterns of class w_j
+	classes, groups, err := groupPatterns(patterns)
+	if err != nil {
+		return err
+	}
+	classifier.Classes = classes
+	classifier.Means = nil
+	for _, class := range classes {
+		var mean []float64 = make([]float64, len(patterns[0].Features))
+		for _, features := range groups[class] {
+			for index, value := range features {
+				mean[index] += value
+			}
+		}
+		for index := range mean {
+			mean[index] /= float64(len(groups[class]))
+		}
+		classifier.Means = append(classifier.Means, mean)
+	}
+	return nil
+}
+
+func (classifier *MinimumDistanceClassifier) Predict(features []float64) (string, error) {
+	// The largest decision function d_j(x) = x^T m_j - 1/2 m_j^T m_j, which is the class
+	// with the smallest Euclidean distance ||x - m_j||
+	if len(classifier.Means) == 0 {
+		return "", fmt.Errorf("classifier is not trained")
+	}
+	if len(features) != len(classifier.Means[0]) {
+		return "", fmt.Errorf("pattern has %d features, want %d", len(features), len(classifier.Means[0]))
+	}
+	var best int = 0
+	var bestDecision float64 = math.Inf(-1)
+	for class, mean := range classifier.Means {
+		var decision float64 = 0
+		for index, value := range features {
+			decision += value*mean[index] - mean[index]*mean[index]/2
+		}
+		if decision > bestDecision {
+			best, bestDecision = class, decision
+		}
+	}
+	return classifier.Classes[best], nil
+}
+
+func correlationCoefficient(first []float64, second []float64) float64 {
+	// The correlation coefficient of two vectors of the same length, in [-1, 1], and 0
+	// when either of them is constant
+	var meanFirst, meanSecond float64
+	for index := range first {
+		meanFirst += first[index] / float64(len(first))
+		meanSecond += second[index] / float64(len(second))
+	}
+	var product, squaresFirst, squaresSecond float64
+	for index := range first {
+		product += (first[index] - meanFirst) * (second[index] - meanSecond)
+		squaresFirst += (first[index] - meanFirst) * (first[index] - meanFirst)
+		squaresSecond += (second[index] - meanSecond) * (second[index] - meanSecond)
+	}
+	if squaresFirst == 0 || squaresSecond == 0 {
+		return 0
+	}
+	return product / math.Sqrt(squaresFirst*squaresSecond)
+}
+
+func (classifier *CorrelationClassifier) Train(patterns []Pattern) error {
+	// Every training pattern is kept as a prototype of its class
+	if _, _, err := groupPatterns(patterns); err != nil {
+		return err
+	}
+	classifier.Prototypes = nil
+	for _, pattern := range patterns {
+		classifier.Prototypes = append(classifier.Prototypes, Pattern{
+			Features: append([]float64(nil), pattern.Features...),
+			Class:    pattern.Class,
+		})
+	}
+	return nil
+}
+
+func (classifier *CorrelationClassifier) Predict(features []float64) (string, error) {
+	// This is from Section 12.2.1 of DIP book
+	// Matching by correlation, the class of the prototype with the largest
+	// correlation coefficient
+	if len(classifier.Prototypes) == 0 {
+		return "", fmt.Errorf("classifier is not trained")
+	}
+	if len(features) != len(classifier.Prototypes[0].Features) {
+		return "", fmt.Errorf("pattern has %d features, want %d", len(features), len(classifier.Prototypes[0].Features))
+	}
+	var best int = 0
+	var bestCorrelation float64 = math.Inf(-1)
+	for index, prototype := range classifier.Prototypes {
+		correlation := correlationCoefficient(features, prototype.Features)
+		if correlation > bestCorrelation {
+			best, bestCorrelation = index, correlation
+		}
+	}
+	return classifier.Prototypes[best].Class, nil
+}
+
+func choleskyDecomposition(matrix [][]float64) ([][]float64, error) {
+	// The lower triangular L with L L^T = matrix, for a symmetric positive definite matrix
+	var size int = len(matrix)
+	var lower [][]float64 = newFloats(size, size)
+	for row := 0; row < size; row++ {
+		for column := 0; column <= row; column++ {
+			sum := matrix[row][column]
+			for k := 0; k < column; k++ {
+				sum -= lower[row][k] * lower[column][k]
+			}
+			if row == column {
+				if sum <= 0 {
+					return nil, fmt.Errorf("covariance matrix is not positive definite")
+				}
+				lower[row][row] = math.Sqrt(sum)
+			} else {
+				lower[row][column] = sum / lower[column][column]
+			}
+		}
+	}
+	return lower, nil
+}
+
+func mahalanobisTerms(covariance [][]float64, difference []float64) (float64, float64, error) {
+	// (x - m)^T C^-1 (x - m) and ln |C| from the Cholesky factor of C, solving L z = x - m
+	// so that the quadratic form is z^T z
+	lower, err := choleskyDecomposition(covariance)
+	if err != nil {
+		return 0, 0, err
+	}
+	var solved []float64 = make([]float64, len(difference))
+	var quadratic, logDeterminant float64
+	for row := range difference {
+		sum := difference[row]
+		for k := 0; k < row; k++ {
+			sum -= lower[row][k] * solved[k]
+		}
+		solved[row] = sum / lower[row][row]
+		quadratic += solved[row] * solved[row]
+		logDeterminant += 2 * math.Log(lower[row][row])
+	}
+	return quadratic, logDeterminant, nil
+}
+
+func (classifier *BayesClassifier) Train(patterns []Pattern) error {
+	// This is from Section 12.2.2 of DIP book
+	// Each class gets its mean vector, its covariance matrix and the prior P(w_j), the
+	// fraction of the training patterns in it
+	classes, groups, err := groupPatterns(patterns)
+	if err != nil {
+		return err
+	}
+	classifier.Classes = classes
+	classifier.Priors, classifier.Means, classifier.Covariances = nil, nil, nil
+	for _, class := range classes {
+		components, err := ComputePrincipalComponents(groups[class])
+		if err != nil {
+			return err
+		}
+		var covariance [][]float64 = components.Covariance
+		var ridge float64 = classifier.Regularisation
+		if ridge == 0 {
+			var trace float64 = 0
+			for index := range covariance {
+				trace += covariance[index][index]
+			}
+			ridge = math.Max(1e-6*trace/float64(len(covariance)), 1e-12)
+		}
+		for index := range covariance {
+			covariance[index][index] += ridge
+		}
+		if _, err := choleskyDecomposition(covariance); err != nil {
+			return fmt.Errorf("class %q: %v", class, err)
+		}
+		classifier.Priors = append(classifier.Priors, float64(len(groups[class]))/float64(len(patterns)))
+		classifier.Means = append(classifier.Means, components.Mean)
+		classifier.Covariances = append(classifier.Covariances, covariance)
+	}
+	return nil
+}
+
+func (classifier *BayesClassifier) Predict(features []float64) (string, error) {
+	// The largest decision function
+	// d_j(x) = ln P(w_j) - 1/2 ln |C_j| - 1/2 (x - m_j)^T C_j^-1 (x - m_j)
+	if len(classifier.Means) == 0 {
+		return "", fmt.Errorf("classifier is not trained")
+	}
+	if len(features) != len(classifier.Means[0]) {
+		return "", fmt.Errorf("pattern has %d features, want %d", len(features), len(classifier.Means[0]))
+	}
+	var best int = 0
+	var bestDecision float64 = math.Inf(-1)
+	var difference []float64 = make([]float64, len(features))
+	for class, mean := range classifier.Means {
+		for index, value := range features {
+			difference[index] = value - mean[index]
+		}
+		quadratic, logDeterminant, err := mahalanobisTerms(classifier.Covariances[class], difference)
+		if err != nil {
+			return "", fmt.Errorf("class %q: %v", classifier.Classes[class], err)
+		}
+		decision := math.Log(classifier.Priors[class]) - logDeterminant/2 - quadratic/2
+		if decision > bestDecision {
+			best, bestDecision = class, decision
+		}
+	}
+	return classifier.Classes[best], nil
+}
+
+// savedClassifier wraps a classifier with its kind so that it can be read back
+type savedClassifier struct {
+	Type       string          `json:"type"`
+	Classifier json.RawMessage `json:"classifier"`
+}
+
+func SaveClassifier(w io.Writer, classifier Classifier) error {
+	// Writes a trained classifier as JSON, LoadClassifier reads it back
+	var kind string
+	switch classifier.(type) {
+	case *MinimumDistanceClassifier:
+		kind = "minimum_distance"
+	case *CorrelationClassifier:
+		kind = "correlation"
+	case *BayesClassifier:
+		kind = "bayes"
+	default:
+		return fmt.Errorf("unknown classifier type %T", classifier)
+	}
+	encoded, err := json.Marshal(classifier)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(savedClassifier{Type: kind, Classifier: encoded})
+}
+
+func NewClassifier(kind string) (Classifier, error) {
+	// An untrained classifier: minimum_distance, correlation or bayes
+	switch kind {
+	case "minimum_distance":
+		return &MinimumDistanceClassifier{}, nil
+	case "correlation":
+		return &CorrelationClassifier{}, nil
+	case "bayes":
+		return &BayesClassifier{}, nil
+	}
+	return nil, fmt.Errorf("unknown classifier type %q", kind)
+}
+
+func LoadClassifier(r io.Reader) (Classifier, error) {
+	var saved savedClassifier
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, err
+	}
+	classifier, err := NewClassifier(saved.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(saved.Classifier, classifier); err != nil {
+		return nil, err
+	}
+	return classifier, nil
+}
+
+func EvaluateClassifier(classifier Classifier, patterns []Pattern) (ConfusionMatrix, error) {
+	// Classifies every labelled test pattern and counts the outcomes. Classes are all the
+	// true and predicted classes in sorted order.
+	var matrix ConfusionMatrix
+	if len(patterns) == 0 {
+		return matrix, fmt.Errorf("no test patterns")
+	}
+	var predictions []string
+	var seen map[string]bool = make(map[string]bool)
+	for _, pattern := range patterns {
+		if pattern.Class == "" {
+			return matrix, fmt.Errorf("test pattern without a class")
+		}
+		prediction, err := classifier.Predict(pattern.Features)
+		if err != nil {
+			return matrix, err
+		}
+		predictions = append(predictions, prediction)
+		for _, class := range []string{pattern.Class, prediction} {
+			if !seen[class] {
+				seen[class] = true
+				matrix.Classes = append(matrix.Classes, class)
+			}
+		}
+	}
+	sort.Strings(matrix.Classes)
+
+	var indices map[string]int = make(map[string]int)
+	for index, class := range matrix.Classes {
+		indices[class] = index
+	}
+	matrix.Counts = make([][]int, len(matrix.Classes))
+	for index := range matrix.Counts {
+		matrix.Counts[index] = make([]int, len(matrix.Classes))
+	}
+	for index, pattern := range patterns {
+		matrix.Counts[indices[pattern.Class]][indices[predictions[index]]]++
+	}
+	return matrix, nil
+}
+
+func (matrix ConfusionMatrix) Accuracy() float64 {
+	// The fraction of test patterns on the diagonal
+	var correct, total int
+	for row := range matrix.Counts {
+		for column, count := range matrix.Counts[row] {
+			total += count
+			if row == column {
+				correct += count
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(correct) / float64(total)
+}
+
+func (matrix ConfusionMatrix) Report() string {
+	// The counts as a table followed by the recall and precision of each class and the
+	// overall accuracy
+	var width int = len("true \\ predicted")
+	for _, class := range matrix.Classes {
+		if len(class) > width {
+			width = len(class)
+		}
+	}
+	var report strings.Builder
+	fmt.Fprintf(&report, "%-*s", width, "true \\ predicted")
+	for _, class := range matrix.Classes {
+		fmt.Fprintf(&report, " %*s", width, class)
+	}
+	report.WriteString("\n")
+	for row, class := range matrix.Classes {
+		fmt.Fprintf(&report, "%-*s", width, class)
+		for _, count := range matrix.Counts[row] {
+			fmt.Fprintf(&report, " %*d", width, count)
+		}
+		report.WriteString("\n")
+	}
+
+	for index, class := range matrix.Classes {
+		var actual, predicted int
+		for other := range matrix.Classes {
+			actual += matrix.Counts[index][other]
+			predicted += matrix.Counts[other][index]
+		}
+		var recall, precision float64
+		if actual > 0 {
+			recall = float64(matrix.Counts[index][index]) / float64(actual)
+		}
+		if predicted > 0 {
+			precision = float64(matrix.Counts[index][index]) / float64(predicted)
+		}
+		fmt.Fprintf(&report, "%s: recall %.3f, precision %.3f\n", class, recall, precision)
+	}
+	fmt.Fprintf(&report, "Accuracy: %.3f\n", matrix.Accuracy())
+	return report.String()
+}
@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func createSpreadPatterns(class string, centreX float64, centreY float64, spread float64) []Pattern {
+	// Nine patterns on a square grid around the centre
+	var patterns []Pattern
+	for _, dx := range []float64{-spread, 0, spread} {
+		for _, dy := range []float64{-spread, 0, spread} {
+			patterns = append(patterns, Pattern{Features: []float64{centreX + dx, centreY + dy}, Class: class})
+		}
+	}
+	return patterns
+}
+
+func checkPrediction(t *testing.T, classifier Classifier, features []float64, expected string) {
+	t.Helper()
+	class, err := classifier.Predict(features)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class != expected {
+		t.Errorf("%T predicts %q for %v, want %q", classifier, class, features, expected)
+	}
+}
+
+func TestMinimumDistanceClassifier(t *testing.T) {
+	patterns := append(createSpreadPatterns("round", 0, 0, 1), createSpreadPatterns("long", 5, 5, 1)...)
+	classifier := &MinimumDistanceClassifier{}
+	if err := classifier.Train(patterns); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(classifier.Classes, []string{"long", "round"}) || !reflect.DeepEqual(classifier.Means[0], []float64{5, 5}) {
+		t.Errorf("classes %v with means %v", classifier.Classes, classifier.Means)
+	}
+	checkPrediction(t, classifier, []float64{1, 0}, "round")
+	checkPrediction(t, classifier, []float64{4, 6}, "long")
+
+	if _, err := classifier.Predict([]float64{1}); err == nil {
+		t.Error("expected an error for the wrong number of features")
+	}
+	if err := classifier.Train([]Pattern{{Features: []float64{1}}}); err == nil {
+		t.Error("expected an error for a pattern without a class")
+	}
+}
+
+func TestCorrelationClassifier(t *testing.T) {
+	classifier := &CorrelationClassifier{}
+	err := classifier.Train([]Pattern{
+		{Features: []float64{1, 2, 3, 4}, Class: "rising"},
+		{Features: []float64{4, 3, 2, 1}, Class: "falling"},
+		{Features: []float64{1, 4, 4, 1}, Class: "peak"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The correlation does not depend on the offset and scale of the vector
+	checkPrediction(t, classifier, []float64{110, 120, 130, 140}, "rising")
+	checkPrediction(t, classifier, []float64{0, 0.9, 1, 0.2}, "peak")
+
+	if correlationCoefficient([]float64{1, 2, 3}, []float64{-2, -4, -6}) != -1 {
+		t.Error("expected a correlation of -1 for opposite vectors")
+	}
+}
+
+func TestBayesClassifier(t *testing.T) {
+	// Both classes have the same mean, so only their covariances tell them apart
+	patterns := append(createSpreadPatterns("smooth", 0, 0, 0.1), createSpreadPatterns("rough", 0, 0, 3)...)
+	bayes := &BayesClassifier{}
+	if err := bayes.Train(patterns); err != nil {
+		t.Fatal(err)
+	}
+	checkPrediction(t, bayes, []float64{0.05, 0}, "smooth")
+	checkPrediction(t, bayes, []float64{2.5, -2}, "rough")
+	if math.Abs(bayes.Priors[0]-0.5) > 1e-12 || math.Abs(bayes.Covariances[1][0][0]-0.1*0.1*2/3) > 1e-6 {
+		t.Errorf("priors %v and covariances %v", bayes.Priors, bayes.Covariances)
+	}
+
+	// A feature that is constant within a class is kept invertible by the regularisation
+	constant := []Pattern{
+		{Features: []float64{1, 0}, Class: "a"}, {Features: []float64{2, 0}, Class: "a"},
+		{Features: []float64{1, 5}, Class: "b"}, {Features: []float64{2, 5}, Class: "b"},
+	}
+	if err := bayes.Train(constant); err != nil {
+		t.Fatal(err)
+	}
+	checkPrediction(t, bayes, []float64{1.5, 4}, "b")
+}
+
+func TestSaveAndLoadClassifier(t *testing.T) {
+	patterns := append(createSpreadPatterns("smooth", 0, 0, 0.5), createSpreadPatterns("rough", 4, 1, 2)...)
+	for _, kind := range []string{"minimum_distance", "correlation", "bayes"} {
+		classifier, err := NewClassifier(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := classifier.Train(patterns); err != nil {
+			t.Fatal(err)
+		}
+		var buffer bytes.Buffer
+		if err := SaveClassifier(&buffer, classifier); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadClassifier(&buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, classifier) {
+			t.Errorf("%s classifier does not survive saving: %+v, want %+v", kind, loaded, classifier)
+		}
+	}
+
+	if _, err := NewClassifier("neural"); err == nil {
+		t.Error("expected an error for an unknown classifier")
+	}
+	if _, err := LoadClassifier(strings.NewReader(`{"type": "neural", "classifier": {}}`)); err == nil {
+		t.Error("expected an error for an unknown saved classifier")
+	}
+}
+
+func TestEvaluateClassifier(t *testing.T) {
+	classifier := &MinimumDistanceClassifier{}
+	if err := classifier.Train(append(createSpreadPatterns("a", 0, 0, 1), createSpreadPatterns("b", 10, 0, 1)...)); err != nil {
+		t.Fatal(err)
+	}
+	test := []Pattern{
+		{Features: []float64{1, 1}, Class: "a"},
+		{Features: []float64{6, 0}, Class: "a"},
+		{Features: []float64{9, 1}, Class: "b"},
+		{Features: []float64{11, 0}, Class: "b"},
+	}
+	matrix, err := EvaluateClassifier(classifier, test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(matrix.Counts, [][]int{{1, 1}, {0, 2}}) {
+		t.Errorf("confusion matrix = %v", matrix.Counts)
+	}
+	if matrix.Accuracy() != 0.75 {
+		t.Errorf("accuracy = %v, want 0.75", matrix.Accuracy())
+	}
+	report := matrix.Report()
+	for _, line := range []string{"a: recall 0.500, precision 1.000", "b: recall 1.000, precision 0.667", "Accuracy: 0.750"} {
+		if !strings.Contains(report, line) {
+			t.Errorf("report does not contain %q:\n%s", line, report)
+		}
+	}
+}
+
+func TestDescriptorFeatures(t *testing.T) {
+	features := DescriptorFeatures(RegionDescriptors{Circularity: 0.9, Eccentricity: 0.1, EulerNumber: 1, HuMoments: [7]float64{0.01, 0, -0.001}})
+	if len(features) != 10 {
+		t.Fatalf("got %d features, want 10", len(features))
+	}
+	if features[3] != 2 || features[4] != 0 || features[5] != -3 {
+		t.Errorf("log scaled moments = %v", features[3:])
+	}
+}
@@ -0,0 +1,432 @@
+// Lossless predictive coding and lossy DPCM with delta modulation and Lloyd-Max quantisers
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+)
+
+// Predictor estimates a pixel from its neighbours a to the left, b above and c above
+// left, which have already been coded in raster order
+type Predictor int
+
+const (
+	// PreviousPixelPredictor predicts a
+	PreviousPixelPredictor Predictor = iota
+	// AbovePredictor predicts b
+	AbovePredictor
+	// AveragePredictor predicts (a + b) / 2
+	AveragePredictor
+	// PlanarPredictor predicts a + b - c, the plane through the three neighbours
+	PlanarPredictor
+	// MEDPredictor is the median edge detector of JPEG-LS: min(a, b) or max(a, b)
+	// when c suggests an edge, otherwise the planar prediction
+	MEDPredictor
+)
+
+// Predictors lists every Predictor
+var Predictors []Predictor = []Predictor{
+	PreviousPixelPredictor, AbovePredictor, AveragePredictor, PlanarPredictor, MEDPredictor,
+}
+
+func (predictor Predictor) String() string {
+	switch predictor {
+	case PreviousPixelPredictor:
+		return "previous"
+	case AbovePredictor:
+		return "above"
+	case AveragePredictor:
+		return "average"
+	case PlanarPredictor:
+		return "planar"
+	case MEDPredictor:
+		return "med"
+	}
+	return fmt.Sprintf("Predictor(%d)", int(predictor))
+}
+
+func (predictor Predictor) valid() bool {
+	return predictor >= PreviousPixelPredictor && predictor <= MEDPredictor
+}
+
+// The prediction errors of 8 bit levels run from -255 to 255
+const predictionErrorOffset int = 255
+
+// PredictiveCodingReport describes the result of PredictiveCode. ErrorHistogram counts
+// the prediction errors, error e at index e + 255. EntropySaving is ImageEntropy minus
+// ErrorEntropy, both first-order in bits per pixel. Bits is the size of the errors
+// coded with the adaptive arithmetic coder and CompressionRatio is 8 bits per pixel
+// over AverageCodeLength.
+type PredictiveCodingReport struct {
+	Predictor         Predictor
+	ErrorHistogram    []int
+	ImageEntropy      float64
+	ErrorEntropy      float64
+	EntropySaving     float64
+	Bits              int
+	AverageCodeLength float64
+	CompressionRatio  float64
+}
+
+func predict(values [][]float64, x int, y int, predictor Predictor) float64 {
+	// Along the first row only a is known and down the first column only b, and the
+	// first pixel is predicted as mid grey
+	switch {
+	case x == 0 && y == 0:
+		return float64(MaxGrayscaleLevels / 2)
+	case y == 0:
+		return values[x-1][y]
+	case x == 0:
+		return values[x][y-1]
+	}
+	var a, b, c float64 = values[x-1][y], values[x][y-1], values[x-1][y-1]
+	var prediction float64
+	switch predictor {
+	case PreviousPixelPredictor:
+		prediction = a
+	case AbovePredictor:
+		prediction = b
+	case AveragePredictor:
+		prediction = (a + b) / 2
+	case PlanarPredictor:
+		prediction = a + b - c
+	default:
+		switch {
+		case c >= math.Max(a, b):
+			prediction = math.Min(a, b)
+		case c <= math.Min(a, b):
+			prediction = math.Max(a, b)
+		default:
+			prediction = a + b - c
+		}
+	}
+	return math.Max(0, math.Min(float64(MaxGrayscaleLevels-1), prediction))
+}
+
+func predictionErrors(values [][]float64, predictor Predictor) [][]int {
+	// The pixels minus their rounded predictions from the original neighbours
+	var errors [][]int = make([][]int, len(values))
+	for x := range values {
+		errors[x] = make([]int, len(values[x]))
+		for y, value := range values[x] {
+			errors[x][y] = int(value) - int(math.Round(predict(values, x, y, predictor)))
+		}
+	}
+	return errors
+}
+
+func PredictionErrorHistogram(img image.Image, predictor Predictor) ([]int, error) {
+	if !predictor.valid() {
+		return nil, fmt.Errorf("unknown predictor %d", predictor)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	var histogram []int = make([]int, 2*predictionErrorOffset+1)
+	for _, column := range predictionErrors(levelsToFloats(levels), predictor) {
+		for _, value := range column {
+			histogram[value+predictionErrorOffset]++
+		}
+	}
+	return histogram, nil
+}
+
+func PredictiveEncode(w io.Writer, img image.Image, predictor Predictor) error {
+	// This is from Section 8.2.9 of DIP book
+	// Writes the image size and predictor, then the prediction errors in raster order,
+	// modulo 256 so that each fits a byte, with the adaptive arithmetic coder
+	if !predictor.valid() {
+		return fmt.Errorf("unknown predictor %d", predictor)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return fmt.Errorf("empty image")
+	}
+	var bits *bitWriter = newBitWriter(w)
+	if err := writeImageSize(bits, len(levels), len(levels[0])); err != nil {
+		return err
+	}
+	if err := bits.writeBits(uint64(predictor), 3); err != nil {
+		return err
+	}
+	if err := bits.flush(); err != nil {
+		return err
+	}
+
+	var errors [][]int = predictionErrors(levelsToFloats(levels), predictor)
+	var stream []byte = make([]byte, 0, len(levels)*len(levels[0]))
+	for y := range levels[0] {
+		for x := range levels {
+			stream = append(stream, byte(errors[x][y]))
+		}
+	}
+	var writer *ArithmeticWriter = NewArithmeticWriter(w)
+	if _, err := writer.Write(stream); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func PredictiveDecode(r io.Reader) (image.Image, error) {
+	// The header is read through the same buffer as the errors that follow it
+	var buffered *bufio.Reader = bufio.NewReader(r)
+	var bits *bitReader = newBitReader(buffered)
+	width, height, err := readImageSize(bits)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	code, err := bits.readBits(3)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	var predictor Predictor = Predictor(code)
+	if !predictor.valid() {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("unknown predictor %d", predictor)
+	}
+
+	var reader *ArithmeticReader = NewArithmeticReader(buffered)
+	var stream []byte = make([]byte, width)
+	var values [][]float64 = newFloats(width, height)
+	for y := 0; y < height; y++ {
+		if _, err := io.ReadFull(reader, stream); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return image.NewGray(image.Rect(0, 0, 1, 1)), err
+		}
+		for x := 0; x < width; x++ {
+			prediction := int(math.Round(predict(values, x, y, predictor)))
+			values[x][y] = float64(uint8(prediction + int(stream[x])))
+		}
+	}
+	return floatsToLevelImage(values)
+}
+
+func PredictiveCode(img image.Image, predictor Predictor) (image.Image, PredictiveCodingReport, error) {
+	// Codes the image losslessly, decodes it again to check that nothing was lost and
+	// returns the prediction error image, with zero error as mid grey
+	var report PredictiveCodingReport = PredictiveCodingReport{Predictor: predictor}
+	histogram, err := PredictionErrorHistogram(img, predictor)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	var coded bytes.Buffer
+	if err := PredictiveEncode(&coded, img, predictor); err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+	}
+	report.Bits = 8 * coded.Len()
+	decoded, err := PredictiveDecode(&coded)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+	}
+	var decodedLevels [][]uint8 = imageToLevels(decoded)
+	for x := range levels {
+		if !bytes.Equal(decodedLevels[x], levels[x]) {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), report, fmt.Errorf("%s predictive coding did not restore the image", predictor)
+		}
+	}
+
+	var pixels int = len(levels) * len(levels[0])
+	report.ErrorHistogram = histogram
+	report.ImageEntropy = Entropy(HistogramGrayscale(img, 0))
+	report.ErrorEntropy = Entropy(histogram)
+	report.EntropySaving = report.ImageEntropy - report.ErrorEntropy
+	report.AverageCodeLength = float64(report.Bits) / float64(pixels)
+	report.CompressionRatio = 8 / report.AverageCodeLength
+
+	var errors [][]int = predictionErrors(levelsToFloats(levels), predictor)
+	var errorLevels [][]uint8 = newLevels(len(levels), len(levels[0]))
+	for x := range errors {
+		for y, value := range errors[x] {
+			errorLevels[x][y] = clampLevel(value + MaxGrayscaleLevels/2)
+		}
+	}
+	errorImage, err := levelsToImage(errorLevels)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+	}
+	return errorImage, report, nil
+}
+
+// Quantiser maps a value to one of the reconstruction Levels, in increasing order.
+// Values up to Decisions[i] map to Levels[i] and values above the last decision level
+// to the last reconstruction level.
+type Quantiser struct {
+	Decisions []float64
+	Levels    []float64
+}
+
+func (quantiser Quantiser) index(value float64) int {
+	return sort.SearchFloat64s(quantiser.Decisions, value)
+}
+
+func (quantiser Quantiser) Quantise(value float64) float64 {
+	return quantiser.Levels[quantiser.index(value)]
+}
+
+func DeltaModulationQuantiser(zeta float64) Quantiser {
+	// This is from Section 8.2.9 of DIP book
+	// The two level quantiser of delta modulation, +zeta for positive errors and
+	// -zeta otherwise
+	return Quantiser{Decisions: []float64{0}, Levels: []float64{-zeta, zeta}}
+}
+
+func lloydMaxIntervals(histogram []int, minimum int, quantiser Quantiser) ([]int, []float64, []float64) {
+	// The count, sum and sum of squares of the values in each interval
+	var counts []int = make([]int, len(quantiser.Levels))
+	var sums, squares []float64 = make([]float64, len(quantiser.Levels)), make([]float64, len(quantiser.Levels))
+	for bin, count := range histogram {
+		if count > 0 {
+			value := float64(minimum + bin)
+			index := quantiser.index(value)
+			counts[index] += count
+			sums[index] += float64(count) * value
+			squares[index] += float64(count) * value * value
+		}
+	}
+	return counts, sums, squares
+}
+
+func setDecisions(quantiser *Quantiser) {
+	quantiser.Decisions = make([]float64, len(quantiser.Levels)-1)
+	for index := range quantiser.Decisions {
+		quantiser.Decisions[index] = (quantiser.Levels[index] + quantiser.Levels[index+1]) / 2
+	}
+}
+
+func LloydMaxQuantiser(histogram []int, minimum int, levels int) (Quantiser, error) {
+	// This is from Section 8.2.9 of DIP book
+	// The quantiser with the given number of levels that minimises the mean squared
+	// quantisation error of the values counted by the histogram, bin i holding the
+	// value minimum + i. Each decision level is halfway between its reconstruction
+	// levels and each reconstruction level is the centroid of its interval. Starting
+	// from the mean, the level of the interval with the largest error is split in two
+	// and the conditions are iterated until the quantiser has all its levels.
+	if levels < 2 {
+		return Quantiser{}, fmt.Errorf("a quantiser needs at least 2 levels, got %d", levels)
+	}
+	var total, sum float64 = 0, 0
+	for bin, count := range histogram {
+		if count < 0 {
+			return Quantiser{}, fmt.Errorf("negative count %d in the histogram", count)
+		}
+		total += float64(count)
+		sum += float64(count * (minimum + bin))
+	}
+	if total == 0 {
+		return Quantiser{}, fmt.Errorf("empty histogram")
+	}
+
+	var quantiser Quantiser = Quantiser{Levels: []float64{sum / total}}
+	for len(quantiser.Levels) < levels {
+		setDecisions(&quantiser)
+		counts, sums, squares := lloydMaxIntervals(histogram, minimum, quantiser)
+		var worst int = 0
+		var worstError float64 = -1
+		for index, count := range counts {
+			if count > 0 && squares[index]-sums[index]*sums[index]/float64(count) > worstError {
+				worst, worstError = index, squares[index]-sums[index]*sums[index]/float64(count)
+			}
+		}
+		// The split is by the spread of the interval, at least half a level
+		var spread float64 = 0.5
+		if counts[worst] > 0 {
+			spread = math.Max(spread, math.Sqrt(worstError/float64(counts[worst])))
+		}
+		var split []float64 = append([]float64{}, quantiser.Levels[:worst]...)
+		split = append(split, quantiser.Levels[worst]-spread, quantiser.Levels[worst]+spread)
+		quantiser.Levels = append(split, quantiser.Levels[worst+1:]...)
+
+		for iteration := 0; iteration < 1000; iteration++ {
+			setDecisions(&quantiser)
+			counts, sums, _ := lloydMaxIntervals(histogram, minimum, quantiser)
+			var change float64 = 0
+			for index := range quantiser.Levels {
+				// An interval without values keeps its level
+				if counts[index] > 0 {
+					centroid := sums[index] / float64(counts[index])
+					change = math.Max(change, math.Abs(centroid-quantiser.Levels[index]))
+					quantiser.Levels[index] = centroid
+				}
+			}
+			if change < 1e-9 {
+				break
+			}
+		}
+	}
+	setDecisions(&quantiser)
+	return quantiser, nil
+}
+
+// DPCMOptions configures DPCMCode. The predictor works on the reconstructed pixels,
+// as the decoder does, and the quantiser on the prediction errors.
+type DPCMOptions struct {
+	Predictor Predictor
+	Quantiser Quantiser
+}
+
+// DPCMReport describes the result of DPCMCode. FixedLengthBits is the bits per pixel
+// of the quantiser indices with a fixed length code and IndexEntropy their first-order
+// entropy. CompressionRatio is 8 bits per pixel over IndexEntropy.
+type DPCMReport struct {
+	Levels              int
+	FixedLengthBits     int
+	IndexEntropy        float64
+	CompressionRatio    float64
+	RootMeanSquareError float64
+}
+
+func DPCMCode(img image.Image, options DPCMOptions) (image.Image, DPCMReport, error) {
+	// This is from Section 8.2.9 of DIP book
+	// Lossy predictive coding: each prediction error is quantised and added back to the
+	// prediction to give the pixel the decoder sees, which the later predictions use.
+	// Delta modulation is the previous pixel predictor with DeltaModulationQuantiser.
+	var quantiser Quantiser = options.Quantiser
+	var report DPCMReport = DPCMReport{Levels: len(quantiser.Levels)}
+	if len(quantiser.Levels) < 2 || len(quantiser.Decisions) != len(quantiser.Levels)-1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, fmt.Errorf("a quantiser needs at least 2 levels and one decision level fewer")
+	}
+	if !options.Predictor.valid() {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, fmt.Errorf("unknown predictor %d", options.Predictor)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, fmt.Errorf("empty image")
+	}
+
+	var width, height int = len(levels), len(levels[0])
+	var reconstructed [][]float64 = newFloats(width, height)
+	var indices []int = make([]int, len(quantiser.Levels))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			prediction := predict(reconstructed, x, y, options.Predictor)
+			index := quantiser.index(float64(levels[x][y]) - prediction)
+			indices[index]++
+			value := prediction + quantiser.Levels[index]
+			reconstructed[x][y] = math.Max(0, math.Min(float64(MaxGrayscaleLevels-1), value))
+		}
+	}
+
+	report.FixedLengthBits = int(math.Ceil(math.Log2(float64(report.Levels))))
+	report.IndexEntropy = Entropy(indices)
+	report.CompressionRatio = math.Inf(1)
+	if report.IndexEntropy > 0 {
+		report.CompressionRatio = 8 / report.IndexEntropy
+	}
+	newImage, err := floatsToLevelImage(reconstructed)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+	}
+	report.RootMeanSquareError, err = RootMeanSquaredError(newImage, img)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+	}
+	return newImage, report, nil
+}
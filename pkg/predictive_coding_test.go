@@ -0,0 +1,192 @@
+package pkg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func createRampTestImage(width int, height int, slope int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.SetGray(x, y, color.Gray{uint8(128 + slope*x)})
+		}
+	}
+	return img
+}
+
+func TestPredictiveCode(t *testing.T) {
+	img := createSmoothTestImage(64, 48)
+	for _, predictor := range Predictors {
+		errorImage, report, err := PredictiveCode(img, predictor)
+		if err != nil {
+			t.Fatalf("%s: %v", predictor, err)
+		}
+		if errorImage.Bounds() != img.Bounds() {
+			t.Errorf("%s: error image is %v", predictor, errorImage.Bounds())
+		}
+		var total int = 0
+		for _, count := range report.ErrorHistogram {
+			total += count
+		}
+		if total != 64*48 {
+			t.Errorf("%s: histogram counts %d errors", predictor, total)
+		}
+		// Neighbouring pixels of a smooth image are alike, so the errors need fewer bits
+		if report.EntropySaving <= 0 || report.EntropySaving != report.ImageEntropy-report.ErrorEntropy {
+			t.Errorf("%s: entropy %.3f of the image, %.3f of the errors", predictor, report.ImageEntropy, report.ErrorEntropy)
+		}
+	}
+
+	// Along a horizontal ramp the previous pixel is always 3 levels darker
+	errorImage, report, err := PredictiveCode(createRampTestImage(30, 10, 3), PreviousPixelPredictor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, errorImage, 5, 5, 128+3)
+	if report.ErrorHistogram[predictionErrorOffset+3] != 29*10 {
+		t.Errorf("%d errors of 3, want %d", report.ErrorHistogram[predictionErrorOffset+3], 29*10)
+	}
+
+	// The median edge detector follows a vertical edge, the average smears it
+	edge := image.NewGray(image.Rect(0, 0, 20, 20))
+	for x := 10; x < 20; x++ {
+		for y := 0; y < 20; y++ {
+			edge.SetGray(x, y, color.Gray{200})
+		}
+	}
+	errorImage, _, err = PredictiveCode(edge, MEDPredictor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, errorImage, 10, 5, 128)
+	errorImage, _, err = PredictiveCode(edge, AveragePredictor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, errorImage, 10, 5, 228)
+
+	if _, _, err := PredictiveCode(img, Predictor(9)); err == nil {
+		t.Error("expected an error for an unknown predictor")
+	}
+}
+
+func TestPredictiveDecodeErrors(t *testing.T) {
+	// A header of 1048576x1048576 must fail before that many pixels are allocated
+	if _, err := PredictiveDecode(bytes.NewReader(createHugeSizeHeader(t))); err == nil {
+		t.Error("expected an error for a stream of 1048576x1048576")
+	}
+
+	// A stream cut short among the prediction errors, not just in the header
+	var coded bytes.Buffer
+	if err := PredictiveEncode(&coded, createSmoothTestImage(64, 64), MEDPredictor); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PredictiveDecode(bytes.NewReader(coded.Bytes()[:coded.Len()/3])); err == nil {
+		t.Error("expected an error for a truncated stream")
+	}
+
+	var header bytes.Buffer
+	bits := newBitWriter(&header)
+	if err := writeImageSize(bits, 4, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := bits.writeBits(7, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := bits.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PredictiveDecode(&header); err == nil {
+		t.Error("expected an error for an unknown predictor")
+	}
+}
+
+func TestLloydMaxQuantiser(t *testing.T) {
+	// A uniform distribution gives the uniform quantiser, up to the whole levels of the
+	// histogram
+	uniform := make([]int, MaxGrayscaleLevels)
+	for level := range uniform {
+		uniform[level] = 10
+	}
+	quantiser, err := LloydMaxQuantiser(uniform, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for index, want := range []float64{31.5, 95.5, 159.5, 223.5} {
+		if math.Abs(quantiser.Levels[index]-want) > 4 {
+			t.Errorf("level %d = %v, want %v", index, quantiser.Levels[index], want)
+		}
+	}
+	if quantiser.Quantise(100) != quantiser.Levels[1] || quantiser.Quantise(255) != quantiser.Levels[3] {
+		t.Errorf("100 and 255 quantise to %v and %v", quantiser.Quantise(100), quantiser.Quantise(255))
+	}
+
+	// A distribution of errors peaked at zero gives levels closer together near zero
+	peaked := make([]int, 2*predictionErrorOffset+1)
+	for bin := range peaked {
+		peaked[bin] = int(1000 * math.Exp(-math.Abs(float64(bin-predictionErrorOffset))/8))
+	}
+	quantiser, err = LloydMaxQuantiser(peaked, -predictionErrorOffset, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(quantiser.Quantise(0)) > 1 || quantiser.Levels[2]-quantiser.Levels[1] >= quantiser.Levels[1]-quantiser.Levels[0] {
+		t.Errorf("levels %v are not closer together near zero", quantiser.Levels)
+	}
+
+	if _, err := LloydMaxQuantiser(uniform, 0, 1); err == nil {
+		t.Error("expected an error for a single level")
+	}
+	if _, err := LloydMaxQuantiser(make([]int, 5), 0, 2); err == nil {
+		t.Error("expected an error for an empty histogram")
+	}
+}
+
+func TestDPCMCode(t *testing.T) {
+	// Delta modulation keeps up with a ramp less steep than its step, but not with a
+	// steeper one, the slope overload of the book
+	for _, slope := range []int{2, 6} {
+		img := createRampTestImage(20, 8, slope)
+		decoded, report, err := DPCMCode(img, DPCMOptions{Predictor: PreviousPixelPredictor, Quantiser: DeltaModulationQuantiser(4)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Bounds() != img.Bounds() || report.Levels != 2 || report.FixedLengthBits != 1 {
+			t.Errorf("slope %d: %v, report %+v", slope, decoded.Bounds(), report)
+		}
+		if (slope < 4) != (report.RootMeanSquareError < 10) {
+			t.Errorf("slope %d: RMS error %v", slope, report.RootMeanSquareError)
+		}
+	}
+
+	// A Lloyd-Max quantiser designed from the prediction errors does better than delta
+	// modulation at more bits per pixel
+	img := createSmoothTestImage(64, 48)
+	histogram, err := PredictionErrorHistogram(img, MEDPredictor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quantiser, err := LloydMaxQuantiser(histogram, -predictionErrorOffset, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, lloydMax, err := DPCMCode(img, DPCMOptions{Predictor: MEDPredictor, Quantiser: quantiser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, delta, err := DPCMCode(img, DPCMOptions{Predictor: PreviousPixelPredictor, Quantiser: DeltaModulationQuantiser(6.5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lloydMax.RootMeanSquareError >= delta.RootMeanSquareError || lloydMax.IndexEntropy > float64(lloydMax.FixedLengthBits) {
+		t.Errorf("Lloyd-Max %+v, delta modulation %+v", lloydMax, delta)
+	}
+
+	if _, _, err := DPCMCode(img, DPCMOptions{Quantiser: Quantiser{Levels: []float64{1}}}); err == nil {
+		t.Error("expected an error for a quantiser with one level")
+	}
+}
@@ -0,0 +1,405 @@
+// Principal components of multi-band images and of point sets
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// PrincipalComponents is the Hotelling transform of a population of vectors. Rows of
+// Eigenvectors are the unit eigenvectors of Covariance, the rows of the matrix A of the
+// DIP book, sorted by decreasing Eigenvalues. Each eigenvector's largest component is
+// positive so the result does not flip between runs.
+type PrincipalComponents struct {
+	Mean         []float64   `json:"mean"`
+	Covariance   [][]float64 `json:"covariance"`
+	Eigenvalues  []float64   `json:"eigenvalues"`
+	Eigenvectors [][]float64 `json:"eigenvectors"`
+}
+
+func symmetricEigen(matrix [][]float64) ([]float64, [][]float64) {
+	// Cyclic Jacobi rotations, each one zeroes an off-diagonal element of the symmetric
+	// matrix until none is left. Returns the eigenvalues and the eigenvectors as rows,
+	// unsorted.
+	var size int = len(matrix)
+	var a [][]float64 = make([][]float64, size)
+	var vectors [][]float64 = make([][]float64, size)
+	for row := range matrix {
+		a[row] = append([]float64(nil), matrix[row]...)
+		vectors[row] = make([]float64, size)
+		vectors[row][row] = 1
+	}
+
+	for sweep := 0; sweep < 100; sweep++ {
+		var offDiagonal float64 = 0
+		for p := 0; p < size; p++ {
+			for q := p + 1; q < size; q++ {
+				offDiagonal += a[p][q] * a[p][q]
+			}
+		}
+		if offDiagonal < 1e-22 {
+			break
+		}
+		for p := 0; p < size; p++ {
+			for q := p + 1; q < size; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				var t float64 = 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < size; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p] = c*akp - s*akq
+					a[k][q] = s*akp + c*akq
+				}
+				for k := 0; k < size; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k] = c*apk - s*aqk
+					a[q][k] = s*apk + c*aqk
+				}
+				// The eigenvectors are kept as rows, so the rotation acts on rows p and q
+				for k := 0; k < size; k++ {
+					vpk, vqk := vectors[p][k], vectors[q][k]
+					vectors[p][k] = c*vpk - s*vqk
+					vectors[q][k] = s*vpk + c*vqk
+				}
+			}
+		}
+	}
+
+	var values []float64 = make([]float64, size)
+	for index := range values {
+		values[index] = a[index][index]
+	}
+	return values, vectors
+}
+
+func ComputePrincipalComponents(vectors [][]float64) (PrincipalComponents, error) {
+	// This is from Section 11.4 of DIP book
+	if len(vectors) == 0 {
+		return PrincipalComponents{}, fmt.Errorf("no vectors")
+	}
+	for _, vector := range vectors {
+		if len(vector) != len(vectors[0]) {
+			return PrincipalComponents{}, fmt.Errorf("vectors have %d and %d components", len(vectors[0]), len(vector))
+		}
+	}
+	return principalComponents(len(vectors), len(vectors[0]), func(index int, vector []float64) {
+		copy(vector, vectors[index])
+	})
+}
+
+func principalComponents(count int, size int, fill func(index int, vector []float64)) (PrincipalComponents, error) {
+	// m_x = 1/K sum x_k and C_x = 1/K sum (x_k - m_x)(x_k - m_x)^T, then the eigenvectors
+	// of C_x, which is real and symmetric. fill writes vector x_k so that large
+	// populations like the pixels of an image need not be held as separate slices.
+	var components PrincipalComponents
+	if size == 0 {
+		return components, fmt.Errorf("vectors have no components")
+	}
+	var vector []float64 = make([]float64, size)
+	components.Mean = make([]float64, size)
+	for index := 0; index < count; index++ {
+		fill(index, vector)
+		for component, value := range vector {
+			components.Mean[component] += value
+		}
+	}
+	for index := range components.Mean {
+		components.Mean[index] /= float64(count)
+	}
+
+	components.Covariance = newFloats(size, size)
+	for index := 0; index < count; index++ {
+		fill(index, vector)
+		for row := 0; row < size; row++ {
+			for column := row; column < size; column++ {
+				components.Covariance[row][column] += (vector[row] - components.Mean[row]) * (vector[column] - components.Mean[column])
+			}
+		}
+	}
+	for row := 0; row < size; row++ {
+		for column := row; column < size; column++ {
+			components.Covariance[row][column] /= float64(count)
+			components.Covariance[column][row] = components.Covariance[row][column]
+		}
+	}
+
+	values, eigenvectors := symmetricEigen(components.Covariance)
+	var order []int = make([]int, size)
+	for index := range order {
+		order[index] = index
+	}
+	sort.SliceStable(order, func(i, j int) bool { return values[order[i]] > values[order[j]] })
+	for _, index := range order {
+		var vector []float64 = eigenvectors[index]
+		var largest int = 0
+		for component := range vector {
+			if math.Abs(vector[component]) > math.Abs(vector[largest])+1e-12 {
+				largest = component
+			}
+		}
+		if vector[largest] < 0 {
+			for component := range vector {
+				vector[component] = -vector[component]
+			}
+		}
+		// Rounding can leave tiny negative variances for directions without any
+		components.Eigenvalues = append(components.Eigenvalues, math.Max(values[index], 0))
+		components.Eigenvectors = append(components.Eigenvectors, vector)
+	}
+	return components, nil
+}
+
+func (components PrincipalComponents) Project(vector []float64) ([]float64, error) {
+	// y = A (x - m_x), the components of x along the eigenvectors
+	if len(vector) != len(components.Mean) {
+		return nil, fmt.Errorf("vector has %d components, want %d", len(vector), len(components.Mean))
+	}
+	var projected []float64 = make([]float64, len(components.Eigenvectors))
+	for row, eigenvector := range components.Eigenvectors {
+		for index, value := range vector {
+			projected[row] += eigenvector[index] * (value - components.Mean[index])
+		}
+	}
+	return projected, nil
+}
+
+func (components PrincipalComponents) Reconstruct(projected []float64, keep int) ([]float64, error) {
+	// x^ = A_k^T y + m_x using only the first keep components of y
+	if keep < 1 || keep > len(components.Eigenvectors) {
+		return nil, fmt.Errorf("can keep between 1 and %d components, got %d", len(components.Eigenvectors), keep)
+	}
+	if len(projected) < keep {
+		return nil, fmt.Errorf("projection has %d components, need %d", len(projected), keep)
+	}
+	var vector []float64 = append([]float64(nil), components.Mean...)
+	for row := 0; row < keep; row++ {
+		for index := range vector {
+			vector[index] += components.Eigenvectors[row][index] * projected[row]
+		}
+	}
+	return vector, nil
+}
+
+func (components PrincipalComponents) DiscardedVariance(keep int) float64 {
+	// The mean squared error of reconstructing from keep components is the sum of the
+	// eigenvalues that are left out
+	var variance float64 = 0
+	for index := keep; index < len(components.Eigenvalues); index++ {
+		variance += components.Eigenvalues[index]
+	}
+	return variance
+}
+
+func ColourBands(img image.Image) ([]image.Image, error) {
+	// Splits a colour image into red, green and blue grey level images
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, fmt.Errorf("empty image")
+	}
+	var bands []*image.Gray
+	for band := 0; band < 3; band++ {
+		bands = append(bands, image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy())))
+	}
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			bands[0].SetGray(x-bounds.Min.X, y-bounds.Min.Y, color.Gray{c.R})
+			bands[1].SetGray(x-bounds.Min.X, y-bounds.Min.Y, color.Gray{c.G})
+			bands[2].SetGray(x-bounds.Min.X, y-bounds.Min.Y, color.Gray{c.B})
+		}
+	}
+	return []image.Image{bands[0], bands[1], bands[2]}, nil
+}
+
+func CombineBands(bands []image.Image) (image.Image, error) {
+	// Puts three grey level images back together as red, green and blue
+	if len(bands) != 3 {
+		return image.NewRGBA(image.Rect(0, 0, 1, 1)), fmt.Errorf("need 3 bands for a colour image, got %d", len(bands))
+	}
+	var levels [][][]uint8
+	for _, band := range bands {
+		levels = append(levels, imageToLevels(band))
+	}
+	if len(levels[0]) == 0 || len(levels[0][0]) == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	var width, height int = len(levels[0]), len(levels[0][0])
+	for _, band := range levels[1:] {
+		if len(band) != width || len(band[0]) != height {
+			return image.NewRGBA(image.Rect(0, 0, 1, 1)), fmt.Errorf("bands differ in size")
+		}
+	}
+	newImage := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			newImage.SetRGBA(x, y, color.RGBA{levels[0][x][y], levels[1][x][y], levels[2][x][y], 255})
+		}
+	}
+	return newImage, nil
+}
+
+func bandLevels(bands []image.Image) ([][][]uint8, error) {
+	// The levels of every band, which must all be the same size
+	if len(bands) == 0 {
+		return nil, fmt.Errorf("no bands")
+	}
+	var levels [][][]uint8
+	for _, band := range bands {
+		levels = append(levels, imageToLevels(band))
+	}
+	if len(levels[0]) == 0 || len(levels[0][0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	var width, height int = len(levels[0]), len(levels[0][0])
+	for index, band := range levels {
+		if len(band) != width || len(band[0]) != height {
+			return nil, fmt.Errorf("band %d is %dx%d, want %dx%d", index, len(band), len(band[0]), width, height)
+		}
+	}
+	return levels, nil
+}
+
+func pixelVector(levels [][][]uint8, x int, y int, vector []float64) {
+	// The vector of pixel (x, y) has its level in every band as components
+	for band := range levels {
+		vector[band] = float64(levels[band][x][y])
+	}
+}
+
+func BandPrincipalComponents(bands []image.Image) (PrincipalComponents, error) {
+	// Every pixel is a vector with one component per band, as for the six band
+	// multispectral images of Section 11.4
+	levels, err := bandLevels(bands)
+	if err != nil {
+		return PrincipalComponents{}, err
+	}
+	var height int = len(levels[0][0])
+	return principalComponents(len(levels[0])*height, len(levels), func(index int, vector []float64) {
+		pixelVector(levels, index/height, index%height, vector)
+	})
+}
+
+func PrincipalComponentImages(bands []image.Image, components PrincipalComponents) ([]image.Image, error) {
+	// The images of y = A (x - m_x), one per principal component, each scaled to the
+	// full grey level range for viewing. The first holds most of the variance.
+	levels, err := bandLevels(bands)
+	if err != nil {
+		return nil, err
+	}
+	var width, height int = len(levels[0]), len(levels[0][0])
+	var values [][][]float64
+	for range components.Eigenvectors {
+		values = append(values, newFloats(width, height))
+	}
+	var vector []float64 = make([]float64, len(bands))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			pixelVector(levels, x, y, vector)
+			projected, err := components.Project(vector)
+			if err != nil {
+				return nil, err
+			}
+			for component, value := range projected {
+				values[component][x][y] = value
+			}
+		}
+	}
+
+	var images []image.Image
+	for _, component := range values {
+		newImage, err := FloatsToImage(component)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, newImage)
+	}
+	return images, nil
+}
+
+func ReconstructBands(bands []image.Image, components PrincipalComponents, keep int) ([]image.Image, float64, error) {
+	// Rebuilds every band from the first keep principal components. Also returns the
+	// mean squared error over all bands and pixels of the rounded result, which is close
+	// to components.DiscardedVariance(keep) when the components come from these bands.
+	levels, err := bandLevels(bands)
+	if err != nil {
+		return nil, 0, err
+	}
+	var width, height int = len(levels[0]), len(levels[0][0])
+	var rebuilt [][][]uint8
+	for range bands {
+		rebuilt = append(rebuilt, newLevels(width, height))
+	}
+	var vector []float64 = make([]float64, len(bands))
+	var squaredError float64 = 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			pixelVector(levels, x, y, vector)
+			projected, err := components.Project(vector)
+			if err != nil {
+				return nil, 0, err
+			}
+			reconstructed, err := components.Reconstruct(projected, keep)
+			if err != nil {
+				return nil, 0, err
+			}
+			for band, value := range reconstructed {
+				level := clampLevel(int(math.Round(value)))
+				rebuilt[band][x][y] = level
+				squaredError += (float64(level) - vector[band]) * (float64(level) - vector[band])
+			}
+		}
+	}
+
+	var images []image.Image
+	for _, band := range rebuilt {
+		newImage, err := levelsToImage(band)
+		if err != nil {
+			return nil, 0, err
+		}
+		images = append(images, newImage)
+	}
+	return images, squaredError / float64(width*height), nil
+}
+
+func AlignPoints(points []image.Point) ([]image.Point, PrincipalComponents, error) {
+	// Treats the coordinates of an object's points as 2-D vectors, so that y = A (x - m_x)
+	// puts the object's centroid at the origin and its main axis along x, whatever its
+	// position and rotation. The result is rounded and moved so every coordinate is at
+	// least 0, as in Figure 11.41 of the book.
+	var vectors [][]float64
+	for _, point := range points {
+		vectors = append(vectors, []float64{float64(point.X), float64(point.Y)})
+	}
+	components, err := ComputePrincipalComponents(vectors)
+	if err != nil {
+		return nil, components, err
+	}
+
+	var projected [][]float64
+	var minimumX, minimumY float64 = math.Inf(1), math.Inf(1)
+	for _, vector := range vectors {
+		// The vectors all have the size of the mean, so there is no error
+		value, _ := components.Project(vector)
+		projected = append(projected, value)
+		minimumX = math.Min(minimumX, math.Round(value[0]))
+		minimumY = math.Min(minimumY, math.Round(value[1]))
+	}
+	var aligned []image.Point
+	for _, value := range projected {
+		aligned = append(aligned, image.Point{
+			int(math.Round(value[0]) - minimumX),
+			int(math.Round(value[1]) - minimumY),
+		})
+	}
+	return aligned, components, nil
+}
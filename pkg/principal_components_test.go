@@ -0,0 +1,158 @@
+package pkg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestComputePrincipalComponents(t *testing.T) {
+	// Points spread along (1, 1) with a little spread along (1, -1)
+	vectors := [][]float64{{0, 0}, {2, 2}, {4, 4}, {1, 3}, {3, 1}, {6, 6}}
+	components, err := ComputePrincipalComponents(vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if components.Mean[0] != 8.0/3 || components.Mean[1] != 8.0/3 {
+		t.Errorf("mean = %v", components.Mean)
+	}
+	if components.Eigenvalues[0] <= components.Eigenvalues[1] {
+		t.Errorf("eigenvalues = %v, want decreasing", components.Eigenvalues)
+	}
+	first := components.Eigenvectors[0]
+	if math.Abs(first[0]-math.Sqrt2/2) > 1e-9 || math.Abs(first[1]-math.Sqrt2/2) > 1e-9 {
+		t.Errorf("first eigenvector = %v, want along (1, 1)", first)
+	}
+
+	// C e = lambda e for every pair
+	for index, vector := range components.Eigenvectors {
+		for row := range vector {
+			var product float64 = 0
+			for column := range vector {
+				product += components.Covariance[row][column] * vector[column]
+			}
+			if math.Abs(product-components.Eigenvalues[index]*vector[row]) > 1e-9 {
+				t.Errorf("eigenvector %d = %v does not match eigenvalue %v", index, vector, components.Eigenvalues[index])
+			}
+		}
+	}
+
+	projected, err := components.Project(vectors[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := components.Reconstruct(projected, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(restored[0]-1) > 1e-9 || math.Abs(restored[1]-3) > 1e-9 {
+		t.Errorf("reconstruction from both components = %v, want [1 3]", restored)
+	}
+	if _, err := components.Reconstruct(projected, 3); err == nil {
+		t.Error("expected an error for keeping more components than there are")
+	}
+	if _, err := ComputePrincipalComponents([][]float64{{1, 2}, {3}}); err == nil {
+		t.Error("expected an error for vectors of different sizes")
+	}
+}
+
+func TestBandPrincipalComponents(t *testing.T) {
+	// The second band is the inverse of the first and the third is constant,
+	// so one component holds all the variance
+	var first, second, third []uint8
+	for index := 0; index < 16; index++ {
+		level := uint8(index * 10)
+		first = append(first, level)
+		second = append(second, 200-level)
+		third = append(third, 77)
+	}
+	bands := []image.Image{createTestImage(4, 4, first), createTestImage(4, 4, second), createTestImage(4, 4, third)}
+
+	components, err := BandPrincipalComponents(bands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if components.Eigenvalues[0] == 0 || components.DiscardedVariance(1) > 1e-9 {
+		t.Errorf("eigenvalues = %v, want a single non-zero one", components.Eigenvalues)
+	}
+
+	reconstructed, meanSquaredError, err := ReconstructBands(bands, components, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meanSquaredError != 0 {
+		t.Errorf("mean squared error = %v, want 0", meanSquaredError)
+	}
+	checkPixelValue(t, reconstructed[1], 1, 2, 200-90)
+	checkPixelValue(t, reconstructed[2], 3, 3, 77)
+
+	images, err := PrincipalComponentImages(bands, components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 3 {
+		t.Fatalf("got %d component images, want 3", len(images))
+	}
+	// The first component follows the first band and is scaled to the full range
+	checkPixelValue(t, images[0], 0, 0, 0)
+	checkPixelValue(t, images[0], 3, 3, 255)
+
+	if _, err := BandPrincipalComponents([]image.Image{bands[0], createTestImage(2, 2, nil)}); err == nil {
+		t.Error("expected an error for bands of different sizes")
+	}
+}
+
+func TestColourBands(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{10, 20, 30, 255})
+	img.SetRGBA(1, 0, color.RGBA{40, 50, 60, 255})
+
+	bands, err := ColourBands(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, bands[0], 1, 0, 40)
+	checkPixelValue(t, bands[2], 0, 0, 30)
+
+	combined, err := CombineBands(bands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if combined.At(1, 0) != (color.RGBA{40, 50, 60, 255}) {
+		t.Errorf("combined colour = %v", combined.At(1, 0))
+	}
+	if _, err := CombineBands(bands[:2]); err == nil {
+		t.Error("expected an error for two bands")
+	}
+}
+
+func TestAlignPoints(t *testing.T) {
+	// A diagonal bar is turned so it lies along x
+	var points []image.Point
+	for step := 0; step < 10; step++ {
+		points = append(points, image.Point{step + 5, 20 - step}, image.Point{step + 6, 20 - step})
+	}
+	aligned, components, err := AlignPoints(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var width, height int
+	for _, point := range aligned {
+		if point.X < 0 || point.Y < 0 {
+			t.Fatalf("aligned point %v is negative", point)
+		}
+		if point.X > width {
+			width = point.X
+		}
+		if point.Y > height {
+			height = point.Y
+		}
+	}
+	if width < 12 || height > 1 {
+		t.Errorf("aligned bar spans %dx%d, want long along x", width, height)
+	}
+	if components.Eigenvalues[0] < 10*components.Eigenvalues[1] {
+		t.Errorf("eigenvalues = %v", components.Eigenvalues)
+	}
+}
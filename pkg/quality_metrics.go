@@ -0,0 +1,253 @@
+// Full-reference image quality metrics for comparing a processed image with the original, and no-reference measures
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+func referenceFloats(img image.Image, reference image.Image) ([][]float64, [][]float64, error) {
+	// The grey levels of both images, which must be the same non-empty size
+	if img.Bounds().Dx() != reference.Bounds().Dx() || img.Bounds().Dy() != reference.Bounds().Dy() {
+		return nil, nil, fmt.Errorf("image is %dx%d but the reference is %dx%d", img.Bounds().Dx(), img.Bounds().Dy(), reference.Bounds().Dx(), reference.Bounds().Dy())
+	}
+	if img.Bounds().Empty() {
+		return nil, nil, fmt.Errorf("empty image")
+	}
+	return levelsToFloats(imageToLevels(img)), levelsToFloats(imageToLevels(reference)), nil
+}
+
+func MeanSquaredError(img image.Image, reference image.Image) (float64, error) {
+	// This is from Section 8.1.4 of DIP book
+	values, referenceValues, err := referenceFloats(img, reference)
+	if err != nil {
+		return 0, err
+	}
+	var sum float64 = 0
+	for x := range values {
+		for y := range values[x] {
+			difference := values[x][y] - referenceValues[x][y]
+			sum += difference * difference
+		}
+	}
+	return sum / float64(len(values)*len(values[0])), nil
+}
+
+func RootMeanSquaredError(img image.Image, reference image.Image) (float64, error) {
+	meanSquaredError, err := MeanSquaredError(img, reference)
+	if err != nil {
+		return 0, err
+	}
+	return math.Sqrt(meanSquaredError), nil
+}
+
+func PeakSignalToNoiseRatio(img image.Image, reference image.Image) (float64, error) {
+	// 10 log10(255^2 / MSE) in decibels, +Inf for identical images
+	meanSquaredError, err := MeanSquaredError(img, reference)
+	if err != nil {
+		return 0, err
+	}
+	if meanSquaredError == 0 {
+		return math.Inf(1), nil
+	}
+	var peak float64 = float64(MaxGrayscaleLevels - 1)
+	return 10 * math.Log10(peak*peak/meanSquaredError), nil
+}
+
+func structuralSimilarityMap(values [][]float64, referenceValues [][]float64) ([][]float64, [][]float64) {
+	// Wang et al., "Image quality assessment: from error visibility to structural
+	// similarity", with the local statistics weighted by a Gaussian of sigma 1.5 and
+	// the usual constants C1 = (0.01 L)^2 and C2 = (0.03 L)^2. The second map is the
+	// contrast and structure part alone, without the luminance term.
+	var peak float64 = float64(MaxGrayscaleLevels - 1)
+	var c1 float64 = (0.01 * peak) * (0.01 * peak)
+	var c2 float64 = (0.03 * peak) * (0.03 * peak)
+
+	var width, height int = len(values), len(values[0])
+	var squares, referenceSquares, products [][]float64 = newFloats(width, height), newFloats(width, height), newFloats(width, height)
+	for x := range values {
+		for y := range values[x] {
+			squares[x][y] = values[x][y] * values[x][y]
+			referenceSquares[x][y] = referenceValues[x][y] * referenceValues[x][y]
+			products[x][y] = values[x][y] * referenceValues[x][y]
+		}
+	}
+	var smooth = func(input [][]float64) [][]float64 {
+		smoothed, _ := gaussianSmoothFloats(input, 1.5)
+		return smoothed
+	}
+	means, referenceMeans := smooth(values), smooth(referenceValues)
+	squares, referenceSquares, products = smooth(squares), smooth(referenceSquares), smooth(products)
+
+	var similarity, contrastStructure [][]float64 = newFloats(width, height), newFloats(width, height)
+	for x := range similarity {
+		for y := range similarity[x] {
+			mean, referenceMean := means[x][y], referenceMeans[x][y]
+			variance := squares[x][y] - mean*mean
+			referenceVariance := referenceSquares[x][y] - referenceMean*referenceMean
+			covariance := products[x][y] - mean*referenceMean
+			contrastStructure[x][y] = (2*covariance + c2) / (variance + referenceVariance + c2)
+			similarity[x][y] = (2*mean*referenceMean + c1) / (mean*mean + referenceMean*referenceMean + c1) * contrastStructure[x][y]
+		}
+	}
+	return similarity, contrastStructure
+}
+
+func meanFloats(values [][]float64) float64 {
+	var sum float64 = 0
+	for _, column := range values {
+		for _, value := range column {
+			sum += value
+		}
+	}
+	return sum / float64(len(values)*len(values[0]))
+}
+
+func StructuralSimilarity(img image.Image, reference image.Image) (float64, error) {
+	// The mean structural similarity index, 1 for identical images
+	values, referenceValues, err := referenceFloats(img, reference)
+	if err != nil {
+		return 0, err
+	}
+	similarity, _ := structuralSimilarityMap(values, referenceValues)
+	return meanFloats(similarity), nil
+}
+
+func StructuralSimilarityMap(img image.Image, reference image.Image) (image.Image, error) {
+	// The local structural similarity from 0 to 1 as levels 0 to 255, so that the
+	// places that differ most are darkest. Negative similarity is shown as 0.
+	values, referenceValues, err := referenceFloats(img, reference)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	similarity, _ := structuralSimilarityMap(values, referenceValues)
+	for x := range similarity {
+		for y := range similarity[x] {
+			similarity[x][y] *= float64(MaxGrayscaleLevels - 1)
+		}
+	}
+	return floatsToLevelImage(similarity)
+}
+
+// The weights of the five scales of MS-SSIM from the finest, from Wang, Simoncelli and
+// Bovik, "Multiscale structural similarity for image quality assessment"
+var multiScaleWeights []float64 = []float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+// The smallest width or height at which a scale of MS-SSIM is still used
+const multiScaleMinimumSize int = 8
+
+func multiScaleStructuralSimilarity(values [][]float64, referenceValues [][]float64) (float64, float64) {
+	// The SSIM at the finest scale and the MS-SSIM. The contrast and structure term is
+	// taken at every scale and the luminance term only at the coarsest, halving the
+	// size with the pyramid reduction each time. Small images use fewer scales with
+	// their weights rescaled to add up to 1, and negative terms count as 0.
+	var scales int = 1
+	for width, height := len(values), len(values[0]); scales < len(multiScaleWeights); scales++ {
+		width, height = (width+1)/2, (height+1)/2
+		if width < multiScaleMinimumSize || height < multiScaleMinimumSize {
+			break
+		}
+	}
+	var totalWeight float64 = 0
+	for _, weight := range multiScaleWeights[:scales] {
+		totalWeight += weight
+	}
+
+	var singleScale float64 = 0
+	var multiScale float64 = 1
+	for scale := 0; scale < scales; scale++ {
+		if scale > 0 {
+			values, referenceValues = reduceFloats(values), reduceFloats(referenceValues)
+		}
+		similarity, contrastStructure := structuralSimilarityMap(values, referenceValues)
+		term := meanFloats(contrastStructure)
+		if scale == 0 {
+			singleScale = meanFloats(similarity)
+		}
+		if scale == scales-1 {
+			term = meanFloats(similarity)
+		}
+		multiScale *= math.Pow(math.Max(term, 0), multiScaleWeights[scale]/totalWeight)
+	}
+	return singleScale, multiScale
+}
+
+func MultiScaleStructuralSimilarity(img image.Image, reference image.Image) (float64, error) {
+	values, referenceValues, err := referenceFloats(img, reference)
+	if err != nil {
+		return 0, err
+	}
+	_, multiScale := multiScaleStructuralSimilarity(values, referenceValues)
+	return multiScale, nil
+}
+
+// QualityReport holds the full-reference metrics of an image against a reference.
+// PeakSignalToNoiseRatio is in decibels and +Inf for identical images.
+type QualityReport struct {
+	MeanSquaredError               float64
+	RootMeanSquareError            float64
+	PeakSignalToNoiseRatio         float64
+	StructuralSimilarity           float64
+	MultiScaleStructuralSimilarity float64
+}
+
+func CompareImages(img image.Image, reference image.Image) (QualityReport, error) {
+	var report QualityReport
+	meanSquaredError, err := MeanSquaredError(img, reference)
+	if err != nil {
+		return report, err
+	}
+	psnr, err := PeakSignalToNoiseRatio(img, reference)
+	if err != nil {
+		return report, err
+	}
+	values, referenceValues, err := referenceFloats(img, reference)
+	if err != nil {
+		return report, err
+	}
+	report.MeanSquaredError = meanSquaredError
+	report.RootMeanSquareError = math.Sqrt(meanSquaredError)
+	report.PeakSignalToNoiseRatio = psnr
+	report.StructuralSimilarity, report.MultiScaleStructuralSimilarity = multiScaleStructuralSimilarity(values, referenceValues)
+	return report, nil
+}
+
+// NoReferenceQuality holds measures of a single image. Entropy is the first-order
+// entropy of the grey levels in bits per pixel, Contrast the RMS contrast, the
+// standard deviation of the levels, and Sharpness the variance of the Laplacian,
+// which falls as an image is blurred.
+type NoReferenceQuality struct {
+	Entropy   float64
+	Contrast  float64
+	Sharpness float64
+}
+
+func MeasureQuality(img image.Image) (NoReferenceQuality, error) {
+	var quality NoReferenceQuality
+	if img.Bounds().Empty() {
+		return quality, fmt.Errorf("empty image")
+	}
+	var values [][]float64 = levelsToFloats(imageToLevels(img))
+	quality.Entropy = Entropy(HistogramGrayscale(img, 0))
+
+	var mean float64 = meanFloats(values)
+	var sum float64 = 0
+	for _, column := range values {
+		for _, value := range column {
+			sum += (value - mean) * (value - mean)
+		}
+	}
+	quality.Contrast = math.Sqrt(sum / float64(len(values)*len(values[0])))
+
+	// This is from Section 3.6.2 of DIP book
+	var laplacian [][]float64 = correlateFloats(values, [][]float64{{0, 1, 0}, {1, -4, 1}, {0, 1, 0}})
+	mean, sum = meanFloats(laplacian), 0
+	for _, column := range laplacian {
+		for _, value := range column {
+			sum += (value - mean) * (value - mean)
+		}
+	}
+	quality.Sharpness = sum / float64(len(values)*len(values[0]))
+	return quality, nil
+}
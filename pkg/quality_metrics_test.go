@@ -0,0 +1,168 @@
+package pkg
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestMeanSquaredErrorAndPeakSignalToNoiseRatio(t *testing.T) {
+	reference := createTestImage(2, 2, []uint8{10, 20, 30, 40})
+	img := createTestImage(2, 2, []uint8{12, 20, 30, 36})
+
+	meanSquaredError, err := MeanSquaredError(img, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meanSquaredError != 5 {
+		t.Errorf("MSE = %v, want 5", meanSquaredError)
+	}
+	psnr, err := PeakSignalToNoiseRatio(img, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(psnr-10*math.Log10(255*255/5.0)) > 1e-9 {
+		t.Errorf("PSNR = %v, want %v", psnr, 10*math.Log10(255*255/5.0))
+	}
+	psnr, err = PeakSignalToNoiseRatio(reference, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(psnr, 1) {
+		t.Errorf("PSNR of identical images = %v, want +Inf", psnr)
+	}
+
+	if _, err := MeanSquaredError(createTestImage(3, 2, nil), reference); err == nil {
+		t.Error("expected an error for images of different sizes")
+	}
+}
+
+func TestStructuralSimilarity(t *testing.T) {
+	reference := createWaveletTestImage(24, 20)
+	similarity, err := StructuralSimilarity(reference, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(similarity-1) > 1e-9 {
+		t.Errorf("SSIM of identical images = %v, want 1", similarity)
+	}
+
+	// Noise lowers the similarity more than a small change of brightness does
+	noisy := addTestNoise(reference, 20, 1)
+	brighter := createWaveletTestImage(24, 20)
+	for index := range brighter.Pix {
+		brighter.Pix[index] = clampLevel(int(brighter.Pix[index]) + 5)
+	}
+	noisySimilarity, err := StructuralSimilarity(noisy, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brighterSimilarity, err := StructuralSimilarity(brighter, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if noisySimilarity >= brighterSimilarity || brighterSimilarity >= 1 {
+		t.Errorf("SSIM with noise = %v and brighter = %v", noisySimilarity, brighterSimilarity)
+	}
+}
+
+func TestMultiScaleStructuralSimilarity(t *testing.T) {
+	reference := createWaveletTestImage(64, 48)
+	similarity, err := MultiScaleStructuralSimilarity(reference, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(similarity-1) > 1e-9 {
+		t.Errorf("MS-SSIM of identical images = %v, want 1", similarity)
+	}
+
+	noisy := addTestNoise(reference, 20, 2)
+	report, err := CompareImages(noisy, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.MultiScaleStructuralSimilarity <= 0 || report.MultiScaleStructuralSimilarity >= 1 {
+		t.Errorf("MS-SSIM with noise = %v", report.MultiScaleStructuralSimilarity)
+	}
+	ssim, err := StructuralSimilarity(noisy, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rmse, err := RootMeanSquaredError(noisy, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(report.StructuralSimilarity-ssim) > 1e-12 || report.RootMeanSquareError != rmse ||
+		math.Abs(rmse*rmse-report.MeanSquaredError) > 1e-9 {
+		t.Errorf("report %+v, SSIM %v, RMSE %v", report, ssim, rmse)
+	}
+
+	// An image too small to reduce has one scale, where MS-SSIM is SSIM
+	small, smallReference := addTestNoise(createWaveletTestImage(10, 10), 10, 3), createWaveletTestImage(10, 10)
+	report, err = CompareImages(small, smallReference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(report.MultiScaleStructuralSimilarity-report.StructuralSimilarity) > 1e-12 {
+		t.Errorf("MS-SSIM %v and SSIM %v of a small image", report.MultiScaleStructuralSimilarity, report.StructuralSimilarity)
+	}
+}
+
+func TestStructuralSimilarityMap(t *testing.T) {
+	reference := createWaveletTestImage(40, 20)
+	// Noise in the left half only
+	noisy := addTestNoise(reference, 30, 4)
+	for y := 0; y < 20; y++ {
+		for x := 20; x < 40; x++ {
+			noisy.SetGray(x, y, reference.GrayAt(x, y))
+		}
+	}
+	similarity, err := StructuralSimilarityMap(noisy, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, similarity, 35, 10, 255)
+	if level := color.GrayModel.Convert(similarity.At(5, 10)).(color.Gray).Y; level > 200 {
+		t.Errorf("similarity in the noisy half = %d", level)
+	}
+}
+
+func TestMeasureQuality(t *testing.T) {
+	quality, err := MeasureQuality(createTestImage(3, 3, []uint8{7, 7, 7, 7, 7, 7, 7, 7, 7}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quality.Entropy != 0 || quality.Contrast != 0 || quality.Sharpness != 0 {
+		t.Errorf("quality of a constant image = %+v", quality)
+	}
+
+	quality, err = MeasureQuality(createTestImage(2, 2, []uint8{0, 100, 100, 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quality.Entropy != 1 || quality.Contrast != 50 {
+		t.Errorf("quality of two equally likely levels = %+v, want entropy 1 and contrast 50", quality)
+	}
+
+	// Blurring lowers the sharpness
+	img := createWaveletTestImage(32, 32)
+	smoothed, err := gaussianSmoothFloats(levelsToFloats(imageToLevels(img)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blurred, err := floatsToLevelImage(smoothed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharp, err := MeasureQuality(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quality, err = MeasureQuality(blurred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quality.Sharpness >= sharp.Sharpness {
+		t.Errorf("sharpness %v after blurring, %v before", quality.Sharpness, sharp.Sharpness)
+	}
+}
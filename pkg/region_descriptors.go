@@ -0,0 +1,480 @@
+// Shape and region descriptors: simple descriptors, Euler number, Hu moments, Fourier descriptors and signatures
+package pkg
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strconv"
+)
+
+// DescriptorOptions sets the length of the descriptors that depend on the caller.
+// FourierDescriptors is the number of normalised Fourier descriptor magnitudes and
+// SignatureSamples the number of angles of the distance signature, zero leaves
+// them out.
+type DescriptorOptions struct {
+	FourierDescriptors int
+	SignatureSamples   int
+}
+
+// RegionDescriptors describes one labelled region. Perimeter is the length of the
+// 8-connected boundary, compactness is perimeter^2 / area and circularity
+// 4 pi area / perimeter^2, which is 1 for a disk. Eccentricity is that of the ellipse
+// with the same second moments, 0 for a circle and approaching 1 for a line.
+type RegionDescriptors struct {
+	Label              int        `json:"label"`
+	Area               int        `json:"area"`
+	CentroidX          float64    `json:"centroid_x"`
+	CentroidY          float64    `json:"centroid_y"`
+	Perimeter          float64    `json:"perimeter"`
+	Compactness        float64    `json:"compactness"`
+	Circularity        float64    `json:"circularity"`
+	Eccentricity       float64    `json:"eccentricity"`
+	EulerNumber        int        `json:"euler_number"`
+	HuMoments          [7]float64 `json:"hu_moments"`
+	FourierDescriptors []float64  `json:"fourier_descriptors,omitempty"`
+	Signature          []float64  `json:"signature,omitempty"`
+}
+
+// croppedRegion is one label cut out of a label image with a background border of
+// one pixel, so that holes and boundaries can be found without scanning the whole image
+type croppedRegion struct {
+	pixels [][]bool
+	offset image.Point
+}
+
+func cropRegions(labels [][]int) (map[int]croppedRegion, []int) {
+	var boxes map[int]image.Rectangle = make(map[int]image.Rectangle)
+	for x := range labels {
+		for y, label := range labels[x] {
+			if label <= 0 {
+				continue
+			}
+			pixel := image.Rect(x, y, x+1, y+1)
+			if box, ok := boxes[label]; ok {
+				boxes[label] = box.Union(pixel)
+			} else {
+				boxes[label] = pixel
+			}
+		}
+	}
+
+	var regions map[int]croppedRegion = make(map[int]croppedRegion)
+	var order []int
+	for label, box := range boxes {
+		region := croppedRegion{
+			pixels: newBinary(box.Dx()+2, box.Dy()+2),
+			offset: box.Min.Sub(image.Point{1, 1}),
+		}
+		for x := box.Min.X; x < box.Max.X; x++ {
+			for y := box.Min.Y; y < box.Max.Y; y++ {
+				region.pixels[x-region.offset.X][y-region.offset.Y] = labels[x][y] == label
+			}
+		}
+		regions[label] = region
+		order = append(order, label)
+	}
+	sort.Ints(order)
+	return regions, order
+}
+
+func eulerNumber(pixels [][]bool) int {
+	// This is from Section 11.3.2 of DIP book, E = C - H. C counts the 8-connected
+	// components and H the holes, 4-connected background components off the border.
+	_, components, _ := labelBinary(pixels, EightConnectivity)
+
+	var background [][]bool = newBinary(len(pixels), len(pixels[0]))
+	for x := range pixels {
+		for y := range pixels[x] {
+			background[x][y] = !pixels[x][y]
+		}
+	}
+	backgroundLabels, count, _ := labelBinary(background, FourConnectivity)
+	var touchesBorder []bool = make([]bool, count+1)
+	for x := range backgroundLabels {
+		for y, label := range backgroundLabels[x] {
+			if x == 0 || y == 0 || x == len(pixels)-1 || y == len(pixels[0])-1 {
+				touchesBorder[label] = true
+			}
+		}
+	}
+	var holes int = 0
+	for label := 1; label <= count; label++ {
+		if !touchesBorder[label] {
+			holes++
+		}
+	}
+	return components - holes
+}
+
+func huMoments(pixels [][]bool) [7]float64 {
+	// This is from Section 11.3.4 of DIP book
+	// The seven moment invariants, built from the normalised central moments
+	// eta_pq = mu_pq / mu_00^((p + q) / 2 + 1), are invariant to translation, scale,
+	// mirroring (up to the sign of the seventh) and rotation
+	var m00, m10, m01 float64
+	for x := range pixels {
+		for y := range pixels[x] {
+			if pixels[x][y] {
+				m00++
+				m10 += float64(x)
+				m01 += float64(y)
+			}
+		}
+	}
+	var hu [7]float64
+	if m00 == 0 {
+		return hu
+	}
+	meanX, meanY := m10/m00, m01/m00
+
+	var mu [4][4]float64
+	for x := range pixels {
+		for y := range pixels[x] {
+			if !pixels[x][y] {
+				continue
+			}
+			dx, dy := float64(x)-meanX, float64(y)-meanY
+			for p := 0; p <= 3; p++ {
+				for q := 0; p+q <= 3; q++ {
+					mu[p][q] += math.Pow(dx, float64(p)) * math.Pow(dy, float64(q))
+				}
+			}
+		}
+	}
+	eta := func(p int, q int) float64 {
+		return mu[p][q] / math.Pow(m00, float64(p+q)/2+1)
+	}
+	n20, n02, n11 := eta(2, 0), eta(0, 2), eta(1, 1)
+	n30, n03, n21, n12 := eta(3, 0), eta(0, 3), eta(2, 1), eta(1, 2)
+
+	hu[0] = n20 + n02
+	hu[1] = (n20-n02)*(n20-n02) + 4*n11*n11
+	hu[2] = (n30-3*n12)*(n30-3*n12) + (3*n21-n03)*(3*n21-n03)
+	hu[3] = (n30+n12)*(n30+n12) + (n21+n03)*(n21+n03)
+	hu[4] = (n30-3*n12)*(n30+n12)*((n30+n12)*(n30+n12)-3*(n21+n03)*(n21+n03)) +
+		(3*n21-n03)*(n21+n03)*(3*(n30+n12)*(n30+n12)-(n21+n03)*(n21+n03))
+	hu[5] = (n20-n02)*((n30+n12)*(n30+n12)-(n21+n03)*(n21+n03)) + 4*n11*(n30+n12)*(n21+n03)
+	hu[6] = (3*n21-n03)*(n30+n12)*((n30+n12)*(n30+n12)-3*(n21+n03)*(n21+n03)) +
+		(3*n12-n30)*(n21+n03)*(3*(n30+n12)*(n30+n12)-(n21+n03)*(n21+n03))
+	return hu
+}
+
+func FourierDescriptors(boundary Boundary) ([]complex128, error) {
+	// This is from Section 11.2.3 of DIP book
+	// Each boundary point is the complex number s(k) = x(k) + j y(k) and the descriptors
+	// are its DFT, a(u) = sum s(k) exp(-j 2 pi u k / K)
+	if len(boundary.Points) == 0 {
+		return nil, fmt.Errorf("empty boundary")
+	}
+	var values []complex128 = make([]complex128, len(boundary.Points))
+	for index, point := range boundary.Points {
+		values[index] = complex(float64(point.X), float64(point.Y))
+	}
+	return fastFourierTransform(values, false), nil
+}
+
+func TruncateFourierDescriptors(descriptors []complex128, keep int) ([]complex128, error) {
+	// Keeps the keep descriptors of lowest frequency, a(0) and then a(1), a(-1), a(2), ...
+	// where a(-u) is stored at a(K - u), and sets the others to zero
+	if keep < 1 || keep > len(descriptors) {
+		return nil, fmt.Errorf("can keep between 1 and %d descriptors, got %d", len(descriptors), keep)
+	}
+	var truncated []complex128 = make([]complex128, len(descriptors))
+	truncated[0] = descriptors[0]
+	for kept, frequency := 1, 1; kept < keep; frequency++ {
+		truncated[frequency] = descriptors[frequency]
+		kept++
+		if kept < keep {
+			truncated[len(descriptors)-frequency] = descriptors[len(descriptors)-frequency]
+			kept++
+		}
+	}
+	return truncated, nil
+}
+
+func ReconstructBoundary(descriptors []complex128, keep int) ([]image.Point, error) {
+	// The approximation of the boundary from its keep lowest frequency descriptors,
+	// s(k) = 1/K sum a(u) exp(j 2 pi u k / K). Fewer descriptors keep the coarse shape
+	// and lose the detail.
+	truncated, err := TruncateFourierDescriptors(descriptors, keep)
+	if err != nil {
+		return nil, err
+	}
+	var points []image.Point
+	for _, value := range fastFourierTransform(truncated, true) {
+		points = append(points, image.Point{int(math.Round(real(value))), int(math.Round(imag(value)))})
+	}
+	return points, nil
+}
+
+func normalisedFourierDescriptors(descriptors []complex128, count int) []float64 {
+	// Magnitudes of a(1), a(-1), a(2), a(-2), ... divided by the largest of them. Leaving
+	// out a(0) removes the position, the magnitudes do not depend on rotation or the
+	// starting point, and the division removes the scale.
+	var magnitudes []float64 = make([]float64, count)
+	var largest float64 = 0
+	for index := 0; index < count; index++ {
+		frequency := index/2 + 1
+		position := frequency
+		if index%2 == 1 {
+			position = len(descriptors) - frequency
+		}
+		if frequency >= len(descriptors) {
+			continue
+		}
+		magnitudes[index] = cmplx.Abs(descriptors[position])
+		largest = math.Max(largest, magnitudes[index])
+	}
+	if largest > 0 {
+		for index := range magnitudes {
+			magnitudes[index] /= largest
+		}
+	}
+	return magnitudes
+}
+
+func DistanceSignature(boundary Boundary, samples int) ([]float64, error) {
+	// This is from Section 11.1.5 of DIP book
+	// Distance from the centroid of the boundary to the boundary as a function of angle,
+	// r(theta), at samples equally spaced angles starting from the x axis. Where the
+	// boundary crosses an angle more than once the farthest point is used, and angles
+	// no boundary point falls on are interpolated from their neighbours.
+	if samples < 1 {
+		return nil, fmt.Errorf("samples must be at least 1, got %d", samples)
+	}
+	if len(boundary.Points) == 0 {
+		return nil, fmt.Errorf("empty boundary")
+	}
+	var centreX, centreY float64
+	for _, point := range boundary.Points {
+		centreX += float64(point.X)
+		centreY += float64(point.Y)
+	}
+	centreX /= float64(len(boundary.Points))
+	centreY /= float64(len(boundary.Points))
+
+	var signature []float64 = make([]float64, samples)
+	var filled []bool = make([]bool, samples)
+	for _, point := range boundary.Points {
+		dx, dy := float64(point.X)-centreX, float64(point.Y)-centreY
+		angle := math.Atan2(dy, dx)
+		if angle < 0 {
+			angle += 2 * math.Pi
+		}
+		bin := int(math.Round(angle/(2*math.Pi)*float64(samples))) % samples
+		distance := math.Hypot(dx, dy)
+		if !filled[bin] || distance > signature[bin] {
+			signature[bin] = distance
+			filled[bin] = true
+		}
+	}
+
+	for index := range signature {
+		if filled[index] {
+			continue
+		}
+		var before, after int = 1, 1
+		for !filled[(index-before+samples)%samples] {
+			before++
+		}
+		for !filled[(index+after)%samples] {
+			after++
+		}
+		low := signature[(index-before+samples)%samples]
+		high := signature[(index+after)%samples]
+		signature[index] = low + (high-low)*float64(before)/float64(before+after)
+	}
+	return signature, nil
+}
+
+func boundaryLength(boundary Boundary) float64 {
+	// Horizontal and vertical steps count 1, diagonal steps sqrt(2)
+	if len(boundary.Points) < 2 {
+		return 0
+	}
+	var length float64 = 0
+	for index, point := range boundary.Points {
+		step := boundary.Points[(index+1)%len(boundary.Points)].Sub(point)
+		if step.X != 0 && step.Y != 0 {
+			length += math.Sqrt2
+		} else {
+			length++
+		}
+	}
+	return length
+}
+
+func ComputeRegionDescriptors(labels [][]int, options DescriptorOptions) ([]RegionDescriptors, error) {
+	// This is from Sections 11.2 and 11.3 of DIP book
+	// Describes every positive label of the label image, in increasing label order.
+	// Boundary based descriptors use the outer boundary of the region's first
+	// 8-connected component.
+	if len(labels) == 0 || len(labels[0]) == 0 {
+		return nil, fmt.Errorf("empty label image")
+	}
+	if options.FourierDescriptors < 0 || options.SignatureSamples < 0 {
+		return nil, fmt.Errorf("descriptor lengths must not be negative, got %d and %d", options.FourierDescriptors, options.SignatureSamples)
+	}
+
+	regions, order := cropRegions(labels)
+	var descriptors []RegionDescriptors
+	for _, label := range order {
+		region := regions[label]
+		var description RegionDescriptors = RegionDescriptors{Label: label}
+
+		var sumX, sumY float64
+		for x := range region.pixels {
+			for y := range region.pixels[x] {
+				if region.pixels[x][y] {
+					description.Area++
+					sumX += float64(x)
+					sumY += float64(y)
+				}
+			}
+		}
+		description.CentroidX = sumX/float64(description.Area) + float64(region.offset.X)
+		description.CentroidY = sumY/float64(description.Area) + float64(region.offset.Y)
+
+		// Eccentricity from the eigenvalues of the covariance matrix
+		var covarianceXX, covarianceYY, covarianceXY float64
+		for x := range region.pixels {
+			for y := range region.pixels[x] {
+				if region.pixels[x][y] {
+					dx := float64(x) - sumX/float64(description.Area)
+					dy := float64(y) - sumY/float64(description.Area)
+					covarianceXX += dx * dx
+					covarianceYY += dy * dy
+					covarianceXY += dx * dy
+				}
+			}
+		}
+		spread := math.Sqrt((covarianceXX-covarianceYY)*(covarianceXX-covarianceYY) + 4*covarianceXY*covarianceXY)
+		major := (covarianceXX + covarianceYY + spread) / 2
+		minor := (covarianceXX + covarianceYY - spread) / 2
+		if major > 0 {
+			description.Eccentricity = math.Sqrt(math.Max(0, 1-minor/major))
+		}
+
+		description.EulerNumber = eulerNumber(region.pixels)
+		description.HuMoments = huMoments(region.pixels)
+
+		var regionLabels [][]int = newLabels(len(region.pixels), len(region.pixels[0]))
+		for x := range region.pixels {
+			for y := range region.pixels[x] {
+				if region.pixels[x][y] {
+					regionLabels[x][y] = 1
+				}
+			}
+		}
+		boundary, err := FollowBoundary(regionLabels, 1)
+		if err != nil {
+			return nil, err
+		}
+		for index := range boundary.Points {
+			boundary.Points[index] = boundary.Points[index].Add(region.offset)
+		}
+		boundary.Label = label
+
+		description.Perimeter = boundaryLength(boundary)
+		if description.Perimeter > 0 {
+			description.Compactness = description.Perimeter * description.Perimeter / float64(description.Area)
+			description.Circularity = 4 * math.Pi * float64(description.Area) / (description.Perimeter * description.Perimeter)
+		}
+
+		if options.FourierDescriptors > 0 {
+			coefficients, err := FourierDescriptors(boundary)
+			if err != nil {
+				return nil, err
+			}
+			description.FourierDescriptors = normalisedFourierDescriptors(coefficients, options.FourierDescriptors)
+		}
+		if options.SignatureSamples > 0 {
+			description.Signature, err = DistanceSignature(boundary, options.SignatureSamples)
+			if err != nil {
+				return nil, err
+			}
+		}
+		descriptors = append(descriptors, description)
+	}
+	return descriptors, nil
+}
+
+func WriteDescriptorsJSON(w io.Writer, descriptors []RegionDescriptors) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(descriptors)
+}
+
+func WriteDescriptorsCSV(w io.Writer, descriptors []RegionDescriptors) error {
+	// One row per region after a header row. The Fourier descriptors and signature
+	// take as many columns as the longest of them, fd1, fd2, ... and r1, r2, ...
+	var fourierColumns, signatureColumns int
+	for _, description := range descriptors {
+		if len(description.FourierDescriptors) > fourierColumns {
+			fourierColumns = len(description.FourierDescriptors)
+		}
+		if len(description.Signature) > signatureColumns {
+			signatureColumns = len(description.Signature)
+		}
+	}
+
+	var header []string = []string{"label", "area", "centroid_x", "centroid_y", "perimeter", "compactness", "circularity", "eccentricity", "euler_number"}
+	for index := 1; index <= 7; index++ {
+		header = append(header, fmt.Sprintf("hu%d", index))
+	}
+	for index := 1; index <= fourierColumns; index++ {
+		header = append(header, fmt.Sprintf("fd%d", index))
+	}
+	for index := 1; index <= signatureColumns; index++ {
+		header = append(header, fmt.Sprintf("r%d", index))
+	}
+
+	formatFloat := func(value float64) string {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, description := range descriptors {
+		var record []string = []string{
+			strconv.Itoa(description.Label),
+			strconv.Itoa(description.Area),
+			formatFloat(description.CentroidX),
+			formatFloat(description.CentroidY),
+			formatFloat(description.Perimeter),
+			formatFloat(description.Compactness),
+			formatFloat(description.Circularity),
+			formatFloat(description.Eccentricity),
+			strconv.Itoa(description.EulerNumber),
+		}
+		for _, moment := range description.HuMoments {
+			record = append(record, formatFloat(moment))
+		}
+		for index := 0; index < fourierColumns; index++ {
+			if index < len(description.FourierDescriptors) {
+				record = append(record, formatFloat(description.FourierDescriptors[index]))
+			} else {
+				record = append(record, "")
+			}
+		}
+		for index := 0; index < signatureColumns; index++ {
+			if index < len(description.Signature) {
+				record = append(record, formatFloat(description.Signature[index]))
+			} else {
+				record = append(record, "")
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
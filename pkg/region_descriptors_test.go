@@ -0,0 +1,199 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"math/cmplx"
+	"reflect"
+	"testing"
+)
+
+func TestFastFourierTransform(t *testing.T) {
+	for _, length := range []int{1, 8, 12, 17} {
+		var values []complex128
+		for index := 0; index < length; index++ {
+			values = append(values, complex(float64(index%5)-1, float64(index*index%7)))
+		}
+		transformed := fastFourierTransform(values, false)
+		for u := 0; u < length; u++ {
+			var want complex128
+			for x, value := range values {
+				want += value * cmplx.Exp(complex(0, -2*math.Pi*float64(u*x)/float64(length)))
+			}
+			if cmplx.Abs(transformed[u]-want) > 1e-9 {
+				t.Errorf("length %d: F(%d) = %v, want %v", length, u, transformed[u], want)
+			}
+		}
+		restored := fastFourierTransform(transformed, true)
+		for index := range values {
+			if cmplx.Abs(restored[index]-values[index]) > 1e-9 {
+				t.Errorf("length %d: inverse gives %v at %d, want %v", length, restored[index], index, values[index])
+			}
+		}
+	}
+}
+
+func TestComputeRegionDescriptors(t *testing.T) {
+	labels := newLabels(40, 30)
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 30; y++ {
+			// 1: disk, 2: long bar, 3: ring, 4: two separate dots
+			switch {
+			case math.Hypot(float64(x-8), float64(y-8)) <= 6:
+				labels[x][y] = 1
+			case x >= 20 && x < 38 && y >= 2 && y < 5:
+				labels[x][y] = 2
+			case x >= 20 && x < 27 && y >= 10 && y < 17 && !(x >= 22 && x < 25 && y >= 12 && y < 15):
+				labels[x][y] = 3
+			case (x == 5 || x == 9) && y == 25:
+				labels[x][y] = 4
+			}
+		}
+	}
+
+	descriptors, err := ComputeRegionDescriptors(labels, DescriptorOptions{FourierDescriptors: 6, SignatureSamples: 36})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descriptors) != 4 {
+		t.Fatalf("got %d regions, want 4", len(descriptors))
+	}
+	disk, bar, ring, dots := descriptors[0], descriptors[1], descriptors[2], descriptors[3]
+
+	if disk.Circularity < 0.85 || disk.Eccentricity > 0.1 {
+		t.Errorf("disk circularity and eccentricity = %v and %v, want near 1 and 0", disk.Circularity, disk.Eccentricity)
+	}
+	if math.Abs(disk.CentroidX-8) > 1e-9 || math.Abs(disk.CentroidY-8) > 1e-9 {
+		t.Errorf("disk centroid = (%v, %v), want (8, 8)", disk.CentroidX, disk.CentroidY)
+	}
+	if bar.Eccentricity < 0.95 || bar.Compactness <= disk.Compactness {
+		t.Errorf("bar eccentricity and compactness = %v and %v, want a long thin shape", bar.Eccentricity, bar.Compactness)
+	}
+	if bar.Area != 54 || bar.Perimeter != 38 {
+		t.Errorf("bar area and perimeter = %d and %v, want 54 and 38", bar.Area, bar.Perimeter)
+	}
+	if disk.EulerNumber != 1 || ring.EulerNumber != 0 || dots.EulerNumber != 2 {
+		t.Errorf("Euler numbers = %d, %d and %d, want 1, 0 and 2", disk.EulerNumber, ring.EulerNumber, dots.EulerNumber)
+	}
+
+	// The first invariant of a disk of area A is 1 / (2 pi) in the continuous case
+	if math.Abs(disk.HuMoments[0]-1/(2*math.Pi)) > 0.01 || math.Abs(disk.HuMoments[1]) > 1e-4 {
+		t.Errorf("disk Hu moments = %v", disk.HuMoments)
+	}
+	if len(disk.FourierDescriptors) != 6 || disk.FourierDescriptors[0] != 1 {
+		t.Errorf("disk Fourier descriptors = %v, want a(1) to dominate", disk.FourierDescriptors)
+	}
+	for _, distance := range disk.Signature {
+		if math.Abs(distance-6) > 1 {
+			t.Errorf("disk signature = %v, want close to the radius 6", disk.Signature)
+			break
+		}
+	}
+
+	if _, err := ComputeRegionDescriptors(labels, DescriptorOptions{SignatureSamples: -1}); err == nil {
+		t.Error("expected an error for a negative signature length")
+	}
+}
+
+func TestHuMomentInvariance(t *testing.T) {
+	shape := [][]bool{
+		{true, true, true, true},
+		{true, false, false, false},
+		{true, false, false, false},
+	}
+	// The same shape transposed, that is mirrored and rotated by 90 degrees, and moved
+	var moved [][]bool = newBinary(8, 9)
+	for x := range shape {
+		for y := range shape[x] {
+			moved[y+3][x+2] = shape[x][y]
+		}
+	}
+	first, second := huMoments(shape), huMoments(moved)
+	for index := 0; index < 6; index++ {
+		if math.Abs(first[index]-second[index]) > 1e-12 {
+			t.Errorf("invariant %d = %v and %v, want equal", index+1, first[index], second[index])
+		}
+	}
+	// Mirroring only changes the sign of the last invariant
+	if math.Abs(first[6]+second[6]) > 1e-12 {
+		t.Errorf("seventh invariant = %v and %v, want opposite signs", first[6], second[6])
+	}
+}
+
+func TestFourierDescriptorReconstruction(t *testing.T) {
+	labels := labelsFromRows([]string{
+		".......",
+		".11111.",
+		".11111.",
+		".11111.",
+		".......",
+	})
+	boundary, err := FollowBoundary(labels, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptors, err := FourierDescriptors(boundary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := ReconstructBoundary(descriptors, len(descriptors))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(full, boundary.Points) {
+		t.Errorf("reconstruction from every descriptor = %v, want %v", full, boundary.Points)
+	}
+
+	// With only a(0) every point collapses onto the centroid
+	centroid, err := ReconstructBoundary(descriptors, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, point := range centroid {
+		if point != centroid[0] {
+			t.Errorf("a(0) alone gives %v, want a single point", centroid)
+			break
+		}
+	}
+
+	if _, err := ReconstructBoundary(descriptors, 0); err == nil {
+		t.Error("expected an error when keeping no descriptors")
+	}
+}
+
+func TestWriteDescriptors(t *testing.T) {
+	descriptors := []RegionDescriptors{
+		{Label: 1, Area: 4, Perimeter: 4, FourierDescriptors: []float64{1, 0.5}},
+		{Label: 2, Area: 1, Signature: []float64{0}},
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteDescriptorsCSV(&buffer, descriptors); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || len(records[0]) != 9+7+2+1 {
+		t.Fatalf("got %d rows of %d columns, want 3 rows of 19", len(records), len(records[0]))
+	}
+	if records[0][16] != "fd1" || records[1][17] != "0.5" || records[2][16] != "" {
+		t.Errorf("Fourier descriptor columns = %v, %v and %v", records[0][16], records[1][17], records[2][16])
+	}
+
+	buffer.Reset()
+	if err := WriteDescriptorsJSON(&buffer, descriptors); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []RegionDescriptors
+	if err := json.Unmarshal(buffer.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, descriptors) {
+		t.Errorf("JSON round trip gives %+v, want %+v", decoded, descriptors)
+	}
+}
@@ -0,0 +1,606 @@
+// Region-based segmentation: region growing, region splitting and merging, and marker-controlled watershed
+package pkg
+
+import (
+	"container/heap"
+	"fmt"
+	"image"
+	"math"
+)
+
+// Segmentations are returned as label images indexed [x][y]. Label 0 is background
+// (pixels that belong to no region, or watershed lines) and regions are numbered from 1.
+
+// LevelStatistics summarises the grey levels of a region
+type LevelStatistics struct {
+	Count             int
+	Mean              float64
+	StandardDeviation float64
+	Minimum           uint8
+	Maximum           uint8
+}
+
+// HomogeneityPredicate is the predicate Q of Section 10.4.2, it returns true when a
+// region is uniform enough to be left whole
+type HomogeneityPredicate func(statistics LevelStatistics) bool
+
+// GrowingPredicate decides whether a pixel joins a region grown from a seed, given
+// its level, the level of the seed and the region grown so far
+type GrowingPredicate func(level uint8, seedLevel uint8, region LevelStatistics) bool
+
+// levelSums keeps running sums so regions can be grown and merged in constant time
+type levelSums struct {
+	count   int
+	sum     float64
+	squares float64
+	minimum uint8
+	maximum uint8
+}
+
+func (sums *levelSums) add(level uint8) {
+	if sums.count == 0 || level < sums.minimum {
+		sums.minimum = level
+	}
+	if sums.count == 0 || level > sums.maximum {
+		sums.maximum = level
+	}
+	sums.count++
+	sums.sum += float64(level)
+	sums.squares += float64(level) * float64(level)
+}
+
+func (sums levelSums) merge(other levelSums) levelSums {
+	if sums.count == 0 {
+		return other
+	}
+	if other.count == 0 {
+		return sums
+	}
+	merged := levelSums{
+		count:   sums.count + other.count,
+		sum:     sums.sum + other.sum,
+		squares: sums.squares + other.squares,
+		minimum: sums.minimum,
+		maximum: sums.maximum,
+	}
+	if other.minimum < merged.minimum {
+		merged.minimum = other.minimum
+	}
+	if other.maximum > merged.maximum {
+		merged.maximum = other.maximum
+	}
+	return merged
+}
+
+func (sums levelSums) statistics() LevelStatistics {
+	if sums.count == 0 {
+		return LevelStatistics{}
+	}
+	mean := sums.sum / float64(sums.count)
+	variance := sums.squares/float64(sums.count) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	return LevelStatistics{
+		Count:             sums.count,
+		Mean:              mean,
+		StandardDeviation: math.Sqrt(variance),
+		Minimum:           sums.minimum,
+		Maximum:           sums.maximum,
+	}
+}
+
+func newLabels(width int, height int) [][]int {
+	labels := make([][]int, width)
+	for x := range labels {
+		labels[x] = make([]int, height)
+	}
+	return labels
+}
+
+var eightNeighbours []image.Point = []image.Point{
+	{-1, -1}, {0, -1}, {1, -1},
+	{-1, 0}, {1, 0},
+	{-1, 1}, {0, 1}, {1, 1},
+}
+
+func SeedSimilarityPredicate(threshold float64) GrowingPredicate {
+	// Q = TRUE when the absolute difference between the pixel and the seed is at most
+	// the threshold, the predicate used in Example 10.20 of DIP book
+	return func(level uint8, seedLevel uint8, region LevelStatistics) bool {
+		return math.Abs(float64(level)-float64(seedLevel)) <= threshold
+	}
+}
+
+func MeanSimilarityPredicate(threshold float64) GrowingPredicate {
+	// Q = TRUE when the pixel is within the threshold of the mean of the region so far
+	return func(level uint8, seedLevel uint8, region LevelStatistics) bool {
+		return math.Abs(float64(level)-region.Mean) <= threshold
+	}
+}
+
+func RegionGrowing(img image.Image, seeds []image.Point, predicate GrowingPredicate) ([][]int, error) {
+	// This is from Section 10.4.1 of DIP book
+	// Each seed grows a region by appending 8-connected neighbours that satisfy the
+	// predicate. Seeds that already lie in a region grown from an earlier seed are skipped.
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("no seeds")
+	}
+	var width int = len(levels)
+	var height int = len(levels[0])
+	var labels [][]int = newLabels(width, height)
+	var label int = 0
+
+	for _, seed := range seeds {
+		if seed.X < 0 || seed.Y < 0 || seed.X >= width || seed.Y >= height {
+			return nil, fmt.Errorf("seed %v is outside the %dx%d image", seed, width, height)
+		}
+		if labels[seed.X][seed.Y] != 0 {
+			continue
+		}
+		label++
+		var seedLevel uint8 = levels[seed.X][seed.Y]
+		var sums levelSums
+		sums.add(seedLevel)
+		labels[seed.X][seed.Y] = label
+
+		// Breadth first, so the region mean evolves outwards from the seed
+		var queue []image.Point = []image.Point{seed}
+		for len(queue) > 0 {
+			point := queue[0]
+			queue = queue[1:]
+			for _, offset := range eightNeighbours {
+				neighbour := point.Add(offset)
+				if neighbour.X < 0 || neighbour.Y < 0 || neighbour.X >= width || neighbour.Y >= height || labels[neighbour.X][neighbour.Y] != 0 {
+					continue
+				}
+				level := levels[neighbour.X][neighbour.Y]
+				if predicate(level, seedLevel, sums.statistics()) {
+					labels[neighbour.X][neighbour.Y] = label
+					sums.add(level)
+					queue = append(queue, neighbour)
+				}
+			}
+		}
+	}
+	return labels, nil
+}
+
+func StandardDeviationPredicate(maximum float64) HomogeneityPredicate {
+	// Q = TRUE when the standard deviation of the region is at most maximum
+	return func(statistics LevelStatistics) bool {
+		return statistics.StandardDeviation <= maximum
+	}
+}
+
+func RangePredicate(maximum uint8) HomogeneityPredicate {
+	// Q = TRUE when the difference between the brightest and darkest pixel is at most maximum
+	return func(statistics LevelStatistics) bool {
+		return statistics.Maximum-statistics.Minimum <= maximum
+	}
+}
+
+func SplitAndMerge(img image.Image, predicate HomogeneityPredicate, minimumSize int) ([][]int, error) {
+	// This is from Section 10.4.2 of DIP book
+	// 1. Split into four disjoint quadrants any region for which Q is FALSE, quadrants
+	//    smaller than minimumSize on a side are not split any further
+	// 2. When no further splitting is possible, merge any adjacent regions for which
+	//    Q of their union is TRUE
+	// 3. Stop when no further merging is possible
+	if minimumSize < 1 {
+		return nil, fmt.Errorf("minimum size must be at least 1, got %d", minimumSize)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	var width int = len(levels)
+	var height int = len(levels[0])
+	var labels [][]int = newLabels(width, height)
+
+	// Index 0 is unused so region numbers match labels
+	var regions []levelSums = []levelSums{{}}
+	var split func(bounds image.Rectangle)
+	split = func(bounds image.Rectangle) {
+		var sums levelSums
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				sums.add(levels[x][y])
+			}
+		}
+		if predicate(sums.statistics()) || bounds.Dx() < 2*minimumSize || bounds.Dy() < 2*minimumSize {
+			regions = append(regions, sums)
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+					labels[x][y] = len(regions) - 1
+				}
+			}
+			return
+		}
+		middle := image.Point{(bounds.Min.X + bounds.Max.X) / 2, (bounds.Min.Y + bounds.Max.Y) / 2}
+		split(image.Rect(bounds.Min.X, bounds.Min.Y, middle.X, middle.Y))
+		split(image.Rect(middle.X, bounds.Min.Y, bounds.Max.X, middle.Y))
+		split(image.Rect(bounds.Min.X, middle.Y, middle.X, bounds.Max.Y))
+		split(image.Rect(middle.X, middle.Y, bounds.Max.X, bounds.Max.Y))
+	}
+	split(image.Rect(0, 0, width, height))
+
+	// Merged regions point to the region they joined, like a union-find forest
+	var parents []int = make([]int, len(regions))
+	for index := range parents {
+		parents[index] = index
+	}
+	var find func(region int) int
+	find = func(region int) int {
+		if parents[region] != region {
+			parents[region] = find(parents[region])
+		}
+		return parents[region]
+	}
+
+	for merged := true; merged; {
+		merged = false
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				for _, neighbour := range []image.Point{{x + 1, y}, {x, y + 1}} {
+					if neighbour.X >= width || neighbour.Y >= height {
+						continue
+					}
+					first, second := find(labels[x][y]), find(labels[neighbour.X][neighbour.Y])
+					if first == second {
+						continue
+					}
+					union := regions[first].merge(regions[second])
+					if predicate(union.statistics()) {
+						parents[second] = first
+						regions[first] = union
+						merged = true
+					}
+				}
+			}
+		}
+	}
+
+	// Renumber the surviving regions consecutively
+	var numbers map[int]int = make(map[int]int)
+	for x := range labels {
+		for y := range labels[x] {
+			root := find(labels[x][y])
+			if _, ok := numbers[root]; !ok {
+				numbers[root] = len(numbers) + 1
+			}
+			labels[x][y] = numbers[root]
+		}
+	}
+	return labels, nil
+}
+
+// floodItem is a pixel waiting in the watershed's priority queue. Equal levels are
+// served in insertion order so flooding spreads evenly from every marker.
+type floodItem struct {
+	point image.Point
+	level float64
+	order int
+}
+
+type floodQueue []floodItem
+
+func (queue floodQueue) Len() int { return len(queue) }
+func (queue floodQueue) Less(i, j int) bool {
+	if queue[i].level != queue[j].level {
+		return queue[i].level < queue[j].level
+	}
+	return queue[i].order < queue[j].order
+}
+func (queue floodQueue) Swap(i, j int)  { queue[i], queue[j] = queue[j], queue[i] }
+func (queue *floodQueue) Push(item any) { *queue = append(*queue, item.(floodItem)) }
+func (queue *floodQueue) Pop() any {
+	old := *queue
+	item := old[len(old)-1]
+	*queue = old[:len(old)-1]
+	return item
+}
+
+func watershedFloats(relief [][]float64, markers [][]int, mask [][]bool) [][]int {
+	// Meyer's flooding algorithm. The unlabelled neighbours of every marker are queued by
+	// relief level, the lowest is labelled when all of its labelled neighbours agree and
+	// becomes a watershed line (label 0) where two catchment basins meet. Pixels outside
+	// the mask, when one is given, are never flooded.
+	var width int = len(relief)
+	var height int = len(relief[0])
+	var labels [][]int = newLabels(width, height)
+	var queued [][]bool = newBinary(width, height)
+	var queue floodQueue
+	var order int = 0
+
+	push := func(point image.Point) {
+		for _, offset := range eightNeighbours {
+			neighbour := point.Add(offset)
+			if neighbour.X < 0 || neighbour.Y < 0 || neighbour.X >= width || neighbour.Y >= height {
+				continue
+			}
+			if queued[neighbour.X][neighbour.Y] || labels[neighbour.X][neighbour.Y] != 0 {
+				continue
+			}
+			if mask != nil && !mask[neighbour.X][neighbour.Y] {
+				continue
+			}
+			queued[neighbour.X][neighbour.Y] = true
+			heap.Push(&queue, floodItem{point: neighbour, level: relief[neighbour.X][neighbour.Y], order: order})
+			order++
+		}
+	}
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if markers[x][y] > 0 && (mask == nil || mask[x][y]) {
+				labels[x][y] = markers[x][y]
+				queued[x][y] = true
+			}
+		}
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if labels[x][y] > 0 {
+				push(image.Point{x, y})
+			}
+		}
+	}
+
+	for queue.Len() > 0 {
+		item := heap.Pop(&queue).(floodItem)
+		var label int = 0
+		var conflict bool = false
+		for _, offset := range eightNeighbours {
+			neighbour := item.point.Add(offset)
+			if neighbour.X < 0 || neighbour.Y < 0 || neighbour.X >= width || neighbour.Y >= height {
+				continue
+			}
+			neighbourLabel := labels[neighbour.X][neighbour.Y]
+			if neighbourLabel == 0 {
+				continue
+			}
+			if label == 0 {
+				label = neighbourLabel
+			} else if neighbourLabel != label {
+				conflict = true
+			}
+		}
+		if conflict || label == 0 {
+			// Watershed line, it stays 0 and does not spread the flood
+			continue
+		}
+		labels[item.point.X][item.point.Y] = label
+		push(item.point)
+	}
+	return labels
+}
+
+func Watershed(img image.Image, markers [][]int) ([][]int, error) {
+	// This is from Section 10.5 of DIP book
+	// Marker-controlled watershed. img is the relief to flood, usually a gradient magnitude
+	// image, and markers is a label image of the same size where every positive label is
+	// an internal marker (a basin to flood from) and 0 is unmarked. Returns the catchment
+	// basins labelled like their markers, with the watershed lines set to 0.
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	if len(markers) != len(levels) || len(markers[0]) != len(levels[0]) {
+		return nil, fmt.Errorf("markers are %dx%d but the image is %dx%d", len(markers), len(markers[0]), len(levels), len(levels[0]))
+	}
+	return watershedFloats(levelsToFloats(levels), markers, nil), nil
+}
+
+func regionalMinima(levels [][]uint8) [][]int {
+	// Labels every 8-connected plateau that has no lower neighbour
+	var width int = len(levels)
+	var height int = len(levels[0])
+	var labels [][]int = newLabels(width, height)
+	var visited [][]bool = newBinary(width, height)
+	var label int = 0
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if visited[x][y] {
+				continue
+			}
+			var level uint8 = levels[x][y]
+			var plateau []image.Point
+			var minimum bool = true
+			var stack []image.Point = []image.Point{{x, y}}
+			visited[x][y] = true
+			for len(stack) > 0 {
+				point := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				plateau = append(plateau, point)
+				for _, offset := range eightNeighbours {
+					neighbour := point.Add(offset)
+					if neighbour.X < 0 || neighbour.Y < 0 || neighbour.X >= width || neighbour.Y >= height {
+						continue
+					}
+					neighbourLevel := levels[neighbour.X][neighbour.Y]
+					if neighbourLevel < level {
+						minimum = false
+					}
+					if neighbourLevel == level && !visited[neighbour.X][neighbour.Y] {
+						visited[neighbour.X][neighbour.Y] = true
+						stack = append(stack, neighbour)
+					}
+				}
+			}
+			if minimum {
+				label++
+				for _, point := range plateau {
+					labels[point.X][point.Y] = label
+				}
+			}
+		}
+	}
+	return labels
+}
+
+func RegionalMinimaMarkers(img image.Image, depth uint8) ([][]int, error) {
+	// Internal markers for the watershed, one label per regional minimum. Using every
+	// minimum of a noisy gradient over-segments (Fig. 10.56 of DIP book), so minima
+	// shallower than depth are removed first with the h-minima transform: the image
+	// raised by depth is reconstructed by erosion over the original.
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	if depth > 0 {
+		var raised [][]uint8 = newLevels(len(levels), len(levels[0]))
+		for x := range levels {
+			for y := range levels[x] {
+				raised[x][y] = clampLevel(int(levels[x][y]) + int(depth))
+			}
+		}
+		element, err := SquareStructuringElement(3)
+		if err != nil {
+			return nil, err
+		}
+		levels = reconstructLevels(raised, levels, element, false)
+	}
+	return regionalMinima(levels), nil
+}
+
+func DistanceTransform(img image.Image) ([][]float64, error) {
+	// Euclidean distance from every foreground pixel to the nearest background pixel,
+	// background pixels are 0. Computed exactly with two passes of the 1-D lower
+	// envelope algorithm of Felzenszwalb and Huttenlocher.
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 || len(pixels[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	var width int = len(pixels)
+	var height int = len(pixels[0])
+	var infinity float64 = float64(width*width + height*height)
+
+	var squared [][]float64 = newFloats(width, height)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if pixels[x][y] {
+				squared[x][y] = infinity
+			}
+		}
+	}
+
+	var column []float64 = make([]float64, height)
+	for x := 0; x < width; x++ {
+		copy(column, squared[x])
+		copy(squared[x], squaredDistance1D(column))
+	}
+	var row []float64 = make([]float64, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			row[x] = squared[x][y]
+		}
+		transformed := squaredDistance1D(row)
+		for x := 0; x < width; x++ {
+			squared[x][y] = math.Sqrt(transformed[x])
+		}
+	}
+	return squared, nil
+}
+
+func squaredDistance1D(values []float64) []float64 {
+	// Lower envelope of the parabolas (q - p)^2 + values[p]
+	var length int = len(values)
+	var result []float64 = make([]float64, length)
+	var vertices []int = make([]int, length)
+	var boundaries []float64 = make([]float64, length+1)
+	var count int = 0
+	boundaries[0] = math.Inf(-1)
+	boundaries[1] = math.Inf(1)
+
+	for q := 1; q < length; q++ {
+		intersection := parabolaIntersection(values, vertices[count], q)
+		for intersection <= boundaries[count] {
+			// boundaries[0] is minus infinity, so this stops at the first parabola
+			count--
+			intersection = parabolaIntersection(values, vertices[count], q)
+		}
+		count++
+		vertices[count] = q
+		boundaries[count] = intersection
+		boundaries[count+1] = math.Inf(1)
+	}
+
+	var index int = 0
+	for q := 0; q < length; q++ {
+		for boundaries[index+1] < float64(q) {
+			index++
+		}
+		difference := float64(q - vertices[index])
+		result[q] = difference*difference + values[vertices[index]]
+	}
+	return result
+}
+
+func parabolaIntersection(values []float64, p int, q int) float64 {
+	return ((values[q] + float64(q*q)) - (values[p] + float64(p*p))) / float64(2*q-2*p)
+}
+
+func SeparateTouchingBlobs(img image.Image, depth uint8) ([][]int, error) {
+	// Splits touching blobs of a binary image with the watershed of the negated distance
+	// transform (Section 10.5 of DIP book). Every blob centre becomes a basin, necks
+	// between blobs become watershed lines. Centres closer in distance than depth pixels
+	// to the neck joining them are not split.
+	distances, err := DistanceTransform(img)
+	if err != nil {
+		return nil, err
+	}
+	var foreground [][]bool = imageToBinary(img)
+	var width int = len(distances)
+	var height int = len(distances[0])
+
+	var relief [][]uint8 = newLevels(width, height)
+	var negated [][]float64 = newFloats(width, height)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			relief[x][y] = uint8(MaxGrayscaleLevels-1) - clampLevel(int(math.Round(distances[x][y])))
+			negated[x][y] = -distances[x][y]
+		}
+	}
+	reliefImage, err := levelsToImage(relief)
+	if err != nil {
+		return nil, err
+	}
+	markers, err := RegionalMinimaMarkers(reliefImage, depth)
+	if err != nil {
+		return nil, err
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if !foreground[x][y] {
+				markers[x][y] = 0
+			}
+		}
+	}
+	return watershedFloats(negated, markers, foreground), nil
+}
+
+func LabelsToImage(labels [][]int) (image.Image, error) {
+	// Gives every label its own colour, label 0 is black. Hues are spaced by the golden
+	// angle so neighbouring labels get clearly different colours.
+	if len(labels) == 0 || len(labels[0]) == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty label image")
+	}
+	newImage := image.NewRGBA(image.Rect(0, 0, len(labels), len(labels[0])))
+	for x := range labels {
+		for y, label := range labels[x] {
+			if label <= 0 {
+				newImage.Set(x, y, hsvToRGBA(0, 0, 0))
+				continue
+			}
+			hue := math.Mod(float64(label)*137.508, 360)
+			newImage.Set(x, y, hsvToRGBA(hue, 0.75, 0.6+0.4*float64(label%3)/2))
+		}
+	}
+	return newImage, nil
+}
@@ -0,0 +1,183 @@
+package pkg
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func countLabels(labels [][]int) int {
+	var seen map[int]bool = make(map[int]bool)
+	for x := range labels {
+		for _, label := range labels[x] {
+			if label > 0 {
+				seen[label] = true
+			}
+		}
+	}
+	return len(seen)
+}
+
+func TestRegionGrowing(t *testing.T) {
+	// A bright square with a slight ramp on a dark background
+	var values []uint8
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			var level uint8 = 20
+			if x >= 2 && x < 7 && y >= 2 && y < 7 {
+				level = uint8(200 + 3*x)
+			}
+			values = append(values, level)
+		}
+	}
+	img := createTestImage(10, 10, values)
+
+	labels, err := RegionGrowing(img, []image.Point{{4, 4}, {5, 5}, {0, 0}}, SeedSimilarityPredicate(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second seed is already inside the first region
+	if got := countLabels(labels); got != 2 {
+		t.Errorf("got %d regions, want 2", got)
+	}
+	if labels[2][2] != 1 || labels[6][6] != 1 || labels[7][7] != 2 || labels[0][9] != 2 {
+		t.Error("pixels are not assigned to the region of their seed")
+	}
+
+	// A tight predicate stops at the ramp
+	labels, err = RegionGrowing(img, []image.Point{{2, 4}}, MeanSimilarityPredicate(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels[3][4] != 1 || labels[6][4] != 0 {
+		t.Error("mean predicate should accept the close neighbour and reject the far end of the ramp")
+	}
+
+	if _, err := RegionGrowing(img, []image.Point{{10, 0}}, SeedSimilarityPredicate(20)); err == nil {
+		t.Error("expected an error for a seed outside the image")
+	}
+}
+
+func TestSplitAndMerge(t *testing.T) {
+	// A bright quadrant next to three dark ones at slightly different levels
+	var values []uint8
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			var level uint8
+			switch {
+			case x < 8 && y < 8:
+				level = 200
+			case y < 8:
+				level = 30
+			default:
+				level = 34
+			}
+			values = append(values, level)
+		}
+	}
+	img := createTestImage(16, 16, values)
+
+	labels, err := SplitAndMerge(img, RangePredicate(10), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The dark quadrants are merged into one region
+	if got := countLabels(labels); got != 2 {
+		t.Errorf("got %d regions, want 2", got)
+	}
+	if labels[12][2] != labels[2][12] || labels[12][2] != labels[15][15] {
+		t.Error("the dark quadrants should have been merged")
+	}
+	if labels[0][0] == labels[15][15] {
+		t.Error("the bright quadrant should stay apart")
+	}
+
+	if _, err := SplitAndMerge(img, StandardDeviationPredicate(1), 0); err == nil {
+		t.Error("expected an error for a zero minimum size")
+	}
+}
+
+func TestWatershed(t *testing.T) {
+	// Two valleys separated by a ridge at x = 6
+	var values []uint8
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 13; x++ {
+			values = append(values, uint8(110+30*absInt(absInt(x-6)-3)))
+		}
+	}
+	img := createTestImage(13, 8, values)
+
+	markers, err := RegionalMinimaMarkers(img, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countLabels(markers); got != 2 {
+		t.Fatalf("got %d minima, want 2", got)
+	}
+
+	labels, err := Watershed(img, markers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels[0][0] == 0 || labels[12][0] == 0 || labels[0][0] == labels[12][0] {
+		t.Error("each valley should be its own basin")
+	}
+	for y := 0; y < 8; y++ {
+		if labels[6][y] != 0 {
+			t.Errorf("ridge pixel (6,%d) has label %d, want a watershed line", y, labels[6][y])
+		}
+	}
+
+	// A shallow dip does not make a marker once it is below the depth
+	noisy := createModalTestImage(12, 4, []uint8{100, 95, 100})
+	shallow, err := RegionalMinimaMarkers(noisy, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countLabels(shallow); got != 1 {
+		t.Errorf("got %d markers with h-minima, want 1", got)
+	}
+}
+
+func TestDistanceTransformAndTouchingBlobs(t *testing.T) {
+	// Two overlapping disks
+	var values []uint8
+	for y := 0; y < 15; y++ {
+		for x := 0; x < 26; x++ {
+			var level uint8 = 0
+			if math.Hypot(float64(x-7), float64(y-7)) <= 6 || math.Hypot(float64(x-18), float64(y-7)) <= 6 {
+				level = 255
+			}
+			values = append(values, level)
+		}
+	}
+	img := createTestImage(26, 15, values)
+
+	distances, err := DistanceTransform(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The nearest background pixel to both (7, 7) and (2, 7) is (1, 6)
+	if distances[0][0] != 0 || math.Abs(distances[7][7]-math.Sqrt(37)) > 1e-9 || math.Abs(distances[2][7]-math.Sqrt2) > 1e-9 {
+		t.Errorf("distances = %v, %v and %v, want 0, sqrt(37) and sqrt(2)", distances[0][0], distances[7][7], distances[2][7])
+	}
+
+	labels, err := SeparateTouchingBlobs(img, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countLabels(labels); got != 2 {
+		t.Fatalf("got %d blobs, want 2", got)
+	}
+	if labels[7][7] == labels[18][7] || labels[0][0] != 0 {
+		t.Error("the disks should be separate blobs on a background of 0")
+	}
+
+	colours, err := LabelsToImage(labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if colours.At(7, 7) == colours.At(18, 7) {
+		t.Error("different labels should have different colours")
+	}
+}
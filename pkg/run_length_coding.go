@@ -0,0 +1,383 @@
+// Run-length coding of binary images in one and two dimensions, and bit-plane coding of grey levels
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"io"
+)
+
+// The mode codes of the two dimensional coding, from the CCITT Group 3 and 4 standards
+var readModeCodes = map[string]struct {
+	code   uint64
+	length uint
+}{
+	"V0":         {1, 1},
+	"VR1":        {3, 3},
+	"VL1":        {2, 3},
+	"horizontal": {1, 3},
+	"pass":       {1, 4},
+	"VR2":        {3, 6},
+	"VL2":        {2, 6},
+	"VR3":        {3, 7},
+	"VL3":        {2, 7},
+}
+
+func writeImageSize(bits *bitWriter, width int, height int) error {
+	if err := bits.writeGamma(uint64(width)); err != nil {
+		return err
+	}
+	return bits.writeGamma(uint64(height))
+}
+
+func readImageSize(bits *bitReader) (int, int, error) {
+	width, err := bits.readGamma()
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := bits.readGamma()
+	if err != nil {
+		return 0, 0, err
+	}
+	if width > 1<<20 || height > 1<<20 || int(width*height) > maxImagePixels {
+		return 0, 0, fmt.Errorf("image size %dx%d is too large", width, height)
+	}
+	return int(width), int(height), nil
+}
+
+func encodeRuns(bits *bitWriter, pixels [][]bool, y int) error {
+	// One row as alternating runs of background and foreground, starting with
+	// background, each length plus one in the Elias gamma code
+	var colour bool = false
+	var run uint64 = 0
+	for x := range pixels {
+		if pixels[x][y] != colour {
+			if err := bits.writeGamma(run + 1); err != nil {
+				return err
+			}
+			colour, run = !colour, 0
+		}
+		run++
+	}
+	return bits.writeGamma(run + 1)
+}
+
+func decodeRuns(bits *bitReader, pixels [][]bool, y int) error {
+	var colour bool = false
+	for x := 0; x < len(pixels); {
+		run, err := bits.readGamma()
+		if err != nil {
+			return err
+		}
+		// Only the first background run of a row may be empty
+		if run == 1 && (x > 0 || colour) {
+			return fmt.Errorf("empty run at %d", x)
+		}
+		if x+int(run-1) > len(pixels) {
+			return fmt.Errorf("run of %d at %d is longer than the row", run-1, x)
+		}
+		for end := x + int(run-1); x < end; x++ {
+			pixels[x][y] = colour
+		}
+		colour = !colour
+	}
+	return nil
+}
+
+func RunLengthEncode(w io.Writer, img image.Image) error {
+	// This is from Section 8.2.5 of DIP book
+	// Codes the binary image row by row, after the image size
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 || len(pixels[0]) == 0 {
+		return fmt.Errorf("empty image")
+	}
+	var bits *bitWriter = newBitWriter(w)
+	if err := writeImageSize(bits, len(pixels), len(pixels[0])); err != nil {
+		return err
+	}
+	for y := range pixels[0] {
+		if err := encodeRuns(bits, pixels, y); err != nil {
+			return err
+		}
+	}
+	return bits.flush()
+}
+
+func RunLengthDecode(r io.Reader) (image.Image, error) {
+	var bits *bitReader = newBitReader(r)
+	width, height, err := readImageSize(bits)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	var pixels [][]bool = newBinary(width, height)
+	for y := 0; y < height; y++ {
+		if err := decodeRuns(bits, pixels, y); err != nil {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), err
+		}
+	}
+	return binaryToImage(pixels)
+}
+
+func nextChange(pixels [][]bool, y int, after int, colour bool) int {
+	// The first changing element right of after whose pixel has the given colour, or
+	// the width. Row -1 is an imaginary background row and so is the pixel left of
+	// each row.
+	var width int = len(pixels)
+	for x := after + 1; x < width; x++ {
+		var current, previous bool
+		if y >= 0 {
+			current = pixels[x][y]
+			if x > 0 {
+				previous = pixels[x-1][y]
+			}
+		}
+		if current != previous && current == colour {
+			return x
+		}
+	}
+	return width
+}
+
+func RunLengthEncode2D(w io.Writer, img image.Image) error {
+	// This is from Section 8.2.5 of DIP book
+	// Relative coding of each row against the one above, the modified READ code of
+	// CCITT Group 3 and 4. A changing element close to one in the row above is coded
+	// by the distance in vertical mode, otherwise the next two runs are coded in
+	// horizontal mode, with Elias gamma codes instead of the standard run tables.
+	var pixels [][]bool = imageToBinary(img)
+	if len(pixels) == 0 || len(pixels[0]) == 0 {
+		return fmt.Errorf("empty image")
+	}
+	var width int = len(pixels)
+	var bits *bitWriter = newBitWriter(w)
+	if err := writeImageSize(bits, width, len(pixels[0])); err != nil {
+		return err
+	}
+	var writeMode = func(mode string) error {
+		return bits.writeBits(readModeCodes[mode].code, readModeCodes[mode].length)
+	}
+
+	for y := range pixels[0] {
+		var a0 int = -1
+		var colour bool = false
+		for a0 < width {
+			a1 := nextChange(pixels, y, a0, !colour)
+			b1 := nextChange(pixels, y-1, a0, !colour)
+			b2 := nextChange(pixels, y-1, b1, colour)
+			switch {
+			case b2 < a1:
+				if err := writeMode("pass"); err != nil {
+					return err
+				}
+				a0 = b2
+			case a1-b1 >= -3 && a1-b1 <= 3:
+				mode := "V0"
+				if a1 > b1 {
+					mode = fmt.Sprintf("VR%d", a1-b1)
+				} else if a1 < b1 {
+					mode = fmt.Sprintf("VL%d", b1-a1)
+				}
+				if err := writeMode(mode); err != nil {
+					return err
+				}
+				a0, colour = a1, !colour
+			default:
+				a2 := nextChange(pixels, y, a1, colour)
+				start := a0
+				if start < 0 {
+					start = 0
+				}
+				if err := writeMode("horizontal"); err != nil {
+					return err
+				}
+				if err := bits.writeGamma(uint64(a1-start) + 1); err != nil {
+					return err
+				}
+				if err := bits.writeGamma(uint64(a2-a1) + 1); err != nil {
+					return err
+				}
+				a0 = a2
+			}
+		}
+	}
+	return bits.flush()
+}
+
+func readMode(bits *bitReader) (string, error) {
+	var code uint64 = 0
+	for length := uint(1); length <= 7; length++ {
+		bit, err := bits.readBit()
+		if err != nil {
+			return "", err
+		}
+		code = code<<1 | uint64(bit)
+		for mode, entry := range readModeCodes {
+			if entry.length == length && entry.code == code {
+				return mode, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("invalid mode code")
+}
+
+func RunLengthDecode2D(r io.Reader) (image.Image, error) {
+	var bits *bitReader = newBitReader(r)
+	width, height, err := readImageSize(bits)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	var pixels [][]bool = newBinary(width, height)
+	var fill = func(y int, from int, to int, colour bool) error {
+		if from < 0 {
+			from = 0
+		}
+		if to > width || to < from {
+			return fmt.Errorf("invalid run from %d to %d in row %d", from, to, y)
+		}
+		for x := from; x < to; x++ {
+			pixels[x][y] = colour
+		}
+		return nil
+	}
+
+	for y := 0; y < height; y++ {
+		var a0 int = -1
+		var colour bool = false
+		for a0 < width {
+			mode, err := readMode(bits)
+			if err != nil {
+				return image.NewGray(image.Rect(0, 0, 1, 1)), err
+			}
+			b1 := nextChange(pixels, y-1, a0, !colour)
+			switch mode {
+			case "pass":
+				b2 := nextChange(pixels, y-1, b1, colour)
+				if err := fill(y, a0, b2, colour); err != nil {
+					return image.NewGray(image.Rect(0, 0, 1, 1)), err
+				}
+				a0 = b2
+			case "horizontal":
+				start := a0
+				if start < 0 {
+					start = 0
+				}
+				first, err := bits.readGamma()
+				if err != nil {
+					return image.NewGray(image.Rect(0, 0, 1, 1)), err
+				}
+				second, err := bits.readGamma()
+				if err != nil {
+					return image.NewGray(image.Rect(0, 0, 1, 1)), err
+				}
+				a1 := start + int(first-1)
+				a2 := a1 + int(second-1)
+				// The second run is only empty when the first reaches the end of the row
+				if a2 == a1 && a1 < width {
+					return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty second run in row %d", y)
+				}
+				if err := fill(y, start, a1, colour); err != nil {
+					return image.NewGray(image.Rect(0, 0, 1, 1)), err
+				}
+				if err := fill(y, a1, a2, !colour); err != nil {
+					return image.NewGray(image.Rect(0, 0, 1, 1)), err
+				}
+				a0 = a2
+			default:
+				var offset int = 0
+				if mode != "V0" {
+					offset = int(mode[2] - '0')
+					if mode[1] == 'L' {
+						offset = -offset
+					}
+				}
+				a1 := b1 + offset
+				if a1 <= a0 {
+					return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("changing element %d does not follow %d in row %d", a1, a0, y)
+				}
+				if err := fill(y, a0, a1, colour); err != nil {
+					return image.NewGray(image.Rect(0, 0, 1, 1)), err
+				}
+				a0, colour = a1, !colour
+			}
+		}
+	}
+	return binaryToImage(pixels)
+}
+
+func BitPlaneEncode(w io.Writer, img image.Image, grayCode bool) error {
+	// This is from Section 8.2.7 of DIP book
+	// Splits the grey levels into their 8 bit planes, optionally of the Gray code of the
+	// levels so that neighbouring levels differ in one plane only, and run-length codes
+	// each plane from the most significant
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return fmt.Errorf("empty image")
+	}
+	var width, height int = len(levels), len(levels[0])
+	var bits *bitWriter = newBitWriter(w)
+	if err := writeImageSize(bits, width, height); err != nil {
+		return err
+	}
+	var flag uint = 0
+	if grayCode {
+		flag = 1
+	}
+	if err := bits.writeBit(flag); err != nil {
+		return err
+	}
+
+	var plane [][]bool = newBinary(width, height)
+	for bit := 7; bit >= 0; bit-- {
+		for x := range levels {
+			for y, level := range levels[x] {
+				if grayCode {
+					level = GrayCode(level)
+				}
+				plane[x][y] = level>>uint(bit)&1 == 1
+			}
+		}
+		for y := 0; y < height; y++ {
+			if err := encodeRuns(bits, plane, y); err != nil {
+				return err
+			}
+		}
+	}
+	return bits.flush()
+}
+
+func BitPlaneDecode(r io.Reader) (image.Image, error) {
+	var bits *bitReader = newBitReader(r)
+	width, height, err := readImageSize(bits)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	flag, err := bits.readBit()
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	var levels [][]uint8 = newLevels(width, height)
+	var plane [][]bool = newBinary(width, height)
+	for bit := 7; bit >= 0; bit-- {
+		for y := 0; y < height; y++ {
+			if err := decodeRuns(bits, plane, y); err != nil {
+				return image.NewGray(image.Rect(0, 0, 1, 1)), err
+			}
+		}
+		for x := range plane {
+			for y, set := range plane[x] {
+				if set {
+					levels[x][y] |= 1 << uint(bit)
+				}
+			}
+		}
+	}
+	if flag == 1 {
+		for x := range levels {
+			for y, level := range levels[x] {
+				levels[x][y] = InverseGrayCode(level)
+			}
+		}
+	}
+	return levelsToImage(levels)
+}
@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func createRunLengthTestImage() *image.Gray {
+	// A slanted bar, a disk, a thin vertical line, a dotted row and a run to the end of
+	// a row, which exercise the vertical, horizontal and pass modes of the two
+	// dimensional coding
+	img := image.NewGray(image.Rect(0, 0, 45, 30))
+	for x := 0; x < 45; x++ {
+		for y := 0; y < 30; y++ {
+			foreground := (x >= 3+y/2 && x < 10+y) ||
+				(x-30)*(x-30)+(y-12)*(y-12) < 49 ||
+				(x == 42 && y > 5 && y < 20) ||
+				(y == 25 && x%3 == 0) ||
+				(y == 28 && x > 38)
+			if foreground {
+				img.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	return img
+}
+
+func checkSameLevels(t *testing.T, decoded image.Image, expected image.Image) {
+	t.Helper()
+	if decoded.Bounds() != expected.Bounds() {
+		t.Fatalf("decoded image is %v, want %v", decoded.Bounds(), expected.Bounds())
+	}
+	decodedLevels, expectedLevels := imageToLevels(decoded), imageToLevels(expected)
+	for x := range expectedLevels {
+		for y := range expectedLevels[x] {
+			if decodedLevels[x][y] != expectedLevels[x][y] {
+				t.Fatalf("pixel (%d, %d) = %d, want %d", x, y, decodedLevels[x][y], expectedLevels[x][y])
+			}
+		}
+	}
+}
+
+func TestRunLengthCoding(t *testing.T) {
+	img := createRunLengthTestImage()
+
+	var oneDimensional bytes.Buffer
+	if err := RunLengthEncode(&oneDimensional, img); err != nil {
+		t.Fatal(err)
+	}
+	coded := oneDimensional.Len()
+	decoded, err := RunLengthDecode(&oneDimensional)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameLevels(t, decoded, img)
+
+	var twoDimensional bytes.Buffer
+	if err := RunLengthEncode2D(&twoDimensional, img); err != nil {
+		t.Fatal(err)
+	}
+	// Rows that are much like the one above cost less relative to it
+	if twoDimensional.Len() >= coded {
+		t.Errorf("2-D coding takes %d bytes, 1-D coding %d", twoDimensional.Len(), coded)
+	}
+	decoded, err = RunLengthDecode2D(&twoDimensional)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameLevels(t, decoded, img)
+
+	if _, err := RunLengthDecode(bytes.NewReader([]byte{0x50})); err == nil {
+		t.Error("expected an error for a truncated stream")
+	}
+
+	// A header of 1048576x1048576 must fail before that many pixels are allocated
+	huge := createHugeSizeHeader(t)
+	if _, err := RunLengthDecode(bytes.NewReader(huge)); err == nil {
+		t.Error("expected an error for a 1-D stream of 1048576x1048576")
+	}
+	if _, err := RunLengthDecode2D(bytes.NewReader(huge)); err == nil {
+		t.Error("expected an error for a 2-D stream of 1048576x1048576")
+	}
+	if _, err := BitPlaneDecode(bytes.NewReader(huge)); err == nil {
+		t.Error("expected an error for a bit-plane stream of 1048576x1048576")
+	}
+}
+
+func createHugeSizeHeader(t *testing.T) []byte {
+	t.Helper()
+	var header bytes.Buffer
+	bits := newBitWriter(&header)
+	if err := writeImageSize(bits, 1<<20, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := bits.flush(); err != nil {
+		t.Fatal(err)
+	}
+	return header.Bytes()
+}
+
+func TestBitPlaneCoding(t *testing.T) {
+	img := createWaveletTestImage(23, 17)
+	for _, grayCode := range []bool{false, true} {
+		var coded bytes.Buffer
+		if err := BitPlaneEncode(&coded, img, grayCode); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := BitPlaneDecode(&coded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSameLevels(t, decoded, img)
+	}
+
+	for level := 0; level < MaxGrayscaleLevels; level++ {
+		code := GrayCode(uint8(level))
+		if InverseGrayCode(code) != uint8(level) {
+			t.Fatalf("inverse Gray code of %d = %d, want %d", code, InverseGrayCode(code), level)
+		}
+		// Neighbouring levels differ in one bit
+		if level > 0 {
+			difference := code ^ GrayCode(uint8(level-1))
+			if difference&(difference-1) != 0 {
+				t.Errorf("Gray codes of %d and %d differ in more than one bit", level-1, level)
+			}
+		}
+	}
+
+	// 127 and 128 differ in every bit plane but only the top one of the Gray code
+	img = image.NewGray(image.Rect(0, 0, 2, 1))
+	img.SetGray(0, 0, color.Gray{127})
+	img.SetGray(1, 0, color.Gray{128})
+	for bit := uint8(0); bit < 7; bit++ {
+		plane, err := BitPlane(img, bit, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPixelValue(t, plane, 0, 0, 255*uint8(bit/6))
+		checkPixelValue(t, plane, 1, 0, 255*uint8(bit/6))
+	}
+	plane, err := BitPlane(img, 7, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, plane, 0, 0, 0)
+	checkPixelValue(t, plane, 1, 0, 255)
+	if _, err := BitPlane(img, 8, false); err == nil {
+		t.Error("expected an error for bit 8")
+	}
+}
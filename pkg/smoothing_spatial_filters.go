@@ -158,3 +158,33 @@ func MedianOrder(levels [][]uint8) uint8 {
 
 	return uint8(values[medianIndex])
 }
+
+func smoothLevels(levels [][]uint8, mask [][]uint8) [][]uint8 {
+	// Weighted average over the mask, only neighbours inside the image are counted so the
+	// border is not darkened. Sums are done in int to avoid overflowing uint8 weights.
+	var result [][]uint8 = newLevels(len(levels), len(levels[0]))
+	var originX int = len(mask) / 2
+	var originY int = len(mask[0]) / 2
+
+	for x := range levels {
+		for y := range levels[x] {
+			var sum int = 0
+			var weight int = 0
+			for rowIndex, row := range mask {
+				for colIndex, cell := range row {
+					neighbourX := x + rowIndex - originX
+					neighbourY := y + colIndex - originY
+					if neighbourX < 0 || neighbourY < 0 || neighbourX >= len(levels) || neighbourY >= len(levels[x]) {
+						continue
+					}
+					sum += int(cell) * int(levels[neighbourX][neighbourY])
+					weight += int(cell)
+				}
+			}
+			if weight > 0 {
+				result[x][y] = uint8((sum + weight/2) / weight)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,282 @@
+// Template matching: sum of squared and absolute differences, cross-correlation and normalised cross-correlation
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// MatchingMethod selects how a template is compared with the image under it
+type MatchingMethod int
+
+const (
+	// SumOfSquaredDifferences is sum (f - w)^2, 0 for a perfect match
+	SumOfSquaredDifferences MatchingMethod = iota
+	// SumOfAbsoluteDifferences is sum |f - w|, 0 for a perfect match
+	SumOfAbsoluteDifferences
+	// CrossCorrelation is sum f w, which favours bright areas of the image
+	CrossCorrelation
+	// NormalisedCrossCorrelation is the zero-mean correlation coefficient in [-1, 1],
+	// 1 for a match up to brightness and contrast
+	NormalisedCrossCorrelation
+)
+
+// lowerIsBetter is true for the methods that measure a difference
+func (method MatchingMethod) lowerIsBetter() bool {
+	return method == SumOfSquaredDifferences || method == SumOfAbsoluteDifferences
+}
+
+// TemplateScores is the score of the template at every position where it fits
+// inside the image. Scores is indexed [x][y] by the position of the template's
+// top left corner and TemplateSize is the width and height of the template.
+type TemplateScores struct {
+	Scores       [][]float64
+	Method       MatchingMethod
+	TemplateSize image.Point
+}
+
+// TemplateMatch is one position of the template, Box is the area of the image it covers
+type TemplateMatch struct {
+	Location image.Point
+	Box      image.Rectangle
+	Score    float64
+}
+
+func correlateWithFFT(values [][]float64, template [][]float64) [][]float64 {
+	// c(x, y) = sum_s sum_t f(x + s, y + t) w(s, t) for every position where the template
+	// fits, as the product F(u, v) W*(u, v) in the frequency domain. Both are padded with
+	// zeros to a power of two at least the size of the image, so the circular correlation
+	// never wraps at the positions that are returned.
+	var width, height int = len(values), len(values[0])
+	var templateWidth, templateHeight int = len(template), len(template[0])
+	var paddedWidth, paddedHeight int = nextPowerOfTwo(width), nextPowerOfTwo(height)
+
+	var spectrum [][]complex128 = make([][]complex128, paddedWidth)
+	var templateSpectrum [][]complex128 = make([][]complex128, paddedWidth)
+	for x := 0; x < paddedWidth; x++ {
+		spectrum[x] = make([]complex128, paddedHeight)
+		templateSpectrum[x] = make([]complex128, paddedHeight)
+		for y := 0; y < paddedHeight; y++ {
+			if x < width && y < height {
+				spectrum[x][y] = complex(values[x][y], 0)
+			}
+			if x < templateWidth && y < templateHeight {
+				templateSpectrum[x][y] = complex(template[x][y], 0)
+			}
+		}
+	}
+	fourierTransform2D(spectrum, false)
+	fourierTransform2D(templateSpectrum, false)
+	for x := range spectrum {
+		for y := range spectrum[x] {
+			spectrum[x][y] *= complexConjugate(templateSpectrum[x][y])
+		}
+	}
+	fourierTransform2D(spectrum, true)
+
+	var correlation [][]float64 = newFloats(width-templateWidth+1, height-templateHeight+1)
+	for x := range correlation {
+		for y := range correlation[x] {
+			correlation[x][y] = real(spectrum[x][y])
+		}
+	}
+	return correlation
+}
+
+func sumOfAbsoluteDifferences(values [][]float64, template [][]float64) [][]float64 {
+	// The absolute value has no frequency domain shortcut, so this one is direct
+	var templateWidth, templateHeight int = len(template), len(template[0])
+	var scores [][]float64 = newFloats(len(values)-templateWidth+1, len(values[0])-templateHeight+1)
+	for x := range scores {
+		for y := range scores[x] {
+			var sum float64 = 0
+			for s := 0; s < templateWidth; s++ {
+				for t := 0; t < templateHeight; t++ {
+					sum += math.Abs(values[x+s][y+t] - template[s][t])
+				}
+			}
+			scores[x][y] = sum
+		}
+	}
+	return scores
+}
+
+func MatchTemplate(img image.Image, template image.Image, method MatchingMethod) (TemplateScores, error) {
+	// This is from Section 12.2.1 of DIP book
+	// The correlation part of every method is done with the FFT, and the sums of f and f^2
+	// under the template, which SSD and the normalised correlation also need, come from
+	// integral images. The cost then hardly depends on the size of the template, except
+	// for SAD which is computed directly.
+	var values [][]float64 = levelsToFloats(imageToLevels(img))
+	var weights [][]float64 = levelsToFloats(imageToLevels(template))
+	if len(values) == 0 || len(values[0]) == 0 || len(weights) == 0 || len(weights[0]) == 0 {
+		return TemplateScores{}, fmt.Errorf("empty image or template")
+	}
+	var templateWidth, templateHeight int = len(weights), len(weights[0])
+	if templateWidth > len(values) || templateHeight > len(values[0]) {
+		return TemplateScores{}, fmt.Errorf("template is %dx%d but the image is only %dx%d", templateWidth, templateHeight, len(values), len(values[0]))
+	}
+	var scores TemplateScores = TemplateScores{Method: method, TemplateSize: image.Point{templateWidth, templateHeight}}
+
+	var count float64 = float64(templateWidth * templateHeight)
+	var templateSum, templateSquares float64
+	for s := range weights {
+		for _, weight := range weights[s] {
+			templateSum += weight
+			templateSquares += weight * weight
+		}
+	}
+
+	switch method {
+	case SumOfAbsoluteDifferences:
+		scores.Scores = sumOfAbsoluteDifferences(values, weights)
+	case CrossCorrelation:
+		scores.Scores = correlateWithFFT(values, weights)
+	case SumOfSquaredDifferences:
+		// sum (f - w)^2 = sum f^2 - 2 sum f w + sum w^2
+		integral := newIntegralImage(values)
+		scores.Scores = correlateWithFFT(values, weights)
+		for x := range scores.Scores {
+			for y := range scores.Scores[x] {
+				squares := integral.windowSum(integral.squares, x, y, x+templateWidth, y+templateHeight)
+				scores.Scores[x][y] = math.Max(squares-2*scores.Scores[x][y]+templateSquares, 0)
+			}
+		}
+	case NormalisedCrossCorrelation:
+		// With w' = w - mean(w), sum (f - mean(f)) w' = sum f w', so correlating with the
+		// zero-mean template gives the numerator directly
+		var centred [][]float64 = newFloats(templateWidth, templateHeight)
+		for s := range weights {
+			for t, weight := range weights[s] {
+				centred[s][t] = weight - templateSum/count
+			}
+		}
+		var templateVariance float64 = templateSquares - templateSum*templateSum/count
+		integral := newIntegralImage(values)
+		scores.Scores = correlateWithFFT(values, centred)
+		for x := range scores.Scores {
+			for y := range scores.Scores[x] {
+				sum := integral.windowSum(integral.sums, x, y, x+templateWidth, y+templateHeight)
+				squares := integral.windowSum(integral.squares, x, y, x+templateWidth, y+templateHeight)
+				variance := squares - sum*sum/count
+				// A flat template or a flat patch of image does not correlate with anything
+				if variance <= 1e-9*count || templateVariance <= 1e-9*count {
+					scores.Scores[x][y] = 0
+					continue
+				}
+				coefficient := scores.Scores[x][y] / math.Sqrt(variance*templateVariance)
+				scores.Scores[x][y] = math.Max(-1, math.Min(1, coefficient))
+			}
+		}
+	default:
+		return TemplateScores{}, fmt.Errorf("unknown matching method %d", method)
+	}
+	return scores, nil
+}
+
+func overlapRatio(first image.Rectangle, second image.Rectangle) float64 {
+	// Intersection over union of two boxes
+	intersection := first.Intersect(second)
+	if intersection.Empty() {
+		return 0
+	}
+	var shared float64 = float64(intersection.Dx() * intersection.Dy())
+	return shared / (float64(first.Dx()*first.Dy()+second.Dx()*second.Dy()) - shared)
+}
+
+func TemplateMatchPeaks(scores TemplateScores, count int, threshold float64, maximumOverlap float64) ([]TemplateMatch, error) {
+	// Returns up to count matches, best first. Candidates are the local optima of the
+	// score map that reach threshold, a lowest score for the correlations and a highest
+	// one for the differences. Non-maximum suppression then drops every candidate whose
+	// box overlaps a better match's box by more than maximumOverlap, as intersection over
+	// union, so 0 allows no overlap at all.
+	if len(scores.Scores) == 0 || len(scores.Scores[0]) == 0 {
+		return nil, fmt.Errorf("empty score map")
+	}
+	if count < 1 || maximumOverlap < 0 || maximumOverlap > 1 {
+		return nil, fmt.Errorf("invalid match count %d or overlap %v", count, maximumOverlap)
+	}
+	var sign float64 = 1
+	if scores.Method.lowerIsBetter() {
+		sign = -1
+	}
+	var width, height int = len(scores.Scores), len(scores.Scores[0])
+
+	var candidates []TemplateMatch
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			score := scores.Scores[x][y]
+			if sign*score < sign*threshold {
+				continue
+			}
+			var optimum bool = true
+			for _, offset := range eightNeighbours {
+				neighbourX, neighbourY := x+offset.X, y+offset.Y
+				if neighbourX >= 0 && neighbourY >= 0 && neighbourX < width && neighbourY < height && sign*scores.Scores[neighbourX][neighbourY] > sign*score {
+					optimum = false
+					break
+				}
+			}
+			if optimum {
+				location := image.Point{x, y}
+				candidates = append(candidates, TemplateMatch{
+					Location: location,
+					Box:      image.Rectangle{location, location.Add(scores.TemplateSize)},
+					Score:    score,
+				})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return sign*candidates[i].Score > sign*candidates[j].Score })
+
+	var matches []TemplateMatch
+	for _, candidate := range candidates {
+		var kept bool = true
+		for _, match := range matches {
+			if overlapRatio(candidate.Box, match.Box) > maximumOverlap {
+				kept = false
+				break
+			}
+		}
+		if kept {
+			matches = append(matches, candidate)
+			if len(matches) == count {
+				break
+			}
+		}
+	}
+	return matches, nil
+}
+
+func TemplateScoreImage(scores TemplateScores) (image.Image, error) {
+	// Scales the scores to 0..255 for display with the best matches bright
+	if len(scores.Scores) == 0 || len(scores.Scores[0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty score map")
+	}
+	if !scores.Method.lowerIsBetter() {
+		return FloatsToImage(scores.Scores)
+	}
+	var inverted [][]float64 = newFloats(len(scores.Scores), len(scores.Scores[0]))
+	for x := range scores.Scores {
+		for y, score := range scores.Scores[x] {
+			inverted[x][y] = -score
+		}
+	}
+	return FloatsToImage(inverted)
+}
+
+func DrawTemplateMatches(img image.Image, matches []TemplateMatch, colour color.Color) (image.Image, error) {
+	// Outlines the bounding box of every match
+	canvas := imageToRGBA(img)
+	for _, match := range matches {
+		box := match.Box
+		corners := []image.Point{box.Min, {box.Max.X - 1, box.Min.Y}, box.Max.Sub(image.Point{1, 1}), {box.Min.X, box.Max.Y - 1}}
+		for index, corner := range corners {
+			drawLine(canvas, corner, corners[(index+1)%len(corners)], colour)
+		}
+	}
+	return canvas, nil
+}
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func createTemplateTestImages() (*image.Gray, *image.Gray) {
+	// A textured background with the template pasted at (12, 7) and a darker,
+	// lower contrast copy of it at (25, 18)
+	img := image.NewGray(image.Rect(0, 0, 40, 30))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 30; y++ {
+			img.SetGray(x, y, color.Gray{uint8((x*37 + y*91 + x*y*13) % 97)})
+		}
+	}
+	template := image.NewGray(image.Rect(0, 0, 8, 6))
+	for s := 0; s < 8; s++ {
+		for t := 0; t < 6; t++ {
+			level := uint8(100 + (s*s*7+t*29)%150)
+			template.SetGray(s, t, color.Gray{level})
+			img.SetGray(12+s, 7+t, color.Gray{level})
+			img.SetGray(25+s, 18+t, color.Gray{level/2 + 10})
+		}
+	}
+	return img, template
+}
+
+func TestMatchTemplate(t *testing.T) {
+	img, template := createTemplateTestImages()
+
+	for _, method := range []MatchingMethod{SumOfSquaredDifferences, SumOfAbsoluteDifferences, CrossCorrelation, NormalisedCrossCorrelation} {
+		scores, err := MatchTemplate(img, template, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(scores.Scores) != 33 || len(scores.Scores[0]) != 25 {
+			t.Fatalf("method %d: score map is %dx%d, want 33x25", method, len(scores.Scores), len(scores.Scores[0]))
+		}
+		// Keep every score, the lowest for the correlations and the highest for the differences
+		threshold := math.Inf(-1)
+		if method.lowerIsBetter() {
+			threshold = math.Inf(1)
+		}
+		matches, err := TemplateMatchPeaks(scores, 1, threshold, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Plain cross-correlation prefers the brightest area, which is the exact copy here
+		if len(matches) != 1 || matches[0].Location != (image.Point{12, 7}) {
+			t.Errorf("method %d: best match = %v, want (12, 7)", method, matches)
+		}
+	}
+
+	// The FFT correlation agrees with the direct sum
+	scores, err := MatchTemplate(img, template, CrossCorrelation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, position := range []image.Point{{0, 0}, {5, 20}, {32, 24}} {
+		var direct float64 = 0
+		for s := 0; s < 8; s++ {
+			for u := 0; u < 6; u++ {
+				direct += float64(img.GrayAt(position.X+s, position.Y+u).Y) * float64(template.GrayAt(s, u).Y)
+			}
+		}
+		if math.Abs(scores.Scores[position.X][position.Y]-direct) > 1e-6 {
+			t.Errorf("correlation at %v = %v, want %v", position, scores.Scores[position.X][position.Y], direct)
+		}
+	}
+
+	if _, err := MatchTemplate(template, img, NormalisedCrossCorrelation); err == nil {
+		t.Error("expected an error for a template larger than the image")
+	}
+}
+
+func TestTemplateMatchPeaks(t *testing.T) {
+	img, template := createTemplateTestImages()
+
+	scores, err := MatchTemplate(img, template, NormalisedCrossCorrelation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := TemplateMatchPeaks(scores, 5, 0.95, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The normalised correlation also finds the copy with different brightness and contrast
+	if len(matches) != 2 || matches[0].Location != (image.Point{12, 7}) || matches[1].Location != (image.Point{25, 18}) {
+		t.Fatalf("matches = %v, want (12, 7) and (25, 18)", matches)
+	}
+	if math.Abs(matches[0].Score-1) > 1e-9 || matches[1].Score < 0.99 {
+		t.Errorf("scores = %v and %v, want close to 1", matches[0].Score, matches[1].Score)
+	}
+	if matches[1].Box != image.Rect(25, 18, 33, 24) {
+		t.Errorf("box = %v, want (25,18)-(33,24)", matches[1].Box)
+	}
+
+	// With overlap allowed, neighbouring optima may come back, without it none overlap
+	matches, err = TemplateMatchPeaks(scores, 20, -1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range matches {
+		for j := i + 1; j < len(matches); j++ {
+			if overlapRatio(matches[i].Box, matches[j].Box) > 0 {
+				t.Errorf("matches %v and %v overlap", matches[i].Box, matches[j].Box)
+			}
+		}
+	}
+
+	if _, err := TemplateMatchPeaks(scores, 0, 0.5, 0); err == nil {
+		t.Error("expected an error for a zero match count")
+	}
+	if overlapRatio(image.Rect(0, 0, 2, 2), image.Rect(1, 0, 3, 2)) != 1.0/3 {
+		t.Errorf("overlap = %v, want 1/3", overlapRatio(image.Rect(0, 0, 2, 2), image.Rect(1, 0, 3, 2)))
+	}
+}
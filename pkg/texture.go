@@ -0,0 +1,336 @@
+// Texture descriptors: statistical moments of the histogram and grey-level co-occurrence matrices
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// TextureMoments are the histogram based texture measures of Table 11.2 of the DIP book.
+// Smoothness is R = 1 - 1 / (1 + variance), 0 for a constant region, and Skewness is
+// the third moment. Both use levels scaled to [0, 1] so that they stay comparable in
+// size with the other measures. Entropy is in bits.
+type TextureMoments struct {
+	Mean              float64 `json:"mean"`
+	StandardDeviation float64 `json:"standard_deviation"`
+	Variance          float64 `json:"variance"`
+	Smoothness        float64 `json:"smoothness"`
+	Skewness          float64 `json:"skewness"`
+	Uniformity        float64 `json:"uniformity"`
+	Entropy           float64 `json:"entropy"`
+}
+
+// CoOccurrenceOptions configures the grey-level co-occurrence matrices. Every offset
+// gives one matrix counting the pairs of levels at p and p + offset. Levels is the
+// number of grey levels the image is quantised to, and Symmetric also counts every
+// pair the other way round, so that opposite offsets give the same matrix.
+type CoOccurrenceOptions struct {
+	Offsets   []image.Point
+	Levels    int
+	Symmetric bool
+}
+
+// HaralickFeatures are the descriptors of a normalised co-occurrence matrix, Table 11.3
+// of the DIP book. Energy is also called uniformity and the angular second moment.
+type HaralickFeatures struct {
+	MaximumProbability float64 `json:"maximum_probability"`
+	Contrast           float64 `json:"contrast"`
+	Correlation        float64 `json:"correlation"`
+	Homogeneity        float64 `json:"homogeneity"`
+	Energy             float64 `json:"energy"`
+	Entropy            float64 `json:"entropy"`
+}
+
+// TextureDescription collects the texture of a whole image or of one labelled region,
+// Label is 0 for the whole image. Haralick holds the features of each offset in the
+// order of the options and Average their mean, which depends less on direction.
+type TextureDescription struct {
+	Label    int                `json:"label"`
+	Moments  TextureMoments     `json:"moments"`
+	Haralick []HaralickFeatures `json:"haralick"`
+	Average  HaralickFeatures   `json:"average"`
+}
+
+func CoOccurrenceOffsets(distance int, angles []float64) ([]image.Point, error) {
+	// Offsets at distance pixels in the directions of angles, in degrees counterclockwise
+	// from the x axis. With y pointing down 90 degrees is (0, -distance). The angles must
+	// be multiples of 45 degrees so the offsets land on pixels.
+	if distance < 1 {
+		return nil, fmt.Errorf("distance must be at least 1, got %d", distance)
+	}
+	var offsets []image.Point
+	for _, angle := range angles {
+		if math.Mod(angle, 45) != 0 {
+			return nil, fmt.Errorf("angle must be a multiple of 45 degrees, got %v", angle)
+		}
+		radians := angle * math.Pi / 180
+		offsets = append(offsets, image.Point{
+			int(math.Round(math.Cos(radians))) * distance,
+			-int(math.Round(math.Sin(radians))) * distance,
+		})
+	}
+	return offsets, nil
+}
+
+func textureMoments(histogram []int) TextureMoments {
+	// This is from Section 11.3.3 of DIP book
+	// The moments of the normalised histogram p(z) about the mean m,
+	// mu_n = sum (z - m)^n p(z)
+	var moments TextureMoments
+	var total int = 0
+	for _, count := range histogram {
+		total += count
+	}
+	if total == 0 {
+		return moments
+	}
+	var probabilities []float64 = make([]float64, len(histogram))
+	for level, count := range histogram {
+		probabilities[level] = float64(count) / float64(total)
+		moments.Mean += float64(level) * probabilities[level]
+	}
+
+	var scale float64 = float64(len(histogram)-1) * float64(len(histogram)-1)
+	var third float64 = 0
+	for level, probability := range probabilities {
+		if probability == 0 {
+			continue
+		}
+		difference := float64(level) - moments.Mean
+		moments.Variance += difference * difference * probability
+		third += difference * difference * difference * probability
+		moments.Uniformity += probability * probability
+		moments.Entropy -= probability * math.Log2(probability)
+	}
+	moments.StandardDeviation = math.Sqrt(moments.Variance)
+	moments.Smoothness = 1 - 1/(1+moments.Variance/scale)
+	moments.Skewness = third / scale
+	return moments
+}
+
+func HistogramTextureMoments(img image.Image) (TextureMoments, error) {
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return TextureMoments{}, fmt.Errorf("empty image")
+	}
+	var histogram []int = make([]int, MaxGrayscaleLevels)
+	for x := range levels {
+		for _, level := range levels[x] {
+			histogram[level]++
+		}
+	}
+	return textureMoments(histogram), nil
+}
+
+func (options CoOccurrenceOptions) validate() error {
+	if len(options.Offsets) == 0 {
+		return fmt.Errorf("no co-occurrence offsets")
+	}
+	if options.Levels < 2 || options.Levels > MaxGrayscaleLevels {
+		return fmt.Errorf("co-occurrence levels must be between 2 and %d, got %d", MaxGrayscaleLevels, options.Levels)
+	}
+	for _, offset := range options.Offsets {
+		if offset == (image.Point{}) {
+			return fmt.Errorf("co-occurrence offset must not be zero")
+		}
+	}
+	return nil
+}
+
+func quantiseLevels(levels [][]uint8, count int) [][]uint8 {
+	// Maps 0..255 onto count equally wide bins
+	var quantised [][]uint8 = newLevels(len(levels), len(levels[0]))
+	for x := range levels {
+		for y, level := range levels[x] {
+			quantised[x][y] = uint8(int(level) * count / MaxGrayscaleLevels)
+		}
+	}
+	return quantised
+}
+
+func coOccurrenceCounts(quantised [][]uint8, labels [][]int, label int, box image.Rectangle, offset image.Point, count int, symmetric bool) [][]float64 {
+	// Pairs are only counted when both pixels are inside the image and carry label,
+	// box bounds the pixels that do
+	var counts [][]float64 = newFloats(count, count)
+	var width int = len(quantised)
+	var height int = len(quantised[0])
+	for x := box.Min.X; x < box.Max.X; x++ {
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			otherX, otherY := x+offset.X, y+offset.Y
+			if otherX < 0 || otherY < 0 || otherX >= width || otherY >= height {
+				continue
+			}
+			if labels[x][y] != label || labels[otherX][otherY] != label {
+				continue
+			}
+			first, second := quantised[x][y], quantised[otherX][otherY]
+			counts[first][second]++
+			if symmetric {
+				counts[second][first]++
+			}
+		}
+	}
+	return counts
+}
+
+func normaliseCounts(counts [][]float64) [][]float64 {
+	var total float64 = 0
+	for row := range counts {
+		for _, value := range counts[row] {
+			total += value
+		}
+	}
+	if total == 0 {
+		return counts
+	}
+	for row := range counts {
+		for column := range counts[row] {
+			counts[row][column] /= total
+		}
+	}
+	return counts
+}
+
+func CoOccurrenceMatrix(img image.Image, offset image.Point, levels int, symmetric bool) ([][]float64, error) {
+	// This is from Section 11.3.3 of DIP book
+	// Element (i, j) is the probability that a pixel with level i has a pixel with level
+	// j at the offset from it, after quantising the image to levels grey levels.
+	var options CoOccurrenceOptions = CoOccurrenceOptions{Offsets: []image.Point{offset}, Levels: levels, Symmetric: symmetric}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	var pixels [][]uint8 = imageToLevels(img)
+	if len(pixels) == 0 || len(pixels[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	var everywhere [][]int = newLabels(len(pixels), len(pixels[0]))
+	var box image.Rectangle = image.Rect(0, 0, len(pixels), len(pixels[0]))
+	return normaliseCounts(coOccurrenceCounts(quantiseLevels(pixels, levels), everywhere, 0, box, offset, levels, symmetric)), nil
+}
+
+func ComputeHaralickFeatures(matrix [][]float64) (HaralickFeatures, error) {
+	// The features of a normalised co-occurrence matrix p(i, j) with row and column
+	// means m_r, m_c and standard deviations s_r, s_c
+	var features HaralickFeatures
+	if len(matrix) == 0 {
+		return features, fmt.Errorf("empty co-occurrence matrix")
+	}
+	for _, row := range matrix {
+		if len(row) != len(matrix) {
+			return features, fmt.Errorf("co-occurrence matrix must be square")
+		}
+	}
+
+	var meanRow, meanColumn float64
+	for i := range matrix {
+		for j, probability := range matrix[i] {
+			meanRow += float64(i) * probability
+			meanColumn += float64(j) * probability
+		}
+	}
+	var varianceRow, varianceColumn, covariance float64
+	for i := range matrix {
+		for j, probability := range matrix[i] {
+			if probability == 0 {
+				continue
+			}
+			difference := float64(i - j)
+			features.MaximumProbability = math.Max(features.MaximumProbability, probability)
+			features.Contrast += difference * difference * probability
+			features.Homogeneity += probability / (1 + math.Abs(difference))
+			features.Energy += probability * probability
+			features.Entropy -= probability * math.Log2(probability)
+			varianceRow += (float64(i) - meanRow) * (float64(i) - meanRow) * probability
+			varianceColumn += (float64(j) - meanColumn) * (float64(j) - meanColumn) * probability
+			covariance += (float64(i) - meanRow) * (float64(j) - meanColumn) * probability
+		}
+	}
+	if varianceRow > 0 && varianceColumn > 0 {
+		features.Correlation = covariance / math.Sqrt(varianceRow*varianceColumn)
+	} else {
+		// Correlation is undefined for a constant texture, which is taken as perfectly correlated
+		features.Correlation = 1
+	}
+	return features, nil
+}
+
+func describeTexture(levels [][]uint8, quantised [][]uint8, labels [][]int, label int, box image.Rectangle, options CoOccurrenceOptions) TextureDescription {
+	var description TextureDescription = TextureDescription{Label: label}
+	var histogram []int = make([]int, MaxGrayscaleLevels)
+	for x := box.Min.X; x < box.Max.X; x++ {
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			if labels[x][y] == label {
+				histogram[levels[x][y]]++
+			}
+		}
+	}
+	description.Moments = textureMoments(histogram)
+
+	for _, offset := range options.Offsets {
+		matrix := normaliseCounts(coOccurrenceCounts(quantised, labels, label, box, offset, options.Levels, options.Symmetric))
+		// The matrix is square and not empty, so there is no error
+		features, _ := ComputeHaralickFeatures(matrix)
+		description.Haralick = append(description.Haralick, features)
+
+		var share float64 = 1 / float64(len(options.Offsets))
+		description.Average.MaximumProbability += features.MaximumProbability * share
+		description.Average.Contrast += features.Contrast * share
+		description.Average.Correlation += features.Correlation * share
+		description.Average.Homogeneity += features.Homogeneity * share
+		description.Average.Energy += features.Energy * share
+		description.Average.Entropy += features.Entropy * share
+	}
+	return description
+}
+
+func ImageTexture(img image.Image, options CoOccurrenceOptions) (TextureDescription, error) {
+	// The texture of the whole image
+	if err := options.validate(); err != nil {
+		return TextureDescription{}, err
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return TextureDescription{}, fmt.Errorf("empty image")
+	}
+	var everywhere [][]int = newLabels(len(levels), len(levels[0]))
+	var box image.Rectangle = image.Rect(0, 0, len(levels), len(levels[0]))
+	return describeTexture(levels, quantiseLevels(levels, options.Levels), everywhere, 0, box, options), nil
+}
+
+func RegionTextures(img image.Image, labels [][]int, options CoOccurrenceOptions) ([]TextureDescription, error) {
+	// The texture of every positive label, indexed by label - 1. Co-occurring pairs must
+	// both lie in the region, so the background next to a region does not leak into it.
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	if len(labels) == 0 || len(labels[0]) == 0 {
+		return nil, fmt.Errorf("empty label image")
+	}
+	if len(levels) != len(labels) || len(levels[0]) != len(labels[0]) {
+		return nil, fmt.Errorf("labels are %dx%d but the image is %dx%d", len(labels), len(labels[0]), len(levels), len(levels[0]))
+	}
+
+	var boxes []image.Rectangle
+	for x := range labels {
+		for y, label := range labels[x] {
+			if label <= 0 {
+				continue
+			}
+			for len(boxes) < label {
+				boxes = append(boxes, image.Rectangle{})
+			}
+			boxes[label-1] = boxes[label-1].Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	var quantised [][]uint8 = quantiseLevels(levels, options.Levels)
+	var descriptions []TextureDescription
+	for index, box := range boxes {
+		descriptions = append(descriptions, describeTexture(levels, quantised, labels, index+1, box, options))
+	}
+	return descriptions, nil
+}
@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"image"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func createStripeTestImage(width int, height int, stripeWidth int) image.Image {
+	// Vertical stripes of 0 and 255, stripeWidth columns wide
+	var values []uint8
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (x/stripeWidth)%2 == 0 {
+				values = append(values, 0)
+			} else {
+				values = append(values, 255)
+			}
+		}
+	}
+	return createTestImage(width, height, values)
+}
+
+func TestHistogramTextureMoments(t *testing.T) {
+	constant, err := HistogramTextureMoments(createTestImage(4, 4, []uint8{90, 90, 90, 90, 90, 90, 90, 90, 90, 90, 90, 90, 90, 90, 90, 90}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if constant.Mean != 90 || constant.Variance != 0 || constant.Smoothness != 0 || constant.Uniformity != 1 || constant.Entropy != 0 {
+		t.Errorf("constant image moments = %+v", constant)
+	}
+
+	stripes, err := HistogramTextureMoments(createStripeTestImage(8, 4, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stripes.Mean != 127.5 || stripes.StandardDeviation != 127.5 || stripes.Skewness != 0 {
+		t.Errorf("stripe moments = %+v, want mean and deviation 127.5 and no skew", stripes)
+	}
+	if stripes.Uniformity != 0.5 || stripes.Entropy != 1 || math.Abs(stripes.Smoothness-0.2) > 1e-12 {
+		t.Errorf("stripe moments = %+v, want uniformity 0.5, entropy 1 and smoothness 0.2", stripes)
+	}
+}
+
+func TestCoOccurrenceOffsets(t *testing.T) {
+	offsets, err := CoOccurrenceOffsets(2, []float64{0, 45, 90, 135})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []image.Point{{2, 0}, {2, -2}, {0, -2}, {-2, -2}}
+	if !reflect.DeepEqual(offsets, want) {
+		t.Errorf("offsets = %v, want %v", offsets, want)
+	}
+	if _, err := CoOccurrenceOffsets(1, []float64{30}); err == nil {
+		t.Error("expected an error for an angle off the pixel grid")
+	}
+	if _, err := CoOccurrenceOffsets(0, []float64{0}); err == nil {
+		t.Error("expected an error for a zero distance")
+	}
+}
+
+func TestCoOccurrenceMatrixAndHaralickFeatures(t *testing.T) {
+	img := createStripeTestImage(8, 8, 1)
+
+	// Across the stripes every pair changes level
+	across, err := CoOccurrenceMatrix(img, image.Point{1, 0}, 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(across, [][]float64{{0, 0.5}, {0.5, 0}}) {
+		t.Errorf("matrix across the stripes = %v", across)
+	}
+	features, err := ComputeHaralickFeatures(across)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if features.Contrast != 1 || features.Correlation != -1 || features.Homogeneity != 0.5 || features.Energy != 0.5 || features.Entropy != 1 {
+		t.Errorf("features across the stripes = %+v", features)
+	}
+
+	// Along the stripes no pair changes level
+	along, err := CoOccurrenceMatrix(img, image.Point{0, 1}, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	features, err = ComputeHaralickFeatures(along)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if features.Contrast != 0 || features.Correlation != 1 || features.Homogeneity != 1 || features.MaximumProbability != 0.5 {
+		t.Errorf("features along the stripes = %+v", features)
+	}
+
+	if _, err := CoOccurrenceMatrix(img, image.Point{}, 2, false); err == nil {
+		t.Error("expected an error for a zero offset")
+	}
+	if _, err := CoOccurrenceMatrix(img, image.Point{1, 0}, 1, false); err == nil {
+		t.Error("expected an error for a single level")
+	}
+	if _, err := ComputeHaralickFeatures([][]float64{{1, 0}}); err == nil {
+		t.Error("expected an error for a matrix that is not square")
+	}
+}
+
+func TestRegionTextures(t *testing.T) {
+	// Stripes on the left, a constant level on the right
+	var values []uint8
+	labels := newLabels(8, 4)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			if x < 4 {
+				values = append(values, uint8(255*(x%2)))
+				labels[x][y] = 1
+			} else {
+				values = append(values, 200)
+				labels[x][y] = 2
+			}
+		}
+	}
+	img := createTestImage(8, 4, values)
+	options := CoOccurrenceOptions{Offsets: []image.Point{{1, 0}, {0, 1}}, Levels: 8, Symmetric: true}
+
+	descriptions, err := RegionTextures(img, labels, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descriptions) != 2 {
+		t.Fatalf("got %d regions, want 2", len(descriptions))
+	}
+	stripes, plain := descriptions[0], descriptions[1]
+	if stripes.Label != 1 || stripes.Haralick[0].Contrast != 49 || stripes.Haralick[1].Contrast != 0 || stripes.Average.Contrast != 24.5 {
+		t.Errorf("striped region = %+v", stripes)
+	}
+	// Pairs that cross into the striped region are not counted
+	if plain.Label != 2 || plain.Average.Contrast != 0 || plain.Average.Energy != 1 || plain.Moments.Variance != 0 {
+		t.Errorf("plain region = %+v", plain)
+	}
+
+	whole, err := ImageTexture(img, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each row has three striped pairs, the pair across the border from level 7 to 6 and three plain pairs
+	if whole.Label != 0 || math.Abs(whole.Haralick[0].Contrast-(3*49+1)/7.0) > 1e-12 {
+		t.Errorf("whole image = %+v", whole)
+	}
+
+	if _, err := RegionTextures(img, newLabels(3, 3), options); err == nil {
+		t.Error("expected an error for labels of the wrong size")
+	}
+	if _, err := RegionTextures(image.NewGray(image.Rectangle{}), newLabels(3, 3), options); err == nil {
+		t.Error("expected an error for an empty image")
+	}
+}
@@ -0,0 +1,371 @@
+// Global thresholding: basic iterative, Otsu and multi-level Otsu
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// ThresholdOptions control how the histogram used for thresholding is computed
+type ThresholdOptions struct {
+	// Smooth the image with GaussianFiveByFiveSigmaOne and segment the smoothed image, Section 10.3.4
+	Smooth bool
+	// When above zero only pixels whose absolute Laplacian is at or above this
+	// percentile (0 to 100) contribute to the histogram, Section 10.3.5
+	EdgePercentile float64
+}
+
+func thresholdHistogram(img image.Image, options ThresholdOptions) ([]int, image.Image, error) {
+	// Returns the histogram and the image the threshold is to be applied to, which is
+	// the smoothed image when smoothing, as Section 10.3.4 segments that rather than the original
+	if options.EdgePercentile < 0 || options.EdgePercentile >= 100 {
+		return nil, nil, fmt.Errorf("edge percentile must be between 0 and 100, got %v", options.EdgePercentile)
+	}
+	if !options.Smooth && options.EdgePercentile == 0 {
+		return HistogramGrayscale(img, 0), img, nil
+	}
+
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return nil, nil, fmt.Errorf("empty image")
+	}
+	var segmented image.Image = img
+	if options.Smooth {
+		levels = smoothLevels(levels, GaussianFiveByFiveSigmaOne())
+		smoothed, err := levelsToImage(levels)
+		if err != nil {
+			return nil, nil, err
+		}
+		segmented = smoothed
+	}
+
+	var histogram []int = make([]int, MaxGrayscaleLevels)
+	if options.EdgePercentile == 0 {
+		for x := range levels {
+			for y := range levels[x] {
+				histogram[levels[x][y]]++
+			}
+		}
+		return histogram, segmented, nil
+	}
+
+	// Edge strength from the absolute Laplacian, pixels near edges sit on both sides of
+	// the boundary so their histogram has far more balanced modes
+	var mask [][]int = LaplacianMask2()
+	var strengths [][]int = make([][]int, len(levels))
+	var sorted []int
+	for x := range levels {
+		strengths[x] = make([]int, len(levels[x]))
+		for y := range levels[x] {
+			var response int = 0
+			for rowIndex, row := range mask {
+				for colIndex, cell := range row {
+					neighbourX := x + rowIndex - 1
+					neighbourY := y + colIndex - 1
+					if neighbourX < 0 || neighbourY < 0 || neighbourX >= len(levels) || neighbourY >= len(levels[x]) {
+						neighbourX = x
+						neighbourY = y
+					}
+					response += cell * int(levels[neighbourX][neighbourY])
+				}
+			}
+			if response < 0 {
+				response = -response
+			}
+			strengths[x][y] = response
+			sorted = append(sorted, response)
+		}
+	}
+	sort.Ints(sorted)
+	var cutoff int = sorted[int(options.EdgePercentile/100.0*float64(len(sorted)-1))]
+
+	for x := range levels {
+		for y := range levels[x] {
+			if strengths[x][y] >= cutoff && strengths[x][y] > 0 {
+				histogram[levels[x][y]]++
+			}
+		}
+	}
+	return histogram, segmented, nil
+}
+
+func ThresholdImage(img image.Image, threshold uint8) (image.Image, error) {
+	// g(x, y) = 1 if f(x, y) > T, 0 otherwise
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+
+	for x := range levels {
+		for y := range levels[x] {
+			if levels[x][y] > threshold {
+				levels[x][y] = uint8(MaxGrayscaleLevels - 1)
+			} else {
+				levels[x][y] = 0
+			}
+		}
+	}
+
+	newImage, err := levelsToImage(levels)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func MultiThresholdImage(img image.Image, thresholds []uint8) (image.Image, error) {
+	// Class k holds levels in (T_k-1, T_k], classes are spread evenly over the grayscale range
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty image")
+	}
+	if len(thresholds) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("no thresholds given")
+	}
+
+	var step int = (MaxGrayscaleLevels - 1) / len(thresholds)
+	for x := range levels {
+		for y := range levels[x] {
+			var class int = 0
+			for class < len(thresholds) && levels[x][y] > thresholds[class] {
+				class++
+			}
+			levels[x][y] = uint8(class * step)
+		}
+	}
+
+	newImage, err := levelsToImage(levels)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func BasicGlobalThreshold(img image.Image, deltaT float64, options ThresholdOptions) (uint8, image.Image, error) {
+	// This is from Section 10.3.2 of DIP book
+	// 1. Start with T as the mean intensity
+	// 2. Split the pixels into G1 (> T) and G2 (<= T) and compute their means m1 and m2
+	// 3. T = (m1 + m2) / 2, repeat until T changes by less than deltaT
+	if deltaT <= 0 {
+		return 0, image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("delta T must be greater than 0, got %v", deltaT)
+	}
+	histogram, segmented, err := thresholdHistogram(img, options)
+	if err != nil {
+		return 0, image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	var total, weighted float64
+	for level, count := range histogram {
+		total += float64(count)
+		weighted += float64(level * count)
+	}
+	if total == 0 {
+		return 0, image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("histogram is empty")
+	}
+
+	var threshold float64 = weighted / total
+	for {
+		var count1, sum1, count2, sum2 float64
+		for level, count := range histogram {
+			if float64(level) > threshold {
+				count1 += float64(count)
+				sum1 += float64(level * count)
+			} else {
+				count2 += float64(count)
+				sum2 += float64(level * count)
+			}
+		}
+		var mean1, mean2 float64 = threshold, threshold
+		if count1 > 0 {
+			mean1 = sum1 / count1
+		}
+		if count2 > 0 {
+			mean2 = sum2 / count2
+		}
+
+		next := (mean1 + mean2) / 2
+		if math.Abs(next-threshold) < deltaT {
+			threshold = next
+			break
+		}
+		threshold = next
+	}
+
+	var level uint8 = uint8(threshold)
+	newImage, err := ThresholdImage(segmented, level)
+	if err != nil {
+		return 0, image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return level, newImage, nil
+}
+
+func otsuFromHistogram(histogram []int) (uint8, float64, error) {
+	// This is from Section 10.3.3 of DIP book
+	var total float64 = 0
+	for _, count := range histogram {
+		total += float64(count)
+	}
+	if total == 0 {
+		return 0, 0, fmt.Errorf("histogram is empty")
+	}
+
+	var probabilities []float64 = make([]float64, len(histogram))
+	var globalMean float64 = 0
+	for level, count := range histogram {
+		probabilities[level] = float64(count) / total
+		globalMean += float64(level) * probabilities[level]
+	}
+	var globalVariance float64 = 0
+	for level, probability := range probabilities {
+		globalVariance += math.Pow(float64(level)-globalMean, 2) * probability
+	}
+
+	// sigma_B^2(k) = [m_G P1(k) - m(k)]^2 / [P1(k)(1 - P1(k))]
+	var cumulativeProbability, cumulativeMean float64
+	var bestVariance float64 = -1
+	var bestSum, bestCount int
+	for k := 0; k < len(probabilities); k++ {
+		cumulativeProbability += probabilities[k]
+		cumulativeMean += float64(k) * probabilities[k]
+		if cumulativeProbability <= 0 || cumulativeProbability >= 1 {
+			continue
+		}
+		variance := math.Pow(globalMean*cumulativeProbability-cumulativeMean, 2) / (cumulativeProbability * (1 - cumulativeProbability))
+		if variance > bestVariance+1e-9 {
+			bestVariance = variance
+			bestSum = k
+			bestCount = 1
+		} else if math.Abs(variance-bestVariance) <= 1e-9 {
+			// The book averages k over all the maxima
+			bestSum += k
+			bestCount++
+		}
+	}
+	if bestCount == 0 {
+		// A single intensity, nothing to separate
+		return uint8(globalMean), 0, nil
+	}
+
+	var separability float64 = 0
+	if globalVariance > 0 {
+		separability = bestVariance / globalVariance
+	}
+	return uint8(bestSum / bestCount), separability, nil
+}
+
+func OtsuThreshold(img image.Image, options ThresholdOptions) (uint8, float64, image.Image, error) {
+	// This is from Section 10.3.3 of DIP book
+	// Returns the threshold, the separability measure eta = sigma_B^2 / sigma_G^2 and the binary image
+	histogram, segmented, err := thresholdHistogram(img, options)
+	if err != nil {
+		return 0, 0, image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	threshold, separability, err := otsuFromHistogram(histogram)
+	if err != nil {
+		return 0, 0, image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	newImage, err := ThresholdImage(segmented, threshold)
+	if err != nil {
+		return 0, 0, image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return threshold, separability, newImage, nil
+}
+
+func MultiOtsuThreshold(img image.Image, classes int, options ThresholdOptions) ([]uint8, float64, image.Image, error) {
+	// This is from Section 10.3.6 of DIP book
+	// sigma_B^2 = sum P_k (m_k - m_G)^2 = sum (S_k^2 / P_k) - m_G^2, where S_k is the
+	// first moment of class k. Each class adds an independent term, so instead of trying
+	// every combination of thresholds we use dynamic programming over the class boundaries.
+	if classes < 2 || classes > MaxGrayscaleLevels {
+		return nil, 0, image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("classes must be between 2 and %d, got %d", MaxGrayscaleLevels, classes)
+	}
+	histogram, segmented, err := thresholdHistogram(img, options)
+	if err != nil {
+		return nil, 0, image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	var total float64 = 0
+	for _, count := range histogram {
+		total += float64(count)
+	}
+	if total == 0 {
+		return nil, 0, image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("histogram is empty")
+	}
+
+	// Cumulative sums with a leading zero, class (a, b] has P = P[b+1] - P[a+1]
+	var levelCount int = len(histogram)
+	var cumulativeP []float64 = make([]float64, levelCount+1)
+	var cumulativeS []float64 = make([]float64, levelCount+1)
+	var cumulativeSquares []float64 = make([]float64, levelCount+1)
+	for level, count := range histogram {
+		probability := float64(count) / total
+		cumulativeP[level+1] = cumulativeP[level] + probability
+		cumulativeS[level+1] = cumulativeS[level] + float64(level)*probability
+		cumulativeSquares[level+1] = cumulativeSquares[level] + float64(level*level)*probability
+	}
+	classTerm := func(start int, end int) float64 {
+		// Levels start..end-1
+		probability := cumulativeP[end] - cumulativeP[start]
+		if probability <= 0 {
+			return 0
+		}
+		moment := cumulativeS[end] - cumulativeS[start]
+		return moment * moment / probability
+	}
+
+	// best[c][end] is the largest sum for c+1 classes covering levels 0..end-1
+	var best [][]float64 = make([][]float64, classes)
+	var previous [][]int = make([][]int, classes)
+	for c := range best {
+		best[c] = make([]float64, levelCount+1)
+		previous[c] = make([]int, levelCount+1)
+		for end := range best[c] {
+			best[c][end] = math.Inf(-1)
+		}
+	}
+	for end := 1; end <= levelCount; end++ {
+		best[0][end] = classTerm(0, end)
+	}
+	for c := 1; c < classes; c++ {
+		for end := c + 1; end <= levelCount; end++ {
+			for start := c; start < end; start++ {
+				if math.IsInf(best[c-1][start], -1) {
+					continue
+				}
+				value := best[c-1][start] + classTerm(start, end)
+				if value > best[c][end] {
+					best[c][end] = value
+					previous[c][end] = start
+				}
+			}
+		}
+	}
+	if math.IsInf(best[classes-1][levelCount], -1) {
+		return nil, 0, image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("cannot split %d levels into %d classes", levelCount, classes)
+	}
+
+	var thresholds []uint8 = make([]uint8, classes-1)
+	var end int = levelCount
+	for c := classes - 1; c > 0; c-- {
+		start := previous[c][end]
+		thresholds[c-1] = uint8(start - 1)
+		end = start
+	}
+
+	var globalMean float64 = cumulativeS[levelCount]
+	var globalVariance float64 = cumulativeSquares[levelCount] - globalMean*globalMean
+	var separability float64 = 0
+	if globalVariance > 0 {
+		separability = (best[classes-1][levelCount] - globalMean*globalMean) / globalVariance
+	}
+
+	newImage, err := MultiThresholdImage(segmented, thresholds)
+	if err != nil {
+		return nil, 0, image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return thresholds, separability, newImage, nil
+}
@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func createModalTestImage(width int, height int, modes []uint8) image.Image {
+	// Splits the image into vertical bands, one per mode
+	var values []uint8
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			values = append(values, modes[x*len(modes)/width])
+		}
+	}
+	return createTestImage(width, height, values)
+}
+
+func TestBasicGlobalThreshold(t *testing.T) {
+	img := createModalTestImage(8, 4, []uint8{40, 200})
+
+	threshold, binary, err := BasicGlobalThreshold(img, 0.5, ThresholdOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if threshold < 40 || threshold >= 200 {
+		t.Errorf("threshold = %d, want between 40 and 200", threshold)
+	}
+	checkPixelValue(t, binary, 0, 0, 0)
+	checkPixelValue(t, binary, 7, 3, 255)
+
+	if _, _, err := BasicGlobalThreshold(img, 0, ThresholdOptions{}); err == nil {
+		t.Error("expected an error for a zero delta")
+	}
+}
+
+func TestOtsuThreshold(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ThresholdOptions
+	}{
+		{name: "plain histogram"},
+		{name: "smoothed histogram", options: ThresholdOptions{Smooth: true}},
+		{name: "edge weighted histogram", options: ThresholdOptions{EdgePercentile: 50}},
+	}
+
+	img := createModalTestImage(10, 6, []uint8{30, 180})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			threshold, separability, binary, err := OtsuThreshold(img, tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if threshold < 30 || threshold >= 180 {
+				t.Errorf("threshold = %d, want between 30 and 180", threshold)
+			}
+			if separability <= 0 || separability > 1+1e-9 {
+				t.Errorf("separability = %v, want in (0, 1]", separability)
+			}
+			checkPixelValue(t, binary, 0, 0, 0)
+			checkPixelValue(t, binary, 9, 5, 255)
+		})
+	}
+
+	if _, _, _, err := OtsuThreshold(img, ThresholdOptions{EdgePercentile: 100}); err == nil {
+		t.Error("expected an error for a percentile of 100")
+	}
+}
+
+func TestSmoothedThresholdRemovesNoise(t *testing.T) {
+	// Section 10.3.4 segments the smoothed image, so isolated noise pixels are not kept
+	img := createModalTestImage(20, 10, []uint8{30, 180}).(*image.Gray)
+	img.Pix[4*img.Stride+3] = 255
+	img.Pix[5*img.Stride+15] = 0
+
+	_, _, noisy, err := OtsuThreshold(img, ThresholdOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, noisy, 3, 4, 255)
+	checkPixelValue(t, noisy, 15, 5, 0)
+
+	_, _, smoothed, err := OtsuThreshold(img, ThresholdOptions{Smooth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, smoothed, 3, 4, 0)
+	checkPixelValue(t, smoothed, 15, 5, 255)
+
+	_, basic, err := BasicGlobalThreshold(img, 0.5, ThresholdOptions{Smooth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, basic, 3, 4, 0)
+	checkPixelValue(t, basic, 15, 5, 255)
+
+	_, _, labelled, err := MultiOtsuThreshold(img, 2, ThresholdOptions{Smooth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixelValue(t, labelled, 3, 4, 0)
+	checkPixelValue(t, labelled, 15, 5, 255)
+}
+
+func TestMultiOtsuThreshold(t *testing.T) {
+	img := createModalTestImage(9, 3, []uint8{20, 120, 220})
+
+	thresholds, separability, labelled, err := MultiOtsuThreshold(img, 3, ThresholdOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thresholds) != 2 {
+		t.Fatalf("got %d thresholds, want 2", len(thresholds))
+	}
+	if thresholds[0] < 20 || thresholds[0] >= 120 || thresholds[1] < 120 || thresholds[1] >= 220 {
+		t.Errorf("thresholds = %v, want one in [20,120) and one in [120,220)", thresholds)
+	}
+	if separability < 0.99 {
+		t.Errorf("separability = %v, want close to 1 for perfectly separated classes", separability)
+	}
+	checkPixelValue(t, labelled, 0, 0, 0)
+	checkPixelValue(t, labelled, 4, 0, 127)
+	checkPixelValue(t, labelled, 8, 0, 254)
+
+	// Two classes separate a bimodal image just like Otsu
+	bimodal := createModalTestImage(10, 6, []uint8{30, 180})
+	two, twoSeparability, _, err := MultiOtsuThreshold(bimodal, 2, ThresholdOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otsuSeparability, _, _ := OtsuThreshold(bimodal, ThresholdOptions{})
+	if two[0] < 30 || two[0] >= 180 {
+		t.Errorf("threshold = %d, want between 30 and 180", two[0])
+	}
+	if math.Abs(twoSeparability-otsuSeparability) > 1e-9 {
+		t.Errorf("separability = %v, Otsu gives %v", twoSeparability, otsuSeparability)
+	}
+
+	if _, _, _, err := MultiOtsuThreshold(img, 1, ThresholdOptions{}); err == nil {
+		t.Error("expected an error for a single class")
+	}
+}
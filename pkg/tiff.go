@@ -0,0 +1,372 @@
+// Uncompressed baseline TIFF reading and writing, registered with the image package
+package pkg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+func init() {
+	image.RegisterFormat(string(TIFFFormat), "II*\x00", decodeTIFF, decodeTIFFConfig)
+	image.RegisterFormat(string(TIFFFormat), "MM\x00*", decodeTIFF, decodeTIFFConfig)
+}
+
+// The baseline TIFF tags that are read or written
+const (
+	tiffImageWidth                = 256
+	tiffImageLength               = 257
+	tiffBitsPerSample             = 258
+	tiffCompression               = 259
+	tiffPhotometricInterpretation = 262
+	tiffStripOffsets              = 273
+	tiffSamplesPerPixel           = 277
+	tiffRowsPerStrip              = 278
+	tiffStripByteCounts           = 279
+	tiffXResolution               = 282
+	tiffYResolution               = 283
+	tiffPlanarConfiguration       = 284
+	tiffResolutionUnit            = 296
+)
+
+// The field types of TIFF and their sizes in bytes
+const (
+	tiffByte     = 1
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+var tiffTypeSizes map[uint16]int = map[uint16]int{tiffByte: 1, tiffShort: 2, tiffLong: 4, tiffRational: 8}
+
+// tiffEntry is one field of an image file directory, with its values for writing
+type tiffEntry struct {
+	tag       uint16
+	fieldType uint16
+	values    []uint32
+}
+
+func encodeTIFF(w io.Writer, img image.Image) error {
+	// Little-endian, one uncompressed strip, grey or RGB at 8 or 16 bits per sample.
+	// The pixels follow the header and the image file directory follows the pixels.
+	var bounds image.Rectangle = img.Bounds()
+	var width, height int = bounds.Dx(), bounds.Dy()
+	var samples, bits int = 3, 8
+	var photometric uint32 = 2
+	if isGrayModel(img) {
+		samples, photometric = 1, 1
+	}
+	if is16BitModel(img) {
+		bits = 16
+	}
+
+	var pixels []byte = make([]byte, 0, width*height*samples*bits/8)
+	var appendSample = func(value uint32) {
+		if bits == 16 {
+			pixels = append(pixels, byte(value), byte(value>>8))
+		} else {
+			pixels = append(pixels, byte(value>>8))
+		}
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if samples == 1 {
+				appendSample(uint32(color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y))
+				continue
+			}
+			pixel := color.RGBA64Model.Convert(img.At(x, y)).(color.RGBA64)
+			appendSample(uint32(pixel.R))
+			appendSample(uint32(pixel.G))
+			appendSample(uint32(pixel.B))
+		}
+	}
+	var directoryOffset int = 8 + len(pixels) + len(pixels)%2
+
+	var bitsPerSample []uint32 = make([]uint32, samples)
+	for index := range bitsPerSample {
+		bitsPerSample[index] = uint32(bits)
+	}
+	var entries []tiffEntry = []tiffEntry{
+		{tiffImageWidth, tiffLong, []uint32{uint32(width)}},
+		{tiffImageLength, tiffLong, []uint32{uint32(height)}},
+		{tiffBitsPerSample, tiffShort, bitsPerSample},
+		{tiffCompression, tiffShort, []uint32{1}},
+		{tiffPhotometricInterpretation, tiffShort, []uint32{photometric}},
+		{tiffStripOffsets, tiffLong, []uint32{8}},
+		{tiffSamplesPerPixel, tiffShort, []uint32{uint32(samples)}},
+		{tiffRowsPerStrip, tiffLong, []uint32{uint32(height)}},
+		{tiffStripByteCounts, tiffLong, []uint32{uint32(len(pixels))}},
+		{tiffXResolution, tiffRational, []uint32{72, 1}},
+		{tiffYResolution, tiffRational, []uint32{72, 1}},
+		{tiffPlanarConfiguration, tiffShort, []uint32{1}},
+		{tiffResolutionUnit, tiffShort, []uint32{2}},
+	}
+
+	// Values that do not fit the 4 bytes of an entry go after the directory
+	var directory []byte = make([]byte, 2+12*len(entries)+4)
+	var extra []byte
+	var extraOffset int = directoryOffset + len(directory)
+	binary.LittleEndian.PutUint16(directory, uint16(len(entries)))
+	for index, entry := range entries {
+		field := directory[2+12*index:]
+		binary.LittleEndian.PutUint16(field[0:], entry.tag)
+		binary.LittleEndian.PutUint16(field[2:], entry.fieldType)
+		count := len(entry.values)
+		if entry.fieldType == tiffRational {
+			count /= 2
+		}
+		binary.LittleEndian.PutUint32(field[4:], uint32(count))
+
+		var data []byte = make([]byte, tiffTypeSizes[entry.fieldType]*count)
+		for index, value := range entry.values {
+			if entry.fieldType == tiffShort {
+				binary.LittleEndian.PutUint16(data[2*index:], uint16(value))
+			} else {
+				binary.LittleEndian.PutUint32(data[4*index:], value)
+			}
+		}
+		if len(data) <= 4 {
+			copy(field[8:12], data)
+			continue
+		}
+		binary.LittleEndian.PutUint32(field[8:], uint32(extraOffset+len(extra)))
+		extra = append(extra, data...)
+	}
+
+	var writer *bufio.Writer = bufio.NewWriter(w)
+	var header []byte = []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(header[4:], uint32(directoryOffset))
+	for _, part := range [][]byte{header, pixels, make([]byte, len(pixels)%2), directory, extra} {
+		if _, err := writer.Write(part); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// tiffImage is the first image file directory of a TIFF file, as needed to read it
+type tiffImage struct {
+	order        binary.ByteOrder
+	width        int
+	height       int
+	bits         int
+	samples      int
+	photometric  uint32
+	stripOffsets []uint32
+	stripCounts  []uint32
+}
+
+func readTIFFDirectory(data []byte) (tiffImage, error) {
+	// Baseline grey and RGB images without compression in contiguous samples of 1, 8 or
+	// 16 bits. Only the first image of the file is read.
+	var file tiffImage
+	if len(data) < 8 {
+		return file, io.ErrUnexpectedEOF
+	}
+	switch string(data[:4]) {
+	case "II*\x00":
+		file.order = binary.LittleEndian
+	case "MM\x00*":
+		file.order = binary.BigEndian
+	default:
+		return file, fmt.Errorf("not a TIFF file")
+	}
+	var offset int = int(file.order.Uint32(data[4:]))
+	if offset+2 > len(data) {
+		return file, fmt.Errorf("TIFF directory at %d is past the end of the file", offset)
+	}
+	var count int = int(file.order.Uint16(data[offset:]))
+	if offset+2+12*count > len(data) {
+		return file, fmt.Errorf("TIFF directory at %d is past the end of the file", offset)
+	}
+
+	var fields map[uint16][]uint32 = map[uint16][]uint32{}
+	for index := 0; index < count; index++ {
+		field := data[offset+2+12*index:]
+		tag, fieldType, valueCount := file.order.Uint16(field), file.order.Uint16(field[2:]), int(file.order.Uint32(field[4:]))
+		size, known := tiffTypeSizes[fieldType]
+		if !known || fieldType == tiffRational || valueCount > len(data) {
+			// Not needed to read the pixels
+			continue
+		}
+		values := field[8:12]
+		if size*valueCount > 4 {
+			start := int(file.order.Uint32(field[8:]))
+			if start+size*valueCount > len(data) {
+				return file, fmt.Errorf("TIFF tag %d is past the end of the file", tag)
+			}
+			values = data[start:]
+		}
+		for value := 0; value < valueCount; value++ {
+			switch fieldType {
+			case tiffByte:
+				fields[tag] = append(fields[tag], uint32(values[value]))
+			case tiffShort:
+				fields[tag] = append(fields[tag], uint32(file.order.Uint16(values[2*value:])))
+			default:
+				fields[tag] = append(fields[tag], file.order.Uint32(values[4*value:]))
+			}
+		}
+	}
+	var field = func(tag uint16, fallback uint32) uint32 {
+		if values := fields[tag]; len(values) > 0 {
+			return values[0]
+		}
+		return fallback
+	}
+
+	file.width, file.height = int(field(tiffImageWidth, 0)), int(field(tiffImageLength, 0))
+	file.bits, file.samples = int(field(tiffBitsPerSample, 1)), int(field(tiffSamplesPerPixel, 1))
+	file.photometric = field(tiffPhotometricInterpretation, 1)
+	file.stripOffsets, file.stripCounts = fields[tiffStripOffsets], fields[tiffStripByteCounts]
+	if file.width <= 0 || file.height <= 0 || file.width > 1<<20 || file.height > 1<<20 || file.width*file.height > maxImagePixels {
+		return file, fmt.Errorf("invalid TIFF size %dx%d", file.width, file.height)
+	}
+	if compression := field(tiffCompression, 1); compression != 1 {
+		return file, fmt.Errorf("TIFF compression %d is not supported", compression)
+	}
+	if field(tiffPlanarConfiguration, 1) != 1 {
+		return file, fmt.Errorf("TIFF files with separate sample planes are not supported")
+	}
+	switch {
+	case file.photometric <= 1 && file.samples == 1 && (file.bits == 1 || file.bits == 8 || file.bits == 16):
+	case file.photometric == 2 && (file.samples == 3 || file.samples == 4) && (file.bits == 8 || file.bits == 16):
+	default:
+		return file, fmt.Errorf("TIFF photometric interpretation %d with %d samples of %d bits is not supported", file.photometric, file.samples, file.bits)
+	}
+	if len(file.stripOffsets) == 0 || len(file.stripOffsets) != len(file.stripCounts) {
+		return file, fmt.Errorf("TIFF strips are missing")
+	}
+	return file, nil
+}
+
+func decodeTIFFConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	file, err := readTIFFDirectory(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	var model color.Model = color.RGBAModel
+	switch {
+	case file.photometric <= 1 && file.bits == 16:
+		model = color.Gray16Model
+	case file.photometric <= 1:
+		model = color.GrayModel
+	case file.bits == 16:
+		model = color.RGBA64Model
+	}
+	return image.Config{ColorModel: model, Width: file.width, Height: file.height}, nil
+}
+
+func decodeTIFF(r io.Reader) (image.Image, error) {
+	// Grey images are returned as *image.Gray or *image.Gray16 and RGB images as
+	// *image.RGBA or *image.RGBA64, ignoring any extra samples
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	file, err := readTIFFDirectory(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The strips hold whole rows in order, each row starting on a byte. The size in the
+	// header is checked against the strips before anything that large is allocated, and
+	// bytes shared by overlapping strips are counted once so the total is at most the
+	// size of the file.
+	var rowSize int = (file.width*file.samples*file.bits + 7) / 8
+	var strips [][2]int = make([][2]int, len(file.stripOffsets))
+	for index, offset := range file.stripOffsets {
+		end := int(offset) + int(file.stripCounts[index])
+		if end > len(data) || end < int(offset) {
+			return nil, fmt.Errorf("TIFF strip %d is past the end of the file", index)
+		}
+		strips[index] = [2]int{int(offset), end}
+	}
+	sort.Slice(strips, func(i, j int) bool { return strips[i][0] < strips[j][0] })
+	var total, covered int = 0, 0
+	for _, strip := range strips {
+		if strip[0] > covered {
+			covered = strip[0]
+		}
+		if strip[1] > covered {
+			total += strip[1] - covered
+			covered = strip[1]
+		}
+	}
+	if total < rowSize*file.height {
+		return nil, fmt.Errorf("TIFF strips hold %d bytes, want %d", total, rowSize*file.height)
+	}
+	var pixels []byte = make([]byte, 0, rowSize*file.height)
+	for index, offset := range file.stripOffsets {
+		strip := data[offset : int(offset)+int(file.stripCounts[index])]
+		if remaining := cap(pixels) - len(pixels); len(strip) > remaining {
+			strip = strip[:remaining]
+		}
+		pixels = append(pixels, strip...)
+	}
+
+	var rectangle image.Rectangle = image.Rect(0, 0, file.width, file.height)
+	var sample = func(y int, index int) uint16 {
+		// The sample scaled to 16 bits, with white as 0 inverted
+		var row []byte = pixels[y*rowSize:]
+		var value uint16
+		switch file.bits {
+		case 1:
+			value = uint16(row[index/8]>>uint(7-index%8)&1) * 0xffff
+		case 8:
+			value = uint16(row[index]) * 0x101
+		default:
+			value = file.order.Uint16(row[2*index:])
+		}
+		if file.photometric == 0 {
+			value = 0xffff - value
+		}
+		return value
+	}
+
+	if file.photometric <= 1 {
+		if file.bits == 16 {
+			gray := image.NewGray16(rectangle)
+			for y := 0; y < file.height; y++ {
+				for x := 0; x < file.width; x++ {
+					gray.SetGray16(x, y, color.Gray16{sample(y, x*file.samples)})
+				}
+			}
+			return gray, nil
+		}
+		gray := image.NewGray(rectangle)
+		for y := 0; y < file.height; y++ {
+			for x := 0; x < file.width; x++ {
+				gray.Pix[y*gray.Stride+x] = uint8(sample(y, x*file.samples) >> 8)
+			}
+		}
+		return gray, nil
+	}
+	if file.bits == 16 {
+		rgba := image.NewRGBA64(rectangle)
+		for y := 0; y < file.height; y++ {
+			for x := 0; x < file.width; x++ {
+				index := x * file.samples
+				rgba.SetRGBA64(x, y, color.RGBA64{sample(y, index), sample(y, index+1), sample(y, index+2), 0xffff})
+			}
+		}
+		return rgba, nil
+	}
+	rgba := image.NewRGBA(rectangle)
+	for y := 0; y < file.height; y++ {
+		for x := 0; x < file.width; x++ {
+			index := x * file.samples
+			target := rgba.Pix[y*rgba.Stride+4*x:]
+			target[0], target[1], target[2], target[3] = uint8(sample(y, index)>>8), uint8(sample(y, index+1)>>8), uint8(sample(y, index+2)>>8), 255
+		}
+	}
+	return rgba, nil
+}
@@ -0,0 +1,334 @@
+// Block transform coding with the DCT: zonal, threshold and quantisation table masks
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// TransformMask is how the coefficients of each block are selected and quantised
+type TransformMask int
+
+const (
+	// ZonalMask keeps the same coefficients in every block, those with the largest
+	// variance over all blocks, rounded to whole numbers
+	ZonalMask TransformMask = iota
+	// ThresholdMask keeps the largest coefficients of each block, rounded to whole numbers
+	ThresholdMask
+	// QuantisationMask divides every coefficient by a normalisation table scaled by
+	// the quality and rounds, as in baseline JPEG. It needs 8x8 blocks.
+	QuantisationMask
+)
+
+// TransformCodingOptions configures TransformCode. BlockSize is 8 when left at 0.
+// Coefficients is the number kept per block by the zonal and threshold masks and
+// Quality, from 1 to 100, scales the table of the quantisation mask.
+type TransformCodingOptions struct {
+	BlockSize    int
+	Mask         TransformMask
+	Coefficients int
+	Quality      int
+}
+
+// TransformCodingReport describes the result of TransformCode. Bits is an estimate of
+// the coded size: the quantised blocks are scanned in zig-zag order into JPEG style
+// run-length and size symbols, which are counted at their first-order entropy, plus
+// the amplitude bits. CompressionRatio is 8 bits per pixel over that estimate.
+type TransformCodingReport struct {
+	BlockSize           int
+	Blocks              int
+	NonZeroCoefficients int
+	Bits                int
+	BitsPerPixel        float64
+	CompressionRatio    float64
+	RootMeanSquareError float64
+}
+
+// JPEGLuminanceQuantisation is the normalisation array of Section 8.2.8 of DIP book,
+// indexed [u][v] with u the horizontal frequency
+var JPEGLuminanceQuantisation [8][8]int = func() [8][8]int {
+	var rows [8][8]int = [8][8]int{
+		{16, 11, 10, 16, 24, 40, 51, 61},
+		{12, 12, 14, 19, 26, 58, 60, 55},
+		{14, 13, 16, 24, 40, 57, 69, 56},
+		{14, 17, 22, 29, 51, 87, 80, 62},
+		{18, 22, 37, 56, 68, 109, 103, 77},
+		{24, 35, 55, 64, 81, 104, 113, 92},
+		{49, 64, 78, 87, 103, 121, 120, 101},
+		{72, 92, 95, 98, 112, 100, 103, 99},
+	}
+	// The table is printed by rows of v, store it by columns of u like the images
+	var table [8][8]int
+	for v := range rows {
+		for u := range rows[v] {
+			table[u][v] = rows[v][u]
+		}
+	}
+	return table
+}()
+
+func QuantisationTable(quality int) ([8][8]int, error) {
+	// Scales JPEGLuminanceQuantisation the way the IJG library does, quality 50 is the
+	// table itself, lower qualities coarser and 100 a step of 1 everywhere
+	var table [8][8]int
+	if quality < 1 || quality > 100 {
+		return table, fmt.Errorf("quality must be between 1 and 100, got %d", quality)
+	}
+	var scale int = 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	for u := range table {
+		for v := range table[u] {
+			step := (JPEGLuminanceQuantisation[u][v]*scale + 50) / 100
+			if step < 1 {
+				step = 1
+			}
+			table[u][v] = step
+		}
+	}
+	return table, nil
+}
+
+func ZigZagOrder(size int) []image.Point {
+	// The zig-zag scan of a size x size block from the lowest frequency to the highest,
+	// as points (u, v) with u the horizontal frequency
+	var order []image.Point = make([]image.Point, 0, size*size)
+	for diagonal := 0; diagonal < 2*size-1; diagonal++ {
+		for step := 0; step <= diagonal; step++ {
+			// Odd diagonals run from the top right down to the left, even ones from
+			// the bottom left up to the right, starting with (1, 0) after the DC term
+			u, v := step, diagonal-step
+			if diagonal%2 == 1 {
+				u, v = diagonal-step, step
+			}
+			if u < size && v < size {
+				order = append(order, image.Point{u, v})
+			}
+		}
+	}
+	return order
+}
+
+func sizeCategory(value int) int {
+	// The number of bits of |value|, the size category of JPEG
+	var category int = 0
+	for magnitude := absInt(value); magnitude > 0; magnitude >>= 1 {
+		category++
+	}
+	return category
+}
+
+func entropyCodedBits(scans [][]int) int {
+	// The JPEG style size of the zig-zag scans of the quantised blocks. The DC terms
+	// are coded as differences from the previous block. The AC terms are coded as
+	// (zero run, size) symbols, with 16 zeros as (15, 0) and the rest of a block as
+	// the end of block (0, 0). Each symbol costs its first-order entropy and each
+	// non-zero value its size category in bits.
+	var dcSymbols, acSymbols map[int]int = map[int]int{}, map[int]int{}
+	var amplitudeBits int = 0
+	var previous int = 0
+	for _, scan := range scans {
+		category := sizeCategory(scan[0] - previous)
+		dcSymbols[category]++
+		amplitudeBits += category
+		previous = scan[0]
+
+		var run int = 0
+		for _, value := range scan[1:] {
+			if value == 0 {
+				run++
+				continue
+			}
+			for ; run > 15; run -= 16 {
+				acSymbols[15<<4]++
+			}
+			category := sizeCategory(value)
+			acSymbols[run<<4|category]++
+			amplitudeBits += category
+			run = 0
+		}
+		if run > 0 {
+			acSymbols[0]++
+		}
+	}
+
+	var symbolBits float64 = 0
+	for _, symbols := range []map[int]int{dcSymbols, acSymbols} {
+		var total int = 0
+		for _, count := range symbols {
+			total += count
+		}
+		for _, count := range symbols {
+			symbolBits -= float64(count) * math.Log2(float64(count)/float64(total))
+		}
+	}
+	return amplitudeBits + int(math.Ceil(symbolBits))
+}
+
+func TransformCode(img image.Image, options TransformCodingOptions) (image.Image, TransformCodingReport, error) {
+	// This is from Section 8.2.8 of DIP book
+	// Splits the level shifted image into blocks, transforms each with the DCT, keeps
+	// and quantises coefficients according to the mask, and decodes the result. The
+	// image is padded by repeating its last row and column to whole blocks.
+	var report TransformCodingReport = TransformCodingReport{BlockSize: options.BlockSize}
+	if report.BlockSize == 0 {
+		report.BlockSize = 8
+	}
+	var size int = report.BlockSize
+	if size < 1 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, fmt.Errorf("block size must be at least 1, got %d", size)
+	}
+	var table [8][8]int
+	switch options.Mask {
+	case ZonalMask, ThresholdMask:
+		if options.Coefficients < 1 || options.Coefficients > size*size {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), report, fmt.Errorf("coefficients must be between 1 and %d, got %d", size*size, options.Coefficients)
+		}
+	case QuantisationMask:
+		if size != 8 {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), report, fmt.Errorf("the quantisation mask needs 8x8 blocks, got %dx%d", size, size)
+		}
+		var err error
+		if table, err = QuantisationTable(options.Quality); err != nil {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+		}
+	default:
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, fmt.Errorf("unknown transform mask %d", options.Mask)
+	}
+	var levels [][]uint8 = imageToLevels(img)
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, fmt.Errorf("empty image")
+	}
+	var width, height int = len(levels), len(levels[0])
+	var blocksX, blocksY int = (width + size - 1) / size, (height + size - 1) / size
+	report.Blocks = blocksX * blocksY
+
+	// Forward transform of every block
+	var blocks [][][]float64 = make([][][]float64, 0, report.Blocks)
+	for blockX := 0; blockX < blocksX; blockX++ {
+		for blockY := 0; blockY < blocksY; blockY++ {
+			var block [][]float64 = newFloats(size, size)
+			for x := 0; x < size; x++ {
+				for y := 0; y < size; y++ {
+					block[x][y] = float64(levels[clampIndex(blockX*size+x, width)][clampIndex(blockY*size+y, height)]) - 128
+				}
+			}
+			coefficients, err := DiscreteCosineTransform(block)
+			if err != nil {
+				return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+			}
+			blocks = append(blocks, coefficients)
+		}
+	}
+
+	// The zonal mask keeps the positions with the largest variance over all blocks
+	var zone [][]bool = make([][]bool, size)
+	for u := range zone {
+		zone[u] = make([]bool, size)
+	}
+	if options.Mask == ZonalMask {
+		var positions []image.Point
+		var variances [][]float64 = newFloats(size, size)
+		for u := 0; u < size; u++ {
+			for v := 0; v < size; v++ {
+				var sum, sumOfSquares float64 = 0, 0
+				for _, block := range blocks {
+					sum += block[u][v]
+					sumOfSquares += block[u][v] * block[u][v]
+				}
+				mean := sum / float64(len(blocks))
+				variances[u][v] = sumOfSquares/float64(len(blocks)) - mean*mean
+				positions = append(positions, image.Point{u, v})
+			}
+		}
+		sort.SliceStable(positions, func(i, j int) bool {
+			return variances[positions[i].X][positions[i].Y] > variances[positions[j].X][positions[j].Y]
+		})
+		for _, position := range positions[:options.Coefficients] {
+			zone[position.X][position.Y] = true
+		}
+	}
+
+	// Quantise, scan for the size estimate and decode
+	var order []image.Point = ZigZagOrder(size)
+	var scans [][]int = make([][]int, 0, len(blocks))
+	var reconstructed [][]uint8 = newLevels(width, height)
+	for index, block := range blocks {
+		var quantised [][]int = make([][]int, size)
+		for u := range quantised {
+			quantised[u] = make([]int, size)
+		}
+		switch options.Mask {
+		case ZonalMask:
+			for u := range block {
+				for v := range block[u] {
+					if zone[u][v] {
+						quantised[u][v] = int(math.Round(block[u][v]))
+					}
+				}
+			}
+		case ThresholdMask:
+			ranked := append([]image.Point(nil), order...)
+			sort.SliceStable(ranked, func(i, j int) bool {
+				return math.Abs(block[ranked[i].X][ranked[i].Y]) > math.Abs(block[ranked[j].X][ranked[j].Y])
+			})
+			for _, position := range ranked[:options.Coefficients] {
+				quantised[position.X][position.Y] = int(math.Round(block[position.X][position.Y]))
+			}
+		case QuantisationMask:
+			for u := range block {
+				for v := range block[u] {
+					quantised[u][v] = int(math.Round(block[u][v] / float64(table[u][v])))
+				}
+			}
+		}
+
+		var scan []int = make([]int, len(order))
+		for position, point := range order {
+			scan[position] = quantised[point.X][point.Y]
+			if scan[position] != 0 {
+				report.NonZeroCoefficients++
+			}
+		}
+		scans = append(scans, scan)
+
+		var dequantised [][]float64 = newFloats(size, size)
+		for u := range quantised {
+			for v := range quantised[u] {
+				dequantised[u][v] = float64(quantised[u][v])
+				if options.Mask == QuantisationMask {
+					dequantised[u][v] *= float64(table[u][v])
+				}
+			}
+		}
+		decoded, err := InverseDiscreteCosineTransform(dequantised)
+		if err != nil {
+			return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+		}
+		blockX, blockY := index/blocksY, index%blocksY
+		for x := 0; x < size && blockX*size+x < width; x++ {
+			for y := 0; y < size && blockY*size+y < height; y++ {
+				reconstructed[blockX*size+x][blockY*size+y] = clampLevel(int(math.Round(decoded[x][y] + 128)))
+			}
+		}
+	}
+
+	report.Bits = entropyCodedBits(scans)
+	report.BitsPerPixel = float64(report.Bits) / float64(width*height)
+	if report.Bits > 0 {
+		report.CompressionRatio = float64(8*width*height) / float64(report.Bits)
+	}
+
+	newImage, err := levelsToImage(reconstructed)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+	}
+	report.RootMeanSquareError, err = RootMeanSquaredError(newImage, img)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), report, err
+	}
+	return newImage, report, nil
+}
@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"image"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDiscreteCosineTransform(t *testing.T) {
+	// A constant block only has a DC term, sqrt(width height) times the value
+	constant := newFloats(8, 8)
+	for x := range constant {
+		for y := range constant[x] {
+			constant[x][y] = 10
+		}
+	}
+	coefficients, err := DiscreteCosineTransform(constant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for u := range coefficients {
+		for v := range coefficients[u] {
+			expected := 0.0
+			if u == 0 && v == 0 {
+				expected = 80
+			}
+			if math.Abs(coefficients[u][v]-expected) > 1e-9 {
+				t.Errorf("coefficient (%d, %d) = %v, want %v", u, v, coefficients[u][v], expected)
+			}
+		}
+	}
+
+	// The 8x8 fast path agrees with the general transform, and both invert
+	for _, size := range [][2]int{{8, 8}, {5, 3}, {1, 6}} {
+		values := newFloats(size[0], size[1])
+		for x := range values {
+			for y := range values[x] {
+				values[x][y] = float64((x*31+y*17)%23) - 11
+			}
+		}
+		coefficients, err := DiscreteCosineTransform(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		general := dctFloats(values, false)
+		restored, err := InverseDiscreteCosineTransform(coefficients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for x := range values {
+			for y := range values[x] {
+				if math.Abs(coefficients[x][y]-general[x][y]) > 1e-9 || math.Abs(restored[x][y]-values[x][y]) > 1e-9 {
+					t.Fatalf("%dx%d: at (%d, %d) transform %v, general %v, restored %v from %v", size[0], size[1], x, y, coefficients[x][y], general[x][y], restored[x][y], values[x][y])
+				}
+			}
+		}
+	}
+
+	if _, err := DiscreteCosineTransform([][]float64{{1, 2}, {3}}); err == nil {
+		t.Error("expected an error for ragged values")
+	}
+}
+
+func TestZigZagOrderAndQuantisationTable(t *testing.T) {
+	order := ZigZagOrder(8)
+	if len(order) != 64 {
+		t.Fatalf("got %d positions, want 64", len(order))
+	}
+	expected := []image.Point{{0, 0}, {1, 0}, {0, 1}, {0, 2}, {1, 1}, {2, 0}, {3, 0}}
+	if !reflect.DeepEqual(order[:len(expected)], expected) || order[63] != (image.Point{7, 7}) {
+		t.Errorf("zig-zag order starts %v and ends %v", order[:len(expected)], order[63])
+	}
+
+	table, err := QuantisationTable(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table != JPEGLuminanceQuantisation || table[1][0] != 11 || table[0][1] != 12 {
+		t.Errorf("quality 50 table = %v", table)
+	}
+	table, err = QuantisationTable(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table[7][7] != 1 {
+		t.Errorf("quality 100 step = %d, want 1", table[7][7])
+	}
+	if _, err := QuantisationTable(0); err == nil {
+		t.Error("expected an error for quality 0")
+	}
+}
+
+func TestTransformCode(t *testing.T) {
+	img := createSmoothTestImage(37, 29)
+
+	var previous TransformCodingReport
+	for index, quality := range []int{95, 50, 10} {
+		_, report, err := TransformCode(img, TransformCodingOptions{Mask: QuantisationMask, Quality: quality})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Blocks != 5*4 || report.Bits <= 0 {
+			t.Errorf("quality %d: %d blocks and %d bits", quality, report.Blocks, report.Bits)
+		}
+		// Lower quality compresses more and loses more
+		if index > 0 && (report.CompressionRatio <= previous.CompressionRatio || report.RootMeanSquareError <= previous.RootMeanSquareError) {
+			t.Errorf("quality %d: ratio %.2f and error %.2f, before %.2f and %.2f", quality, report.CompressionRatio, report.RootMeanSquareError, previous.CompressionRatio, previous.RootMeanSquareError)
+		}
+		previous = report
+	}
+
+	// Keeping every coefficient only loses the rounding
+	decoded, report, err := TransformCode(img, TransformCodingOptions{Mask: ZonalMask, Coefficients: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds() != img.Bounds() || report.RootMeanSquareError > 0.5 {
+		t.Errorf("decoded %v with error %v", decoded.Bounds(), report.RootMeanSquareError)
+	}
+
+	// With only the DC term every block is flat
+	decoded, report, err = TransformCode(img, TransformCodingOptions{Mask: ThresholdMask, Coefficients: 1, BlockSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NonZeroCoefficients > report.Blocks {
+		t.Errorf("%d non-zero coefficients in %d blocks", report.NonZeroCoefficients, report.Blocks)
+	}
+	levels := imageToLevels(decoded)
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			if levels[x][y] != levels[0][0] {
+				t.Fatalf("block is not flat at (%d, %d)", x, y)
+			}
+		}
+	}
+
+	if _, _, err := TransformCode(img, TransformCodingOptions{Mask: QuantisationMask, Quality: 50, BlockSize: 16}); err == nil {
+		t.Error("expected an error for the quantisation mask without 8x8 blocks")
+	}
+	if _, _, err := TransformCode(img, TransformCodingOptions{Mask: ZonalMask}); err == nil {
+		t.Error("expected an error for zero coefficients")
+	}
+}
+
+func TestEntropyCodedBits(t *testing.T) {
+	// Two blocks with the same DC, so the second difference is 0, and one AC value of
+	// 3 after a run of 2 zeros, then the end of block
+	scans := [][]int{{4, 0, 0, 3, 0}, {4, 0, 0, 0, 0}}
+	// DC symbols: categories 3 and 0, 1 bit each plus 3 amplitude bits. AC symbols:
+	// (2, 2), EOB and EOB, -log2(1/3) + 2 (-log2(2/3)) plus 2 amplitude bits.
+	expected := 2 + 3 + int(math.Ceil(math.Log2(3)+2*math.Log2(1.5))) + 2
+	if bits := entropyCodedBits(scans); bits != expected {
+		t.Errorf("bits = %d, want %d", bits, expected)
+	}
+}
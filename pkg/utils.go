@@ -5,17 +5,12 @@ import (
 	"image"
 	"image/color"
 	"log"
-	"os"
+	"math"
 )
 
 func FileNameToImage(filename string) image.Image {
-	reader, err := os.Open(filename)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer reader.Close()
-
-	img, _, err := image.Decode(reader)
+	// For the command line, LoadImage returns the error instead
+	img, _, err := LoadImage(filename)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -51,3 +46,152 @@ func PixelsToImage(pixels [][]color.Gray) (image.Image, error) {
 
 	return newImage, nil
 }
+
+// imageToLevels returns the grayscale levels of the image indexed as [x][y],
+// the same layout PixelsToImage expects, with the origin moved to (0,0).
+func imageToLevels(img image.Image) [][]uint8 {
+	bounds := img.Bounds()
+	levels := make([][]uint8, bounds.Dx())
+
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		column := make([]uint8, bounds.Dy())
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			column[y-bounds.Min.Y] = color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+		}
+		levels[x-bounds.Min.X] = column
+	}
+	return levels
+}
+
+func levelsToImage(levels [][]uint8) (image.Image, error) {
+	if len(levels) == 0 || len(levels[0]) == 0 {
+		return nil, fmt.Errorf("empty pixel array")
+	}
+
+	width := len(levels)
+	height := len(levels[0])
+	newImage := image.NewGray(image.Rect(0, 0, width, height))
+
+	for x := 0; x < width; x++ {
+		if len(levels[x]) != height {
+			return nil, fmt.Errorf("inconsistent pixel array dimensions at row %d", x)
+		}
+		for y := 0; y < height; y++ {
+			newImage.Pix[y*newImage.Stride+x] = levels[x][y]
+		}
+	}
+	return newImage, nil
+}
+
+func newLevels(width int, height int) [][]uint8 {
+	levels := make([][]uint8, width)
+	for x := range levels {
+		levels[x] = make([]uint8, height)
+	}
+	return levels
+}
+
+func clampLevel(level int) uint8 {
+	if level < 0 {
+		return 0
+	}
+	if level > MaxGrayscaleLevels-1 {
+		return uint8(MaxGrayscaleLevels - 1)
+	}
+	return uint8(level)
+}
+
+func FloatsToImage(values [][]float64) (image.Image, error) {
+	// Linearly scales the values so the smallest becomes 0 and the largest 255,
+	// for viewing signed or unbounded responses like gradients and transforms
+	if len(values) == 0 || len(values[0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty pixel array")
+	}
+
+	var minimum float64 = values[0][0]
+	var maximum float64 = values[0][0]
+	for _, column := range values {
+		for _, value := range column {
+			if value < minimum {
+				minimum = value
+			}
+			if value > maximum {
+				maximum = value
+			}
+		}
+	}
+
+	var levels [][]uint8 = make([][]uint8, len(values))
+	for x, column := range values {
+		levels[x] = make([]uint8, len(column))
+		if maximum == minimum {
+			continue
+		}
+		for y, value := range column {
+			levels[x][y] = uint8(math.Round((value - minimum) * float64(MaxGrayscaleLevels-1) / (maximum - minimum)))
+		}
+	}
+
+	newImage, err := levelsToImage(levels)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
+
+func newFloats(width int, height int) [][]float64 {
+	values := make([][]float64, width)
+	for x := range values {
+		values[x] = make([]float64, height)
+	}
+	return values
+}
+
+func intMaskToFloats(mask [][]int) [][]float64 {
+	var floats [][]float64 = make([][]float64, len(mask))
+	for rowIndex, row := range mask {
+		floats[rowIndex] = make([]float64, len(row))
+		for colIndex, cell := range row {
+			floats[rowIndex][colIndex] = float64(cell)
+		}
+	}
+	return floats
+}
+
+func correlateFloats(values [][]float64, mask [][]float64) [][]float64 {
+	// Same anchoring as the filters in this package, mask[row][col] is applied to
+	// (x + row - len(mask)/2, y + col - len(row)/2). Neighbours outside the image are
+	// replaced by the nearest border pixel so the border does not show up as an edge.
+	var width int = len(values)
+	var height int = len(values[0])
+	var result [][]float64 = newFloats(width, height)
+	var originX int = len(mask) / 2
+	var originY int = len(mask[0]) / 2
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			var sum float64 = 0
+			for rowIndex, row := range mask {
+				neighbourX := clampIndex(x+rowIndex-originX, width)
+				for colIndex, cell := range row {
+					if cell == 0 {
+						continue
+					}
+					sum += cell * values[neighbourX][clampIndex(y+colIndex-originY, height)]
+				}
+			}
+			result[x][y] = sum
+		}
+	}
+	return result
+}
+
+func clampIndex(index int, length int) int {
+	if index < 0 {
+		return 0
+	}
+	if index >= length {
+		return length - 1
+	}
+	return index
+}
@@ -0,0 +1,235 @@
+// Wavelet shrinkage denoising and wavelet-domain edge enhancement
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// ThresholdRule is how a detail coefficient is shrunk by a threshold T
+type ThresholdRule int
+
+const (
+	// SoftThreshold sets coefficients below T to zero and moves the others T towards zero
+	SoftThreshold ThresholdRule = iota
+	// HardThreshold sets coefficients below T to zero and keeps the others
+	HardThreshold
+)
+
+// ShrinkageMethod is how the threshold of each detail subband is chosen
+type ShrinkageMethod int
+
+const (
+	// VisuShrink uses the universal threshold sigma sqrt(2 ln N) of Donoho and Johnstone
+	VisuShrink ShrinkageMethod = iota
+	// BayesShrink uses sigma^2 / sigma_x, adapted to the signal variance of each subband
+	BayesShrink
+)
+
+// WaveletDenoiseOptions configures WaveletDenoise. NoiseSigma is the standard deviation
+// of the noise in grey levels, 0 to estimate it separately for every level.
+type WaveletDenoiseOptions struct {
+	Wavelet    Wavelet
+	Levels     int
+	Method     ShrinkageMethod
+	Rule       ThresholdRule
+	NoiseSigma float64
+}
+
+// WaveletEnhanceOptions configures WaveletEdgeEnhancement. Detail coefficients are
+// multiplied by Gain, except those smaller than NoiseThreshold times the estimated
+// noise of their level, which are left alone so the noise is not boosted with the edges.
+type WaveletEnhanceOptions struct {
+	Wavelet        Wavelet
+	Levels         int
+	Gain           float64
+	NoiseThreshold float64
+}
+
+func thresholdCoefficient(value float64, threshold float64, rule ThresholdRule) float64 {
+	if math.Abs(value) <= threshold {
+		return 0
+	}
+	if rule == HardThreshold {
+		return value
+	}
+	return math.Copysign(math.Abs(value)-threshold, value)
+}
+
+func copyDecomposition(decomposition WaveletDecomposition) WaveletDecomposition {
+	var copied WaveletDecomposition = decomposition
+	copied.Coefficients = make([][]float64, len(decomposition.Coefficients))
+	for x := range decomposition.Coefficients {
+		copied.Coefficients[x] = append([]float64(nil), decomposition.Coefficients[x]...)
+	}
+	return copied
+}
+
+func EstimateWaveletNoise(decomposition WaveletDecomposition) ([]float64, error) {
+	// The robust noise estimate median(|d|) / 0.6745 of the diagonal detail subband of
+	// every level, index 0 for level 1. The diagonal details of natural images are
+	// mostly noise, and the median ignores the few large coefficients at edges.
+	var estimates []float64 = make([]float64, decomposition.Levels)
+	for level := 1; level <= decomposition.Levels; level++ {
+		bounds, err := decomposition.SubbandBounds(level, HighHigh)
+		if err != nil {
+			return nil, err
+		}
+		var magnitudes []float64
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				magnitudes = append(magnitudes, math.Abs(decomposition.Coefficients[x][y]))
+			}
+		}
+		sort.Float64s(magnitudes)
+		var median float64 = magnitudes[len(magnitudes)/2]
+		if len(magnitudes)%2 == 0 {
+			median = (median + magnitudes[len(magnitudes)/2-1]) / 2
+		}
+		estimates[level-1] = median / 0.6745
+	}
+	return estimates, nil
+}
+
+func ShrinkWaveletCoefficients(decomposition WaveletDecomposition, options WaveletDenoiseOptions) (WaveletDecomposition, error) {
+	// Thresholds the detail subbands of a copy of the decomposition, the approximation
+	// is kept. Only Method, Rule and NoiseSigma of the options are used.
+	if len(decomposition.Coefficients) == 0 || decomposition.Levels < 1 {
+		return decomposition, fmt.Errorf("empty wavelet decomposition")
+	}
+	if options.NoiseSigma < 0 {
+		return decomposition, fmt.Errorf("noise sigma must not be negative, got %v", options.NoiseSigma)
+	}
+	if options.Method != VisuShrink && options.Method != BayesShrink {
+		return decomposition, fmt.Errorf("unknown shrinkage method %d", options.Method)
+	}
+	if options.Rule != SoftThreshold && options.Rule != HardThreshold {
+		return decomposition, fmt.Errorf("unknown threshold rule %d", options.Rule)
+	}
+	sigmas, err := EstimateWaveletNoise(decomposition)
+	if err != nil {
+		return decomposition, err
+	}
+	if options.NoiseSigma > 0 {
+		for index := range sigmas {
+			sigmas[index] = options.NoiseSigma
+		}
+	}
+
+	var shrunk WaveletDecomposition = copyDecomposition(decomposition)
+	var count float64 = float64(decomposition.Width * decomposition.Height)
+	for level := 1; level <= decomposition.Levels; level++ {
+		sigma := sigmas[level-1]
+		for _, subband := range []WaveletSubband{HighLow, LowHigh, HighHigh} {
+			bounds, err := decomposition.SubbandBounds(level, subband)
+			if err != nil {
+				return decomposition, err
+			}
+
+			var threshold float64 = sigma * math.Sqrt(2*math.Log(count))
+			if options.Method == BayesShrink {
+				// The coefficients are signal plus independent noise, so the signal
+				// variance is what is left of the subband variance after the noise
+				var sumOfSquares float64 = 0
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+						sumOfSquares += decomposition.Coefficients[x][y] * decomposition.Coefficients[x][y]
+					}
+				}
+				signalVariance := sumOfSquares/float64(bounds.Dx()*bounds.Dy()) - sigma*sigma
+				if signalVariance > 0 {
+					threshold = sigma * sigma / math.Sqrt(signalVariance)
+				} else {
+					threshold = math.Inf(1)
+				}
+			}
+
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+					shrunk.Coefficients[x][y] = thresholdCoefficient(shrunk.Coefficients[x][y], threshold, options.Rule)
+				}
+			}
+		}
+	}
+	return shrunk, nil
+}
+
+func WaveletDenoise(img image.Image, options WaveletDenoiseOptions) (image.Image, error) {
+	// This is from Section 7.6 of DIP book
+	// Transforms, shrinks the detail coefficients and transforms back. Unlike the
+	// averaging of SmoothingSpatialFilter, edges have large coefficients that survive.
+	if len(options.Wavelet.AnalysisLow.Coefficients) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("no wavelet given")
+	}
+	decomposition, err := WaveletTransform(img, options.Wavelet, options.Levels)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	shrunk, err := ShrinkWaveletCoefficients(decomposition, options)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return InverseWaveletTransform(shrunk)
+}
+
+func WaveletEdgeEnhancement(img image.Image, options WaveletEnhanceOptions) (image.Image, error) {
+	// Sharpens by scaling the detail coefficients, a gain of 0 gives the smooth
+	// approximation only and a gain of 1 the image itself
+	if len(options.Wavelet.AnalysisLow.Coefficients) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("no wavelet given")
+	}
+	if options.Gain < 0 || options.NoiseThreshold < 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("gain and noise threshold must not be negative, got %v and %v", options.Gain, options.NoiseThreshold)
+	}
+	decomposition, err := WaveletTransform(img, options.Wavelet, options.Levels)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	sigmas, err := EstimateWaveletNoise(decomposition)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+
+	for level := 1; level <= decomposition.Levels; level++ {
+		var floor float64 = options.NoiseThreshold * sigmas[level-1]
+		for _, subband := range []WaveletSubband{HighLow, LowHigh, HighHigh} {
+			bounds, err := decomposition.SubbandBounds(level, subband)
+			if err != nil {
+				return image.NewGray(image.Rect(0, 0, 1, 1)), err
+			}
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+					if math.Abs(decomposition.Coefficients[x][y]) >= floor {
+						decomposition.Coefficients[x][y] *= options.Gain
+					}
+				}
+			}
+		}
+	}
+	return InverseWaveletTransform(decomposition)
+}
+
+func WaveletEdges(img image.Image, wavelet Wavelet, levels int) (image.Image, error) {
+	// The image rebuilt with the approximation set to zero, which leaves the edges at
+	// the scales of the decomposition, scaled to the full grey range for viewing
+	decomposition, err := WaveletTransform(img, wavelet, levels)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	bounds, err := decomposition.SubbandBounds(levels, LowLow)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			decomposition.Coefficients[x][y] = 0
+		}
+	}
+	values, err := InverseWaveletTransformFloats(decomposition)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return FloatsToImage(values)
+}
@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func addTestNoise(img *image.Gray, sigma float64, seed int64) *image.Gray {
+	// Repeatable Gaussian noise of the given standard deviation
+	random := rand.New(rand.NewSource(seed))
+	noisy := image.NewGray(img.Bounds())
+	for index, level := range img.Pix {
+		noisy.Pix[index] = clampLevel(int(math.Round(float64(level) + sigma*random.NormFloat64())))
+	}
+	return noisy
+}
+
+func createSmoothTestImage(width int, height int) *image.Gray {
+	// Gentle shading with a bright disk, kept away from 0 and 255 so noise is not clipped
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			level := 70 + x/2 + y/4
+			if (x-width/2)*(x-width/2)+(y-height/2)*(y-height/2) < width*width/16 {
+				level += 60
+			}
+			img.SetGray(x, y, color.Gray{uint8(level)})
+		}
+	}
+	return img
+}
+
+func TestThresholdCoefficient(t *testing.T) {
+	cases := []struct {
+		value    float64
+		rule     ThresholdRule
+		expected float64
+	}{
+		{5, SoftThreshold, 3},
+		{-5, SoftThreshold, -3},
+		{1.5, SoftThreshold, 0},
+		{5, HardThreshold, 5},
+		{-2, HardThreshold, 0},
+	}
+	for _, c := range cases {
+		if result := thresholdCoefficient(c.value, 2, c.rule); result != c.expected {
+			t.Errorf("threshold %v with rule %d = %v, want %v", c.value, c.rule, result, c.expected)
+		}
+	}
+}
+
+func TestEstimateWaveletNoise(t *testing.T) {
+	haar, err := NewWavelet("haar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decomposition, err := WaveletTransform(addTestNoise(createSmoothTestImage(128, 128), 12, 3), haar, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigmas, err := EstimateWaveletNoise(decomposition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The orthonormal transform keeps white noise at the same level in every subband
+	for level, sigma := range sigmas {
+		if math.Abs(sigma-12) > 1.5 {
+			t.Errorf("noise estimate of level %d = %v, want about 12", level+1, sigma)
+		}
+	}
+}
+
+func TestWaveletDenoise(t *testing.T) {
+	clean := createSmoothTestImage(96, 80)
+	noisy := addTestNoise(clean, 15, 7)
+	noisyPSNR, err := PeakSignalToNoiseRatio(noisy, clean)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"haar", "daubechies8", "biorthogonal97"} {
+		wavelet, err := NewWavelet(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, method := range []ShrinkageMethod{VisuShrink, BayesShrink} {
+			for _, rule := range []ThresholdRule{SoftThreshold, HardThreshold} {
+				denoised, err := WaveletDenoise(noisy, WaveletDenoiseOptions{Wavelet: wavelet, Levels: 3, Method: method, Rule: rule})
+				if err != nil {
+					t.Fatal(err)
+				}
+				psnr, err := PeakSignalToNoiseRatio(denoised, clean)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if psnr < noisyPSNR+3 {
+					t.Errorf("%s method %d rule %d: PSNR %.2f dB, noisy image %.2f dB", name, method, rule, psnr, noisyPSNR)
+				}
+			}
+		}
+	}
+
+	// Without noise to remove, a known sigma of almost nothing keeps the image
+	haar, err := NewWavelet("haar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := WaveletDenoise(clean, WaveletDenoiseOptions{Wavelet: haar, Levels: 2, NoiseSigma: 1e-9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meanSquaredError, _ := MeanSquaredError(kept, clean); meanSquaredError != 0 {
+		t.Errorf("MSE after denoising with no noise = %v, want 0", meanSquaredError)
+	}
+
+	if _, err := WaveletDenoise(noisy, WaveletDenoiseOptions{Levels: 2}); err == nil {
+		t.Error("expected an error without a wavelet")
+	}
+	if _, err := WaveletDenoise(noisy, WaveletDenoiseOptions{Wavelet: haar, Levels: 2, NoiseSigma: -1}); err == nil {
+		t.Error("expected an error for a negative noise sigma")
+	}
+}
+
+func TestWaveletEdgeEnhancement(t *testing.T) {
+	img := createSmoothTestImage(64, 64)
+	haar, err := NewWavelet("haar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	same, err := WaveletEdgeEnhancement(img, WaveletEnhanceOptions{Wavelet: haar, Levels: 2, Gain: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meanSquaredError, _ := MeanSquaredError(same, img); meanSquaredError != 0 {
+		t.Errorf("MSE with a gain of 1 = %v, want 0", meanSquaredError)
+	}
+
+	// A larger gain steepens the edge of the disk
+	enhanced, err := WaveletEdgeEnhancement(img, WaveletEnhanceOptions{Wavelet: haar, Levels: 2, Gain: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var variation = func(result image.Image) int {
+		levels := imageToLevels(result)
+		var sum int = 0
+		for x := 1; x < len(levels); x++ {
+			for y := range levels[x] {
+				difference := int(levels[x][y]) - int(levels[x-1][y])
+				sum += difference * difference
+			}
+		}
+		return sum
+	}
+	if variation(enhanced) <= variation(img) {
+		t.Errorf("variation along x is %d, originally %d", variation(enhanced), variation(img))
+	}
+
+	edges, err := WaveletEdges(img, haar, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edges.Bounds() != img.Bounds() {
+		t.Errorf("edge image is %v, want %v", edges.Bounds(), img.Bounds())
+	}
+	if _, err := WaveletEdgeEnhancement(img, WaveletEnhanceOptions{Wavelet: haar, Levels: 2, Gain: -1}); err == nil {
+		t.Error("expected an error for a negative gain")
+	}
+}
@@ -0,0 +1,366 @@
+// Discrete wavelet transforms: Haar, Daubechies, symlet and biorthogonal 9/7 fast wavelet transforms in 2-D
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// WaveletFilter is a finite filter whose first coefficient is at index Start
+type WaveletFilter struct {
+	Coefficients []float64
+	Start        int
+}
+
+// Wavelet holds the four filters of a two-band filter bank. The analysis filters are
+// correlated with the signal at every other sample,
+//
+//	a(k) = sum_j AnalysisLow(j) x(2k + j),  d(k) = sum_j AnalysisHigh(j) x(2k + j),
+//
+// and the synthesis filters put it back together,
+//
+//	x(m) = sum_k a(k) SynthesisLow(m - 2k) + d(k) SynthesisHigh(m - 2k).
+//
+// For the orthonormal wavelets the synthesis filters are the analysis filters.
+type Wavelet struct {
+	Name          string
+	AnalysisLow   WaveletFilter
+	AnalysisHigh  WaveletFilter
+	SynthesisLow  WaveletFilter
+	SynthesisHigh WaveletFilter
+}
+
+// WaveletSubband names the four outputs of one level of the 2-D transform. The first
+// letter is the filter along x and the second the filter along y, so LowHigh holds
+// the horizontal edges.
+type WaveletSubband int
+
+const (
+	LowLow WaveletSubband = iota
+	HighLow
+	LowHigh
+	HighHigh
+)
+
+// WaveletDecomposition is a multi-level 2-D wavelet transform in the usual layout:
+// the approximation of the last level in the top left corner and the three detail
+// subbands of every level around it, the finest level in the outer quadrants.
+// Coefficients is indexed [x][y] and padded by mirroring to a multiple of 2^Levels
+// in each direction. Width and Height are the size of the original image.
+type WaveletDecomposition struct {
+	Wavelet      Wavelet
+	Levels       int
+	Width        int
+	Height       int
+	Coefficients [][]float64
+}
+
+func orthonormalWavelet(name string, scaling []float64) Wavelet {
+	// The filter bank of an orthonormal wavelet from its scaling filter h, with the
+	// wavelet filter g(n) = (-1)^n h(L - 1 - n) of Section 7.2.2 of DIP book
+	var high []float64 = make([]float64, len(scaling))
+	for index := range scaling {
+		high[index] = scaling[len(scaling)-1-index]
+		if index%2 == 1 {
+			high[index] = -high[index]
+		}
+	}
+	var low WaveletFilter = WaveletFilter{Coefficients: scaling}
+	var wavelet WaveletFilter = WaveletFilter{Coefficients: high}
+	return Wavelet{Name: name, AnalysisLow: low, AnalysisHigh: wavelet, SynthesisLow: low, SynthesisHigh: wavelet}
+}
+
+func NewWavelet(name string) (Wavelet, error) {
+	// The supported wavelets, named by their number of taps as in the book: haar,
+	// daubechies4 and daubechies8 (db2 and db4 in MATLAB), symlet8 (sym4) and
+	// biorthogonal97, the Cohen-Daubechies-Feauveau 9/7 wavelet of JPEG 2000
+	switch name {
+	case "haar":
+		return orthonormalWavelet(name, []float64{1 / math.Sqrt2, 1 / math.Sqrt2}), nil
+	case "daubechies4":
+		return orthonormalWavelet(name, []float64{
+			0.48296291314469025, 0.836516303737469, 0.22414386804185735, -0.12940952255092145,
+		}), nil
+	case "daubechies8":
+		return orthonormalWavelet(name, []float64{
+			0.23037781330885523, 0.7148465705525415, 0.6308807679295904, -0.02798376941698385,
+			-0.18703481171888114, 0.030841381835986965, 0.032883011666982945, -0.010597401784997278,
+		}), nil
+	case "symlet8":
+		return orthonormalWavelet(name, []float64{
+			0.0322231006040427, -0.012603967262037833, -0.09921954357684722, 0.29785779560527736,
+			0.8037387518059161, 0.49761866763201545, -0.02963552764599851, -0.07576571478927333,
+		}), nil
+	case "biorthogonal97":
+		// The analysis lowpass filter is centred on the even samples and the analysis
+		// highpass filter on the odd ones
+		return Wavelet{
+			Name: name,
+			AnalysisLow: WaveletFilter{Start: -4, Coefficients: []float64{
+				0.026748757410810, -0.016864118442875, -0.078223266528988, 0.266864118442872, 0.602949018236358,
+				0.266864118442872, -0.078223266528988, -0.016864118442875, 0.026748757410810,
+			}},
+			AnalysisHigh: WaveletFilter{Start: -2, Coefficients: []float64{
+				0.091271763114250, -0.057543526228500, -0.591271763114247, 1.115087052456994,
+				-0.591271763114247, -0.057543526228500, 0.091271763114250,
+			}},
+			SynthesisLow: WaveletFilter{Start: -3, Coefficients: []float64{
+				-0.091271763114250, -0.057543526228500, 0.591271763114247, 1.115087052456994,
+				0.591271763114247, -0.057543526228500, -0.091271763114250,
+			}},
+			SynthesisHigh: WaveletFilter{Start: -3, Coefficients: []float64{
+				0.026748757410810, 0.016864118442875, -0.078223266528988, -0.266864118442872, 0.602949018236358,
+				-0.266864118442872, -0.078223266528988, 0.016864118442875, 0.026748757410810,
+			}},
+		}, nil
+	}
+	return Wavelet{}, fmt.Errorf("unknown wavelet %q, use haar, daubechies4, daubechies8, symlet8 or biorthogonal97", name)
+}
+
+func wrapIndex(index int, length int) int {
+	// Periodic extension of the signal
+	index %= length
+	if index < 0 {
+		index += length
+	}
+	return index
+}
+
+func analysisStep(signal []float64, wavelet Wavelet) ([]float64, []float64) {
+	// One level of the 1-D fast wavelet transform of a signal of even length, extended
+	// periodically at its ends
+	var half int = len(signal) / 2
+	var approximation []float64 = make([]float64, half)
+	var detail []float64 = make([]float64, half)
+	for k := 0; k < half; k++ {
+		for index, coefficient := range wavelet.AnalysisLow.Coefficients {
+			approximation[k] += coefficient * signal[wrapIndex(2*k+wavelet.AnalysisLow.Start+index, len(signal))]
+		}
+		for index, coefficient := range wavelet.AnalysisHigh.Coefficients {
+			detail[k] += coefficient * signal[wrapIndex(2*k+wavelet.AnalysisHigh.Start+index, len(signal))]
+		}
+	}
+	return approximation, detail
+}
+
+func synthesisStep(approximation []float64, detail []float64, wavelet Wavelet) []float64 {
+	// The inverse of analysisStep, each coefficient adds its synthesis filter into the
+	// signal at twice its position
+	var signal []float64 = make([]float64, 2*len(approximation))
+	for k := range approximation {
+		for index, coefficient := range wavelet.SynthesisLow.Coefficients {
+			signal[wrapIndex(2*k+wavelet.SynthesisLow.Start+index, len(signal))] += coefficient * approximation[k]
+		}
+		for index, coefficient := range wavelet.SynthesisHigh.Coefficients {
+			signal[wrapIndex(2*k+wavelet.SynthesisHigh.Start+index, len(signal))] += coefficient * detail[k]
+		}
+	}
+	return signal
+}
+
+func transformBlock(values [][]float64, width int, height int, wavelet Wavelet, inverse bool) {
+	// One level of the separable 2-D transform of the top left width x height block,
+	// in place. Forward it filters along x and then along y, the inverse undoes the
+	// steps in the opposite order.
+	var alongX = func() {
+		var row []float64 = make([]float64, width)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				row[x] = values[x][y]
+			}
+			if inverse {
+				row = synthesisStep(row[:width/2], row[width/2:], wavelet)
+			} else {
+				approximation, detail := analysisStep(row, wavelet)
+				row = append(approximation, detail...)
+			}
+			for x := 0; x < width; x++ {
+				values[x][y] = row[x]
+			}
+		}
+	}
+	var alongY = func() {
+		for x := 0; x < width; x++ {
+			var column []float64 = values[x][:height]
+			if inverse {
+				copy(column, synthesisStep(column[:height/2], column[height/2:], wavelet))
+			} else {
+				approximation, detail := analysisStep(column, wavelet)
+				copy(column, append(approximation, detail...))
+			}
+		}
+	}
+	if inverse {
+		alongY()
+		alongX()
+	} else {
+		alongX()
+		alongY()
+	}
+}
+
+func mirrorIndex(index int, length int) int {
+	// Whole-sample symmetric extension, ... 2 1 0 1 2 ... at the start
+	if length == 1 {
+		return 0
+	}
+	var period int = 2 * (length - 1)
+	index = wrapIndex(index, period)
+	if index >= length {
+		index = period - index
+	}
+	return index
+}
+
+func WaveletTransform(img image.Image, wavelet Wavelet, levels int) (WaveletDecomposition, error) {
+	// This is from Section 7.5 of DIP book
+	// The 2-D fast wavelet transform, each level splits the previous approximation into
+	// a half size approximation and horizontal, vertical and diagonal details
+	var decomposition WaveletDecomposition = WaveletDecomposition{Wavelet: wavelet, Levels: levels}
+	if levels < 1 {
+		return decomposition, fmt.Errorf("levels must be at least 1, got %d", levels)
+	}
+	var levelsOfImage [][]uint8 = imageToLevels(img)
+	if len(levelsOfImage) == 0 || len(levelsOfImage[0]) == 0 {
+		return decomposition, fmt.Errorf("empty image")
+	}
+	decomposition.Width, decomposition.Height = len(levelsOfImage), len(levelsOfImage[0])
+
+	// Mirror the image out to a multiple of 2^levels so every level halves exactly
+	var block int = 1 << levels
+	var width int = (decomposition.Width + block - 1) / block * block
+	var height int = (decomposition.Height + block - 1) / block * block
+	decomposition.Coefficients = newFloats(width, height)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			level := levelsOfImage[mirrorIndex(x, decomposition.Width)][mirrorIndex(y, decomposition.Height)]
+			decomposition.Coefficients[x][y] = float64(level)
+		}
+	}
+
+	for level := 0; level < levels; level++ {
+		transformBlock(decomposition.Coefficients, width>>level, height>>level, wavelet, false)
+	}
+	return decomposition, nil
+}
+
+func InverseWaveletTransformFloats(decomposition WaveletDecomposition) ([][]float64, error) {
+	// The values of the original image size reconstructed from the coefficients, not
+	// rounded, so that processing the coefficients can be measured precisely
+	if len(decomposition.Coefficients) == 0 || len(decomposition.Coefficients[0]) == 0 {
+		return nil, fmt.Errorf("empty wavelet decomposition")
+	}
+	var width int = len(decomposition.Coefficients)
+	var height int = len(decomposition.Coefficients[0])
+	if decomposition.Levels < 1 || width%(1<<decomposition.Levels) != 0 || height%(1<<decomposition.Levels) != 0 {
+		return nil, fmt.Errorf("%dx%d coefficients do not fit %d levels", width, height, decomposition.Levels)
+	}
+	if decomposition.Width > width || decomposition.Height > height {
+		return nil, fmt.Errorf("image size %dx%d is larger than the coefficients", decomposition.Width, decomposition.Height)
+	}
+
+	var values [][]float64 = newFloats(width, height)
+	for x := range values {
+		copy(values[x], decomposition.Coefficients[x])
+	}
+	for level := decomposition.Levels - 1; level >= 0; level-- {
+		transformBlock(values, width>>level, height>>level, decomposition.Wavelet, true)
+	}
+
+	values = values[:decomposition.Width]
+	for x := range values {
+		values[x] = values[x][:decomposition.Height]
+	}
+	return values, nil
+}
+
+func InverseWaveletTransform(decomposition WaveletDecomposition) (image.Image, error) {
+	values, err := InverseWaveletTransformFloats(decomposition)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return floatsToLevelImage(values)
+}
+
+func (decomposition WaveletDecomposition) SubbandBounds(level int, subband WaveletSubband) (image.Rectangle, error) {
+	// Where a subband sits in Coefficients. Level 1 is the finest, and LowLow only
+	// exists for the last level, Levels.
+	if level < 1 || level > decomposition.Levels {
+		return image.Rectangle{}, fmt.Errorf("level must be between 1 and %d, got %d", decomposition.Levels, level)
+	}
+	if subband == LowLow && level != decomposition.Levels {
+		return image.Rectangle{}, fmt.Errorf("only level %d has an approximation", decomposition.Levels)
+	}
+	var width int = len(decomposition.Coefficients) >> level
+	var height int = len(decomposition.Coefficients[0]) >> level
+	var corner image.Point
+	switch subband {
+	case LowLow:
+	case HighLow:
+		corner = image.Point{width, 0}
+	case LowHigh:
+		corner = image.Point{0, height}
+	case HighHigh:
+		corner = image.Point{width, height}
+	default:
+		return image.Rectangle{}, fmt.Errorf("unknown subband %d", subband)
+	}
+	return image.Rectangle{corner, corner.Add(image.Point{width, height})}, nil
+}
+
+func WaveletDecompositionImage(decomposition WaveletDecomposition) (image.Image, error) {
+	// Shows every subband in its place. The approximation is scaled to the full range
+	// and each detail subband to mid grey plus or minus its largest magnitude, so that
+	// zero detail is grey as in the figures of the book.
+	if len(decomposition.Coefficients) == 0 || len(decomposition.Coefficients[0]) == 0 {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), fmt.Errorf("empty wavelet decomposition")
+	}
+	var levels [][]uint8 = newLevels(len(decomposition.Coefficients), len(decomposition.Coefficients[0]))
+	var draw = func(bounds image.Rectangle, detail bool) {
+		var minimum, maximum float64 = math.Inf(1), math.Inf(-1)
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				value := decomposition.Coefficients[x][y]
+				if detail {
+					value = math.Abs(value)
+				}
+				minimum, maximum = math.Min(minimum, value), math.Max(maximum, value)
+			}
+		}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				value := decomposition.Coefficients[x][y]
+				switch {
+				case detail && maximum > 0:
+					levels[x][y] = clampLevel(int(math.Round(128 + 127*value/maximum)))
+				case detail:
+					levels[x][y] = 128
+				case maximum > minimum:
+					levels[x][y] = clampLevel(int(math.Round(255 * (value - minimum) / (maximum - minimum))))
+				}
+			}
+		}
+	}
+
+	for level := 1; level <= decomposition.Levels; level++ {
+		for _, subband := range []WaveletSubband{HighLow, LowHigh, HighHigh} {
+			bounds, err := decomposition.SubbandBounds(level, subband)
+			if err != nil {
+				return image.NewGray(image.Rect(0, 0, 1, 1)), err
+			}
+			draw(bounds, true)
+		}
+	}
+	bounds, err := decomposition.SubbandBounds(decomposition.Levels, LowLow)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	draw(bounds, false)
+
+	newImage, err := levelsToImage(levels)
+	if err != nil {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), err
+	}
+	return newImage, nil
+}
@@ -0,0 +1,160 @@
+package pkg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func createWaveletTestImage(width int, height int) *image.Gray {
+	// A smooth ramp with a bright square and some fine pattern, so every subband has detail
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			level := 40 + 3*x + 2*y + (x*y*7)%23
+			if x > width/3 && x < 2*width/3 && y > height/3 && y < 2*height/3 {
+				level += 80
+			}
+			img.SetGray(x, y, color.Gray{clampLevel(level)})
+		}
+	}
+	return img
+}
+
+func TestWaveletPerfectReconstruction(t *testing.T) {
+	img := createWaveletTestImage(37, 23)
+	for _, name := range []string{"haar", "daubechies4", "daubechies8", "symlet8", "biorthogonal97"} {
+		wavelet, err := NewWavelet(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, levels := range []int{1, 3} {
+			decomposition, err := WaveletTransform(img, wavelet, levels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Padded to a multiple of 2^levels
+			block := 1 << levels
+			if len(decomposition.Coefficients)%block != 0 || len(decomposition.Coefficients[0])%block != 0 {
+				t.Errorf("%s: coefficients are %dx%d", name, len(decomposition.Coefficients), len(decomposition.Coefficients[0]))
+			}
+			values, err := InverseWaveletTransformFloats(decomposition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(values) != 37 || len(values[0]) != 23 {
+				t.Fatalf("%s: reconstruction is %dx%d, want 37x23", name, len(values), len(values[0]))
+			}
+			var worst float64 = 0
+			for x := range values {
+				for y := range values[x] {
+					worst = math.Max(worst, math.Abs(values[x][y]-float64(img.GrayAt(x, y).Y)))
+				}
+			}
+			if worst > 1e-8 {
+				t.Errorf("%s with %d levels: largest reconstruction error %v", name, levels, worst)
+			}
+		}
+	}
+}
+
+func TestHaarWaveletCoefficients(t *testing.T) {
+	haar, err := NewWavelet("haar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A constant image has no detail, and each level scales the approximation by 2
+	constant := createTestImage(4, 4, []uint8{10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10})
+	decomposition, err := WaveletTransform(constant, haar, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := range decomposition.Coefficients {
+		for y, value := range decomposition.Coefficients[x] {
+			expected := 0.0
+			if x == 0 && y == 0 {
+				expected = 40
+			}
+			if math.Abs(value-expected) > 1e-9 {
+				t.Errorf("coefficient (%d, %d) = %v, want %v", x, y, value, expected)
+			}
+		}
+	}
+
+	// A vertical edge only shows up in the HighLow subband
+	edge := createTestImage(2, 2, []uint8{0, 8, 0, 8})
+	decomposition, err = WaveletTransform(edge, haar, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]float64{{8, 0}, {-8, 0}}
+	for x := range expected {
+		for y := range expected[x] {
+			if math.Abs(decomposition.Coefficients[x][y]-expected[x][y]) > 1e-9 {
+				t.Errorf("coefficients = %v, want %v", decomposition.Coefficients, expected)
+			}
+		}
+	}
+}
+
+func TestSubbandBounds(t *testing.T) {
+	haar, err := NewWavelet("haar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decomposition, err := WaveletTransform(createWaveletTestImage(16, 8), haar, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		level    int
+		subband  WaveletSubband
+		expected image.Rectangle
+	}{
+		{1, HighLow, image.Rect(8, 0, 16, 4)},
+		{1, LowHigh, image.Rect(0, 4, 8, 8)},
+		{1, HighHigh, image.Rect(8, 4, 16, 8)},
+		{2, LowLow, image.Rect(0, 0, 4, 2)},
+		{2, HighHigh, image.Rect(4, 2, 8, 4)},
+	}
+	for _, c := range cases {
+		bounds, err := decomposition.SubbandBounds(c.level, c.subband)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bounds != c.expected {
+			t.Errorf("level %d subband %d = %v, want %v", c.level, c.subband, bounds, c.expected)
+		}
+	}
+	if _, err := decomposition.SubbandBounds(1, LowLow); err == nil {
+		t.Error("expected an error for the approximation of an inner level")
+	}
+	if _, err := decomposition.SubbandBounds(3, HighLow); err == nil {
+		t.Error("expected an error for a level beyond the decomposition")
+	}
+
+	layout, err := WaveletDecompositionImage(decomposition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Bounds() != image.Rect(0, 0, 16, 8) {
+		t.Errorf("layout image is %v, want 16x8", layout.Bounds())
+	}
+}
+
+func TestWaveletErrors(t *testing.T) {
+	if _, err := NewWavelet("mexican_hat"); err == nil {
+		t.Error("expected an error for an unknown wavelet")
+	}
+	haar, err := NewWavelet("haar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WaveletTransform(createWaveletTestImage(4, 4), haar, 0); err == nil {
+		t.Error("expected an error for zero levels")
+	}
+	if _, err := InverseWaveletTransform(WaveletDecomposition{Wavelet: haar, Levels: 1}); err == nil {
+		t.Error("expected an error for an empty decomposition")
+	}
+}
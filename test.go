@@ -2,10 +2,12 @@ package main
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"image"
 	"log"
+	"math"
 	"strings"
 
 	"os"
@@ -18,6 +20,9 @@ import (
 	"github.com/jitendraag/loomis/pkg"
 )
 
+// How saveOutputImage encodes images, from the -format, -jpeg_quality and -plain flags
+var outputOptions pkg.SaveOptions
+
 func main() {
 	// TODO: ideally all new commands should self document
 	var command = flag.String("command", "histgray", "Command to execute, possible options: histgray, intensity_levels, log_transformation")
@@ -27,6 +32,105 @@ func main() {
 	var gamma = flag.Float64("gamma", 2.5, "Gamma for power law")
 	var numberOfBits = flag.Uint("bits", 2, "Number of bits to set to zero")
 	var bitNumber = flag.Uint("bit", 2, "Exact bit to set to zero")
+	var elementShape = flag.String("se", "square", "Structuring element shape: square, disk, cross, line")
+	var elementSize = flag.Int("size", 3, "Structuring element size (radius for disk, length for line)")
+	var angle = flag.Float64("angle", 0, "Angle in degrees for line structuring element")
+	var secondSize = flag.Int("size2", 10, "Second structuring element size (gap radius for textural segmentation)")
+	var iterations = flag.Int("iterations", 0, "Iterations for thinning and thickening (0 until convergence) and branch length for pruning (0 for 3)")
+	var seedX = flag.Int("x", 0, "Seed x coordinate")
+	var seedY = flag.Int("y", 0, "Seed y coordinate")
+
+	var classes = flag.Int("classes", 3, "Number of classes for multi-level Otsu thresholding")
+	var deltaT = flag.Float64("delta", 0.5, "Convergence limit for basic global thresholding")
+	var smooth = flag.Bool("smooth", false, "Smooth the image and threshold the smoothed image")
+	var edgePercentile = flag.Float64("edge_percentile", 0, "Only use pixels above this edge strength percentile for thresholding (0 to disable)")
+
+	var window = flag.Int("window", 15, "Window size for local thresholding")
+	var k = flag.Float64("k", -0.2, "k for Niblack and Sauvola thresholding (0.5 for Sauvola when unset)")
+	var r = flag.Float64("r", 128, "Standard deviation range R for Sauvola thresholding")
+	var a = flag.Float64("a", 30, "Standard deviation multiplier a for variable thresholding")
+	var b = flag.Float64("b", 1.5, "Mean multiplier b for variable and moving average thresholding (0.5 for moving average when unset)")
+	var globalMean = flag.Bool("global_mean", false, "Use the global mean for variable thresholding")
+	var n = flag.Int("n", 20, "Number of points in the moving average")
+	var partitions = flag.Int("partitions", 2, "Number of partitions along each axis for partition thresholding")
+
+	var operator = flag.String("operator", "sobel", "Gradient operator: sobel, prewitt, roberts, scharr, kirsch")
+	var l1 = flag.Bool("l1", false, "Use the |gx| + |gy| approximation of the gradient magnitude")
+
+	var sigma = flag.Float64("sigma", 2, "Standard deviation of the Gaussian smoothing")
+	var low = flag.Float64("low", 0, "Low threshold as a fraction of the maximum magnitude (0 for automatic)")
+	var high = flag.Float64("high", 0, "High threshold as a fraction of the maximum magnitude (0 for automatic)")
+	var sigma2 = flag.Float64("sigma2", 0, "Second standard deviation for the difference of Gaussians (0 for sigma / 1.6)")
+	var threshold = flag.Float64("threshold", 0.04, "Zero crossing threshold as a fraction of the maximum response")
+
+	var peaks = flag.Int("peaks", 10, "Maximum number of Hough transform detections")
+	var thetaStep = flag.Float64("theta_step", 1, "Theta resolution of the line Hough transform in degrees")
+	var rhoStep = flag.Float64("rho_step", 1, "Rho resolution of the line Hough transform in pixels")
+	var fillGap = flag.Float64("fill_gap", 20, "Largest gap bridged within a Hough line segment")
+	var minLength = flag.Float64("min_length", 40, "Shortest Hough line segment kept")
+	var minRadius = flag.Int("min_radius", 10, "Smallest circle radius for the circle Hough transform")
+	var maxRadius = flag.Int("max_radius", 30, "Largest circle radius for the circle Hough transform")
+	var coverage = flag.Float64("coverage", 0.5, "Fraction of a circle that must be on edges to be detected")
+	var templateFileName = flag.String("template", "", "Template image for the generalised Hough transform")
+	var accumulatorFileName = flag.String("accumulator", "", "Also save the Hough accumulator to this file")
+
+	var similarity = flag.Float64("similarity", 20, "Largest difference from the seed for region growing")
+	var uniformity = flag.Float64("uniformity", 10, "Largest standard deviation of a uniform region for split and merge")
+	var depth = flag.Int("depth", 10, "Smallest depth of a regional minimum used as a watershed marker")
+
+	var connectivity = flag.Int("connectivity", 8, "Pixel connectivity for connected components: 4 or 8")
+	var minArea = flag.Int("min_area", 0, "Smallest connected component area kept")
+	var maxArea = flag.Int("max_area", 0, "Largest connected component area kept (0 for no limit)")
+
+	var directions = flag.Int("directions", 8, "Chain code directions: 4 or 8")
+	var cellSize = flag.Int("cell_size", 4, "Cell size for the minimum-perimeter polygon")
+	var jsonFileName = flag.String("json", "", "Save the boundary descriptions or region descriptors as JSON to this file")
+
+	var fourier = flag.Int("fourier", 10, "Number of normalised Fourier descriptors per region")
+	var signature = flag.Int("signature", 0, "Number of angles in the distance signature per region (0 to leave out)")
+	var csvFileName = flag.String("csv", "", "Save the region descriptors as CSV to this file")
+
+	var grayLevels = flag.Int("gray_levels", 8, "Number of grey levels in the co-occurrence matrices")
+	var distance = flag.Int("distance", 1, "Distance between the pixels of a co-occurring pair")
+	var angles = flag.String("angles", "0,45,90,135", "Comma separated co-occurrence directions in degrees")
+	var regions = flag.Bool("regions", false, "Describe the texture of every connected component instead of the whole image")
+
+	var bandFileNames = flag.String("bands", "", "Comma separated grey level images stacked as the bands for principal components (default the colour bands of the input)")
+	var components = flag.Int("components", 1, "Number of principal components kept, or the component to save")
+
+	var method = flag.String("method", "zncc", "Template matching method: ssd, sad, cc, zncc")
+	var score = flag.Float64("score", 0.8, "Lowest score of a template match for cc and zncc, highest for ssd and sad")
+	var overlap = flag.Float64("overlap", 0.3, "Largest overlap, as intersection over union, between two template matches")
+	var scoresFileName = flag.String("scores", "", "Also save the template matching score map to this file")
+
+	var class = flag.String("class", "", "Class of the patterns extracted from the input image")
+	var patternFileNames = flag.String("patterns", "", "Comma separated JSON files of labelled patterns")
+	var classifierType = flag.String("classifier", "minimum_distance", "Classifier: minimum_distance, correlation, bayes")
+	var modelFileName = flag.String("model", "classifier.json", "JSON file the trained classifier is saved to or loaded from")
+
+	var waveletName = flag.String("wavelet", "haar", "Wavelet: haar, daubechies4, daubechies8, symlet8, biorthogonal97")
+	var scales = flag.Int("scales", 3, "Number of wavelet decomposition levels or pyramid levels")
+	var shrinkage = flag.String("shrinkage", "bayes", "Wavelet shrinkage threshold: visu, bayes")
+	var rule = flag.String("rule", "soft", "Wavelet thresholding rule: soft, hard")
+	var noiseSigma = flag.Float64("noise_sigma", 0, "Standard deviation of the noise (0 to estimate it per level)")
+	var gain = flag.Float64("gain", 2, "Gain of the wavelet detail coefficients for edge enhancement")
+	var noiseThreshold = flag.Float64("noise_threshold", 3, "Wavelet detail coefficients below this many noise standard deviations are not enhanced")
+	var referenceFileName = flag.String("ref", "", "Reference image to compare the result or the input with")
+
+	var mask = flag.String("mask", "quantisation", "Transform coding mask: zonal, threshold, quantisation")
+	var quality = flag.Int("quality", 50, "Quality from 1 to 100 that scales the JPEG quantisation table")
+	var coefficients = flag.Int("coefficients", 8, "Coefficients kept per block by the zonal and threshold masks")
+	var blockSize = flag.Int("block", 8, "Block size for transform coding")
+
+	var coder = flag.String("coder", "all", "Lossless coder: huffman, arithmetic, lzw, run_length, run_length_2d, bit_plane, gray_bit_plane or all")
+	var grayCode = flag.Bool("gray_code", false, "Take the bit plane from the Gray code of the levels")
+	var predictorName = flag.String("predictor", "med", "Predictor: previous, above, average, planar, med, or all for predictive coding")
+	var quantiserName = flag.String("quantiser", "lloyd_max", "DPCM quantiser: lloyd_max with -levels levels, or delta for delta modulation")
+	var zeta = flag.Float64("zeta", 6.5, "Step of the delta modulation quantiser")
+
+	var outputFormat = flag.String("format", "", "Output format: png, jpeg, gif, bmp, tiff, pgm, ppm, pbm, pam (default from the output file extension)")
+	var jpegQuality = flag.Int("jpeg_quality", 75, "Quality from 1 to 100 of JPEG output")
+	var plain = flag.Bool("plain", false, "Write PBM, PGM and PPM output in the plain ASCII variants")
 
 	var help = flag.Bool("help", false, "Show help")
 
@@ -36,6 +140,11 @@ func main() {
 		flag.Usage()
 		os.Exit(0)
 	}
+	outputOptions = pkg.SaveOptions{Format: pkg.ImageFormat(*outputFormat), Quality: *jpegQuality, Plain: *plain}
+
+	// Flags given on the command line, for those whose default depends on the command
+	var explicitFlags map[string]bool = map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicitFlags[f.Name] = true })
 
 	// fmt.Printf("%v, %v, %v", *command, *inputFileName, *outputFileName)
 
@@ -53,6 +162,8 @@ func main() {
 		testBitPlaneSlicing(uint8(*numberOfBits), *inputFileName, *outputFileName)
 	case "bitnumber_slicing":
 		testBitPlaneSlicingBitNumber(uint8(*bitNumber), *inputFileName, *outputFileName)
+	case "bit_plane":
+		testBitPlane(uint8(*bitNumber), *grayCode, *inputFileName, *outputFileName)
 	case "histequalisation":
 		testHistogramEqualisation(*inputFileName, *outputFileName)
 	case "histnormal":
@@ -83,6 +194,112 @@ func main() {
 		testGaussianPdf()
 	case "rayleigh_pdf":
 		testRayleighPdf()
+	case "binary_erosion", "binary_dilation", "binary_opening", "binary_closing",
+		"gray_erosion", "gray_dilation", "gray_opening", "gray_closing":
+		testMorphology(*command, *elementShape, *elementSize, *angle, *inputFileName, *outputFileName)
+	case "boundary_extraction":
+		testBoundaryExtraction(*elementShape, *elementSize, *angle, *inputFileName, *outputFileName)
+	case "hole_filling":
+		testHoleFilling(*seedX, *seedY, *inputFileName, *outputFileName)
+	case "thinning":
+		testThinning(*iterations, *inputFileName, *outputFileName)
+	case "thickening":
+		testThickening(*iterations, *inputFileName, *outputFileName)
+	case "skeleton":
+		testSkeleton(*elementShape, *elementSize, *angle, *inputFileName, *outputFileName)
+	case "pruning":
+		testPruning(*iterations, *inputFileName, *outputFileName)
+	case "convex_hull":
+		testConvexHull(*inputFileName, *outputFileName)
+	case "tophat", "bottomhat", "morph_gradient", "opening_reconstruction", "closing_reconstruction":
+		testGrayscaleMorphology(*command, *elementShape, *elementSize, *angle, *iterations, *inputFileName, *outputFileName)
+	case "tophat_equalisation":
+		testTopHatEqualisation(*elementShape, *elementSize, *angle, *inputFileName, *outputFileName)
+	case "fill_holes":
+		testFillHoles(*inputFileName, *outputFileName)
+	case "clear_border":
+		testClearBorder(*inputFileName, *outputFileName)
+	case "granulometry":
+		testGranulometry(*elementSize, *inputFileName)
+	case "textural_segmentation":
+		testTexturalSegmentation(*elementSize, *secondSize, *inputFileName, *outputFileName)
+	case "basic_threshold", "otsu", "multi_otsu":
+		testGlobalThreshold(*command, *deltaT, *classes, pkg.ThresholdOptions{Smooth: *smooth, EdgePercentile: *edgePercentile}, *inputFileName, *outputFileName)
+	case "variable_threshold", "niblack", "sauvola", "moving_average_threshold", "partition_threshold":
+		// Sauvola needs a positive k and the book's moving average example uses b = 0.5
+		if *command == "sauvola" && !explicitFlags["k"] {
+			*k = 0.5
+		}
+		if *command == "moving_average_threshold" && !explicitFlags["b"] {
+			*b = 0.5
+		}
+		testLocalThreshold(*command, *window, *k, *r, *a, *b, *globalMean, *n, *partitions, *inputFileName, *outputFileName)
+	case "gradient_magnitude", "gradient_direction", "gradient_x", "gradient_y":
+		testGradient(*command, *operator, *l1, *inputFileName, *outputFileName)
+	case "canny":
+		testCanny(*sigma, *low, *high, *inputFileName, *outputFileName)
+	case "marr_hildreth":
+		testMarrHildreth(*sigma, *threshold, *inputFileName, *outputFileName)
+	case "log":
+		testLaplacianOfGaussian(*sigma, *inputFileName, *outputFileName)
+	case "dog":
+		testDifferenceOfGaussians(*sigma, *sigma2, *inputFileName, *outputFileName)
+	case "hough_lines":
+		testHoughLines(*sigma, *thetaStep, *rhoStep, *peaks, *fillGap, *minLength, *inputFileName, *outputFileName, *accumulatorFileName)
+	case "hough_circles":
+		testHoughCircles(*sigma, *minRadius, *maxRadius, *peaks, *coverage, *inputFileName, *outputFileName, *accumulatorFileName)
+	case "generalised_hough":
+		testGeneralisedHough(*sigma, *peaks, *templateFileName, *inputFileName, *outputFileName, *accumulatorFileName)
+	case "region_growing":
+		testRegionGrowing(*seedX, *seedY, *similarity, *inputFileName, *outputFileName)
+	case "split_merge":
+		testSplitAndMerge(*uniformity, *elementSize, *inputFileName, *outputFileName)
+	case "watershed":
+		testWatershed(*depth, *inputFileName, *outputFileName)
+	case "separate_blobs":
+		testSeparateTouchingBlobs(*depth, *inputFileName, *outputFileName)
+	case "components":
+		testConnectedComponents(*connectivity, *minArea, *maxArea, *inputFileName, *outputFileName)
+	case "boundaries":
+		testBoundaries(*minArea, *directions, *cellSize, *inputFileName, *outputFileName, *jsonFileName)
+	case "descriptors":
+		testRegionDescriptors(*minArea, *fourier, *signature, *inputFileName, *outputFileName, *jsonFileName, *csvFileName)
+	case "texture":
+		testTexture(*grayLevels, *distance, *angles, *regions, *minArea, *inputFileName, *jsonFileName)
+	case "pca":
+		testPrincipalComponents(*bandFileNames, *components, *inputFileName, *outputFileName)
+	case "principal_component":
+		testPrincipalComponentImage(*bandFileNames, *components, *inputFileName, *outputFileName)
+	case "template_match":
+		testTemplateMatching(*method, *peaks, *score, *overlap, *templateFileName, *inputFileName, *outputFileName, *scoresFileName)
+	case "patterns":
+		testPatterns(*class, *minArea, *inputFileName, *jsonFileName)
+	case "train_classifier":
+		testTrainClassifier(*classifierType, *patternFileNames, *modelFileName)
+	case "evaluate_classifier":
+		testEvaluateClassifier(*patternFileNames, *modelFileName)
+	case "wavelet":
+		testWavelet(*waveletName, *scales, *inputFileName, *outputFileName)
+	case "wavelet_denoise":
+		testWaveletDenoise(*waveletName, *scales, *shrinkage, *rule, *noiseSigma, *inputFileName, *outputFileName, *referenceFileName)
+	case "wavelet_enhance":
+		testWaveletEnhance(*waveletName, *scales, *gain, *noiseThreshold, *inputFileName, *outputFileName)
+	case "wavelet_edges":
+		testWaveletEdges(*waveletName, *scales, *inputFileName, *outputFileName)
+	case "transform_coding":
+		testTransformCoding(*mask, *quality, *coefficients, *blockSize, *inputFileName, *outputFileName)
+	case "lossless_coding":
+		testLosslessCoding(*coder, *inputFileName)
+	case "compare":
+		testCompare(*inputFileName, *referenceFileName, *outputFileName)
+	case "predictive_coding":
+		testPredictiveCoding(*predictorName, *inputFileName, *outputFileName)
+	case "dpcm":
+		testDPCM(*predictorName, *quantiserName, int(*levels), *zeta, *inputFileName, *outputFileName)
+	case "gaussian_pyramid":
+		testPyramid(false, *scales, *inputFileName, *outputFileName)
+	case "laplacian_pyramid":
+		testPyramid(true, *scales, *inputFileName, *outputFileName)
 	default:
 		flag.Usage()
 	}
@@ -131,15 +348,7 @@ func testIntensityLevels(levelCount int, inputFileName string, outputFileName st
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
-	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
-	}
-	defer out.Close()
-
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
-	}
+	saveOutputImage(newImage, outputFileName)
 }
 
 func testLogTransformation(constant int, inputFileName string, outputFileName string) {
@@ -150,15 +359,7 @@ func testLogTransformation(constant int, inputFileName string, outputFileName st
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
-	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
-	}
-	defer out.Close()
-
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
-	}
+	saveOutputImage(newImage, outputFileName)
 }
 
 func testPowerLawTransformation(constant float64, gamma float64, inputFileName string, outputFileName string) {
@@ -169,15 +370,7 @@ func testPowerLawTransformation(constant float64, gamma float64, inputFileName s
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
-	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
-	}
-	defer out.Close()
-
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
-	}
+	saveOutputImage(newImage, outputFileName)
 }
 
 func testBitPlaneSlicing(numberOfBits uint8, inputFileName string, outputFileName string) {
@@ -188,15 +381,7 @@ func testBitPlaneSlicing(numberOfBits uint8, inputFileName string, outputFileNam
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
-	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
-	}
-	defer out.Close()
-
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
-	}
+	saveOutputImage(newImage, outputFileName)
 }
 
 func testBitPlaneSlicingBitNumber(bitNumber uint8, inputFileName string, outputFileName string) {
@@ -207,15 +392,7 @@ func testBitPlaneSlicingBitNumber(bitNumber uint8, inputFileName string, outputF
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
-	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
-	}
-	defer out.Close()
-
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
-	}
+	saveOutputImage(newImage, outputFileName)
 }
 
 func testHistogramEqualisation(inputFileName string, outputFileName string) {
@@ -226,15 +403,7 @@ func testHistogramEqualisation(inputFileName string, outputFileName string) {
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
-	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
-	}
-	defer out.Close()
-
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
-	}
+	saveOutputImage(newImage, outputFileName)
 }
 
 func testNormalisedHistogram(inputFileName string) {
@@ -255,229 +424,1400 @@ func testConvertToGrayscale(inputFileName string, outputFileName string) {
 		log.Fatalf("Failed to convert image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testSmoothingSpatialFilter(inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.SmoothingSpatialFilter(img, pkg.ThreeByThreeWeighted)
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testNonlinearSmoothingSpatialFilter(inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.NonlinearSmoothingSpatialFilter(img, 5, pkg.MaxOrder)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
 	}
+
+	saveOutputImage(newImage, outputFileName)
 }
 
-func testSmoothingSpatialFilter(inputFileName string, outputFileName string) {
+func testGaussianSpatialFilter(inputFileName string, outputFileName string) {
 	img := pkg.FileNameToImage(inputFileName)
 
-	newImage, err := pkg.SmoothingSpatialFilter(img, pkg.ThreeByThreeWeighted)
+	newImage, err := pkg.GaussianSpatialFilter(img, pkg.GaussianFiveByFiveSigmaOne)
 	if err != nil {
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testLaplacian(inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.Laplacian(img, pkg.LaplacianMask4)
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testScaledLaplacian(inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.ScaledLaplacian(img, pkg.LaplacianMask1)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
 	}
+
+	saveOutputImage(newImage, outputFileName)
 }
 
-func testNonlinearSmoothingSpatialFilter(inputFileName string, outputFileName string) {
+func testScaledLaplacianMaskAddition(inputFileName string, outputFileName string) {
 	img := pkg.FileNameToImage(inputFileName)
 
-	newImage, err := pkg.NonlinearSmoothingSpatialFilter(img, 5, pkg.MaxOrder)
+	newImage, err := pkg.ScaledLaplacianMaskAddition(img, pkg.LaplacianMask1)
 	if err != nil {
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testUnsharpMasking(inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.UnsharpMasking(img, 1.0)
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testUnsharpMaskingScaled(inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.UnsharpMaskingScaled(img, 1.0)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
 	}
+
+	saveOutputImage(newImage, outputFileName)
 }
 
-func testGaussianSpatialFilter(inputFileName string, outputFileName string) {
+func testGradientFilter(levels int, inputFileName string, outputFileName string) {
 	img := pkg.FileNameToImage(inputFileName)
+	var newImage image.Image
+	var err error
+
+	// TODO, find a better way to specify these operators
+	switch levels {
+	case 1:
+		newImage, err = pkg.GradientFilter(img, pkg.SobelOperator1)
+	case 2:
+		newImage, err = pkg.GradientFilter(img, pkg.SobelOperator2)
+	case 3:
+		newImage, err = pkg.GradientFilter(img, pkg.RobertsCrossOperator1)
+	case 4:
+		newImage, err = pkg.GradientFilter(img, pkg.RobertsCrossOperator2)
+	default:
+		fmt.Printf("Only values 1-4 are supported for gradient filter.")
+		newImage = img
+	}
 
-	newImage, err := pkg.GaussianSpatialFilter(img, pkg.GaussianFiveByFiveSigmaOne)
 	if err != nil {
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testDiscreetFourierTransform(inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.DiscreetFourierTransform(img)
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testGaussianPdf() {
+	pdf := pkg.GaussianPdf(128, 20)
+	fmt.Printf("PDF: %v", pdf)
+}
+
+func testRayleighPdf() {
+	pdf := pkg.RayleighPdf(0, 0.4)
+	fmt.Printf("PDF: %v", pdf)
+}
+
+func saveOutputImage(newImage image.Image, outputFileName string) {
+	// In the format of the file extension unless -format gives one
+	if err := pkg.SaveImage(outputFileName, newImage, outputOptions); err != nil {
+		log.Fatalf("Failed to save image: %v", err)
 	}
 }
 
-func testLaplacian(inputFileName string, outputFileName string) {
+func structuringElement(shape string, size int, angle float64) pkg.StructuringElement {
+	var element pkg.StructuringElement
+	var err error
+
+	switch shape {
+	case "square":
+		element, err = pkg.SquareStructuringElement(size)
+	case "disk":
+		element, err = pkg.DiskStructuringElement(size)
+	case "cross":
+		element, err = pkg.CrossStructuringElement(size)
+	case "line":
+		element, err = pkg.LineStructuringElement(size, angle)
+	default:
+		log.Fatalf("Unknown structuring element: %v", shape)
+	}
+	if err != nil {
+		log.Fatalf("Failed to create structuring element: %v", err)
+	}
+	return element
+}
+
+func testMorphology(operation string, shape string, size int, angle float64, inputFileName string, outputFileName string) {
 	img := pkg.FileNameToImage(inputFileName)
+	element := structuringElement(shape, size, angle)
+	var newImage image.Image
+	var err error
 
-	newImage, err := pkg.Laplacian(img, pkg.LaplacianMask4)
+	switch operation {
+	case "binary_erosion":
+		newImage, err = pkg.BinaryErosion(img, element)
+	case "binary_dilation":
+		newImage, err = pkg.BinaryDilation(img, element)
+	case "binary_opening":
+		newImage, err = pkg.BinaryOpening(img, element)
+	case "binary_closing":
+		newImage, err = pkg.BinaryClosing(img, element)
+	case "gray_erosion":
+		newImage, err = pkg.GrayscaleErosion(img, element)
+	case "gray_dilation":
+		newImage, err = pkg.GrayscaleDilation(img, element)
+	case "gray_opening":
+		newImage, err = pkg.GrayscaleOpening(img, element)
+	case "gray_closing":
+		newImage, err = pkg.GrayscaleClosing(img, element)
+	}
 	if err != nil {
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testBoundaryExtraction(shape string, size int, angle float64, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.BoundaryExtraction(img, structuringElement(shape, size, angle))
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
-	}
+	saveOutputImage(newImage, outputFileName)
 }
 
-func testScaledLaplacian(inputFileName string, outputFileName string) {
+func testHoleFilling(seedX int, seedY int, inputFileName string, outputFileName string) {
 	img := pkg.FileNameToImage(inputFileName)
 
-	newImage, err := pkg.ScaledLaplacian(img, pkg.LaplacianMask1)
+	newImage, err := pkg.HoleFilling(img, []image.Point{{seedX, seedY}})
 	if err != nil {
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testThinning(iterations int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.Thinning(img, iterations)
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testThickening(iterations int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.Thickening(img, iterations)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
 	}
+
+	saveOutputImage(newImage, outputFileName)
 }
 
-func testScaledLaplacianMaskAddition(inputFileName string, outputFileName string) {
+func testSkeleton(shape string, size int, angle float64, inputFileName string, outputFileName string) {
 	img := pkg.FileNameToImage(inputFileName)
 
-	newImage, err := pkg.ScaledLaplacianMaskAddition(img, pkg.LaplacianMask1)
+	newImage, skeleton, err := pkg.Skeletonise(img, structuringElement(shape, size, angle))
 	if err != nil {
 		log.Fatalf("Failed to process image: %v", err)
 	}
+	fmt.Printf("Skeleton subsets: %v\n", len(skeleton.Subsets))
+
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testPruning(iterations int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	// Pruning has no convergence, so the flag's default removes branches of up to 3 pixels
+	if iterations < 1 {
+		iterations = 3
+	}
 
-	out, err := os.Create(outputFileName)
+	newImage, err := pkg.Pruning(img, iterations)
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testConvexHull(inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.ConvexHull(img)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
 	}
+
+	saveOutputImage(newImage, outputFileName)
 }
 
-func testUnsharpMasking(inputFileName string, outputFileName string) {
+func testGrayscaleMorphology(operation string, shape string, size int, angle float64, iterations int, inputFileName string, outputFileName string) {
 	img := pkg.FileNameToImage(inputFileName)
+	element := structuringElement(shape, size, angle)
+	var newImage image.Image
+	var err error
 
-	newImage, err := pkg.UnsharpMasking(img, 1.0)
+	if iterations < 1 {
+		iterations = 1
+	}
+
+	switch operation {
+	case "tophat":
+		newImage, err = pkg.TopHat(img, element)
+	case "bottomhat":
+		newImage, err = pkg.BottomHat(img, element)
+	case "morph_gradient":
+		newImage, err = pkg.MorphologicalGradient(img, element)
+	case "opening_reconstruction":
+		newImage, err = pkg.OpeningByReconstruction(img, element, iterations)
+	case "closing_reconstruction":
+		newImage, err = pkg.ClosingByReconstruction(img, element, iterations)
+	}
 	if err != nil {
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testTopHatEqualisation(shape string, size int, angle float64, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	// Remove uneven illumination before spreading the histogram
+	topHat, err := pkg.TopHat(img, structuringElement(shape, size, angle))
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	newImage, err := pkg.HistogramEqualisation(topHat)
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testFillHoles(inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.FillHoles(img)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
 	}
+
+	saveOutputImage(newImage, outputFileName)
 }
 
-func testUnsharpMaskingScaled(inputFileName string, outputFileName string) {
+func testClearBorder(inputFileName string, outputFileName string) {
 	img := pkg.FileNameToImage(inputFileName)
 
-	newImage, err := pkg.UnsharpMaskingScaled(img, 1.0)
+	newImage, err := pkg.ClearBorder(img)
 	if err != nil {
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testGranulometry(maxRadius int, inputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	result, err := pkg.Granulometry(img, maxRadius)
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
+	fmt.Printf("Radii: %v\n", result.Radii)
+	fmt.Printf("Surface areas: %v\n", result.SurfaceAreas)
+	fmt.Printf("Differences: %v\n", result.Differences)
+}
+
+func testTexturalSegmentation(smallBlobRadius int, gapRadius int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	_, boundary, err := pkg.TexturalSegmentation(img, smallBlobRadius, gapRadius)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
 	}
+
+	saveOutputImage(boundary, outputFileName)
 }
 
-func testGradientFilter(levels int, inputFileName string, outputFileName string) {
+func testGlobalThreshold(method string, deltaT float64, classes int, options pkg.ThresholdOptions, inputFileName string, outputFileName string) {
 	img := pkg.FileNameToImage(inputFileName)
 	var newImage image.Image
 	var err error
 
-	// TODO, find a better way to specify these operators
-	switch levels {
-	case 1:
-		newImage, err = pkg.GradientFilter(img, pkg.SobelOperator1)
-	case 2:
-		newImage, err = pkg.GradientFilter(img, pkg.SobelOperator2)
-	case 3:
-		newImage, err = pkg.GradientFilter(img, pkg.RobertsCrossOperator1)
-	case 4:
-		newImage, err = pkg.GradientFilter(img, pkg.RobertsCrossOperator2)
-	default:
-		fmt.Printf("Only values 1-4 are supported for gradient filter.")
-		newImage = img
+	switch method {
+	case "basic_threshold":
+		var threshold uint8
+		threshold, newImage, err = pkg.BasicGlobalThreshold(img, deltaT, options)
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+		fmt.Printf("Threshold: %v\n", threshold)
+	case "otsu":
+		var threshold uint8
+		var separability float64
+		threshold, separability, newImage, err = pkg.OtsuThreshold(img, options)
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+		fmt.Printf("Threshold: %v\n", threshold)
+		fmt.Printf("Separability: %v\n", separability)
+	case "multi_otsu":
+		var thresholds []uint8
+		var separability float64
+		thresholds, separability, newImage, err = pkg.MultiOtsuThreshold(img, classes, options)
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+		fmt.Printf("Thresholds: %v\n", thresholds)
+		fmt.Printf("Separability: %v\n", separability)
 	}
 
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testLocalThreshold(method string, window int, k float64, r float64, a float64, b float64, globalMean bool, n int, partitions int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+	var newImage image.Image
+	var err error
+
+	switch method {
+	case "variable_threshold":
+		newImage, err = pkg.VariableThreshold(img, window, a, b, globalMean)
+	case "niblack":
+		newImage, err = pkg.NiblackThreshold(img, window, k)
+	case "sauvola":
+		newImage, err = pkg.SauvolaThreshold(img, window, k, r)
+	case "moving_average_threshold":
+		newImage, err = pkg.MovingAverageThreshold(img, n, b)
+	case "partition_threshold":
+		var thresholds [][]uint8
+		newImage, thresholds, err = pkg.PartitionThreshold(img, partitions, partitions)
+		fmt.Printf("Thresholds: %v\n", thresholds)
+	}
 	if err != nil {
 		log.Fatalf("Failed to process image: %v", err)
 	}
 
-	out, err := os.Create(outputFileName)
+	saveOutputImage(newImage, outputFileName)
+}
+
+func gradientOperator(operator string, img image.Image) pkg.Gradient {
+	var gradient pkg.Gradient
+	var err error
+
+	switch operator {
+	case "sobel":
+		gradient, err = pkg.SobelGradient(img)
+	case "prewitt":
+		gradient, err = pkg.PrewittGradient(img)
+	case "roberts":
+		gradient, err = pkg.RobertsCrossGradient(img)
+	case "scharr":
+		gradient, err = pkg.ScharrGradient(img)
+	case "kirsch":
+		gradient, err = pkg.CompassGradient(img, pkg.KirschCompassMasks())
+	default:
+		log.Fatalf("Unknown gradient operator: %v", operator)
+	}
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
+	return gradient
+}
+
+func testGradient(output string, operator string, l1 bool, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+	gradient := gradientOperator(operator, img)
+	var newImage image.Image
+	var err error
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
+	switch output {
+	case "gradient_magnitude":
+		if l1 {
+			newImage, err = pkg.FloatsToImage(gradient.L1Magnitude)
+		} else {
+			newImage, err = pkg.FloatsToImage(gradient.Magnitude)
+		}
+	case "gradient_direction":
+		newImage, err = pkg.GradientDirectionImage(gradient)
+	case "gradient_x":
+		newImage, err = pkg.FloatsToImage(gradient.Gx)
+	case "gradient_y":
+		newImage, err = pkg.FloatsToImage(gradient.Gy)
+	}
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
 	}
+
+	saveOutputImage(newImage, outputFileName)
 }
 
-func testDiscreetFourierTransform(inputFileName string, outputFileName string) {
+func testCanny(sigma float64, low float64, high float64, inputFileName string, outputFileName string) {
 	img := pkg.FileNameToImage(inputFileName)
 
-	newImage, err := pkg.DiscreetFourierTransform(img)
+	newImage, low, high, err := pkg.CannyEdgeDetector(img, sigma, low, high)
 	if err != nil {
 		log.Fatalf("Failed to process image: %v", err)
 	}
+	fmt.Printf("Thresholds: %v, %v\n", low, high)
+
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testMarrHildreth(sigma float64, threshold float64, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
 
-	out, err := os.Create(outputFileName)
+	newImage, err := pkg.MarrHildreth(img, sigma, threshold)
 	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+		log.Fatalf("Failed to process image: %v", err)
 	}
-	defer out.Close()
 
-	if err := jpeg.Encode(out, newImage, nil); err != nil {
-		log.Fatalf("Failed to encode image: %v", err)
-	}
+	saveOutputImage(newImage, outputFileName)
 }
 
-func testGaussianPdf() {
-	pdf := pkg.GaussianPdf(128, 20)
-	fmt.Printf("PDF: %v", pdf)
-}
+func testLaplacianOfGaussian(sigma float64, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
 
-func testRayleighPdf() {
-	pdf := pkg.RayleighPdf(0, 0.4)
-	fmt.Printf("PDF: %v", pdf)
+	response, err := pkg.LaplacianOfGaussian(img, sigma)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	newImage, err := pkg.FloatsToImage(response)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testDifferenceOfGaussians(sigma1 float64, sigma2 float64, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	if sigma2 <= 0 {
+		sigma2 = sigma1 / 1.6
+	}
+	response, err := pkg.DifferenceOfGaussians(img, sigma1, sigma2)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	newImage, err := pkg.FloatsToImage(response)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+
+	saveOutputImage(newImage, outputFileName)
+}
+
+func cannyEdges(img image.Image, sigma float64) image.Image {
+	// The Hough transforms work on binary edge maps
+	edges, _, _, err := pkg.CannyEdgeDetector(img, sigma, 0, 0)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	return edges
+}
+
+func saveAccumulatorImage(votes [][]int, accumulatorFileName string) {
+	if accumulatorFileName == "" {
+		return
+	}
+	accumulatorImage, err := pkg.HoughAccumulatorImage(votes)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(accumulatorImage, accumulatorFileName)
+}
+
+func testHoughLines(sigma float64, thetaStep float64, rhoStep float64, peaks int, fillGap float64, minLength float64, inputFileName string, outputFileName string, accumulatorFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+	edges := cannyEdges(img, sigma)
+
+	accumulator, err := pkg.HoughLineTransform(edges, thetaStep, rhoStep)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	lines, err := pkg.HoughLinePeaks(accumulator, peaks, 0, 5)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	segments, err := pkg.HoughLineSegments(edges, accumulator, lines, fillGap, minLength)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	for _, segment := range segments {
+		fmt.Printf("Segment: %v to %v (rho %v, theta %.1f, %d votes)\n", segment.Start, segment.End, segment.Line.Rho, segment.Line.Theta*180/math.Pi, segment.Line.Votes)
+	}
+
+	newImage, err := pkg.DrawLineSegments(img, segments, color.RGBA{255, 0, 0, 255})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+	saveAccumulatorImage(accumulator.Votes, accumulatorFileName)
+}
+
+func testHoughCircles(sigma float64, minRadius int, maxRadius int, peaks int, coverage float64, inputFileName string, outputFileName string, accumulatorFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+	edges := cannyEdges(img, sigma)
+
+	accumulator, err := pkg.HoughCircleTransform(edges, minRadius, maxRadius)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	circles, err := pkg.HoughCirclePeaks(accumulator, peaks, coverage, 5)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	for _, circle := range circles {
+		fmt.Printf("Circle: centre %v, radius %d, coverage %.2f\n", circle.Centre, circle.Radius, circle.Coverage)
+	}
+
+	newImage, err := pkg.DrawHoughCircles(img, circles, color.RGBA{255, 0, 0, 255})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+	// Show the most votes any radius gave each centre
+	saveAccumulatorImage(accumulator.Votes, accumulatorFileName)
+}
+
+func testGeneralisedHough(sigma float64, peaks int, templateFileName string, inputFileName string, outputFileName string, accumulatorFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+	edges := cannyEdges(img, sigma)
+	templateEdges := cannyEdges(pkg.FileNameToImage(templateFileName), sigma)
+
+	template, err := pkg.NewGeneralisedHoughTemplate(templateEdges, 18)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	votes, err := pkg.GeneralisedHoughTransform(edges, template)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	matches, err := pkg.GeneralisedHoughPeaks(votes, peaks, 0, 10)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	for _, match := range matches {
+		fmt.Printf("Match: reference %v, %d votes\n", match.Reference, match.Votes)
+	}
+
+	newImage, err := pkg.DrawGeneralisedHoughMatches(img, template, matches, color.RGBA{255, 0, 0, 255})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+	saveAccumulatorImage(votes, accumulatorFileName)
+}
+
+func saveLabelImage(labels [][]int, outputFileName string) {
+	newImage, err := pkg.LabelsToImage(labels)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testRegionGrowing(seedX int, seedY int, similarity float64, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	labels, err := pkg.RegionGrowing(img, []image.Point{{seedX, seedY}}, pkg.SeedSimilarityPredicate(similarity))
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+
+	saveLabelImage(labels, outputFileName)
+}
+
+func testSplitAndMerge(uniformity float64, minimumSize int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	labels, err := pkg.SplitAndMerge(img, pkg.StandardDeviationPredicate(uniformity), minimumSize)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+
+	saveLabelImage(labels, outputFileName)
+}
+
+func testWatershed(depth int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	// Flood the gradient magnitude from its deeper regional minima
+	gradient, err := pkg.SobelGradient(img)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	relief, err := pkg.FloatsToImage(gradient.Magnitude)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	markers, err := pkg.RegionalMinimaMarkers(relief, uint8(depth))
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	labels, err := pkg.Watershed(relief, markers)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+
+	saveLabelImage(labels, outputFileName)
+}
+
+func testSeparateTouchingBlobs(depth int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	labels, err := pkg.SeparateTouchingBlobs(img, uint8(depth))
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+
+	saveLabelImage(labels, outputFileName)
+}
+
+func testConnectedComponents(connectivity int, minArea int, maxArea int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	// Otsu leaves an image that is already binary unchanged
+	_, _, binary, err := pkg.OtsuThreshold(img, pkg.ThresholdOptions{})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	labels, _, err := pkg.LabelConnectedComponents(binary, pkg.Connectivity(connectivity))
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	labels, count, err := pkg.FilterComponentsByArea(labels, minArea, maxArea)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	statistics, err := pkg.ComponentStatistics(labels, img)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+
+	fmt.Printf("Components: %d\n", count)
+	for _, region := range statistics {
+		fmt.Printf("%d: area %d, box %v, centroid (%.1f, %.1f), perimeter %d, mean %.1f, variance %.1f\n",
+			region.Label, region.Area, region.BoundingBox, region.CentroidX, region.CentroidY, region.Perimeter, region.Mean, region.Variance)
+	}
+
+	saveLabelImage(labels, outputFileName)
+}
+
+func testBoundaries(minArea int, directions int, cellSize int, inputFileName string, outputFileName string, jsonFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	_, _, binary, err := pkg.OtsuThreshold(img, pkg.ThresholdOptions{})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	labels, _, err := pkg.LabelConnectedComponents(binary, pkg.EightConnectivity)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	labels, _, err = pkg.FilterComponentsByArea(labels, minArea, 0)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	descriptions, err := pkg.DescribeBoundaries(labels, directions, cellSize)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+
+	var polygons []pkg.Polygon
+	for _, description := range descriptions {
+		fmt.Printf("%d: %d boundary points, MPP with %d vertices and perimeter %.1f\n",
+			description.Label, len(description.Boundary.Points), len(description.MPP.Vertices), description.MPP.Perimeter())
+		polygons = append(polygons, description.MPP)
+	}
+
+	if jsonFileName != "" {
+		encoded, err := json.MarshalIndent(descriptions, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode boundaries: %v", err)
+		}
+		if err := os.WriteFile(jsonFileName, encoded, 0644); err != nil {
+			log.Fatalf("Failed to write boundaries: %v", err)
+		}
+	}
+
+	newImage, err := pkg.DrawPolygons(img, polygons, color.RGBA{255, 0, 0, 255})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testRegionDescriptors(minArea int, fourier int, signature int, inputFileName string, outputFileName string, jsonFileName string, csvFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	_, _, binary, err := pkg.OtsuThreshold(img, pkg.ThresholdOptions{})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	labels, _, err := pkg.LabelConnectedComponents(binary, pkg.EightConnectivity)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	labels, _, err = pkg.FilterComponentsByArea(labels, minArea, 0)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	descriptors, err := pkg.ComputeRegionDescriptors(labels, pkg.DescriptorOptions{FourierDescriptors: fourier, SignatureSamples: signature})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+
+	for _, region := range descriptors {
+		fmt.Printf("%d: area %d, perimeter %.1f, circularity %.3f, eccentricity %.3f, Euler number %d, phi1 %.4f\n",
+			region.Label, region.Area, region.Perimeter, region.Circularity, region.Eccentricity, region.EulerNumber, region.HuMoments[0])
+	}
+
+	if jsonFileName != "" {
+		file, err := os.Create(jsonFileName)
+		if err != nil {
+			log.Fatalf("Failed to write descriptors: %v", err)
+		}
+		defer file.Close()
+		if err := pkg.WriteDescriptorsJSON(file, descriptors); err != nil {
+			log.Fatalf("Failed to write descriptors: %v", err)
+		}
+	}
+	if csvFileName != "" {
+		file, err := os.Create(csvFileName)
+		if err != nil {
+			log.Fatalf("Failed to write descriptors: %v", err)
+		}
+		defer file.Close()
+		if err := pkg.WriteDescriptorsCSV(file, descriptors); err != nil {
+			log.Fatalf("Failed to write descriptors: %v", err)
+		}
+	}
+
+	saveLabelImage(labels, outputFileName)
+}
+
+func testTexture(grayLevels int, distance int, angles string, regions bool, minArea int, inputFileName string, jsonFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	var degrees []float64
+	for _, field := range strings.Split(angles, ",") {
+		var angle float64
+		if _, err := fmt.Sscanf(strings.TrimSpace(field), "%g", &angle); err != nil {
+			log.Fatalf("Invalid angle %q: %v", field, err)
+		}
+		degrees = append(degrees, angle)
+	}
+	offsets, err := pkg.CoOccurrenceOffsets(distance, degrees)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	options := pkg.CoOccurrenceOptions{Offsets: offsets, Levels: grayLevels, Symmetric: true}
+
+	var descriptions []pkg.TextureDescription
+	if regions {
+		_, _, binary, err := pkg.OtsuThreshold(img, pkg.ThresholdOptions{})
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+		labels, _, err := pkg.LabelConnectedComponents(binary, pkg.EightConnectivity)
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+		labels, _, err = pkg.FilterComponentsByArea(labels, minArea, 0)
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+		descriptions, err = pkg.RegionTextures(img, labels, options)
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+	} else {
+		description, err := pkg.ImageTexture(img, options)
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+		descriptions = append(descriptions, description)
+	}
+
+	for _, description := range descriptions {
+		moments, features := description.Moments, description.Average
+		fmt.Printf("%d: mean %.1f, deviation %.1f, smoothness %.4f, skewness %.4f, uniformity %.4f, entropy %.3f\n",
+			description.Label, moments.Mean, moments.StandardDeviation, moments.Smoothness, moments.Skewness, moments.Uniformity, moments.Entropy)
+		fmt.Printf("   contrast %.3f, correlation %.3f, homogeneity %.3f, energy %.4f, entropy %.3f\n",
+			features.Contrast, features.Correlation, features.Homogeneity, features.Energy, features.Entropy)
+	}
+
+	if jsonFileName != "" {
+		encoded, err := json.MarshalIndent(descriptions, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode texture: %v", err)
+		}
+		if err := os.WriteFile(jsonFileName, encoded, 0644); err != nil {
+			log.Fatalf("Failed to write texture: %v", err)
+		}
+	}
+}
+
+func loadBands(bandFileNames string, inputFileName string) []image.Image {
+	if bandFileNames == "" {
+		bands, err := pkg.ColourBands(pkg.FileNameToImage(inputFileName))
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+		return bands
+	}
+	var bands []image.Image
+	for _, fileName := range strings.Split(bandFileNames, ",") {
+		bands = append(bands, pkg.FileNameToImage(strings.TrimSpace(fileName)))
+	}
+	return bands
+}
+
+func testPrincipalComponents(bandFileNames string, components int, inputFileName string, outputFileName string) {
+	bands := loadBands(bandFileNames, inputFileName)
+
+	principal, err := pkg.BandPrincipalComponents(bands)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	reconstructed, meanSquaredError, err := pkg.ReconstructBands(bands, principal, components)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	fmt.Printf("Eigenvalues: %v\n", principal.Eigenvalues)
+	fmt.Printf("Mean squared error with %d components: %.3f (discarded variance %.3f)\n", components, meanSquaredError, principal.DiscardedVariance(components))
+
+	// Three bands are saved as a colour image, otherwise only the first band
+	newImage, err := pkg.CombineBands(reconstructed)
+	if err != nil {
+		newImage = reconstructed[0]
+	}
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testPrincipalComponentImage(bandFileNames string, component int, inputFileName string, outputFileName string) {
+	bands := loadBands(bandFileNames, inputFileName)
+
+	principal, err := pkg.BandPrincipalComponents(bands)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	images, err := pkg.PrincipalComponentImages(bands, principal)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	if component < 1 || component > len(images) {
+		log.Fatalf("Component must be between 1 and %d, got %d", len(images), component)
+	}
+	fmt.Printf("Eigenvalue of component %d: %.3f\n", component, principal.Eigenvalues[component-1])
+
+	saveOutputImage(images[component-1], outputFileName)
+}
+
+func testTemplateMatching(method string, peaks int, score float64, overlap float64, templateFileName string, inputFileName string, outputFileName string, scoresFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+	if templateFileName == "" {
+		log.Fatalf("A template image is needed, set it with -template")
+	}
+	template := pkg.FileNameToImage(templateFileName)
+
+	var matchingMethod pkg.MatchingMethod
+	switch method {
+	case "ssd":
+		matchingMethod = pkg.SumOfSquaredDifferences
+	case "sad":
+		matchingMethod = pkg.SumOfAbsoluteDifferences
+	case "cc":
+		matchingMethod = pkg.CrossCorrelation
+	case "zncc":
+		matchingMethod = pkg.NormalisedCrossCorrelation
+	default:
+		log.Fatalf("Unknown matching method: %v", method)
+	}
+
+	scores, err := pkg.MatchTemplate(img, template, matchingMethod)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	matches, err := pkg.TemplateMatchPeaks(scores, peaks, score, overlap)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	for _, match := range matches {
+		fmt.Printf("Match at %v, box %v, score %.4f\n", match.Location, match.Box, match.Score)
+	}
+
+	if scoresFileName != "" {
+		scoreImage, err := pkg.TemplateScoreImage(scores)
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+		saveOutputImage(scoreImage, scoresFileName)
+	}
+
+	newImage, err := pkg.DrawTemplateMatches(img, matches, color.RGBA{255, 0, 0, 255})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testPatterns(class string, minArea int, inputFileName string, jsonFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	_, _, binary, err := pkg.OtsuThreshold(img, pkg.ThresholdOptions{})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	labels, _, err := pkg.LabelConnectedComponents(binary, pkg.EightConnectivity)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	labels, _, err = pkg.FilterComponentsByArea(labels, minArea, 0)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	descriptors, err := pkg.ComputeRegionDescriptors(labels, pkg.DescriptorOptions{})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+
+	var patterns []pkg.Pattern
+	for _, region := range descriptors {
+		patterns = append(patterns, pkg.Pattern{Features: pkg.DescriptorFeatures(region), Class: class})
+	}
+	fmt.Printf("Patterns: %d\n", len(patterns))
+
+	if jsonFileName == "" {
+		log.Fatalf("Set the pattern file with -json")
+	}
+	encoded, err := json.MarshalIndent(patterns, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode patterns: %v", err)
+	}
+	if err := os.WriteFile(jsonFileName, encoded, 0644); err != nil {
+		log.Fatalf("Failed to write patterns: %v", err)
+	}
+}
+
+func loadPatterns(patternFileNames string) []pkg.Pattern {
+	var patterns []pkg.Pattern
+	for _, fileName := range strings.Split(patternFileNames, ",") {
+		encoded, err := os.ReadFile(strings.TrimSpace(fileName))
+		if err != nil {
+			log.Fatalf("Failed to read patterns: %v", err)
+		}
+		var filePatterns []pkg.Pattern
+		if err := json.Unmarshal(encoded, &filePatterns); err != nil {
+			log.Fatalf("Failed to decode patterns in %v: %v", fileName, err)
+		}
+		patterns = append(patterns, filePatterns...)
+	}
+	return patterns
+}
+
+func testTrainClassifier(classifierType string, patternFileNames string, modelFileName string) {
+	classifier, err := pkg.NewClassifier(classifierType)
+	if err != nil {
+		log.Fatalf("Failed to create classifier: %v", err)
+	}
+	if err := classifier.Train(loadPatterns(patternFileNames)); err != nil {
+		log.Fatalf("Failed to train classifier: %v", err)
+	}
+
+	file, err := os.Create(modelFileName)
+	if err != nil {
+		log.Fatalf("Failed to save classifier: %v", err)
+	}
+	defer file.Close()
+	if err := pkg.SaveClassifier(file, classifier); err != nil {
+		log.Fatalf("Failed to save classifier: %v", err)
+	}
+}
+
+func testEvaluateClassifier(patternFileNames string, modelFileName string) {
+	file, err := os.Open(modelFileName)
+	if err != nil {
+		log.Fatalf("Failed to load classifier: %v", err)
+	}
+	defer file.Close()
+	classifier, err := pkg.LoadClassifier(file)
+	if err != nil {
+		log.Fatalf("Failed to load classifier: %v", err)
+	}
+
+	matrix, err := pkg.EvaluateClassifier(classifier, loadPatterns(patternFileNames))
+	if err != nil {
+		log.Fatalf("Failed to evaluate classifier: %v", err)
+	}
+	fmt.Print(matrix.Report())
+}
+
+func testWavelet(waveletName string, scales int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	wavelet, err := pkg.NewWavelet(waveletName)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	decomposition, err := pkg.WaveletTransform(img, wavelet, scales)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	reconstructed, err := pkg.InverseWaveletTransformFloats(decomposition)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	var largestError float64 = 0
+	bounds := img.Bounds()
+	for x := range reconstructed {
+		for y, value := range reconstructed[x] {
+			original := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+			largestError = math.Max(largestError, math.Abs(value-float64(original)))
+		}
+	}
+	fmt.Printf("Largest reconstruction error: %g\n", largestError)
+
+	newImage, err := pkg.WaveletDecompositionImage(decomposition)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testPyramid(laplacian bool, scales int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	var pyramid [][][]float64
+	var err error
+	if laplacian {
+		pyramid, err = pkg.LaplacianPyramid(img, scales)
+	} else {
+		pyramid, err = pkg.GaussianPyramid(img, scales)
+	}
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	for level, values := range pyramid {
+		fmt.Printf("Level %d: %dx%d\n", level, len(values), len(values[0]))
+	}
+
+	newImage, err := pkg.PyramidImage(pyramid)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+}
+
+func printQuality(name string, img image.Image, reference image.Image) {
+	psnr, err := pkg.PeakSignalToNoiseRatio(img, reference)
+	if err != nil {
+		log.Fatalf("Failed to compare images: %v", err)
+	}
+	similarity, err := pkg.StructuralSimilarity(img, reference)
+	if err != nil {
+		log.Fatalf("Failed to compare images: %v", err)
+	}
+	fmt.Printf("%s: PSNR %.2f dB, SSIM %.4f\n", name, psnr, similarity)
+}
+
+func testCompare(inputFileName string, referenceFileName string, outputFileName string) {
+	if referenceFileName == "" {
+		log.Fatalf("Give the reference image with -ref")
+	}
+	img := pkg.FileNameToImage(inputFileName)
+	reference := pkg.FileNameToImage(referenceFileName)
+
+	for _, named := range []struct {
+		name string
+		img  image.Image
+	}{{inputFileName, img}, {referenceFileName, reference}} {
+		quality, err := pkg.MeasureQuality(named.img)
+		if err != nil {
+			log.Fatalf("Failed to measure image: %v", err)
+		}
+		fmt.Printf("%s: entropy %.3f bits, RMS contrast %.2f, Laplacian variance %.2f\n", named.name, quality.Entropy, quality.Contrast, quality.Sharpness)
+	}
+
+	report, err := pkg.CompareImages(img, reference)
+	if err != nil {
+		log.Fatalf("Failed to compare images: %v", err)
+	}
+	fmt.Printf("MSE %.2f, RMSE %.2f, PSNR %.2f dB, SSIM %.4f, MS-SSIM %.4f\n",
+		report.MeanSquaredError, report.RootMeanSquareError, report.PeakSignalToNoiseRatio, report.StructuralSimilarity, report.MultiScaleStructuralSimilarity)
+
+	// The local SSIM, darkest where the images differ most
+	similarity, err := pkg.StructuralSimilarityMap(img, reference)
+	if err != nil {
+		log.Fatalf("Failed to compare images: %v", err)
+	}
+	saveOutputImage(similarity, outputFileName)
+}
+
+func testWaveletDenoise(waveletName string, scales int, shrinkage string, rule string, noiseSigma float64, inputFileName string, outputFileName string, referenceFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	wavelet, err := pkg.NewWavelet(waveletName)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	var options pkg.WaveletDenoiseOptions = pkg.WaveletDenoiseOptions{Wavelet: wavelet, Levels: scales, NoiseSigma: noiseSigma}
+	switch shrinkage {
+	case "visu":
+		options.Method = pkg.VisuShrink
+	case "bayes":
+		options.Method = pkg.BayesShrink
+	default:
+		log.Fatalf("Unknown shrinkage %q, use visu or bayes", shrinkage)
+	}
+	switch rule {
+	case "soft":
+		options.Rule = pkg.SoftThreshold
+	case "hard":
+		options.Rule = pkg.HardThreshold
+	default:
+		log.Fatalf("Unknown thresholding rule %q, use soft or hard", rule)
+	}
+
+	decomposition, err := pkg.WaveletTransform(img, wavelet, scales)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	sigmas, err := pkg.EstimateWaveletNoise(decomposition)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	fmt.Printf("Estimated noise per level: %.3f\n", sigmas)
+
+	newImage, err := pkg.WaveletDenoise(img, options)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	if referenceFileName != "" {
+		reference := pkg.FileNameToImage(referenceFileName)
+		printQuality("Input", img, reference)
+		printQuality("Denoised", newImage, reference)
+	}
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testWaveletEnhance(waveletName string, scales int, gain float64, noiseThreshold float64, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	wavelet, err := pkg.NewWavelet(waveletName)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	newImage, err := pkg.WaveletEdgeEnhancement(img, pkg.WaveletEnhanceOptions{Wavelet: wavelet, Levels: scales, Gain: gain, NoiseThreshold: noiseThreshold})
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testWaveletEdges(waveletName string, scales int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	wavelet, err := pkg.NewWavelet(waveletName)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	newImage, err := pkg.WaveletEdges(img, wavelet, scales)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testTransformCoding(mask string, quality int, coefficients int, blockSize int, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	var options pkg.TransformCodingOptions = pkg.TransformCodingOptions{BlockSize: blockSize, Coefficients: coefficients, Quality: quality}
+	switch mask {
+	case "zonal":
+		options.Mask = pkg.ZonalMask
+	case "threshold":
+		options.Mask = pkg.ThresholdMask
+	case "quantisation":
+		options.Mask = pkg.QuantisationMask
+	default:
+		log.Fatalf("Unknown mask %q, use zonal, threshold or quantisation", mask)
+	}
+	newImage, report, err := pkg.TransformCode(img, options)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	fmt.Printf("Blocks: %d of %dx%d, non-zero coefficients: %d\n", report.Blocks, report.BlockSize, report.BlockSize, report.NonZeroCoefficients)
+	fmt.Printf("Estimated size: %d bits, %.3f bits per pixel\n", report.Bits, report.BitsPerPixel)
+	fmt.Printf("Compression ratio: %.2f, RMS error: %.3f\n", report.CompressionRatio, report.RootMeanSquareError)
+
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testBitPlane(bitNumber uint8, grayCode bool, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	newImage, err := pkg.BitPlane(img, bitNumber, grayCode)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	saveOutputImage(newImage, outputFileName)
+}
+
+func testLosslessCoding(coder string, inputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	var found bool = false
+	for _, method := range pkg.LosslessMethods {
+		if coder != "all" && coder != method.String() {
+			continue
+		}
+		found = true
+		report, err := pkg.LosslessCode(img, method)
+		if err != nil {
+			log.Fatalf("Failed to code image: %v", err)
+		}
+		fmt.Printf("%s: %d bits, entropy %.3f, average code length %.3f, coding redundancy %.3f bits per pixel, compression ratio %.2f, relative redundancy %.3f\n",
+			method, report.Bits, report.Entropy, report.AverageCodeLength, report.CodingRedundancy, report.CompressionRatio, report.RelativeRedundancy)
+	}
+	if !found {
+		log.Fatalf("Unknown coder %q", coder)
+	}
+}
+
+func parsePredictor(name string) pkg.Predictor {
+	for _, predictor := range pkg.Predictors {
+		if predictor.String() == name {
+			return predictor
+		}
+	}
+	log.Fatalf("Unknown predictor %q, use previous, above, average, planar or med", name)
+	return pkg.MEDPredictor
+}
+
+func testPredictiveCoding(predictorName string, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	// With all, the error image saved is that of the last predictor, med
+	var predictors []pkg.Predictor = pkg.Predictors
+	if predictorName != "all" {
+		predictors = []pkg.Predictor{parsePredictor(predictorName)}
+	}
+	var errorImage image.Image
+	for _, predictor := range predictors {
+		newImage, report, err := pkg.PredictiveCode(img, predictor)
+		if err != nil {
+			log.Fatalf("Failed to code image: %v", err)
+		}
+		errorImage = newImage
+		fmt.Printf("%s: %d bits, image entropy %.3f, error entropy %.3f, saving %.3f, average code length %.3f bits per pixel, compression ratio %.2f\n",
+			predictor, report.Bits, report.ImageEntropy, report.ErrorEntropy, report.EntropySaving, report.AverageCodeLength, report.CompressionRatio)
+
+		// The centre of the error histogram and how much of it lies near zero
+		var pixels, within2, within8 int = 0, 0, 0
+		for index, count := range report.ErrorHistogram {
+			value := index - 255
+			pixels += count
+			if value >= -2 && value <= 2 {
+				within2 += count
+			}
+			if value >= -8 && value <= 8 {
+				within8 += count
+			}
+		}
+		fmt.Printf("  errors -4 to 4: %v, within 2: %.1f%%, within 8: %.1f%%\n",
+			report.ErrorHistogram[255-4:255+5], 100*float64(within2)/float64(pixels), 100*float64(within8)/float64(pixels))
+	}
+	saveOutputImage(errorImage, outputFileName)
+}
+
+func testDPCM(predictorName string, quantiserName string, levels int, zeta float64, inputFileName string, outputFileName string) {
+	img := pkg.FileNameToImage(inputFileName)
+
+	var options pkg.DPCMOptions = pkg.DPCMOptions{Predictor: parsePredictor(predictorName)}
+	switch quantiserName {
+	case "delta":
+		options.Quantiser = pkg.DeltaModulationQuantiser(zeta)
+	case "lloyd_max":
+		// Designed for the errors of predicting from the original pixels
+		histogram, err := pkg.PredictionErrorHistogram(img, options.Predictor)
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+		options.Quantiser, err = pkg.LloydMaxQuantiser(histogram, -255, levels)
+		if err != nil {
+			log.Fatalf("Failed to process image: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown quantiser %q, use lloyd_max or delta", quantiserName)
+	}
+
+	newImage, report, err := pkg.DPCMCode(img, options)
+	if err != nil {
+		log.Fatalf("Failed to process image: %v", err)
+	}
+	fmt.Printf("Quantiser levels %.2f\n", options.Quantiser.Levels)
+	fmt.Printf("%d levels, %d bits per pixel fixed length, index entropy %.3f, compression ratio %.2f, RMS error %.2f\n",
+		report.Levels, report.FixedLengthBits, report.IndexEntropy, report.CompressionRatio, report.RootMeanSquareError)
+	saveOutputImage(newImage, outputFileName)
 }